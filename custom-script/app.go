@@ -40,6 +40,11 @@ func NewApp() *App {
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+
+	// 新日誌轉送給前端
+	SetLogListener(func(entry LogEntry) {
+		runtime.EventsEmit(a.ctx, LogEntryEvent, entry)
+	})
 }
 
 // BuildImage simulates the BuildImage function with progress updates
@@ -53,7 +58,7 @@ func (a *App) BuildImage(buildStream string, logStream string, adminPassword str
 	// Get the directory where the script is located
 	scriptDir, err := os.Getwd()
 	if err != nil {
-		runtime.LogError(a.ctx, fmt.Sprintf("Failed to get current directory: %v", err))
+		logFor("build").Error("Failed to get current directory", "error", err)
 		return false
 	}
 
@@ -71,7 +76,7 @@ func (a *App) BuildImage(buildStream string, logStream string, adminPassword str
 
 	// Check if script exists
 	if _, err := os.Stat(scriptPath); os.IsNotExist(err) {
-		runtime.LogError(a.ctx, fmt.Sprintf("Sample build script not found: %s", scriptPath))
+		logFor("build").Error("Sample build script not found", "path", scriptPath)
 		return false
 	}
 
@@ -86,7 +91,7 @@ func (a *App) BuildImage(buildStream string, logStream string, adminPassword str
 	logPath := filepath.Join(scriptDir, logFilename)
 	logFile, err := os.Create(logPath)
 	if err != nil {
-		runtime.LogError(a.ctx, fmt.Sprintf("Failed to create log file: %v", err))
+		logFor("build").Error("Failed to create log file", "path", logPath, "error", err)
 		return false
 	}
 	defer logFile.Close()
@@ -106,20 +111,21 @@ func (a *App) BuildImage(buildStream string, logStream string, adminPassword str
 	// Get stdout and stderr pipes
 	stdoutPipe, err := cmd.StdoutPipe()
 	if err != nil {
-		runtime.LogError(a.ctx, fmt.Sprintf("Failed to create stdout pipe: %v", err))
+		logFor("build").Error("Failed to create stdout pipe", "error", err)
 		return false
 	}
 
 	stderrPipe, err := cmd.StderrPipe()
 	if err != nil {
-		runtime.LogError(a.ctx, fmt.Sprintf("Failed to create stderr pipe: %v", err))
+		logFor("build").Error("Failed to create stderr pipe", "error", err)
 		return false
 	}
 
 	// Start the command
+	started := time.Now()
 	err = cmd.Start()
 	if err != nil {
-		runtime.LogError(a.ctx, fmt.Sprintf("Failed to start command: %v", err))
+		logFor("build").Error("Failed to start build script", "path", scriptPath, "error", err)
 		return false
 	}
 
@@ -202,6 +208,7 @@ func (a *App) BuildImage(buildStream string, logStream string, adminPassword str
 
 	// Wait for command to complete
 	err = cmd.Wait()
+	logOperation("build", "build.image", started, err, "Sample build script finished", "path", scriptPath)
 	if err != nil {
 		writeLog(a.ctx, logStream, logPath, fmt.Sprintf("[ERROR] Build failed: %v", err))
 		result := BuildResult{
@@ -219,6 +226,7 @@ func (a *App) BuildImage(buildStream string, logStream string, adminPassword str
 
 	// Check final status
 	if preStatus != 2 && preStatus != 1 {
+		logFor("build").Error("Build ended unexpectedly", "percent", cumulativePercent)
 		writeLog(a.ctx, logStream, logPath, "[ERROR] Build ended unexpectedly!")
 		result := BuildResult{
 			Message:   "Build failed",
@@ -234,13 +242,18 @@ func (a *App) BuildImage(buildStream string, logStream string, adminPassword str
 	return true
 }
 
+// GetRecentLogs 取得最近的應用程式日誌（由舊到新），level 為最低層級（debug、info、warn、error，空字串表示全部），limit <= 0 表示全部
+func (a *App) GetRecentLogs(limit int, level string) ([]LogEntry, error) {
+	return RecentLogs(limit, level)
+}
+
 // CancelBuild cancels the sample build process
 func (a *App) CancelBuild() bool {
   	if a.cancelBuild != nil {
         a.cancelBuild() // Call the cancel function to stop the download
 		a.cancelBuild = nil
     }
-	runtime.LogInfo(a.ctx, "Sample build cancelled by user")
+	logFor("build").Info("Sample build cancelled by user")
 	return true
 }
 
@@ -290,7 +303,7 @@ func writeLog(ctx context.Context, logStream string, logPath string, msg string)
 	// Write to file
 	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		runtime.LogError(ctx, fmt.Sprintf("Write log file error: %v", err))
+		logFor("build").Error("Failed to write build log file", "path", logPath, "error", err)
 		return
 	}
 	defer f.Close()
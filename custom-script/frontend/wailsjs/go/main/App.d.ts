@@ -1,8 +1,11 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
+import {main} from '../models';
 
 export function BuildImage(arg1:string,arg2:string,arg3:string,arg4:string):Promise<boolean>;
 
 export function CancelBuild():Promise<boolean>;
 
+export function GetRecentLogs(arg1:number,arg2:string):Promise<Array<main.LogEntry>>;
+
 export function GetSampleBuildLog():Promise<string>;
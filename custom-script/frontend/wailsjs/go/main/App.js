@@ -10,6 +10,10 @@ export function CancelBuild() {
   return window['go']['main']['App']['CancelBuild']();
 }
 
+export function GetRecentLogs(arg1, arg2) {
+  return window['go']['main']['App']['GetRecentLogs'](arg1, arg2);
+}
+
 export function GetSampleBuildLog() {
   return window['go']['main']['App']['GetSampleBuildLog']();
 }
@@ -2,7 +2,10 @@ module custom-scripts
 
 go 1.23
 
-require github.com/wailsapp/wails/v2 v2.9.2
+require (
+	github.com/wailsapp/wails/v2 v2.9.2
+	gopkg.in/natefinch/lumberjack.v2 v2.2.1
+)
 
 require (
 	github.com/bep/debounce v1.2.1 // indirect
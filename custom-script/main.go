@@ -2,6 +2,9 @@ package main
 
 import (
 	"embed"
+	"fmt"
+	"os"
+	"strconv"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -12,11 +15,22 @@ import (
 var assets embed.FS
 
 func main() {
+	// 日誌設定來自 LOG_* 環境變數
+	logOpts, err := envLogOptions()
+	if err == nil {
+		err = InitLogger(logOpts)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid log configuration: %v\n", err)
+		os.Exit(2)
+	}
+	defer CloseLogger()
+
 	// Create an instance of the app structure
 	app := NewApp()
 
 	// Create application with options
-	err := wails.Run(&options.App{
+	err = wails.Run(&options.App{
 		Title:  "Custom Scripts Builder",
 		Width:  1280,
 		Height: 720,
@@ -31,7 +45,41 @@ func main() {
 	})
 
 	if err != nil {
-		println("Error:", err.Error())
+		logFor("app").Error("Application error", "error", err)
 	}
 }
 
+// envLogOptions 由 LOG_* 環境變數讀取日誌設定，未設定的項目使用預設值
+func envLogOptions() (LogOptions, error) {
+	opts := defaultLogOptions()
+	if v, ok := os.LookupEnv("LOG_LEVEL"); ok {
+		opts.Level = v
+	}
+	if v, ok := os.LookupEnv("LOG_FORMAT"); ok {
+		opts.Format = v
+	}
+	if v, ok := os.LookupEnv("LOG_FILE"); ok {
+		opts.File = v
+	}
+	ints := map[string]*int{"LOG_MAX_SIZE_MB": &opts.MaxSizeMB, "LOG_MAX_AGE_DAYS": &opts.MaxAgeDays, "LOG_MAX_BACKUPS": &opts.MaxBackups}
+	for key, dst := range ints {
+		if v, ok := os.LookupEnv(key); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return opts, fmt.Errorf("%s must be a non-negative integer, got %q", key, v)
+			}
+			*dst = n
+		}
+	}
+	bools := map[string]*bool{"LOG_COMPRESS": &opts.Compress, "LOG_STDOUT": &opts.Stdout}
+	for key, dst := range bools {
+		if v, ok := os.LookupEnv(key); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return opts, fmt.Errorf("%s must be true or false, got %q", key, v)
+			}
+			*dst = b
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/user"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 稽核紀錄的動作類型
+const (
+	AuditActionInsert  = "insert"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+	AuditActionPurge   = "purge"
+)
+
+// AuditEntry 一筆用戶異動的稽核紀錄，Before / After 為異動前後的完整快照
+type AuditEntry struct {
+	ID        string                 `json:"id"`
+	UserID    string                 `json:"userId"`
+	Action    string                 `json:"action"`
+	Actor     string                 `json:"actor"`
+	Before    map[string]interface{} `json:"before"`
+	After     map[string]interface{} `json:"after"`
+	CreatedAt string                 `json:"createdAt"`
+}
+
+// actorMu 保護 Database.actor，綁定方法可能被前端並行呼叫
+var actorMu sync.RWMutex
+
+// resolveActor 決定預設的操作者名稱：APP_ACTOR 設定 > 作業系統使用者
+func resolveActor() string {
+	if actor := appConfig().Actor; actor != "" {
+		return actor
+	}
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		return current.Username
+	}
+	return "unknown"
+}
+
+// Actor 回傳目前寫入稽核紀錄的操作者
+func (d *Database) Actor() string {
+	actorMu.RLock()
+	defer actorMu.RUnlock()
+	return d.actor
+}
+
+// SetActor 設定之後異動所記錄的操作者
+func (d *Database) SetActor(actor string) {
+	actorMu.Lock()
+	defer actorMu.Unlock()
+	d.actor = actor
+}
+
+// normalizeUserDoc 將 _id 轉為 id 字串、時間欄位轉為 RFC3339，供前端直接使用
+func normalizeUserDoc(doc map[string]interface{}) map[string]interface{} {
+	if doc == nil {
+		return nil
+	}
+	if id, ok := doc["_id"].(primitive.ObjectID); ok {
+		doc["id"] = id.Hex()
+		delete(doc, "_id")
+	}
+	for _, key := range []string{"created_at", "updated_at", "deleted_at"} {
+		switch v := doc[key].(type) {
+		case primitive.DateTime:
+			doc[key] = v.Time().Format(time.RFC3339)
+		case time.Time:
+			doc[key] = v.Format(time.RFC3339)
+		}
+	}
+	return doc
+}
+
+// findUserDoc 讀取單一用戶的完整快照（包含已軟刪除的用戶）
+func (d *Database) findUserDoc(ctx context.Context, filter bson.M) (bson.M, error) {
+	collection, err := d.collection("users")
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := collection.FindOne(ctx, filter).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// auditChangeType 稽核動作對應的事件名稱：還原視為更新，軟刪除與永久刪除都是刪除
+func auditChangeType(action string) string {
+	switch action {
+	case AuditActionInsert:
+		return UserCreatedEvent
+	case AuditActionDelete, AuditActionPurge:
+		return UserDeletedEvent
+	}
+	return UserUpdatedEvent
+}
+
+// writeAudit 寫入一筆稽核紀錄；在 WithTx 中以 session context 呼叫時與異動在同一個交易中提交（單機部署則在異動成功後寫入）
+func (d *Database) writeAudit(ctx context.Context, userID primitive.ObjectID, action string, before, after bson.M) error {
+	entry := bson.M{
+		"user_id":    userID,
+		"action":     action,
+		"actor":      d.Actor(),
+		"before":     before,
+		"after":      after,
+		"created_at": time.Now(),
+	}
+	collection, err := d.collection("user_audit")
+	if err != nil {
+		return err
+	}
+	if _, err := collection.InsertOne(ctx, entry); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return nil
+}
+
+// GetUserAudit 依時間順序取得單一用戶的所有稽核紀錄（包含已刪除的用戶）
+func (d *Database) GetUserAudit(id string) ([]AuditEntry, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, newValidationError("id", "invalid user ID")
+	}
+
+	ctx, cancel := context.WithTimeout(withOperation(context.Background(), "GetUserAudit"), 10*time.Second)
+	defer cancel()
+
+	collection, err := d.collection("user_audit")
+	if err != nil {
+		return nil, err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.M{"user_id": objectID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit records: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	entries := []AuditEntry{}
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID        primitive.ObjectID `bson:"_id"`
+			UserID    primitive.ObjectID `bson:"user_id"`
+			Action    string             `bson:"action"`
+			Actor     string             `bson:"actor"`
+			Before    bson.M             `bson:"before"`
+			After     bson.M             `bson:"after"`
+			CreatedAt time.Time          `bson:"created_at"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode audit record: %w", err)
+		}
+		entries = append(entries, AuditEntry{
+			ID:        doc.ID.Hex(),
+			UserID:    doc.UserID.Hex(),
+			Action:    doc.Action,
+			Actor:     doc.Actor,
+			Before:    normalizeUserDoc(doc.Before),
+			After:     normalizeUserDoc(doc.After),
+			CreatedAt: doc.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit records: %w", err)
+	}
+
+	return entries, nil
+}
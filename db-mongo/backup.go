@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 備份檔案格式：依序為 header、每個集合的 collection 紀錄與其 document 紀錄、最後的 end 紀錄。
+// 副檔名為 .json / .jsonl 時每行一筆 canonical extended JSON，其餘為連續的 BSON 文件（與 mongodump 相同的編碼）
+const (
+	backupFormat          = "mongo"
+	backupFileExt         = ".bson"
+	backupInsertBatchSize = 1000
+)
+
+// 備份紀錄的種類
+const (
+	backupRecordHeader     = "header"
+	backupRecordCollection = "collection"
+	backupRecordDocument   = "document"
+	backupRecordEnd        = "end"
+)
+
+// BackupCollection 備份中單一集合的文件數
+type BackupCollection struct {
+	Name      string `json:"name"`
+	Documents int64  `json:"documents"`
+}
+
+// BackupInfo 備份或還原的結果
+type BackupInfo struct {
+	Path          string             `json:"path"`
+	Format        string             `json:"format"`
+	Encoding      string             `json:"encoding"`
+	SchemaVersion uint               `json:"schemaVersion"`
+	Dirty         bool               `json:"dirty"`
+	Collections   []BackupCollection `json:"collections"`
+	Size          int64              `json:"size"`
+	CreatedAt     string             `json:"createdAt"`
+	DurationMs    int64              `json:"durationMs"`
+}
+
+// backupRecord 備份檔中的一筆紀錄，依 Type 使用不同欄位
+type backupRecord struct {
+	Type          string           `bson:"type"`
+	Format        string           `bson:"format,omitempty"`
+	Database      string           `bson:"database,omitempty"`
+	SchemaVersion int64            `bson:"schema_version,omitempty"`
+	Dirty         bool             `bson:"dirty,omitempty"`
+	CreatedAt     string           `bson:"created_at,omitempty"`
+	Collection    string           `bson:"collection,omitempty"`
+	Options       bson.Raw         `bson:"options,omitempty"`
+	Indexes       []bson.Raw       `bson:"indexes,omitempty"`
+	Document      bson.Raw         `bson:"document,omitempty"`
+	Counts        map[string]int64 `bson:"counts,omitempty"`
+}
+
+// backupSkipped 不備份也不會在還原時刪除的集合：遷移鎖的租約只屬於當下執行中的程式
+func backupSkipped(name string) bool {
+	return name == migrationLockCollection || strings.HasPrefix(name, "system.")
+}
+
+// backupUsesJSON 依副檔名決定使用 extended JSON 或 BSON
+func backupUsesJSON(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".json" || ext == ".jsonl"
+}
+
+// writeBackupRecord 寫入一筆紀錄
+func writeBackupRecord(w io.Writer, rec *backupRecord, useJSON bool) error {
+	if useJSON {
+		data, err := bson.MarshalExtJSON(rec, true, false)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	}
+	data, err := bson.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// readBackupRecord 讀取下一筆紀錄，沒有更多紀錄時回傳 io.EOF
+func readBackupRecord(r *bufio.Reader, useJSON bool) (*backupRecord, error) {
+	var data []byte
+	if useJSON {
+		line, err := r.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) == 0 {
+			if err == nil {
+				return readBackupRecord(r, useJSON)
+			}
+			return nil, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		rec := &backupRecord{}
+		if err := bson.UnmarshalExtJSON(line, true, rec); err != nil {
+			return nil, fmt.Errorf("invalid backup record: %w", err)
+		}
+		return rec, nil
+	}
+
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(r, size); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("backup is truncated")
+		}
+		return nil, err
+	}
+	length := int(binary.LittleEndian.Uint32(size))
+	if length < 5 {
+		return nil, fmt.Errorf("invalid backup record length %d", length)
+	}
+	data = make([]byte, length)
+	copy(data, size)
+	if _, err := io.ReadFull(r, data[4:]); err != nil {
+		return nil, fmt.Errorf("backup is truncated: %w", err)
+	}
+	rec := &backupRecord{}
+	if err := bson.Unmarshal(data, rec); err != nil {
+		return nil, fmt.Errorf("invalid backup record: %w", err)
+	}
+	return rec, nil
+}
+
+// defaultBackupPath 未指定路徑時的備份檔名：DB_BACKUP_DIR（預設 backups）下的 <資料庫>-<時間>.bson
+func (d *Database) defaultBackupPath() string {
+	name := fmt.Sprintf("%s-%s%s", d.DBName, time.Now().Format("20060102-150405"), backupFileExt)
+	return filepath.Join(appConfig().BackupDir, name)
+}
+
+// Backup 將所有集合（含遷移狀態與歷史，不含遷移鎖）的選項、索引與文件備份到 path，path 為空時使用預設路徑；
+// 各集合依序讀取，不是同一時間點的快照，備份期間應避免寫入
+func (d *Database) Backup(path string) (*BackupInfo, error) {
+	if _, err := d.database(); err != nil {
+		return nil, err
+	}
+	if path == "" {
+		path = d.defaultBackupPath()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	started := time.Now()
+	partial := path + ".partial"
+	info, err := d.writeBackup(withOperation(context.Background(), "Backup"), partial, backupUsesJSON(path))
+	if err != nil {
+		os.Remove(partial)
+		return nil, fmt.Errorf("failed to back up database: %w", err)
+	}
+	if err := os.Rename(partial, path); err != nil {
+		os.Remove(partial)
+		return nil, fmt.Errorf("failed to move backup into place: %w", err)
+	}
+	if stat, err := os.Stat(path); err == nil {
+		info.Size = stat.Size()
+	}
+	info.Path = path
+	info.CreatedAt = started.Format(time.RFC3339)
+	info.DurationMs = time.Since(started).Milliseconds()
+
+	logFor("backup").Info("Database backed up", LogKeyOperation, "backup", LogKeyDuration, info.DurationMs,
+		"path", path, "version", info.SchemaVersion, "collections", len(info.Collections), "bytes", info.Size)
+	return info, nil
+}
+
+func (d *Database) writeBackup(ctx context.Context, path string, useJSON bool) (*BackupInfo, error) {
+	db, err := d.database()
+	if err != nil {
+		return nil, err
+	}
+
+	specs, err := db.ListCollectionSpecifications(ctx, bson.M{"type": "collection"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+
+	var state migrationState
+	err = db.Collection(migrationStateCollection).FindOne(ctx, bson.M{"_id": migrationStateID}).Decode(&state)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("failed to read migration state: %w", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	info := &BackupInfo{Format: backupFormat, Encoding: "bson", SchemaVersion: uint(state.Version), Dirty: state.Dirty, Collections: []BackupCollection{}}
+	if useJSON {
+		info.Encoding = "extjson"
+	}
+	header := &backupRecord{
+		Type:          backupRecordHeader,
+		Format:        backupFormat,
+		Database:      d.DBName,
+		SchemaVersion: state.Version,
+		Dirty:         state.Dirty,
+		CreatedAt:     time.Now().Format(time.RFC3339),
+	}
+	if err := writeBackupRecord(w, header, useJSON); err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int64{}
+	for _, spec := range specs {
+		if backupSkipped(spec.Name) {
+			continue
+		}
+		collection := db.Collection(spec.Name)
+
+		indexes, err := listIndexSpecs(ctx, collection)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list indexes of %s: %w", spec.Name, err)
+		}
+		rec := &backupRecord{Type: backupRecordCollection, Collection: spec.Name, Options: spec.Options, Indexes: indexes}
+		if err := writeBackupRecord(w, rec, useJSON); err != nil {
+			return nil, err
+		}
+
+		cursor, err := collection.Find(ctx, bson.M{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", spec.Name, err)
+		}
+		var n int64
+		for cursor.Next(ctx) {
+			doc := &backupRecord{Type: backupRecordDocument, Collection: spec.Name, Document: cursor.Current}
+			if err := writeBackupRecord(w, doc, useJSON); err != nil {
+				cursor.Close(ctx)
+				return nil, err
+			}
+			n++
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", spec.Name, err)
+		}
+		counts[spec.Name] = n
+		info.Collections = append(info.Collections, BackupCollection{Name: spec.Name, Documents: n})
+	}
+
+	if err := writeBackupRecord(w, &backupRecord{Type: backupRecordEnd, Counts: counts}, useJSON); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write backup file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to write backup file: %w", err)
+	}
+	return info, nil
+}
+
+// listIndexSpecs 讀取集合的索引定義（不含預設的 _id_），移除還原時不需要的 ns 與 v
+func listIndexSpecs(ctx context.Context, collection *mongo.Collection) ([]bson.Raw, error) {
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var specs []bson.Raw
+	for cursor.Next(ctx) {
+		var spec bson.D
+		if err := bson.Unmarshal(cursor.Current, &spec); err != nil {
+			return nil, err
+		}
+		cleaned := bson.D{}
+		skip := false
+		for _, e := range spec {
+			switch e.Key {
+			case "ns", "v":
+				continue
+			case "name":
+				skip = e.Value == "_id_"
+			}
+			cleaned = append(cleaned, e)
+		}
+		if skip {
+			continue
+		}
+		raw, err := bson.Marshal(cleaned)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, raw)
+	}
+	return specs, cursor.Err()
+}
+
+// Restore 以備份檔取代整個資料庫：先完整讀過一次確認檔案沒有截斷，再刪除並重建每個集合；
+// 備份中沒有的集合會被刪除。還原會改變遷移版本，因此在遷移鎖內執行
+func (d *Database) Restore(path string) (*BackupInfo, error) {
+	if _, err := d.database(); err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return nil, newValidationError("path", "backup path is required")
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, newValidationError("path", fmt.Sprintf("cannot read backup %s: %v", path, err))
+	}
+
+	var info *BackupInfo
+	started := time.Now()
+	err = d.withMigrationLock("restore", func(ctx context.Context) error {
+		var err error
+		info, err = d.restoreBackup(withOperation(ctx, "Restore"), path)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore database: %w", err)
+	}
+	info.Path = path
+	info.Size = stat.Size()
+	info.CreatedAt = started.Format(time.RFC3339)
+	info.DurationMs = time.Since(started).Milliseconds()
+
+	logFor("backup").Info("Database restored", LogKeyOperation, "restore", LogKeyDuration, info.DurationMs,
+		"path", path, "version", info.SchemaVersion, "collections", len(info.Collections))
+	return info, nil
+}
+
+// scanBackup 依序讀取備份中的每筆紀錄；檔案必須以 header 開頭、以 end 結尾
+func scanBackup(path string, fn func(rec *backupRecord) error) (*backupRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	useJSON := backupUsesJSON(path)
+	r := bufio.NewReaderSize(f, 1<<20)
+
+	header, err := readBackupRecord(r, useJSON)
+	if err != nil || header.Type != backupRecordHeader {
+		return nil, fmt.Errorf("%s is not a backup file", path)
+	}
+	if header.Format != backupFormat {
+		return nil, fmt.Errorf("backup format %q does not match this database (%s)", header.Format, backupFormat)
+	}
+	for {
+		rec, err := readBackupRecord(r, useJSON)
+		if err == io.EOF {
+			return nil, fmt.Errorf("backup %s is incomplete (missing end record)", path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rec.Type == backupRecordEnd {
+			return header, nil
+		}
+		if err := fn(rec); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (d *Database) restoreBackup(ctx context.Context, path string) (*BackupInfo, error) {
+	// 第一次只檢查檔案，確認完整後才開始修改資料庫
+	keep := map[string]bool{}
+	header, err := scanBackup(path, func(rec *backupRecord) error {
+		if rec.Type == backupRecordCollection {
+			keep[rec.Collection] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	logFor("backup").Info("Restoring backup", "database", header.Database, "version", header.SchemaVersion, "collections", len(keep))
+
+	db, err := d.database()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := db.ListCollectionNames(ctx, bson.M{"type": "collection"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	for _, name := range existing {
+		if !keep[name] && !backupSkipped(name) {
+			logFor("backup").Info("Dropping collection not in backup", "collection", name)
+			if err := db.Collection(name).Drop(ctx); err != nil {
+				return nil, fmt.Errorf("failed to drop %s: %w", name, err)
+			}
+		}
+	}
+
+	// 索引在該集合的文件全部寫入後才建立
+	var current *backupRecord
+	var batch []interface{}
+	finish := func() error {
+		if current == nil {
+			return nil
+		}
+		collection := db.Collection(current.Collection)
+		if len(batch) > 0 {
+			if _, err := collection.InsertMany(ctx, batch, options.InsertMany().SetOrdered(true)); err != nil {
+				return fmt.Errorf("failed to insert into %s: %w", current.Collection, err)
+			}
+			batch = batch[:0]
+		}
+		if len(current.Indexes) > 0 {
+			cmd := bson.D{{Key: "createIndexes", Value: current.Collection}, {Key: "indexes", Value: current.Indexes}}
+			if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+				return fmt.Errorf("failed to create indexes on %s: %w", current.Collection, err)
+			}
+		}
+		return nil
+	}
+
+	_, err = scanBackup(path, func(rec *backupRecord) error {
+		switch rec.Type {
+		case backupRecordCollection:
+			if err := finish(); err != nil {
+				return err
+			}
+			current = rec
+			collection := db.Collection(rec.Collection)
+			if err := collection.Drop(ctx); err != nil {
+				return fmt.Errorf("failed to drop %s: %w", rec.Collection, err)
+			}
+			cmd := bson.D{{Key: "create", Value: rec.Collection}}
+			if rec.Options != nil {
+				var opts bson.D
+				if err := bson.Unmarshal(rec.Options, &opts); err != nil {
+					return err
+				}
+				cmd = append(cmd, opts...)
+			}
+			if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+				return fmt.Errorf("failed to create %s: %w", rec.Collection, err)
+			}
+		case backupRecordDocument:
+			if current == nil || rec.Collection != current.Collection {
+				return fmt.Errorf("document for %s appears outside its collection", rec.Collection)
+			}
+			batch = append(batch, rec.Document)
+			if len(batch) == backupInsertBatchSize {
+				if _, err := db.Collection(rec.Collection).InsertMany(ctx, batch, options.InsertMany().SetOrdered(true)); err != nil {
+					return fmt.Errorf("failed to insert into %s: %w", rec.Collection, err)
+				}
+				batch = batch[:0]
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+
+	info := &BackupInfo{Format: backupFormat, Encoding: "bson", SchemaVersion: uint(header.SchemaVersion), Dirty: header.Dirty, Collections: []BackupCollection{}}
+	if backupUsesJSON(path) {
+		info.Encoding = "extjson"
+	}
+	names := make([]string, 0, len(keep))
+	for name := range keep {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		n, err := db.Collection(name).CountDocuments(ctx, bson.M{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to count %s: %w", name, err)
+		}
+		info.Collections = append(info.Collections, BackupCollection{Name: name, Documents: n})
+	}
+	return info, nil
+}
+
+// backupBeforeMigration 設定 DB_BACKUP_BEFORE_MIGRATE=true 時，在自動遷移套用任何變更前先備份；備份失敗則不遷移
+func (d *Database) backupBeforeMigration(from, to uint) error {
+	if !appConfig().BackupBeforeMigrate {
+		return nil
+	}
+	logFor("backup").Info("Backing up database before migrating", "from", from, "to", to)
+	if _, err := d.Backup(""); err != nil {
+		return fmt.Errorf("automatic backup before migration failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 集合瀏覽額外支援的運算子（其餘沿用 FilterCondition 的運算子）
+const (
+	FilterOpIsNull  = "isnull"
+	FilterOpNotNull = "notnull"
+)
+
+// 瀏覽集合的分頁大小與推測文件結構時抽樣的文件數
+const (
+	defaultBrowsePageSize = 50
+	maxBrowsePageSize     = 500
+	describeSampleSize    = 100
+)
+
+// CollectionSummary 集合名稱與預估文件數
+type CollectionSummary struct {
+	Name      string `json:"name"`
+	Documents int64  `json:"documents"`
+}
+
+// CollectionField 抽樣文件中出現的欄位；Path 以 "." 表示巢狀欄位，Ratio 為出現在抽樣文件中的比例
+type CollectionField struct {
+	Path  string   `json:"path"`
+	Types []string `json:"types"`
+	Count int      `json:"count"`
+	Ratio float64  `json:"ratio"`
+}
+
+// CollectionIndex 索引定義；Keys 為 extended JSON
+type CollectionIndex struct {
+	Name   string `json:"name"`
+	Keys   string `json:"keys"`
+	Unique bool   `json:"unique"`
+}
+
+// CollectionDescription 集合的文件結構（由抽樣推測）與索引
+type CollectionDescription struct {
+	Name      string            `json:"name"`
+	Documents int64             `json:"documents"`
+	Sampled   int               `json:"sampled"`
+	Fields    []CollectionField `json:"fields"`
+	Indexes   []CollectionIndex `json:"indexes"`
+}
+
+// CollectionQuery 瀏覽集合的條件；Conditions 以 AND 組合，Value 可使用 extended JSON（例如 {"$date": ...}），
+// _id 的 24 位十六進位字串會轉為 ObjectID；OrderBy 為空時依 _id 排序
+type CollectionQuery struct {
+	Conditions []FilterCondition `json:"conditions"`
+	OrderBy    string            `json:"orderBy"`
+	Desc       bool              `json:"desc"`
+	Page       int               `json:"page"`
+	PageSize   int               `json:"pageSize"`
+}
+
+// CollectionPage 一頁文件，文件以 relaxed extended JSON 的結構回傳
+type CollectionPage struct {
+	Collection string                   `json:"collection"`
+	Documents  []map[string]interface{} `json:"documents" ts_type:"Array<Record<string, any>>"`
+	Total      int64                    `json:"total"`
+	Page       int                      `json:"page"`
+	PageSize   int                      `json:"pageSize"`
+}
+
+// browsableCollection 確認集合存在且不是系統集合
+func (d *Database) browsableCollection(ctx context.Context, name string) (*mongo.Collection, error) {
+	if name == "" || strings.HasPrefix(name, "system.") {
+		return nil, newValidationError("collection", fmt.Sprintf("unknown collection %q", name))
+	}
+	db, err := d.database()
+	if err != nil {
+		return nil, err
+	}
+	names, err := db.ListCollectionNames(ctx, bson.M{"name": name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	if len(names) == 0 {
+		return nil, newValidationError("collection", fmt.Sprintf("unknown collection %q", name))
+	}
+	return db.Collection(name), nil
+}
+
+// ListCollections 列出所有集合與預估文件數（不含 system.* 與 view）
+func (d *Database) ListCollections() ([]CollectionSummary, error) {
+	ctx, cancel := context.WithTimeout(withOperation(context.Background(), "ListCollections"), 10*time.Second)
+	defer cancel()
+
+	db, err := d.database()
+	if err != nil {
+		return nil, err
+	}
+	names, err := db.ListCollectionNames(ctx, bson.M{"type": "collection"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	sort.Strings(names)
+
+	summaries := []CollectionSummary{}
+	for _, name := range names {
+		if strings.HasPrefix(name, "system.") {
+			continue
+		}
+		count, err := db.Collection(name).EstimatedDocumentCount(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count documents of %s: %w", name, err)
+		}
+		summaries = append(summaries, CollectionSummary{Name: name, Documents: count})
+	}
+	return summaries, nil
+}
+
+// DescribeCollection 以 $sample 抽樣文件推測欄位與型別，並列出索引
+func (d *Database) DescribeCollection(name string) (*CollectionDescription, error) {
+	ctx, cancel := context.WithTimeout(withOperation(context.Background(), "DescribeCollection"), 30*time.Second)
+	defer cancel()
+
+	collection, err := d.browsableCollection(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	desc := &CollectionDescription{Name: name, Fields: []CollectionField{}, Indexes: []CollectionIndex{}}
+	if desc.Documents, err = collection.EstimatedDocumentCount(ctx); err != nil {
+		return nil, fmt.Errorf("failed to count documents: %w", err)
+	}
+
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{{{Key: "$sample", Value: bson.M{"size": describeSampleSize}}}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample documents: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	fields := map[string]*CollectionField{}
+	for cursor.Next(ctx) {
+		desc.Sampled++
+		seen := map[string]bool{}
+		if err := collectFieldTypes(cursor.Current, "", fields, seen); err != nil {
+			return nil, fmt.Errorf("failed to read sampled document: %w", err)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to sample documents: %w", err)
+	}
+	for _, field := range fields {
+		sort.Strings(field.Types)
+		field.Ratio = float64(field.Count) / float64(desc.Sampled)
+		desc.Fields = append(desc.Fields, *field)
+	}
+	sort.Slice(desc.Fields, func(i, j int) bool { return desc.Fields[i].Path < desc.Fields[j].Path })
+
+	specs, err := collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+	for _, spec := range specs {
+		desc.Indexes = append(desc.Indexes, CollectionIndex{
+			Name:   spec.Name,
+			Keys:   extJSON(spec.KeysDocument),
+			Unique: spec.Unique != nil && *spec.Unique,
+		})
+	}
+	sort.Slice(desc.Indexes, func(i, j int) bool { return desc.Indexes[i].Name < desc.Indexes[j].Name })
+	return desc, nil
+}
+
+// collectFieldTypes 記錄文件中每個欄位（含巢狀文件）的 BSON 型別；同一份文件中的欄位只計數一次
+func collectFieldTypes(doc bson.Raw, prefix string, fields map[string]*CollectionField, seen map[string]bool) error {
+	elements, err := doc.Elements()
+	if err != nil {
+		return err
+	}
+	for _, element := range elements {
+		path := prefix + element.Key()
+		value := element.Value()
+		typeName := value.Type.String()
+
+		field, ok := fields[path]
+		if !ok {
+			field = &CollectionField{Path: path, Types: []string{}}
+			fields[path] = field
+		}
+		if !seen[path] {
+			seen[path] = true
+			field.Count++
+		}
+		if !containsString(field.Types, typeName) {
+			field.Types = append(field.Types, typeName)
+		}
+
+		if nested, ok := value.DocumentOK(); ok {
+			if err := collectFieldTypes(nested, path+".", fields, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+// BrowseCollection 分頁讀取任意集合的文件，只執行讀取操作
+func (d *Database) BrowseCollection(name string, query CollectionQuery) (*CollectionPage, error) {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 {
+		query.PageSize = defaultBrowsePageSize
+	}
+	if query.PageSize > maxBrowsePageSize {
+		query.PageSize = maxBrowsePageSize
+	}
+
+	filter := bson.M{}
+	var clauses []bson.M
+	for _, cond := range query.Conditions {
+		clause, err := buildBrowseCondition(cond)
+		if err != nil {
+			return nil, newValidationError("conditions", err.Error())
+		}
+		clauses = append(clauses, clause)
+	}
+	if len(clauses) > 0 {
+		filter = bson.M{"$and": clauses}
+	}
+
+	orderBy := query.OrderBy
+	if orderBy == "" {
+		orderBy = "_id"
+	}
+	if err := checkBrowseField(orderBy); err != nil {
+		return nil, newValidationError("orderBy", err.Error())
+	}
+	direction := 1
+	if query.Desc {
+		direction = -1
+	}
+
+	ctx, cancel := context.WithTimeout(withOperation(context.Background(), "BrowseCollection"), 10*time.Second)
+	defer cancel()
+
+	collection, err := d.browsableCollection(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &CollectionPage{Collection: name, Page: query.Page, PageSize: query.PageSize, Documents: []map[string]interface{}{}}
+	if page.Total, err = collection.CountDocuments(ctx, filter); err != nil {
+		return nil, fmt.Errorf("failed to count documents: %w", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: orderBy, Value: direction}}).
+		SetSkip(int64((query.Page - 1) * query.PageSize)).
+		SetLimit(int64(query.PageSize))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", name, err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		doc, err := browseDocument(cursor.Current)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode document: %w", err)
+		}
+		page.Documents = append(page.Documents, doc)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", name, err)
+	}
+	return page, nil
+}
+
+// checkBrowseField 欄位名稱不可為空、不可以 $ 開頭，避免把運算子當成欄位注入查詢
+func checkBrowseField(field string) error {
+	if field == "" {
+		return fmt.Errorf("field is required")
+	}
+	for _, part := range strings.Split(field, ".") {
+		if part == "" || strings.HasPrefix(part, "$") || strings.ContainsRune(part, 0) {
+			return fmt.Errorf("invalid field %q", field)
+		}
+	}
+	return nil
+}
+
+// buildBrowseCondition 將條件轉為查詢文件
+func buildBrowseCondition(cond FilterCondition) (bson.M, error) {
+	if err := checkBrowseField(cond.Field); err != nil {
+		return nil, err
+	}
+	field := cond.Field
+
+	switch op := strings.ToLower(cond.Op); op {
+	case FilterOpIsNull:
+		return bson.M{field: nil}, nil
+	case FilterOpNotNull:
+		return bson.M{field: bson.M{"$ne": nil}}, nil
+	case FilterOpLike:
+		keyword, ok := cond.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("operator %q on field %q requires a string value", op, field)
+		}
+		return bson.M{field: primitive.Regex{Pattern: regexp.QuoteMeta(keyword), Options: "i"}}, nil
+	case FilterOpIn:
+		if len(cond.Values) == 0 {
+			return nil, fmt.Errorf("operator %q on field %q requires at least one value", op, field)
+		}
+		values := make([]interface{}, 0, len(cond.Values))
+		for _, raw := range cond.Values {
+			value, err := browseArg(field, raw)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return bson.M{field: bson.M{"$in": values}}, nil
+	case FilterOpBetween:
+		if len(cond.Values) != 2 {
+			return nil, fmt.Errorf("operator %q on field %q requires exactly two values", op, field)
+		}
+		low, err := browseArg(field, cond.Values[0])
+		if err != nil {
+			return nil, err
+		}
+		high, err := browseArg(field, cond.Values[1])
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{field: bson.M{"$gte": low, "$lte": high}}, nil
+	default:
+		operators := map[string]string{
+			FilterOpEq:  "$eq",
+			FilterOpNe:  "$ne",
+			FilterOpGt:  "$gt",
+			FilterOpGte: "$gte",
+			FilterOpLt:  "$lt",
+			FilterOpLte: "$lte",
+		}
+		mongoOp, ok := operators[op]
+		if !ok {
+			return nil, fmt.Errorf("unknown filter operator %q", cond.Op)
+		}
+		value, err := browseArg(field, cond.Value)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{field: bson.M{mongoOp: value}}, nil
+	}
+}
+
+// browseArg 將前端傳入的值轉為 BSON：以 extended JSON 解讀（{"$oid": ...}、{"$date": ...} 等），
+// 整數不會變成 double；_id 欄位的 24 位十六進位字串視為 ObjectID
+func browseArg(field string, value interface{}) (interface{}, error) {
+	if s, ok := value.(string); ok && field == "_id" {
+		if id, err := primitive.ObjectIDFromHex(s); err == nil {
+			return id, nil
+		}
+		return s, nil
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"v": value})
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for field %q: %v", field, err)
+	}
+	var doc bson.D
+	if err := bson.UnmarshalExtJSON(data, false, &doc); err != nil {
+		return nil, fmt.Errorf("invalid value for field %q: %v", field, err)
+	}
+	return doc[0].Value, nil
+}
+
+// browseDocument 將文件轉為 relaxed extended JSON 的結構，ObjectID、日期與二進位資料都能原樣顯示
+func browseDocument(raw bson.Raw) (map[string]interface{}, error) {
+	data, err := bson.MarshalExtJSON(raw, false, false)
+	if err != nil {
+		return nil, err
+	}
+	// 以 json.Number 保留 int64 的精度
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc map[string]interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 用戶異動的事件名稱，同時作為送給前端的 Wails 事件名稱
+const (
+	UserCreatedEvent = "user.created"
+	UserUpdatedEvent = "user.updated"
+	UserDeletedEvent = "user.deleted"
+)
+
+// changeFeedCheckInterval 單機部署或尚未連線時，檢查是否已切換連線的間隔
+const changeFeedCheckInterval = 10 * time.Second
+
+// changeStreamHistoryLost resume token 已不在 oplog 中，無法從中斷處繼續
+const changeStreamHistoryLost = 286
+
+// errChangeStreamUnsupported 部署不支援 change stream
+var errChangeStreamUnsupported = errors.New("change streams require a replica set or sharded cluster")
+
+// UserChangeEvent 一筆用戶異動；User 為異動後的資料，永久刪除時只有 id
+type UserChangeEvent struct {
+	Type string                 `json:"type"`
+	ID   string                 `json:"id"`
+	User map[string]interface{} `json:"user"`
+}
+
+var (
+	// userChangeListener 接收用戶異動，由 App 轉送為 Wails 事件
+	userChangeListenerMu sync.RWMutex
+	userChangeListener   func(UserChangeEvent)
+)
+
+// SetUserChangeListener 設定用戶異動的接收者（nil 表示不通知）
+func SetUserChangeListener(fn func(UserChangeEvent)) {
+	userChangeListenerMu.Lock()
+	userChangeListener = fn
+	userChangeListenerMu.Unlock()
+}
+
+// notifyUserChange 通知用戶異動
+func notifyUserChange(event UserChangeEvent) {
+	userChangeListenerMu.RLock()
+	fn := userChangeListener
+	userChangeListenerMu.RUnlock()
+	if fn != nil {
+		fn(event)
+	}
+}
+
+// userChange change stream 中與用戶異動有關的欄位
+type userChange struct {
+	OperationType string `bson:"operationType"`
+	DocumentKey   struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument      bson.M `bson:"fullDocument"`
+	UpdateDescription struct {
+		UpdatedFields bson.M `bson:"updatedFields"`
+	} `bson:"updateDescription"`
+}
+
+// WatchUserChanges 以 change stream 監看 users 集合，把任何程序的用戶異動送給 SetUserChangeListener 設定的接收者，
+// 直到 ctx 結束。change stream 只支援 replica set 與 sharded cluster，單機部署時不通知；
+// 中斷後以 resume token 從中斷處繼續，切換連線時從新資料庫目前的異動開始
+func WatchUserChanges(ctx context.Context) {
+	if !appConfig().ChangeFeed {
+		return
+	}
+	ctx = unobserved(ctx)
+	log := logFor("changes")
+
+	var (
+		d           *Database
+		resumeToken bson.Raw
+		failures    int
+		standalone  bool
+	)
+	for {
+		if current := currentDatabase(); current != d {
+			d, resumeToken, failures, standalone = current, nil, 0, false
+		}
+
+		delay := changeFeedCheckInterval
+		if d != nil && d.Client != nil && !standalone {
+			err := d.watchUsers(ctx, &resumeToken)
+			if ctx.Err() != nil {
+				return
+			}
+			switch {
+			case errors.Is(err, errChangeStreamUnsupported):
+				standalone = true
+				log.Warn("MongoDB is a standalone server, user changes from other instances are not pushed (deploy a replica set to enable change streams)")
+			case err != nil:
+				failures++
+				if failures == 1 {
+					log.Warn("User change stream interrupted", "error", err)
+				}
+				delay = reconnectDelay(failures)
+			default:
+				failures = 0
+				delay = 0
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// watchUsers 開啟 users 的 change stream 並逐筆通知，直到 stream 中斷或失效；resumeToken 隨處理進度更新
+func (d *Database) watchUsers(ctx context.Context, resumeToken *bson.Raw) error {
+	collection, err := d.collection("users")
+	if err != nil {
+		return err
+	}
+	// replica set 與 sharded cluster 才有 change stream（與多文件交易的條件相同）
+	supported, err := d.supportsTransactions(ctx)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return errChangeStreamUnsupported
+	}
+
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if *resumeToken != nil {
+		opts.SetResumeAfter(*resumeToken)
+	}
+	stream, err := collection.Watch(ctx, mongo.Pipeline{}, opts)
+	if err != nil {
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && cmdErr.Code == changeStreamHistoryLost {
+			*resumeToken = nil
+		}
+		return fmt.Errorf("failed to watch users: %w", err)
+	}
+	defer stream.Close(unobserved(context.Background()))
+	logFor("changes").Info("Watching user changes", "source", "change stream", "resumed", *resumeToken != nil)
+
+	for stream.Next(ctx) {
+		var change userChange
+		if err := stream.Decode(&change); err != nil {
+			return fmt.Errorf("failed to decode change event: %w", err)
+		}
+		if change.OperationType == "invalidate" {
+			// 集合被刪除或改名，stream 已失效，重新開啟
+			*resumeToken = nil
+			return nil
+		}
+		*resumeToken = stream.ResumeToken()
+		if event, ok := userChangeEvent(change); ok {
+			notifyUserChange(event)
+		}
+	}
+	return stream.Err()
+}
+
+// userChangeEvent 將 change stream 的事件轉為 UserChangeEvent：設定 deleted_at 的更新為刪除，其餘更新（包括還原）為更新
+func userChangeEvent(change userChange) (UserChangeEvent, bool) {
+	event := UserChangeEvent{ID: change.DocumentKey.ID.Hex(), User: normalizeUserDoc(change.FullDocument)}
+	switch change.OperationType {
+	case "insert":
+		event.Type = UserCreatedEvent
+	case "update", "replace":
+		event.Type = UserUpdatedEvent
+		if deletedAt, ok := change.UpdateDescription.UpdatedFields["deleted_at"]; ok && deletedAt != nil {
+			event.Type = UserDeletedEvent
+		}
+	case "delete":
+		event.Type = UserDeletedEvent
+	default:
+		return event, false
+	}
+	if event.User == nil {
+		// 永久刪除，或更新後文件已被刪除
+		event.User = map[string]interface{}{"id": event.ID}
+	}
+	return event, true
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// captureConnectionStates 記錄送給前端的連線狀態，測試結束時移除
+func captureConnectionStates(t *testing.T) func() []ConnectionState {
+	t.Helper()
+	var mu sync.Mutex
+	var states []ConnectionState
+	SetConnectionListener(func(state ConnectionState) {
+		mu.Lock()
+		states = append(states, state)
+		mu.Unlock()
+	})
+	t.Cleanup(func() { SetConnectionListener(nil) })
+	return func() []ConnectionState {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]ConnectionState(nil), states...)
+	}
+}
+
+func TestCollectionGuardsConnection(t *testing.T) {
+	loadTestConfig(t)
+
+	// 無法建立 client 時 d.DB 是 nil，取得集合回傳 ErrUnavailable 而不是 panic
+	d := newDatabase(ConnectionProfile{Name: "broken", Host: "127.0.0.1", Port: "1", DBName: "test"})
+	if _, err := d.collection("users"); !errors.Is(err, ErrUnavailable) || !strings.Contains(err.Error(), "not connected") {
+		t.Fatalf("collection without a client: err = %v, want ErrUnavailable", err)
+	}
+	if _, err := d.GetUserByID("0123456789abcdef01234567"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("GetUserByID without a client: err = %v, want ErrUnavailable", err)
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("backoff", func(mt *mtest.T) {
+		states := captureConnectionStates(t)
+		d := newMockDatabase(mt)
+		d.conn = newConnTracker("mock")
+
+		// 斷線後在等待時間內直接回傳 ErrUnavailable，不送出命令
+		d.conn.record(errors.New("server selection timeout"))
+		if _, err := d.collection("users"); !errors.Is(err, ErrUnavailable) {
+			mt.Fatalf("collection during backoff: err = %v, want ErrUnavailable", err)
+		}
+		if names, _ := startedCommands(mt); len(names) != 0 {
+			mt.Fatalf("commands sent during backoff: %v", names)
+		}
+		state := d.ConnectionState()
+		if state.Status != ConnectionDisconnected || state.Failures != 1 ||
+			state.RetryAt == nil || state.RetryAt.After(time.Now().Add(time.Second)) {
+			mt.Fatalf("state after the first failure = %+v, want a 1s backoff", state)
+		}
+
+		// 連續失敗時等待時間加倍
+		before := time.Now()
+		d.conn.record(errors.New("server selection timeout"))
+		if state = d.ConnectionState(); state.Failures != 2 || state.RetryAt.Before(before.Add(2*time.Second)) {
+			mt.Fatalf("state after the second failure = %+v, want a 2s backoff", state)
+		}
+
+		// Reconnect 忽略等待時間並以 ping 確認連線
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		if state = d.Reconnect(); state.Status != ConnectionConnected || state.Failures != 0 {
+			mt.Fatalf("state after Reconnect = %+v, want connected", state)
+		}
+		if _, err := d.collection("users"); err != nil {
+			mt.Fatalf("collection after recovery: %v", err)
+		}
+
+		var statuses []string
+		for _, s := range states() {
+			statuses = append(statuses, s.Status)
+		}
+		want := []string{ConnectionDisconnected, ConnectionDisconnected, ConnectionConnected}
+		if !slices.Equal(statuses, want) {
+			mt.Fatalf("notified statuses = %v, want %v", statuses, want)
+		}
+	})
+}
+
+func TestFailedSwitchKeepsCurrentConnection(t *testing.T) {
+	loadTestConfig(t)
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("switch", func(mt *mtest.T) {
+		current := newMockDatabase(mt)
+		current.conn = newConnTracker("current")
+		current.conn.record(nil)
+		states := captureConnectionStates(t)
+
+		dbInstanceMu.Lock()
+		previous := dbInstance
+		dbInstance = current
+		dbInstanceMu.Unlock()
+		defer func() {
+			dbInstanceMu.Lock()
+			dbInstance = previous
+			dbInstanceMu.Unlock()
+		}()
+
+		// 切換期間進行中的呼叫一律拿到目前的連線
+		stop := make(chan struct{})
+		var wrong sync.Once
+		var got *Database
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					if d := GetDBInstance(); d != current {
+						wrong.Do(func() { got = d })
+						return
+					}
+				}
+			}()
+		}
+
+		// CA 檔案不存在，建立 client 時立即失敗
+		profile := ConnectionProfile{Name: "other", Host: "127.0.0.1", Port: "1", DBName: "other",
+			TLS: TLSOptions{Mode: TLSModeVerifyCA, CAFile: filepath.Join(t.TempDir(), "missing.pem")}}
+		_, err := SwitchConnection(profile)
+		close(stop)
+		wg.Wait()
+		if err == nil || !strings.Contains(err.Error(), `profile "other"`) {
+			mt.Fatalf("SwitchConnection with a missing CA file: err = %v", err)
+		}
+		if got != nil {
+			mt.Fatalf("a call during the switch got %p, want the current database %p", got, current)
+		}
+		if GetDBInstance() != current {
+			mt.Fatal("failed switch replaced the current database")
+		}
+
+		// 目前的 client 沒有被關閉，仍可送出命令；候選連線的失敗不通知前端
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		if err := current.DB.RunCommand(context.Background(), bson.D{{Key: "ping", Value: 1}}).Err(); err != nil {
+			mt.Fatalf("ping on the current client: %v", err)
+		}
+		if notified := states(); len(notified) != 0 {
+			mt.Fatalf("notified states = %+v, want none", notified)
+		}
+	})
+}
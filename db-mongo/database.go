@@ -3,123 +3,293 @@ package main
 import (
 	"context"
 	"fmt"
-	"os"
-	"sync"
+	"net"
+	"strconv"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // Database 結構體封裝所有資料庫操作
 type Database struct {
-	Host       string
-	Port       string
-	User       string
-	Password   string
-	DBName     string
-	AuthSource string
-	Client     *mongo.Client
-	DB         *mongo.Database
-}
-
-// 使用 sync.Once 來確保 Singleton 實例只被創建一次
-var once sync.Once
-var dbInstance *Database
-
-// GetDBInstance 獲取 Singleton 實例
-func GetDBInstance() *Database {
-	once.Do(func() {
-		// 讀取環境變數並記錄
-		host := getEnv("DB_HOST", "localhost")
-		port := getEnv("DB_PORT", "27017")
-		user := getEnv("DB_USER", "")
-		password := getEnv("DB_PASSWORD", "")
-		dbName := getEnv("DB_NAME", "mydb")
-		authSource := getEnv("DB_AUTH_SOURCE", "admin")
-
-		// 記錄讀取到的配置（密碼只顯示長度）
-		passwordMask := "***"
-		if password != "" {
-			passwordMask = fmt.Sprintf("*** (%d chars)", len(password))
-		}
-		WriteAppLog(fmt.Sprintf("Database config - Host: %s, Port: %s, User: %s, Password: %s, DB: %s, AuthSource: %s",
-			host, port, user, passwordMask, dbName, authSource), true)
-
-		dbInstance = &Database{
-			Host:       host,
-			Port:       port,
-			User:       user,
-			Password:   password,
-			DBName:     dbName,
-			AuthSource: authSource,
-		}
-		dbInstance.Initialize()
-	})
-	return dbInstance
+	Host           string
+	Port           string
+	User           string
+	Password       string
+	DBName         string
+	AuthSource     string
+	TLS            TLSOptions
+	Client         *mongo.Client
+	DB             *mongo.Database
+	SoftDelete     bool // 為 true 時 DeleteUser 只標記 deleted_at，可再還原
+	AutoMigrate    bool // 為 false 時啟動不自動執行遷移，改由 migrate 子命令或綁定方法管理
+	QueryWriteMode bool // 為 true 時查詢主控台允許寫入命令
+	actor          string
+	txSupport      int32        // 部署是否支援交易（txSupport* 常數），由 supportsTransactions 偵測後快取
+	conn           *connTracker // 連線狀態與重新連線的等待時間
+}
+
+// ConnectionProfile 連線設定，可儲存於 DB_PROFILES_FILE 並在執行期間切換
+type ConnectionProfile struct {
+	Name       string     `json:"name"`
+	Host       string     `json:"host"`
+	Port       string     `json:"port"`
+	User       string     `json:"user"`
+	Password   string     `json:"password,omitempty"`
+	DBName     string     `json:"dbName"`
+	AuthSource string     `json:"authSource"`
+	TLS        TLSOptions `json:"tls"`
+}
+
+// envConnectionProfile 依設定建立預設的連線設定
+func envConnectionProfile() ConnectionProfile {
+	cfg := appConfig()
+	return ConnectionProfile{
+		Name:       defaultProfileName,
+		Host:       cfg.DBHost,
+		Port:       strconv.Itoa(cfg.DBPort),
+		User:       cfg.DBUser,
+		Password:   cfg.DBPassword,
+		DBName:     cfg.DBName,
+		AuthSource: cfg.DBAuthSource,
+		TLS:        envTLSOptions(),
+	}
+}
+
+// withDefaultsFrom 以儲存的設定補上留空的欄位
+func (p ConnectionProfile) withDefaultsFrom(saved ConnectionProfile) ConnectionProfile {
+	if p.Host == "" {
+		p.Host = saved.Host
+	}
+	if p.Port == "" {
+		p.Port = saved.Port
+	}
+	if p.User == "" {
+		p.User = saved.User
+	}
+	if p.DBName == "" {
+		p.DBName = saved.DBName
+	}
+	if p.AuthSource == "" {
+		p.AuthSource = saved.AuthSource
+	}
+	if p.TLS == (TLSOptions{}) {
+		p.TLS = saved.TLS
+	}
+	return p.withSecretsFrom(saved)
+}
+
+// withSecretsFrom 密碼留空時沿用儲存的密碼，前端編輯設定時不需要重新輸入
+func (p ConnectionProfile) withSecretsFrom(saved ConnectionProfile) ConnectionProfile {
+	if p.Password == "" || p.Password == maskedSecret {
+		p.Password = saved.Password
+	}
+	return p
+}
+
+// masked 回傳隱藏密碼的副本，供前端顯示；secret:// 參照不是密碼本身，照常顯示
+func (p ConnectionProfile) masked() ConnectionProfile {
+	if p.Password != "" && !isSecretRef(p.Password) {
+		p.Password = maskedSecret
+	}
+	return p
+}
+
+// validate 檢查連線必要的欄位
+func (p ConnectionProfile) validate() error {
+	verr := &ValidationError{}
+	if p.Host == "" {
+		verr.Add("host", "is required")
+	}
+	if p.Port == "" {
+		verr.Add("port", "is required")
+	}
+	if p.DBName == "" {
+		verr.Add("dbName", "is required")
+	}
+	p.TLS.validate(verr)
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// newDatabaseFromEnv 依設定建立 Database（尚未連線）
+func newDatabaseFromEnv() *Database {
+	profile := envConnectionProfile()
+
+	// 記錄讀取到的配置（密碼一律以固定的遮罩顯示，不透露長度）
+	logFor("database").Info("Database config", "host", profile.Host, "port", profile.Port, "user", profile.User,
+		"password", "***", "database", profile.DBName, "auth_source", profile.AuthSource, "tls", profile.TLS.Mode)
+
+	return newDatabase(profile)
+}
+
+// newDatabase 以連線設定建立 Database（尚未連線），其餘設定讀取環境變數
+func newDatabase(profile ConnectionProfile) *Database {
+	registerSecret(profile.Password)
+	cfg := appConfig()
+	authSource := profile.AuthSource
+	if authSource == "" {
+		authSource = "admin"
+	}
+	return &Database{
+		Host:           profile.Host,
+		Port:           profile.Port,
+		User:           profile.User,
+		Password:       profile.Password,
+		DBName:         profile.DBName,
+		AuthSource:     authSource,
+		TLS:            profile.TLS,
+		SoftDelete:     cfg.SoftDelete,
+		AutoMigrate:    cfg.AutoMigrate,
+		QueryWriteMode: cfg.QueryWriteMode,
+		actor:          resolveActor(),
+		conn:           newConnTracker(profile.Name),
+	}
 }
 
-// getEnv 獲取環境變數，如果不存在則返回預設值
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// Profile 回傳目前的連線設定
+func (d *Database) Profile() ConnectionProfile {
+	return ConnectionProfile{
+		Name:       d.conn.snapshot().Profile,
+		Host:       d.Host,
+		Port:       d.Port,
+		User:       d.User,
+		Password:   d.Password,
+		DBName:     d.DBName,
+		AuthSource: d.AuthSource,
+		TLS:        d.TLS,
 	}
-	return defaultValue
 }
 
 // Initialize 初始化資料庫
 func (d *Database) Initialize() {
 	if err := d.Connect(); err != nil {
-		WriteAppLog(fmt.Sprintf("Failed to connect to database: %v", err), true)
+		logFor("connection").Error("Failed to connect to database", "error", err)
+		d.initializeFailed()
 		return
 	}
 
+	if !d.AutoMigrate {
+		logFor("migration").Info("Automatic migration disabled (DB_AUTO_MIGRATE=false)")
+		return
+	}
 	if err := d.runMigrations(); err != nil {
-		WriteAppLog(fmt.Sprintf("Failed to run migrations: %v", err), true)
+		logFor("migration").Error("Failed to run migrations", "error", err)
+		d.initializeFailed()
 	}
 }
 
-// Connect 連接到 MongoDB
-func (d *Database) Connect() error {
-	WriteAppLog("Connecting to MongoDB...", true)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// 構建 MongoDB 連接字串
-	var uri string
+// clientOptions 建立連線選項；帳號密碼以 Credential 傳入，不經過 URI 拼接，特殊字元不需要跳脫
+func (d *Database) clientOptions() (*options.ClientOptions, error) {
+	clientOptions := options.Client().
+		SetHosts([]string{net.JoinHostPort(d.Host, d.Port)}).
+		SetServerMonitor(&event.ServerMonitor{TopologyDescriptionChanged: d.topologyChanged}).
+		SetMonitor(mongoCommandMonitor())
 	if d.User != "" && d.Password != "" {
-		uri = fmt.Sprintf("mongodb://%s:%s@%s:%s/%s?authSource=%s",
-			d.User, d.Password, d.Host, d.Port, d.DBName, d.AuthSource)
-	} else {
-		uri = fmt.Sprintf("mongodb://%s:%s/%s",
-			d.Host, d.Port, d.DBName)
+		clientOptions.SetAuth(options.Credential{
+			Username:   d.User,
+			Password:   d.Password,
+			AuthSource: d.AuthSource,
+		})
+	}
+
+	tlsConfig, err := d.TLS.config(d.Host)
+	if err != nil {
+		return nil, err
 	}
+	if tlsConfig != nil {
+		clientOptions.SetTLSConfig(tlsConfig)
+	}
+	return clientOptions, nil
+}
 
-	clientOptions := options.Client().ApplyURI(uri)
+// newClient 建立 MongoDB client；驅動程式在背景維持連線，伺服器狀態變化時更新連線狀態
+func (d *Database) newClient(ctx context.Context) (*mongo.Client, error) {
+	clientOptions, err := d.clientOptions()
+	if err != nil {
+		return nil, err
+	}
 	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
-		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
 	}
+	return client, nil
+}
 
-	// 測試連接
+// dial 建立 client 並確認可以連線，失敗時關閉 client
+func (d *Database) dial(ctx context.Context) (*mongo.Client, error) {
+	client, err := d.newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
 	if err := client.Ping(ctx, nil); err != nil {
-		return fmt.Errorf("failed to ping MongoDB: %w", err)
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
 	}
+	return client, nil
+}
+
+// Connect 連接到 MongoDB；伺服器暫時無法連線時仍保留 client，由驅動程式在背景重新連線，恢復後連線狀態會更新為 connected。
+// 無法建立 client（例如連線字串或 TLS 設定錯誤）時 d.DB 仍是 nil，操作應透過 database / collection 取得集合
+func (d *Database) Connect() error {
+	logFor("connection").Info("Connecting to MongoDB")
+
+	ctx, cancel := context.WithTimeout(withOperation(context.Background(), "Connect"), connectionTestTimeout)
+	defer cancel()
 
-	d.Client = client
-	d.DB = client.Database(d.DBName)
+	if d.Client == nil {
+		client, err := d.newClient(ctx)
+		if err != nil {
+			d.conn.record(err)
+			return err
+		}
+		d.Client = client
+		d.DB = client.Database(d.DBName)
+	}
 
-	WriteAppLog("Successfully connected to MongoDB", true)
+	// 測試連接
+	if err := d.Client.Ping(ctx, nil); err != nil {
+		err = fmt.Errorf("failed to ping MongoDB: %w", err)
+		d.conn.record(err)
+		return err
+	}
+	d.conn.record(nil)
+
+	logFor("connection").Info("Successfully connected to MongoDB")
 	return nil
 }
 
+// database 回傳可用的 *mongo.Database：尚未建立 client 時回傳 ErrUnavailable，
+// 斷線且尚未到下一次重試時間時回傳 conn.gate 的錯誤
+func (d *Database) database() (*mongo.Database, error) {
+	if d.Client == nil || d.DB == nil {
+		return nil, fmt.Errorf("%w: not connected", ErrUnavailable)
+	}
+	if err := d.conn.gate(); err != nil {
+		return nil, err
+	}
+	return d.DB, nil
+}
+
+// collection 回傳名為 name 的集合，條件同 database
+func (d *Database) collection(name string) (*mongo.Collection, error) {
+	db, err := d.database()
+	if err != nil {
+		return nil, err
+	}
+	return db.Collection(name), nil
+}
+
 // Disconnect 關閉資料庫連接
 func (d *Database) Disconnect() error {
 	if d.Client != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(withOperation(context.Background(), "Disconnect"), 5*time.Second)
 		defer cancel()
 		return d.Client.Disconnect(ctx)
 	}
@@ -127,7 +297,7 @@ func (d *Database) Disconnect() error {
 }
 
 // region <-- Migration 相關函式-->
-// Migration 版本記錄結構
+// MigrationVersion 舊版 migrations 集合中的單一版本記錄，只在轉換為 schema_migrations 時讀取
 type MigrationVersion struct {
 	ID      primitive.ObjectID `bson:"_id,omitempty"`
 	Version int                `bson:"version"`
@@ -136,117 +306,97 @@ type MigrationVersion struct {
 
 // 執行資料庫 migration
 func (d *Database) runMigrations() error {
-	WriteAppLog("Initializing database migration...", true)
-	WriteAppLog(fmt.Sprintf("DB Host: %s, Port: %s, DB: %s", d.Host, d.Port, d.DBName), true)
+	logFor("migration").Info("Initializing database migration")
+	logFor("migration").Info("Migration target", "host", d.Host, "port", d.Port, "database", d.DBName)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	_, migrationSource, err := migrationFS()
+	if err != nil {
+		return err
+	}
+	logFor("migration").Info("Migration source", "source", migrationSource)
 
-	// 獲取當前版本
-	currentVersion, err := d.getCurrentVersion(ctx)
+	return d.withMigrationLock("startup migration", d.migrateToLatest)
+}
+
+// migrateToLatest 檢查 checksum 後套用所有待處理的遷移，呼叫端需持有遷移鎖；ctx 被取消時在目前的遷移完成後停止
+func (d *Database) migrateToLatest(ctx context.Context) error {
+	status, err := d.GetMigrationStatus()
 	if err != nil {
-		return fmt.Errorf("failed to get current version: %w", err)
+		return err
 	}
+	logFor("migration").Info("Current database version", "version", status.CurrentVersion, "dirty", status.Dirty)
 
-	WriteAppLog(fmt.Sprintf("Current database version: %d", currentVersion), true)
+	for _, info := range status.Applied {
+		if info.Modified {
+			logFor("migration").Warn("Migration was modified after it was applied",
+				"version", info.Version, "name", info.Name, "checksum", info.Checksum, "applied_checksum", info.AppliedChecksum)
+		}
+	}
+	if status.Ahead {
+		logFor("migration").Warn("Database version is newer than the latest migration", "version", status.CurrentVersion, "latest", status.LatestVersion)
+		return nil
+	}
 
-	// 定義所有遷移步驟
-	migrations := []func(context.Context) error{
-		d.migration001_CreateUsersCollection, // Version 1
-		// 未來可以在這裡添加更多遷移
-		// d.migration002_AddNewIndex,        // Version 2
-	}
-
-	// 執行待處理的遷移
-	for i, migration := range migrations {
-		version := i + 1
-		if version > currentVersion {
-			WriteAppLog(fmt.Sprintf("Running migration %d...", version), true)
-			if err := migration(ctx); err != nil {
-				return fmt.Errorf("failed to run migration %d: %w", version, err)
-			}
-
-			// 記錄遷移版本
-			if err := d.setVersion(ctx, version); err != nil {
-				return fmt.Errorf("failed to record migration version %d: %w", version, err)
-			}
-
-			WriteAppLog(fmt.Sprintf("Migration %d completed successfully", version), true)
-		} else {
-			WriteAppLog(fmt.Sprintf("Migration %d already applied, skipping", version), true)
+	// 已有資料且有待套用的遷移時，依設定先備份
+	if status.CurrentVersion > 0 && len(status.Pending) > 0 && !status.Dirty {
+		if err := d.backupBeforeMigration(status.CurrentVersion, status.LatestVersion); err != nil {
+			return err
 		}
 	}
 
-	WriteAppLog("All migrations completed", true)
+	_, err = d.migrateUnlocked(ctx, false, func(set *migrationSet, current uint) (*MigrationPlan, error) {
+		return set.plan(current, set.latest())
+	})
+	if err != nil {
+		return err
+	}
+
+	logFor("migration").Info("All migrations completed")
 	return nil
 }
 
-// getCurrentVersion 獲取當前資料庫版本
-func (d *Database) getCurrentVersion(ctx context.Context) (int, error) {
-	collection := d.DB.Collection("migrations")
-	var version MigrationVersion
+// goMigrations 以 Go 函式撰寫的遷移（無法用宣告式檔案表達時使用），與遷移檔案合併後依版本執行
+func (d *Database) goMigrations() []*mongoMigration {
+	return []*mongoMigration{
+		{Version: 3, Name: "add_user_version", UpFunc: d.migration003_AddUserVersion, DownFunc: d.migration003_RemoveUserVersion},
+		// 未來可以在這裡添加更多遷移
+	}
+}
 
-	err := collection.FindOne(ctx, bson.M{}).Decode(&version)
-	if err == mongo.ErrNoDocuments {
-		return 0, nil // 沒有記錄表示版本為 0
+// migration003_AddUserVersion 為既有用戶補上樂觀鎖使用的 version 與 updated_at
+func (d *Database) migration003_AddUserVersion(ctx context.Context) error {
+	collection, err := d.collection("users")
+	if err != nil {
+		return err
 	}
+	// 以 aggregation pipeline 更新，讓 updated_at 取用各文件自己的 created_at
+	_, err = collection.UpdateMany(ctx,
+		bson.M{"version": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"version": 1, "updated_at": "$created_at"}}}},
+	)
 	if err != nil {
-		return 0, err
+		return fmt.Errorf("failed to backfill user versions: %w", err)
 	}
 
-	return version.Version, nil
+	logFor("migration").Info("Backfilled version and updated_at for existing users")
+	return nil
 }
 
-// setVersion 記錄遷移版本
-func (d *Database) setVersion(ctx context.Context, version int) error {
-	collection := d.DB.Collection("migrations")
-
-	// 使用 upsert 確保只有一條記錄
-	_, err := collection.UpdateOne(
-		ctx,
+// migration003_RemoveUserVersion 回復 migration003，移除 version 與 updated_at
+func (d *Database) migration003_RemoveUserVersion(ctx context.Context) error {
+	collection, err := d.collection("users")
+	if err != nil {
+		return err
+	}
+	_, err = collection.UpdateMany(ctx,
 		bson.M{},
-		bson.M{
-			"$set": bson.M{
-				"version":   version,
-				"applied_at": time.Now(),
-			},
-		},
-		options.Update().SetUpsert(true),
+		bson.M{"$unset": bson.M{"version": "", "updated_at": ""}},
 	)
-
-	return err
-}
-
-// migration001_CreateUsersCollection 創建 users 集合並設置索引
-func (d *Database) migration001_CreateUsersCollection(ctx context.Context) error {
-	collection := d.DB.Collection("users")
-
-	// 創建索引
-	indexes := []mongo.IndexModel{
-		{
-			Keys: bson.D{
-				{Key: "email", Value: 1},
-			},
-			Options: options.Index().SetUnique(true),
-		},
-		{
-			Keys: bson.D{
-				{Key: "created_at", Value: -1},
-			},
-		},
-		{
-			Keys: bson.D{
-				{Key: "name", Value: 1},
-			},
-		},
-	}
-
-	_, err := collection.Indexes().CreateMany(ctx, indexes)
 	if err != nil {
-		return fmt.Errorf("failed to create indexes: %w", err)
+		return fmt.Errorf("failed to remove user versions: %w", err)
 	}
 
-	WriteAppLog("Created users collection with indexes", true)
+	logFor("migration").Info("Removed version and updated_at from users")
 	return nil
 }
 
@@ -254,39 +404,52 @@ func (d *Database) migration001_CreateUsersCollection(ctx context.Context) error
 
 // InsertUser 插入用戶資料
 func (d *Database) InsertUser(name, email string, age int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	_, err := d.insertUser(withOperation(context.Background(), "InsertUser"), name, email, age)
+	return err
+}
 
-	collection := d.DB.Collection("users")
+// InsertUserReturning 插入用戶資料並回傳新用戶（與插入在同一個交易中讀取）
+func (d *Database) InsertUserReturning(name, email string, age int) (map[string]interface{}, error) {
+	return d.insertUser(withOperation(context.Background(), "InsertUserReturning"), name, email, age)
+}
 
-	user := bson.M{
-		"name":       name,
-		"email":      email,
-		"age":        age,
-		"created_at": time.Now(),
+// insertUser InsertUser 與 InsertUserReturning 共用的實作
+func (d *Database) insertUser(ctx context.Context, name, email string, age int) (map[string]interface{}, error) {
+	if err := validateUser(name, email, age); err != nil {
+		return nil, err
 	}
 
-	_, err := collection.InsertOne(ctx, user)
-	if err != nil {
-		if mongo.IsDuplicateKeyError(err) {
-			return fmt.Errorf("email already exists")
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var user map[string]interface{}
+	err := d.WithTx(ctx, func(tx Repo) error {
+		id, err := tx.InsertUser(name, email, age)
+		if err != nil {
+			return err
 		}
-		return fmt.Errorf("failed to insert user: %w", err)
+		user, err = tx.GetUserByID(id)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-
-	return nil
+	return user, nil
 }
 
 // GetAllUsers 獲取所有用戶
 func (d *Database) GetAllUsers() ([]map[string]interface{}, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(withOperation(context.Background(), "GetAllUsers"), 10*time.Second)
 	defer cancel()
 
-	collection := d.DB.Collection("users")
+	collection, err := d.collection("users")
+	if err != nil {
+		return nil, err
+	}
 
 	// 按創建時間降序排序
 	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
-	cursor, err := collection.Find(ctx, bson.M{}, opts)
+	cursor, err := collection.Find(ctx, bson.M{"deleted_at": nil}, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query users: %w", err)
 	}
@@ -297,18 +460,9 @@ func (d *Database) GetAllUsers() ([]map[string]interface{}, error) {
 		return nil, fmt.Errorf("failed to decode users: %w", err)
 	}
 
-	// 轉換 ObjectID 為字串
+	// 轉換 ObjectID 與時間欄位為字串
 	for i := range users {
-		if id, ok := users[i]["_id"].(primitive.ObjectID); ok {
-			users[i]["id"] = id.Hex()
-			delete(users[i], "_id")
-		}
-		// 轉換時間為字串
-		if createdAt, ok := users[i]["created_at"].(primitive.DateTime); ok {
-			users[i]["created_at"] = createdAt.Time().Format(time.RFC3339)
-		} else if createdAt, ok := users[i]["created_at"].(time.Time); ok {
-			users[i]["created_at"] = createdAt.Format(time.RFC3339)
-		}
+		normalizeUserDoc(users[i])
 	}
 
 	return users, nil
@@ -316,112 +470,100 @@ func (d *Database) GetAllUsers() ([]map[string]interface{}, error) {
 
 // GetUserByID 根據 ID 獲取用戶
 func (d *Database) GetUserByID(id string) (map[string]interface{}, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(withOperation(context.Background(), "GetUserByID"), 5*time.Second)
 	defer cancel()
 
+	return d.getUserByID(ctx, id)
+}
+
+// getUserByID 以指定的 context 讀取未刪除的用戶（可為交易的 session context）
+func (d *Database) getUserByID(ctx context.Context, id string) (map[string]interface{}, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user ID: %w", err)
+		return nil, newValidationError("id", "invalid user ID")
 	}
 
-	collection := d.DB.Collection("users")
+	collection, err := d.collection("users")
+	if err != nil {
+		return nil, err
+	}
 	var user map[string]interface{}
 
-	err = collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
+	err = collection.FindOne(ctx, bson.M{"_id": objectID, "deleted_at": nil}).Decode(&user)
 	if err == mongo.ErrNoDocuments {
-		return nil, fmt.Errorf("user not found")
+		return nil, ErrNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to query user: %w", err)
 	}
 
-	// 轉換 ObjectID 為字串
-	if id, ok := user["_id"].(primitive.ObjectID); ok {
-		user["id"] = id.Hex()
-		delete(user, "_id")
-	}
-	// 轉換時間為字串
-	if createdAt, ok := user["created_at"].(primitive.DateTime); ok {
-		user["created_at"] = createdAt.Time().Format(time.RFC3339)
-	} else if createdAt, ok := user["created_at"].(time.Time); ok {
-		user["created_at"] = createdAt.Format(time.RFC3339)
-	}
-
-	return user, nil
+	return normalizeUserDoc(user), nil
 }
 
-// UpdateUser 更新用戶資料
-func (d *Database) UpdateUser(id string, name, email string, age int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// GetUserByEmail 以 email 讀取未刪除的用戶
+func (d *Database) GetUserByEmail(email string) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(withOperation(context.Background(), "GetUserByEmail"), 5*time.Second)
 	defer cancel()
 
-	objectID, err := primitive.ObjectIDFromHex(id)
+	collection, err := d.collection("users")
 	if err != nil {
-		return fmt.Errorf("invalid user ID: %w", err)
+		return nil, err
 	}
-
-	collection := d.DB.Collection("users")
-
-	update := bson.M{
-		"$set": bson.M{
-			"name":  name,
-			"email": email,
-			"age":   age,
-		},
+	var user map[string]interface{}
+	err = collection.FindOne(ctx, bson.M{"email": email, "deleted_at": nil}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
 	}
-
-	result, err := collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
 	if err != nil {
-		if mongo.IsDuplicateKeyError(err) {
-			return fmt.Errorf("email already exists")
-		}
-		return fmt.Errorf("failed to update user: %w", err)
+		return nil, fmt.Errorf("failed to query user: %w", err)
 	}
 
-	if result.MatchedCount == 0 {
-		return fmt.Errorf("user not found")
-	}
+	return normalizeUserDoc(user), nil
+}
 
-	return nil
+// UpdateUser 以樂觀鎖更新用戶資料，expectedVersion 與資料庫不符時回傳 ErrConflict
+func (d *Database) UpdateUser(id string, name, email string, age int, expectedVersion int64) error {
+	if err := validateUser(name, email, age); err != nil {
+		return err
+	}
+	_, err := d.patchUser(withOperation(context.Background(), "UpdateUser"), id,
+		UserPatch{Name: &name, Email: &email, Age: &age, Version: expectedVersion})
+	return err
 }
 
-// DeleteUser 刪除用戶
+// DeleteUser 刪除用戶；SoftDelete 開啟時只標記 deleted_at，可透過 RestoreUser 還原
 func (d *Database) DeleteUser(id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(withOperation(context.Background(), "DeleteUser"), 5*time.Second)
 	defer cancel()
 
-	objectID, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		return fmt.Errorf("invalid user ID: %w", err)
-	}
+	return d.WithTx(ctx, func(tx Repo) error {
+		return tx.DeleteUser(id)
+	})
+}
+
+// SearchUsers 搜尋用戶（支援分頁）
+func (d *Database) SearchUsers(keyword string, page, pageSize int) ([]map[string]interface{}, int, error) {
+	return d.filterUsers(withOperation(context.Background(), "SearchUsers"), UserFilter{Keyword: keyword}, page, pageSize)
+}
 
-	collection := d.DB.Collection("users")
+// FilterUsers 依結構化條件查詢用戶（支援分頁）
+func (d *Database) FilterUsers(filter UserFilter, page, pageSize int) ([]map[string]interface{}, int, error) {
+	return d.filterUsers(withOperation(context.Background(), "FilterUsers"), filter, page, pageSize)
+}
 
-	result, err := collection.DeleteOne(ctx, bson.M{"_id": objectID})
+// filterUsers SearchUsers 與 FilterUsers 共用的實作
+func (d *Database) filterUsers(ctx context.Context, filter UserFilter, page, pageSize int) ([]map[string]interface{}, int, error) {
+	searchFilter, err := buildUserFilter(filter)
 	if err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
-	}
-
-	if result.DeletedCount == 0 {
-		return fmt.Errorf("user not found")
+		return nil, 0, newValidationError("filter", err.Error())
 	}
 
-	return nil
-}
-
-// SearchUsers 搜尋用戶（支援分頁）
-func (d *Database) SearchUsers(keyword string, page, pageSize int) ([]map[string]interface{}, int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	collection := d.DB.Collection("users")
-
-	// 構建搜尋條件（支援姓名和電子郵件）
-	searchFilter := bson.M{
-		"$or": []bson.M{
-			{"name": bson.M{"$regex": keyword, "$options": "i"}},
-			{"email": bson.M{"$regex": keyword, "$options": "i"}},
-		},
+	collection, err := d.collection("users")
+	if err != nil {
+		return nil, 0, err
 	}
 
 	// 計算總數
@@ -450,18 +592,9 @@ func (d *Database) SearchUsers(keyword string, page, pageSize int) ([]map[string
 		return nil, 0, fmt.Errorf("failed to decode users: %w", err)
 	}
 
-	// 轉換 ObjectID 為字串
+	// 轉換 ObjectID 與時間欄位為字串
 	for i := range users {
-		if id, ok := users[i]["_id"].(primitive.ObjectID); ok {
-			users[i]["id"] = id.Hex()
-			delete(users[i], "_id")
-		}
-		// 轉換時間為字串
-		if createdAt, ok := users[i]["created_at"].(primitive.DateTime); ok {
-			users[i]["created_at"] = createdAt.Time().Format(time.RFC3339)
-		} else if createdAt, ok := users[i]["created_at"].(time.Time); ok {
-			users[i]["created_at"] = createdAt.Format(time.RFC3339)
-		}
+		normalizeUserDoc(users[i])
 	}
 
 	return users, int(total), nil
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestOperationsWithoutClient 無法建立 client 時（d.DB 為 nil）每個操作都應回傳 ErrUnavailable，而不是 panic
+func TestOperationsWithoutClient(t *testing.T) {
+	d := &Database{DBName: "test"}
+	const id = "65a000000000000000000001"
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"GetAllUsers", func() error { _, err := d.GetAllUsers(); return err }},
+		{"GetUserByID", func() error { _, err := d.GetUserByID(id); return err }},
+		{"GetUserByEmail", func() error { _, err := d.GetUserByEmail("alice@example.com"); return err }},
+		{"FilterUsers", func() error { _, _, err := d.FilterUsers(UserFilter{Keyword: "a"}, 1, 10); return err }},
+		{"GetDeletedUsers", func() error { _, err := d.GetDeletedUsers(); return err }},
+		{"PurgeDeleted", func() error { _, err := d.PurgeDeleted(0); return err }},
+		{"GetUserAudit", func() error { _, err := d.GetUserAudit(id); return err }},
+		{"GetMigrationHistory", func() error { _, err := d.GetMigrationHistory(10); return err }},
+		{"ListCollections", func() error { _, err := d.ListCollections(); return err }},
+		{"Backup", func() error { _, err := d.Backup(t.TempDir() + "/backup.bson"); return err }},
+		{"WithTx", func() error {
+			return d.WithTx(context.Background(), func(tx Repo) error { return nil })
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, ErrUnavailable) {
+				t.Fatalf("err = %v, want ErrUnavailable", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 領域錯誤：呼叫端可用 errors.Is 判斷，不需比對錯誤字串
+var (
+	ErrNotFound       = errors.New("user not found")
+	ErrDuplicateEmail = errors.New("email already exists")
+	ErrValidation     = errors.New("validation failed")
+	ErrConflict       = errors.New("user was modified by another operation")
+	ErrUnavailable    = errors.New("database unavailable")
+)
+
+// 回傳給前端的錯誤代碼
+const (
+	ErrCodeNotFound       = "not_found"
+	ErrCodeDuplicateEmail = "duplicate_email"
+	ErrCodeValidation     = "validation"
+	ErrCodeConflict       = "conflict"
+	ErrCodeUnavailable    = "unavailable"
+	ErrCodeInternal       = "internal"
+)
+
+// FieldError 單一欄位的驗證失敗原因
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError 彙整所有欄位的驗證錯誤，errors.Is(err, ErrValidation) 為 true
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// newValidationError 建立只含單一欄位的驗證錯誤
+func newValidationError(field, message string) *ValidationError {
+	return &ValidationError{Fields: []FieldError{{Field: field, Message: message}}}
+}
+
+// Add 加入一個欄位錯誤
+func (e *ValidationError) Add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+// Error 實作 error 介面
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		parts = append(parts, fmt.Sprintf("%s: %s", f.Field, f.Message))
+	}
+	return fmt.Sprintf("%s: %s", ErrValidation, strings.Join(parts, "; "))
+}
+
+// Unwrap 讓 errors.Is(err, ErrValidation) 成立
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+// ConflictError 樂觀鎖版本不符：呼叫端持有的版本已過期，需重新讀取後再更新
+type ConflictError struct {
+	Expected int64
+	Current  int64
+}
+
+// Error 實作 error 介面
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: expected version %d, current version %d", ErrConflict, e.Expected, e.Current)
+}
+
+// Unwrap 讓 errors.Is(err, ErrConflict) 成立
+func (e *ConflictError) Unwrap() error {
+	return ErrConflict
+}
+
+// ErrorPayload Wails 綁定回傳給前端的結構化錯誤
+type ErrorPayload struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// formatBindingError 作為 Wails 的 ErrorFormatter，將錯誤轉換為前端可判斷的結構
+func formatBindingError(err error) any {
+	payload := ErrorPayload{Code: ErrCodeInternal, Message: redactSecrets(err.Error())}
+
+	var validationErr *ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		payload.Code = ErrCodeValidation
+		payload.Fields = validationErr.Fields
+	case errors.Is(err, ErrNotFound):
+		payload.Code = ErrCodeNotFound
+	case errors.Is(err, ErrDuplicateEmail):
+		payload.Code = ErrCodeDuplicateEmail
+		payload.Fields = []FieldError{{Field: "email", Message: ErrDuplicateEmail.Error()}}
+	case errors.Is(err, ErrConflict):
+		payload.Code = ErrCodeConflict
+	case errors.Is(err, ErrUnavailable):
+		payload.Code = ErrCodeUnavailable
+	}
+
+	return payload
+}
@@ -2,30 +2,190 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function Backup(arg1) {
+  return window['go']['main']['App']['Backup'](arg1);
+}
+
+export function BrowseCollection(arg1, arg2) {
+  return window['go']['main']['App']['BrowseCollection'](arg1, arg2);
+}
+
+export function CheckSchema() {
+  return window['go']['main']['App']['CheckSchema']();
+}
+
+export function ClearQueryHistory() {
+  return window['go']['main']['App']['ClearQueryHistory']();
+}
+
 export function CreateUser(arg1, arg2, arg3) {
   return window['go']['main']['App']['CreateUser'](arg1, arg2, arg3);
 }
 
+export function CreateUserReturning(arg1, arg2, arg3) {
+  return window['go']['main']['App']['CreateUserReturning'](arg1, arg2, arg3);
+}
+
+export function DeleteConnectionProfile(arg1) {
+  return window['go']['main']['App']['DeleteConnectionProfile'](arg1);
+}
+
 export function DeleteUser(arg1) {
   return window['go']['main']['App']['DeleteUser'](arg1);
 }
 
+export function DescribeCollection(arg1) {
+  return window['go']['main']['App']['DescribeCollection'](arg1);
+}
+
+export function ExecuteQuery(arg1, arg2) {
+  return window['go']['main']['App']['ExecuteQuery'](arg1, arg2);
+}
+
+export function ExplainQuery(arg1, arg2) {
+  return window['go']['main']['App']['ExplainQuery'](arg1, arg2);
+}
+
+export function ExportUsers(arg1, arg2, arg3) {
+  return window['go']['main']['App']['ExportUsers'](arg1, arg2, arg3);
+}
+
+export function FilterUsers(arg1, arg2, arg3) {
+  return window['go']['main']['App']['FilterUsers'](arg1, arg2, arg3);
+}
+
+export function ForceMigrationVersion(arg1) {
+  return window['go']['main']['App']['ForceMigrationVersion'](arg1);
+}
+
 export function GetAllUsers() {
   return window['go']['main']['App']['GetAllUsers']();
 }
 
+export function GetConnectionState() {
+  return window['go']['main']['App']['GetConnectionState']();
+}
+
+export function GetDeletedUsers() {
+  return window['go']['main']['App']['GetDeletedUsers']();
+}
+
+export function GetEffectiveConfig() {
+  return window['go']['main']['App']['GetEffectiveConfig']();
+}
+
+export function GetMigrationHistory(arg1) {
+  return window['go']['main']['App']['GetMigrationHistory'](arg1);
+}
+
+export function GetMigrationStatus() {
+  return window['go']['main']['App']['GetMigrationStatus']();
+}
+
+export function GetQueryHistory(arg1) {
+  return window['go']['main']['App']['GetQueryHistory'](arg1);
+}
+
+export function GetQueryMetrics() {
+  return window['go']['main']['App']['GetQueryMetrics']();
+}
+
+export function GetQueryWriteMode() {
+  return window['go']['main']['App']['GetQueryWriteMode']();
+}
+
+export function GetRecentLogs(arg1, arg2) {
+  return window['go']['main']['App']['GetRecentLogs'](arg1, arg2);
+}
+
 export function GetUser(arg1) {
   return window['go']['main']['App']['GetUser'](arg1);
 }
 
+export function GetUserAudit(arg1) {
+  return window['go']['main']['App']['GetUserAudit'](arg1);
+}
+
 export function Greet(arg1) {
   return window['go']['main']['App']['Greet'](arg1);
 }
 
+export function ImportUsers(arg1, arg2, arg3) {
+  return window['go']['main']['App']['ImportUsers'](arg1, arg2, arg3);
+}
+
+export function ListCollections() {
+  return window['go']['main']['App']['ListCollections']();
+}
+
+export function ListConnectionProfiles() {
+  return window['go']['main']['App']['ListConnectionProfiles']();
+}
+
+export function MigrateSteps(arg1, arg2) {
+  return window['go']['main']['App']['MigrateSteps'](arg1, arg2);
+}
+
+export function MigrateTo(arg1, arg2) {
+  return window['go']['main']['App']['MigrateTo'](arg1, arg2);
+}
+
+export function PatchUser(arg1, arg2) {
+  return window['go']['main']['App']['PatchUser'](arg1, arg2);
+}
+
+export function PreviewImport(arg1, arg2, arg3) {
+  return window['go']['main']['App']['PreviewImport'](arg1, arg2, arg3);
+}
+
+export function PurgeDeleted(arg1) {
+  return window['go']['main']['App']['PurgeDeleted'](arg1);
+}
+
+export function Reconnect() {
+  return window['go']['main']['App']['Reconnect']();
+}
+
+export function RedoMigration(arg1) {
+  return window['go']['main']['App']['RedoMigration'](arg1);
+}
+
+export function Restore(arg1) {
+  return window['go']['main']['App']['Restore'](arg1);
+}
+
+export function RestoreUser(arg1) {
+  return window['go']['main']['App']['RestoreUser'](arg1);
+}
+
+export function RestoreUserReturning(arg1) {
+  return window['go']['main']['App']['RestoreUserReturning'](arg1);
+}
+
+export function SaveConnectionProfile(arg1) {
+  return window['go']['main']['App']['SaveConnectionProfile'](arg1);
+}
+
 export function SearchUsers(arg1, arg2, arg3) {
   return window['go']['main']['App']['SearchUsers'](arg1, arg2, arg3);
 }
 
-export function UpdateUser(arg1, arg2, arg3, arg4) {
-  return window['go']['main']['App']['UpdateUser'](arg1, arg2, arg3, arg4);
+export function SetActor(arg1) {
+  return window['go']['main']['App']['SetActor'](arg1);
+}
+
+export function SetQueryWriteMode(arg1) {
+  return window['go']['main']['App']['SetQueryWriteMode'](arg1);
+}
+
+export function SwitchConnection(arg1) {
+  return window['go']['main']['App']['SwitchConnection'](arg1);
+}
+
+export function TestConnection(arg1) {
+  return window['go']['main']['App']['TestConnection'](arg1);
+}
+
+export function UpdateUser(arg1, arg2, arg3, arg4, arg5) {
+  return window['go']['main']['App']['UpdateUser'](arg1, arg2, arg3, arg4, arg5);
 }
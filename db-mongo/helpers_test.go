@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// loadTestConfig 以暫存目錄中的檔案載入設定並設為目前的設定；flags 為額外的命令列旗標
+func loadTestConfig(t *testing.T, flags ...string) *Config {
+	t.Helper()
+	dir := t.TempDir()
+	args := append([]string{
+		"--db-backup-dir", filepath.Join(dir, "backups"),
+		"--db-query-history-file", filepath.Join(dir, "query_history.jsonl"),
+		"--db-profiles-file", filepath.Join(dir, "connection_profiles.json"),
+		"--log-file", "",
+		"--log-stdout=false",
+	}, flags...)
+	cfg, _, err := LoadConfig(args)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	previous := appConfig()
+	setConfig(cfg)
+	t.Cleanup(func() { setConfig(previous) })
+	discardLogs(t)
+	return cfg
+}
+
+// discardLogs 測試期間把共用 logger 的輸出丟到 io.Discard，測試結束時還原
+func discardLogs(t *testing.T) {
+	t.Helper()
+	logger := slog.New(&appHandler{outputs: []slog.Handler{slog.NewTextHandler(io.Discard, nil)}})
+	loggerMu.Lock()
+	previous := appLogger
+	appLogger = logger
+	loggerMu.Unlock()
+	previousDefault := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() {
+		loggerMu.Lock()
+		appLogger = previous
+		loggerMu.Unlock()
+		slog.SetDefault(previousDefault)
+	})
+}
+
+// newMockDatabase 建立連到 mtest 模擬部署的 Database；模擬部署依序回傳 AddMockResponses 加入的回應
+func newMockDatabase(mt *mtest.T) *Database {
+	return &Database{DBName: "test", Client: mt.Client, DB: mt.Client.Database("test"), actor: "tester"}
+}
+
+// startedCommands 依序回傳送出的命令名稱與命令內容
+func startedCommands(mt *mtest.T) ([]string, []bson.Raw) {
+	var names []string
+	var commands []bson.Raw
+	for _, evt := range mt.GetAllStartedEvents() {
+		names = append(names, evt.CommandName)
+		commands = append(commands, evt.Command)
+	}
+	return names, commands
+}
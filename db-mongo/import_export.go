@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ImportUsers 從 CSV / JSON / NDJSON 檔案批次匯入用戶
+// 每批次以 BulkWrite 寫入；dryRun 為 true 時只回報預估結果，不寫入任何資料
+func (d *Database) ImportUsers(path, format, mode string, dryRun bool) (*ImportReport, error) {
+	start := time.Now()
+	format, err := resolveFormat(path, format)
+	if err != nil {
+		return nil, err
+	}
+	mode, err = resolveImportMode(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	// fail 模式先完整預檢一次，有任何一列會失敗就不開始寫入
+	if mode == ImportModeFail && !dryRun {
+		preview, err := d.ImportUsers(path, format, mode, true)
+		if err != nil {
+			return preview, err
+		}
+		if preview.Failed > 0 {
+			return preview, fmt.Errorf("import aborted: %d row(s) would fail, no changes were applied", preview.Failed)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(withOperation(context.Background(), "ImportUsers"), 10*time.Minute)
+	defer cancel()
+
+	report := &ImportReport{Format: format, Mode: mode, DryRun: dryRun, Errors: []ImportRowError{}}
+	seen := make(map[string]bool)
+	batch := make([]importRecord, 0, importBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := d.importUserBatch(ctx, batch, mode, dryRun, seen, report)
+		batch = batch[:0]
+		return err
+	}
+
+	err = readImportFile(path, format, func(rec importRecord) error {
+		report.Total++
+		batch = append(batch, rec)
+		if len(batch) >= importBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return report, err
+	}
+
+	if !dryRun {
+		logOperation("import_export", "import", start, nil, "Imported users", "path", path,
+			"inserted", report.Inserted, "updated", report.Updated, "skipped", report.Skipped, "failed", report.Failed)
+	}
+	return report, nil
+}
+
+// importUserBatch 驗證一批資料、判斷 email 衝突並寫入（dryRun 時只計數），每筆異動都會寫入稽核紀錄
+func (d *Database) importUserBatch(ctx context.Context, batch []importRecord, mode string, dryRun bool, seen map[string]bool, report *ImportReport) error {
+	collection, err := d.collection("users")
+	if err != nil {
+		return err
+	}
+	valid := make([]importRecord, 0, len(batch))
+	for _, rec := range batch {
+		if rec.Err != nil {
+			report.addError(rec, rec.Err)
+			continue
+		}
+		if err := validateUser(rec.Name, rec.Email, rec.Age); err != nil {
+			report.addError(rec, err)
+			continue
+		}
+		valid = append(valid, rec)
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+
+	existing, err := existingEmails(ctx, collection, valid)
+	if err != nil {
+		return err
+	}
+
+	var models []mongo.WriteModel
+	var insertedDocs []bson.M
+	var updatedEmails []string
+	var updateModels []int // updatedEmails 中每次更新在 models 中的位置
+	now := time.Now()
+	for _, rec := range valid {
+		if !existing[rec.Email] && !seen[rec.Email] {
+			seen[rec.Email] = true
+			doc := bson.M{
+				"_id":        primitive.NewObjectID(),
+				"name":       rec.Name,
+				"email":      rec.Email,
+				"age":        rec.Age,
+				"created_at": now,
+				"updated_at": now,
+				"deleted_at": nil,
+				"version":    1,
+			}
+			models = append(models, mongo.NewInsertOneModel().SetDocument(doc))
+			insertedDocs = append(insertedDocs, doc)
+			continue
+		}
+		switch mode {
+		case ImportModeUpsert:
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"email": rec.Email, "deleted_at": nil}).
+				SetUpdate(bson.M{
+					"$set": bson.M{"name": rec.Name, "age": rec.Age, "updated_at": now},
+					"$inc": bson.M{"version": 1},
+				}))
+			updatedEmails = append(updatedEmails, rec.Email)
+			updateModels = append(updateModels, len(models)-1)
+		case ImportModeSkip:
+			report.Skipped++
+		default:
+			report.addError(rec, ErrDuplicateEmail)
+		}
+	}
+
+	if !dryRun && len(models) > 0 {
+		if err := d.writeImportModels(ctx, collection, batch, models, insertedDocs, updatedEmails, updateModels); err != nil {
+			return err
+		}
+	}
+	report.Inserted += len(insertedDocs)
+	report.Updated += len(updatedEmails)
+	return nil
+}
+
+// writeImportModels 依序寫入一批插入與更新，並為每筆插入與每次更新各寫入一筆稽核紀錄。更新前後的快照各以一次查詢讀取；
+// 同一個 email 在批次中更新多次時，在除了最後一次之外的更新後分段寫入並立即讀取快照，作為該次的更新後與下一次的更新前快照
+func (d *Database) writeImportModels(ctx context.Context, collection *mongo.Collection, batch []importRecord, models []mongo.WriteModel,
+	insertedDocs []bson.M, updatedEmails []string, updateModels []int) error {
+	write := func(models []mongo.WriteModel) error {
+		if len(models) == 0 {
+			return nil
+		}
+		// ordered 寫入確保同一批次中先插入、後更新的順序
+		if _, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(true)); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				err = ErrDuplicateEmail
+			}
+			return fmt.Errorf("failed to import batch (lines %d-%d): %w", batch[0].Line, batch[len(batch)-1].Line, err)
+		}
+		return nil
+	}
+
+	emails := uniqueEmails(updatedEmails)
+	current, err := d.snapshotsByEmail(ctx, emails)
+	if err != nil {
+		return err
+	}
+	last := make(map[string]int, len(emails))
+	for i, email := range updatedEmails {
+		last[email] = i
+	}
+
+	before := make([]bson.M, len(updatedEmails))
+	after := make([]bson.M, len(updatedEmails))
+	start := 0
+	for i, email := range updatedEmails {
+		before[i] = current[email]
+		if last[email] == i {
+			continue
+		}
+		end := updateModels[i] + 1
+		if err := write(models[start:end]); err != nil {
+			return err
+		}
+		start = end
+		snapshots, err := d.snapshotsByEmail(ctx, []string{email})
+		if err != nil {
+			return err
+		}
+		after[i] = snapshots[email]
+		current[email] = snapshots[email]
+	}
+	if err := write(models[start:]); err != nil {
+		return err
+	}
+
+	for _, doc := range insertedDocs {
+		if err := d.recordUserChange(ctx, doc["_id"].(primitive.ObjectID), AuditActionInsert, nil, doc); err != nil {
+			return err
+		}
+	}
+	final, err := d.snapshotsByEmail(ctx, emails)
+	if err != nil {
+		return err
+	}
+	for i, email := range updatedEmails {
+		doc := after[i]
+		if last[email] == i {
+			doc = final[email]
+		}
+		if doc == nil {
+			continue
+		}
+		if err := d.recordUserChange(ctx, doc["_id"].(primitive.ObjectID), AuditActionUpdate, before[i], doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uniqueEmails 回傳不重複的 email，保留第一次出現的順序
+func uniqueEmails(emails []string) []string {
+	unique := make([]string, 0, len(emails))
+	seen := make(map[string]bool, len(emails))
+	for _, email := range emails {
+		if !seen[email] {
+			seen[email] = true
+			unique = append(unique, email)
+		}
+	}
+	return unique
+}
+
+// snapshotsByEmail 以 email 讀取未刪除用戶的完整快照，供 upsert 寫入稽核紀錄
+func (d *Database) snapshotsByEmail(ctx context.Context, emails []string) (map[string]bson.M, error) {
+	snapshots := make(map[string]bson.M, len(emails))
+	if len(emails) == 0 {
+		return snapshots, nil
+	}
+	collection, err := d.collection("users")
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Find(ctx, bson.M{"email": bson.M{"$in": emails}, "deleted_at": nil})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode user: %w", err)
+		}
+		if email, ok := doc["email"].(string); ok {
+			snapshots[email] = doc
+		}
+	}
+	return snapshots, cursor.Err()
+}
+
+// existingEmails 查詢這批資料中哪些 email 已被未刪除的用戶使用；只屬於已軟刪除用戶的 email 可以再次使用
+func existingEmails(ctx context.Context, collection *mongo.Collection, records []importRecord) (map[string]bool, error) {
+	emails := make([]string, 0, len(records))
+	for _, rec := range records {
+		emails = append(emails, rec.Email)
+	}
+
+	opts := options.Find().SetProjection(bson.M{"email": 1})
+	cursor, err := collection.Find(ctx, bson.M{"email": bson.M{"$in": emails}, "deleted_at": nil}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing emails: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	existing := make(map[string]bool)
+	for cursor.Next(ctx) {
+		var doc struct {
+			Email string `bson:"email"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode email: %w", err)
+		}
+		existing[doc.Email] = true
+	}
+	return existing, cursor.Err()
+}
+
+// ExportUsers 將符合條件的用戶以游標逐筆寫出到檔案，不會一次載入整個集合
+func (d *Database) ExportUsers(filter UserFilter, format, path string) (*ExportReport, error) {
+	start := time.Now()
+	format, err := resolveFormat(path, format)
+	if err != nil {
+		return nil, err
+	}
+	searchFilter, err := buildUserFilter(filter)
+	if err != nil {
+		return nil, newValidationError("filter", err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(withOperation(context.Background(), "ExportUsers"), 10*time.Minute)
+	defer cancel()
+
+	collection, err := d.collection("users")
+	if err != nil {
+		return nil, err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := collection.Find(ctx, searchFilter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	out, err := createExportFile(path, format)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ExportReport{Path: path, Format: format}
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID        primitive.ObjectID `bson:"_id"`
+			Name      string             `bson:"name"`
+			Email     string             `bson:"email"`
+			Age       int                `bson:"age"`
+			CreatedAt time.Time          `bson:"created_at"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			out.Abort()
+			return nil, fmt.Errorf("failed to decode user: %w", err)
+		}
+		rec := exportRecord{
+			ID:        doc.ID.Hex(),
+			Name:      doc.Name,
+			Email:     doc.Email,
+			Age:       doc.Age,
+			CreatedAt: formatExportTime(doc.CreatedAt),
+		}
+		if err := out.Write(rec); err != nil {
+			out.Abort()
+			return nil, fmt.Errorf("failed to write export file: %w", err)
+		}
+		report.Count++
+	}
+	if err := cursor.Err(); err != nil {
+		out.Abort()
+		return nil, fmt.Errorf("failed to read users: %w", err)
+	}
+	if err := out.Commit(); err != nil {
+		return nil, err
+	}
+
+	logOperation("import_export", "export", start, nil, "Exported users", "path", path, "format", format, "count", report.Count)
+	return report, nil
+}
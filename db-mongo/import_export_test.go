@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// TestImportUpsertAuditsEveryUpdate 同一個 email 在批次中更新兩次時，應寫入兩筆前後相接的稽核紀錄
+func TestImportUpsertAuditsEveryUpdate(t *testing.T) {
+	loadTestConfig(t)
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("upsert", func(mt *mtest.T) {
+		d := newMockDatabase(mt)
+		bobID := primitive.NewObjectID()
+		bob := func(name string, version int32) bson.D {
+			return bson.D{{Key: "_id", Value: bobID}, {Key: "name", Value: name}, {Key: "email", Value: "bob@example.com"}, {Key: "version", Value: version}}
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.users", mtest.FirstBatch, bson.D{{Key: "email", Value: "bob@example.com"}}),
+			mtest.CreateCursorResponse(0, "test.users", mtest.FirstBatch, bob("Bob", 1)),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCursorResponse(0, "test.users", mtest.FirstBatch, bob("Bob 2", 2)),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCursorResponse(0, "test.users", mtest.FirstBatch, bob("Bob 3", 3)),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+
+		batch := []importRecord{
+			{Line: 1, Name: "Bob 2", Email: "bob@example.com", Age: 41},
+			{Line: 2, Name: "Bob 3", Email: "bob@example.com", Age: 42},
+		}
+		report := &ImportReport{}
+		if err := d.importUserBatch(context.Background(), batch, ImportModeUpsert, false, map[string]bool{}, report); err != nil {
+			mt.Fatalf("importUserBatch: %v", err)
+		}
+		if report.Updated != 2 {
+			mt.Fatalf("report = %+v, want 2 updated", report)
+		}
+
+		names, commands := startedCommands(mt)
+		var audits [][2]string
+		for i, name := range names {
+			if name != "insert" || commands[i].Lookup("insert").StringValue() != "user_audit" {
+				continue
+			}
+			entry := commands[i].Lookup("documents").Array().Index(0).Value().Document()
+			audits = append(audits, [2]string{
+				entry.Lookup("before", "name").StringValue(),
+				entry.Lookup("after", "name").StringValue(),
+			})
+		}
+		want := [][2]string{{"Bob", "Bob 2"}, {"Bob 2", "Bob 3"}}
+		if len(audits) != len(want) || audits[0] != want[0] || audits[1] != want[1] {
+			mt.Fatalf("audit before/after = %v, want %v (commands %v)", audits, want, names)
+		}
+	})
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const migrateUsage = `Usage: <app> [config flags] migrate <command> [--dry-run] [--yes]
+
+Commands:
+  status         show current version and applied / pending migrations
+  up [N]         apply all pending migrations, or the next N
+  down [N]       roll back the last N migrations (default 1)
+  goto V         migrate up or down to version V (0 rolls back everything)
+  redo           roll back the current migration and apply it again
+  history [N]    show the last N migration runs (default 20)
+  force V        mark version V as applied and clear the dirty flag
+                 without running anything
+  check [FILE]   compare the live schema with the migrations applied to a
+                 scratch database; writes a JSON diff to FILE (or stdout),
+                 exit code 3 on drift
+  backup [FILE]  back up the whole database to FILE
+                 (default: a timestamped file in DB_BACKUP_DIR)
+  restore FILE   replace the whole database with the contents of a backup
+
+Flags:
+  --dry-run      print the operations that would run without executing them
+  --yes, -y      skip the confirmation prompt`
+
+// runMigrateCommand 處理 `migrate` 子命令（不啟動視窗），回傳程式結束代碼
+func runMigrateCommand(args []string) int {
+	var (
+		positional []string
+		dryRun     bool
+		yes        bool
+	)
+	for _, arg := range args {
+		switch arg {
+		case "--dry-run":
+			dryRun = true
+		case "--yes", "-y":
+			yes = true
+		case "-h", "--help", "help":
+			fmt.Println(migrateUsage)
+			return 0
+		default:
+			if strings.HasPrefix(arg, "-") {
+				fmt.Fprintf(os.Stderr, "unknown flag %q\n\n%s\n", arg, migrateUsage)
+				return 2
+			}
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	d := newDatabaseFromEnv()
+	if err := d.Connect(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer d.Disconnect()
+	command, rest := positional[0], positional[1:]
+
+	if command == "status" {
+		status, err := d.GetMigrationStatus()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		printMigrationStatus(status)
+		return 0
+	}
+
+	if command == "check" {
+		return runCheckCommand(d, rest)
+	}
+	if command == "backup" {
+		return runBackupCommand(d, rest)
+	}
+	if command == "restore" {
+		return runRestoreCommand(d, rest, yes)
+	}
+	if command == "history" {
+		return runHistoryCommand(d, rest)
+	}
+	if command == "force" {
+		return runForceCommand(d, rest, yes)
+	}
+
+	run, err := migrateCommandFunc(d, command, rest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n%s\n", err, migrateUsage)
+		return 2
+	}
+
+	// 先以 dry run 列出計畫與操作，確認後才實際執行
+	plan, err := run(true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if len(plan.Steps) == 0 {
+		fmt.Println("Nothing to migrate")
+		return 0
+	}
+	if dryRun {
+		return 0
+	}
+	if !yes && !confirm(fmt.Sprintf("Apply %d step(s) from version %d to %d?", len(plan.Steps), plan.FromVersion, plan.ToVersion)) {
+		fmt.Println("Aborted")
+		return 1
+	}
+
+	if _, err := run(false); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// migrateCommandFunc 將子命令轉換為可重複呼叫的遷移函式（dry run 與實際執行共用）
+func migrateCommandFunc(d *Database, command string, args []string) (func(dryRun bool) (*MigrationPlan, error), error) {
+	arg := func(def int) (int, error) {
+		if len(args) == 0 {
+			return def, nil
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number %q", args[0])
+		}
+		return n, nil
+	}
+
+	switch command {
+	case "up":
+		n, err := arg(0)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return func(dryRun bool) (*MigrationPlan, error) {
+				status, err := d.GetMigrationStatus()
+				if err != nil {
+					return nil, err
+				}
+				return d.MigrateTo(status.LatestVersion, dryRun)
+			}, nil
+		}
+		return func(dryRun bool) (*MigrationPlan, error) { return d.MigrateSteps(n, dryRun) }, nil
+	case "down":
+		n, err := arg(1)
+		if err != nil {
+			return nil, err
+		}
+		return func(dryRun bool) (*MigrationPlan, error) { return d.MigrateSteps(-n, dryRun) }, nil
+	case "goto":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("goto requires a target version")
+		}
+		v, err := arg(0)
+		if err != nil {
+			return nil, err
+		}
+		return func(dryRun bool) (*MigrationPlan, error) { return d.MigrateTo(uint(v), dryRun) }, nil
+	case "redo":
+		return d.RedoMigration, nil
+	}
+	return nil, fmt.Errorf("unknown command %q", command)
+}
+
+// printMigrationStatus 輸出目前版本與每個遷移檔案的狀態
+func printMigrationStatus(status *MigrationStatus) {
+	fmt.Printf("Current version: %d (dirty: %t)\n", status.CurrentVersion, status.Dirty)
+	fmt.Printf("Latest version:  %d\n", status.LatestVersion)
+	if status.Ahead {
+		fmt.Println("Warning: database version is newer than the latest migration")
+	}
+	for _, info := range status.Applied {
+		if info.Modified {
+			fmt.Printf("  [applied] %d_%s (%s) MODIFIED since applied\n", info.Version, info.Name, info.Source)
+			continue
+		}
+		fmt.Printf("  [applied] %d_%s (%s)\n", info.Version, info.Name, info.Source)
+	}
+	for _, info := range status.Pending {
+		fmt.Printf("  [pending] %d_%s (%s)\n", info.Version, info.Name, info.Source)
+	}
+}
+
+// runHistoryCommand 輸出最近的遷移執行紀錄
+func runHistoryCommand(d *Database, args []string) int {
+	limit := 20
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid number %q\n", args[0])
+			return 2
+		}
+		limit = n
+	}
+
+	entries, err := d.GetMigrationHistory(limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if len(entries) == 0 {
+		fmt.Println("No migration history")
+		return 0
+	}
+	for _, entry := range entries {
+		result := "ok"
+		if !entry.Success {
+			result = "FAILED: " + entry.Error
+		}
+		fmt.Printf("  %s  %-8s %d_%s  %dms  %s  %s\n", entry.AppliedAt, entry.Direction, entry.Version, entry.Name, entry.DurationMs, entry.Actor, result)
+	}
+	return 0
+}
+
+// runForceCommand 確認後將版本標記為指定值並清除 dirty 標記
+func runForceCommand(d *Database, args []string, yes bool) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: force requires a version")
+		return 2
+	}
+	version, err := strconv.Atoi(args[0])
+	if err != nil || version < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid version %q\n", args[0])
+		return 2
+	}
+	if !yes && !confirm(fmt.Sprintf("Mark version %d as applied without running any migration?", version)) {
+		fmt.Println("Aborted")
+		return 1
+	}
+
+	if err := d.ForceMigrationVersion(uint(version)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Database is now at version %d\n", version)
+	return 0
+}
+
+// runCheckCommand 輸出 JSON 格式的 schema 比對結果（指定檔案時寫入檔案，避免與日誌混在一起）；
+// 有差異時回傳 3，方便在 CI 中判斷
+func runCheckCommand(d *Database, args []string) int {
+	report, err := d.CheckSchema()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if len(args) > 0 {
+		if err := os.WriteFile(args[0], append(out, '\n'), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Schema check: %d difference(s), report written to %s\n", len(report.Differences), args[0])
+	} else {
+		fmt.Println(string(out))
+	}
+	if !report.InSync {
+		return 3
+	}
+	return 0
+}
+
+// runBackupCommand 備份資料庫，未指定檔案時寫入 DB_BACKUP_DIR
+func runBackupCommand(d *Database, args []string) int {
+	path := ""
+	if len(args) > 0 {
+		path = args[0]
+	}
+	info, err := d.Backup(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Backup written to %s\n", info.Path)
+	printBackupInfo(info)
+	return 0
+}
+
+// runRestoreCommand 確認後以備份檔取代目前的資料庫
+func runRestoreCommand(d *Database, args []string, yes bool) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: restore requires a backup file")
+		return 2
+	}
+	if !yes && !confirm(fmt.Sprintf("Replace the current database with %s?", args[0])) {
+		fmt.Println("Aborted")
+		return 1
+	}
+	info, err := d.Restore(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Restored from %s\n", info.Path)
+	printBackupInfo(info)
+	return 0
+}
+
+// printBackupInfo 輸出備份的格式、schema 版本與每個集合的筆數
+func printBackupInfo(info *BackupInfo) {
+	fmt.Printf("Format: %s, schema version: %d (dirty: %t), size: %d bytes, took %dms\n",
+		info.Format, info.SchemaVersion, info.Dirty, info.Size, info.DurationMs)
+	for _, t := range info.Collections {
+		fmt.Printf("  %-28s %d\n", t.Name, t.Documents)
+	}
+}
+
+// confirm 在終端機詢問是否繼續，只有輸入 y / yes 才回傳 true
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
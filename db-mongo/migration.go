@@ -0,0 +1,957 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// embeddedMigrations 編譯時嵌入的宣告式遷移檔案
+//
+//go:embed _assets/db/migration/*.json
+var embeddedMigrations embed.FS
+
+// embeddedMigrationDir 嵌入檔案中遷移檔案所在的目錄
+const embeddedMigrationDir = "_assets/db/migration"
+
+// 遷移狀態與歷史紀錄使用的集合
+const (
+	migrationStateCollection   = "schema_migrations"
+	migrationHistoryCollection = "migration_history"
+	legacyMigrationCollection  = "migrations"
+	migrationStateID           = "state"
+)
+
+// migrationStepTimeout 單一遷移步驟的逾時（回填大量資料可能較久）
+const migrationStepTimeout = 5 * time.Minute
+
+// 遷移方向；歷史紀錄另有 force（手動標記版本）與 baseline（由舊版紀錄轉換）
+const (
+	MigrationDirectionUp       = "up"
+	MigrationDirectionDown     = "down"
+	MigrationDirectionForce    = "force"
+	MigrationDirectionBaseline = "baseline"
+)
+
+// 宣告式遷移支援的操作
+const (
+	migrationOpCreateIndex      = "createIndex"
+	migrationOpDropIndex        = "dropIndex"
+	migrationOpRenameField      = "renameField"
+	migrationOpBackfill         = "backfill"
+	migrationOpUnsetField       = "unsetField"
+	migrationOpCreateCollection = "createCollection"
+	migrationOpDropCollection   = "dropCollection"
+)
+
+// migrationFileRe 遷移檔案名稱格式：<版本>_<名稱>.json
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(.+)\.json$`)
+
+// MigrationInfo 單一遷移的狀態；Modified 為 true 表示已套用後檔案內容又被修改
+type MigrationInfo struct {
+	Version         uint   `json:"version"`
+	Name            string `json:"name"`
+	Source          string `json:"source"`
+	Applied         bool   `json:"applied"`
+	HasDown         bool   `json:"hasDown"`
+	Checksum        string `json:"checksum"`
+	AppliedChecksum string `json:"appliedChecksum,omitempty"`
+	Modified        bool   `json:"modified"`
+}
+
+// MigrationStatus 資料庫目前的遷移狀態，CurrentVersion 為 0 表示尚未套用任何遷移
+// Ahead 為 true 表示資料庫版本比最新的遷移還新（遷移檔案缺漏）
+type MigrationStatus struct {
+	CurrentVersion uint            `json:"currentVersion"`
+	Dirty          bool            `json:"dirty"`
+	LatestVersion  uint            `json:"latestVersion"`
+	Ahead          bool            `json:"ahead"`
+	Applied        []MigrationInfo `json:"applied"`
+	Pending        []MigrationInfo `json:"pending"`
+}
+
+// MigrationStep 遷移計畫中的一個步驟，Operations 為將要執行的操作說明
+type MigrationStep struct {
+	Version    uint     `json:"version"`
+	Name       string   `json:"name"`
+	Direction  string   `json:"direction"`
+	Operations []string `json:"operations"`
+
+	migration *mongoMigration
+}
+
+// MigrationPlan 遷移計畫；DryRun 為 true 時只列出步驟，不會執行
+type MigrationPlan struct {
+	FromVersion uint            `json:"fromVersion"`
+	ToVersion   uint            `json:"toVersion"`
+	DryRun      bool            `json:"dryRun"`
+	Steps       []MigrationStep `json:"steps"`
+}
+
+// MigrationHistoryEntry 一筆遷移執行紀錄，失敗的步驟也會記錄錯誤訊息
+type MigrationHistoryEntry struct {
+	Version    uint   `json:"version"`
+	Name       string `json:"name"`
+	Direction  string `json:"direction"`
+	Checksum   string `json:"checksum"`
+	Success    bool   `json:"success"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+	Actor      string `json:"actor"`
+	AppliedAt  string `json:"appliedAt"`
+}
+
+// migrationHistoryRecord migration_history 集合中的文件
+type migrationHistoryRecord struct {
+	Version    int64     `bson:"version"`
+	Name       string    `bson:"name"`
+	Direction  string    `bson:"direction"`
+	Checksum   string    `bson:"checksum"`
+	Success    bool      `bson:"success"`
+	Error      string    `bson:"error,omitempty"`
+	DurationMs int64     `bson:"duration_ms"`
+	Actor      string    `bson:"actor"`
+	AppliedAt  time.Time `bson:"applied_at"`
+}
+
+// migrationState schema_migrations 集合中唯一的狀態文件，語意與 golang-migrate 相同：
+// 執行前先寫入目標版本並標記 dirty，成功後才清除
+type migrationState struct {
+	Version   int64     `bson:"version"`
+	Dirty     bool      `bson:"dirty"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// migrationOp 宣告式遷移中的一個操作
+type migrationOp struct {
+	Op         string   `bson:"op"`
+	Collection string   `bson:"collection"`
+	Name       string   `bson:"name,omitempty"`
+	Keys       bson.D   `bson:"keys,omitempty"`
+	Unique     bool     `bson:"unique,omitempty"`
+	Sparse     bool     `bson:"sparse,omitempty"`
+	Partial    bson.D   `bson:"partialFilter,omitempty"`
+	From       string   `bson:"from,omitempty"`
+	To         string   `bson:"to,omitempty"`
+	Filter     bson.D   `bson:"filter,omitempty"`
+	Set        bson.D   `bson:"set,omitempty"`
+	Pipeline   bool     `bson:"pipeline,omitempty"`
+	Fields     []string `bson:"fields,omitempty"`
+}
+
+// migrationFile 遷移檔案的內容
+type migrationFile struct {
+	Description string        `bson:"description,omitempty"`
+	Up          []migrationOp `bson:"up"`
+	Down        []migrationOp `bson:"down"`
+}
+
+// mongoMigration 一個可套用與回復的遷移，來源為宣告式檔案或 Go 函式
+type mongoMigration struct {
+	Version  uint
+	Name     string
+	Source   string
+	Checksum string
+
+	Up   []migrationOp
+	Down []migrationOp
+
+	UpFunc   func(context.Context) error
+	DownFunc func(context.Context) error
+}
+
+// hasDown 是否可以回復
+func (m *mongoMigration) hasDown() bool {
+	if m.UpFunc != nil {
+		return m.DownFunc != nil
+	}
+	return len(m.Down) > 0
+}
+
+// operations 回傳指定方向的操作說明，供計畫與日誌使用
+func (m *mongoMigration) operations(direction string) []string {
+	if m.UpFunc != nil {
+		return []string{fmt.Sprintf("go: %d_%s.%s", m.Version, m.Name, direction)}
+	}
+	ops := m.Up
+	if direction == MigrationDirectionDown {
+		ops = m.Down
+	}
+	descriptions := make([]string, 0, len(ops))
+	for _, op := range ops {
+		descriptions = append(descriptions, op.describe())
+	}
+	return descriptions
+}
+
+// run 執行指定方向的遷移
+func (m *mongoMigration) run(ctx context.Context, db *mongo.Database, direction string) error {
+	if m.UpFunc != nil {
+		if direction == MigrationDirectionDown {
+			return m.DownFunc(ctx)
+		}
+		return m.UpFunc(ctx)
+	}
+
+	ops := m.Up
+	if direction == MigrationDirectionDown {
+		ops = m.Down
+	}
+	for i, op := range ops {
+		if err := op.apply(ctx, db); err != nil {
+			return fmt.Errorf("operation %d (%s) failed: %w", i+1, op.describe(), err)
+		}
+	}
+	return nil
+}
+
+// validate 檢查操作的必要欄位，讓格式錯誤在載入時就被發現
+func (op migrationOp) validate() error {
+	if op.Collection == "" {
+		return fmt.Errorf("%s: collection is required", op.Op)
+	}
+	switch op.Op {
+	case migrationOpCreateIndex:
+		if len(op.Keys) == 0 {
+			return fmt.Errorf("%s: keys are required", op.Op)
+		}
+	case migrationOpDropIndex:
+		if op.Name == "" && len(op.Keys) == 0 {
+			return fmt.Errorf("%s: name or keys are required", op.Op)
+		}
+	case migrationOpRenameField:
+		if op.From == "" || op.To == "" {
+			return fmt.Errorf("%s: from and to are required", op.Op)
+		}
+	case migrationOpBackfill:
+		if len(op.Set) == 0 {
+			return fmt.Errorf("%s: set is required", op.Op)
+		}
+	case migrationOpUnsetField:
+		if len(op.Fields) == 0 {
+			return fmt.Errorf("%s: fields are required", op.Op)
+		}
+	case migrationOpCreateCollection, migrationOpDropCollection:
+	default:
+		return fmt.Errorf("unknown op %q", op.Op)
+	}
+	return nil
+}
+
+// indexName 回傳索引名稱；未指定時與 MongoDB 預設規則相同（欄位_方向 串接）
+func (op migrationOp) indexName() string {
+	if op.Name != "" {
+		return op.Name
+	}
+	parts := make([]string, 0, len(op.Keys)*2)
+	for _, key := range op.Keys {
+		parts = append(parts, key.Key, fmt.Sprint(key.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+// filter 回傳操作的篩選條件，未指定時為全部文件
+func (op migrationOp) filter() bson.D {
+	if op.Filter == nil {
+		return bson.D{}
+	}
+	return op.Filter
+}
+
+// describe 回傳操作的單行說明
+func (op migrationOp) describe() string {
+	switch op.Op {
+	case migrationOpCreateIndex:
+		desc := fmt.Sprintf("createIndex %s %s %s", op.Collection, op.indexName(), extJSON(op.Keys))
+		if op.Unique {
+			desc += " unique"
+		}
+		if op.Sparse {
+			desc += " sparse"
+		}
+		if op.Partial != nil {
+			desc += " partial=" + extJSON(op.Partial)
+		}
+		return desc
+	case migrationOpDropIndex:
+		return fmt.Sprintf("dropIndex %s %s", op.Collection, op.indexName())
+	case migrationOpRenameField:
+		return fmt.Sprintf("renameField %s %s -> %s", op.Collection, op.From, op.To)
+	case migrationOpBackfill:
+		desc := fmt.Sprintf("backfill %s filter=%s set=%s", op.Collection, extJSON(op.filter()), extJSON(op.Set))
+		if op.Pipeline {
+			desc += " (pipeline)"
+		}
+		return desc
+	case migrationOpUnsetField:
+		return fmt.Sprintf("unsetField %s %s", op.Collection, strings.Join(op.Fields, ", "))
+	}
+	return fmt.Sprintf("%s %s", op.Op, op.Collection)
+}
+
+// apply 執行單一操作；建立已存在的索引 / 集合、刪除不存在的索引都視為成功，讓重跑的遷移可以繼續
+func (op migrationOp) apply(ctx context.Context, db *mongo.Database) error {
+	collection := db.Collection(op.Collection)
+
+	switch op.Op {
+	case migrationOpCreateIndex:
+		opts := options.Index().SetName(op.indexName())
+		if op.Unique {
+			opts.SetUnique(true)
+		}
+		if op.Sparse {
+			opts.SetSparse(true)
+		}
+		if op.Partial != nil {
+			opts.SetPartialFilterExpression(op.Partial)
+		}
+		_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: op.Keys, Options: opts})
+		return err
+	case migrationOpDropIndex:
+		_, err := collection.Indexes().DropOne(ctx, op.indexName())
+		if isMongoErrorCode(err, 27) { // IndexNotFound
+			return nil
+		}
+		return err
+	case migrationOpRenameField:
+		filter := append(bson.D{{Key: op.From, Value: bson.M{"$exists": true}}}, op.filter()...)
+		_, err := collection.UpdateMany(ctx, filter, bson.M{"$rename": bson.M{op.From: op.To}})
+		return err
+	case migrationOpBackfill:
+		var update interface{} = bson.D{{Key: "$set", Value: op.Set}}
+		if op.Pipeline {
+			// pipeline 形式可在 set 中以 "$欄位" 參照文件自己的其他欄位
+			update = mongo.Pipeline{{{Key: "$set", Value: op.Set}}}
+		}
+		_, err := collection.UpdateMany(ctx, op.filter(), update)
+		return err
+	case migrationOpUnsetField:
+		unset := bson.M{}
+		for _, field := range op.Fields {
+			unset[field] = ""
+		}
+		_, err := collection.UpdateMany(ctx, op.filter(), bson.M{"$unset": unset})
+		return err
+	case migrationOpCreateCollection:
+		err := db.CreateCollection(ctx, op.Collection)
+		if isMongoErrorCode(err, 48) { // NamespaceExists
+			return nil
+		}
+		return err
+	case migrationOpDropCollection:
+		return collection.Drop(ctx)
+	}
+	return fmt.Errorf("unknown op %q", op.Op)
+}
+
+// isMongoErrorCode 判斷錯誤是否為指定的 MongoDB 錯誤代碼
+func isMongoErrorCode(err error, code int) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && int(cmdErr.Code) == code
+}
+
+// extJSON 將文件轉為 relaxed extended JSON，供日誌與計畫顯示
+func extJSON(doc interface{}) string {
+	data, err := bson.MarshalExtJSON(doc, false, false)
+	if err != nil {
+		return fmt.Sprint(doc)
+	}
+	return string(data)
+}
+
+// migrationChecksum 計算內容的 SHA-256
+func migrationChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// migrationFS 回傳遷移檔案來源與說明：設定 DB_MIGRATION_DIR 時使用外部目錄（緊急修補用），否則使用嵌入的檔案
+func migrationFS() (fs.FS, string, error) {
+	if dir := appConfig().MigrationDir; dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to open migration dir %s: %w", dir, err)
+		}
+		if !info.IsDir() {
+			return nil, "", fmt.Errorf("migration dir %s is not a directory", dir)
+		}
+		return os.DirFS(dir), dir, nil
+	}
+
+	sub, err := fs.Sub(embeddedMigrations, embeddedMigrationDir)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open embedded migrations: %w", err)
+	}
+	return sub, "embedded", nil
+}
+
+// loadMigrationFile 讀取並驗證單一宣告式遷移檔案
+func loadMigrationFile(fsys fs.FS, fileName string, version uint, name string) (*mongoMigration, error) {
+	data, err := fs.ReadFile(fsys, fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration %s: %w", fileName, err)
+	}
+
+	var file migrationFile
+	if err := bson.UnmarshalExtJSON(data, false, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse migration %s: %w", fileName, err)
+	}
+	if len(file.Up) == 0 {
+		return nil, fmt.Errorf("migration %s has no up operations", fileName)
+	}
+	for _, ops := range [][]migrationOp{file.Up, file.Down} {
+		for i, op := range ops {
+			if err := op.validate(); err != nil {
+				return nil, fmt.Errorf("migration %s operation %d: %w", fileName, i+1, err)
+			}
+		}
+	}
+
+	return &mongoMigration{
+		Version:  version,
+		Name:     name,
+		Source:   fileName,
+		Checksum: migrationChecksum(data),
+		Up:       file.Up,
+		Down:     file.Down,
+	}, nil
+}
+
+// migrationSet 所有的遷移（依版本遞增排序）
+type migrationSet struct {
+	migrations []*mongoMigration
+}
+
+// loadMigrationSet 合併遷移檔案與 goMigrations 中的 Go 遷移，版本重複時回傳錯誤
+func (d *Database) loadMigrationSet() (*migrationSet, error) {
+	fsys, _, err := migrationFS()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration source: %w", err)
+	}
+
+	set := &migrationSet{}
+	for _, entry := range entries {
+		match := migrationFileRe.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+		migration, err := loadMigrationFile(fsys, entry.Name(), uint(version), match[2])
+		if err != nil {
+			return nil, err
+		}
+		set.migrations = append(set.migrations, migration)
+	}
+	for _, migration := range d.goMigrations() {
+		migration.Source = "go"
+		migration.Checksum = migrationChecksum([]byte(fmt.Sprintf("go:%d_%s", migration.Version, migration.Name)))
+		set.migrations = append(set.migrations, migration)
+	}
+
+	sort.Slice(set.migrations, func(i, j int) bool { return set.migrations[i].Version < set.migrations[j].Version })
+	for i := 1; i < len(set.migrations); i++ {
+		if set.migrations[i].Version == set.migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d (%s, %s)",
+				set.migrations[i].Version, set.migrations[i-1].Source, set.migrations[i].Source)
+		}
+	}
+	return set, nil
+}
+
+// index 回傳版本在清單中的位置；版本 0 回傳 -1，不存在時回傳 -2
+func (s *migrationSet) index(version uint) int {
+	if version == 0 {
+		return -1
+	}
+	for i, migration := range s.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+	return -2
+}
+
+func (s *migrationSet) latest() uint {
+	if len(s.migrations) == 0 {
+		return 0
+	}
+	return s.migrations[len(s.migrations)-1].Version
+}
+
+// previous 回傳指定位置前一個版本，沒有時回傳 0
+func (s *migrationSet) previous(idx int) uint {
+	if idx <= 0 {
+		return 0
+	}
+	return s.migrations[idx-1].Version
+}
+
+// step 建立單一版本指定方向的步驟
+func (s *migrationSet) step(migration *mongoMigration, direction string) (MigrationStep, error) {
+	if direction == MigrationDirectionDown && !migration.hasDown() {
+		return MigrationStep{}, fmt.Errorf("migration %d (%s) has no down operations", migration.Version, migration.Name)
+	}
+	return MigrationStep{
+		Version:    migration.Version,
+		Name:       migration.Name,
+		Direction:  direction,
+		Operations: migration.operations(direction),
+		migration:  migration,
+	}, nil
+}
+
+// plan 計算從 from 遷移到 to 需要依序執行的步驟
+func (s *migrationSet) plan(from, to uint) (*MigrationPlan, error) {
+	fromIdx, toIdx := s.index(from), s.index(to)
+	if fromIdx == -2 {
+		return nil, fmt.Errorf("current version %d has no migration", from)
+	}
+	if toIdx == -2 {
+		return nil, newValidationError("target", fmt.Sprintf("version %d does not exist", to))
+	}
+
+	plan := &MigrationPlan{FromVersion: from, ToVersion: to, Steps: []MigrationStep{}}
+	for i := fromIdx + 1; i <= toIdx; i++ {
+		step, err := s.step(s.migrations[i], MigrationDirectionUp)
+		if err != nil {
+			return nil, err
+		}
+		plan.Steps = append(plan.Steps, step)
+	}
+	for i := fromIdx; i > toIdx; i-- {
+		step, err := s.step(s.migrations[i], MigrationDirectionDown)
+		if err != nil {
+			return nil, err
+		}
+		plan.Steps = append(plan.Steps, step)
+	}
+	return plan, nil
+}
+
+// readMigrationState 讀取目前版本；舊版單一文件的 migrations 集合會先轉換為新格式
+func (d *Database) readMigrationState(ctx context.Context, set *migrationSet) (uint, bool, error) {
+	collection, err := d.collection(migrationStateCollection)
+	if err != nil {
+		return 0, false, err
+	}
+	var state migrationState
+	err = collection.FindOne(ctx, bson.M{"_id": migrationStateID}).Decode(&state)
+	if err == nil {
+		return uint(state.Version), state.Dirty, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return 0, false, fmt.Errorf("failed to get current version: %w", err)
+	}
+
+	version, err := d.convertLegacyMigrations(ctx, set)
+	if err != nil {
+		return 0, false, err
+	}
+	return version, false, nil
+}
+
+// convertLegacyMigrations 將舊版 migrations 集合的版本寫入 schema_migrations，
+// 並為已套用的版本補上 baseline 歷史紀錄（以目前的 checksum 為基準）
+func (d *Database) convertLegacyMigrations(ctx context.Context, set *migrationSet) (uint, error) {
+	collection, err := d.collection(legacyMigrationCollection)
+	if err != nil {
+		return 0, err
+	}
+	var legacy MigrationVersion
+	err = collection.FindOne(ctx, bson.M{}).Decode(&legacy)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read legacy migration version: %w", err)
+	}
+
+	version := uint(legacy.Version)
+	for _, migration := range set.migrations {
+		if migration.Version > version {
+			break
+		}
+		d.recordMigration(ctx, migration.Version, migration.Name, MigrationDirectionBaseline, migration.Checksum, legacy.Applied, 0, nil)
+	}
+	if err := d.writeMigrationState(ctx, version, false); err != nil {
+		return 0, err
+	}
+	if err := collection.Drop(ctx); err != nil {
+		return 0, fmt.Errorf("failed to drop legacy migrations collection: %w", err)
+	}
+
+	logFor("migration").Info("Converted legacy migration record", "version", version, "collection", migrationStateCollection)
+	return version, nil
+}
+
+// writeMigrationState 寫入目前版本與 dirty 標記
+func (d *Database) writeMigrationState(ctx context.Context, version uint, dirty bool) error {
+	collection, err := d.collection(migrationStateCollection)
+	if err != nil {
+		return err
+	}
+	_, err = collection.UpdateOne(ctx,
+		bson.M{"_id": migrationStateID},
+		bson.M{"$set": bson.M{"version": int64(version), "dirty": dirty, "updated_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record migration version %d: %w", version, err)
+	}
+	return nil
+}
+
+// recordMigration 新增一筆歷史紀錄；寫入失敗只記錄日誌，不影響遷移結果
+func (d *Database) recordMigration(ctx context.Context, version uint, name, direction, checksum string, at time.Time, duration time.Duration, runErr error) {
+	record := migrationHistoryRecord{
+		Version:    int64(version),
+		Name:       name,
+		Direction:  direction,
+		Checksum:   checksum,
+		Success:    runErr == nil,
+		DurationMs: duration.Milliseconds(),
+		Actor:      d.Actor(),
+		AppliedAt:  at,
+	}
+	if runErr != nil {
+		record.Error = runErr.Error()
+	}
+	collection, err := d.collection(migrationHistoryCollection)
+	if err == nil {
+		_, err = collection.InsertOne(ctx, record)
+	}
+	if err != nil {
+		logFor("migration").Error("Failed to record migration history", "version", version, "error", err)
+	}
+}
+
+// appliedChecksums 依歷史紀錄計算目前已套用版本的 checksum（之後被回復的版本不列入）
+func (d *Database) appliedChecksums(ctx context.Context) (map[uint]string, error) {
+	collection, err := d.collection(migrationHistoryCollection)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Find(ctx,
+		bson.M{"success": true},
+		options.Find().SetSort(bson.D{{Key: "applied_at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query migration history: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var records []migrationHistoryRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode migration history: %w", err)
+	}
+
+	checksums := make(map[uint]string)
+	for _, record := range records {
+		switch record.Direction {
+		case MigrationDirectionUp, MigrationDirectionBaseline:
+			checksums[uint(record.Version)] = record.Checksum
+		case MigrationDirectionDown:
+			delete(checksums, uint(record.Version))
+		}
+	}
+	return checksums, nil
+}
+
+// GetMigrationStatus 取得目前版本與已套用 / 待套用的遷移，並標示已套用後被修改的遷移
+func (d *Database) GetMigrationStatus() (*MigrationStatus, error) {
+	set, err := d.loadMigrationSet()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(withOperation(context.Background(), "GetMigrationStatus"), 10*time.Second)
+	defer cancel()
+
+	current, dirty, err := d.readMigrationState(ctx, set)
+	if err != nil {
+		return nil, err
+	}
+	checksums, err := d.appliedChecksums(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &MigrationStatus{
+		CurrentVersion: current,
+		Dirty:          dirty,
+		LatestVersion:  set.latest(),
+		Ahead:          current > set.latest(),
+		Applied:        []MigrationInfo{},
+		Pending:        []MigrationInfo{},
+	}
+	for _, migration := range set.migrations {
+		info := MigrationInfo{
+			Version:  migration.Version,
+			Name:     migration.Name,
+			Source:   migration.Source,
+			HasDown:  migration.hasDown(),
+			Checksum: migration.Checksum,
+		}
+		if migration.Version <= current {
+			info.Applied = true
+			info.AppliedChecksum = checksums[migration.Version]
+			info.Modified = info.AppliedChecksum != "" && info.AppliedChecksum != migration.Checksum
+			status.Applied = append(status.Applied, info)
+		} else {
+			status.Pending = append(status.Pending, info)
+		}
+	}
+	return status, nil
+}
+
+// GetMigrationHistory 取得最近的遷移執行紀錄（新到舊），limit <= 0 時回傳全部
+func (d *Database) GetMigrationHistory(limit int) ([]MigrationHistoryEntry, error) {
+	ctx, cancel := context.WithTimeout(withOperation(context.Background(), "GetMigrationHistory"), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "applied_at", Value: -1}, {Key: "_id", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	collection, err := d.collection(migrationHistoryCollection)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query migration history: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var records []migrationHistoryRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode migration history: %w", err)
+	}
+
+	entries := make([]MigrationHistoryEntry, 0, len(records))
+	for _, record := range records {
+		entries = append(entries, MigrationHistoryEntry{
+			Version:    uint(record.Version),
+			Name:       record.Name,
+			Direction:  record.Direction,
+			Checksum:   record.Checksum,
+			Success:    record.Success,
+			Error:      record.Error,
+			DurationMs: record.DurationMs,
+			Actor:      record.Actor,
+			AppliedAt:  record.AppliedAt.Format(time.RFC3339),
+		})
+	}
+	return entries, nil
+}
+
+// MigrateTo 遷移到指定版本（0 表示全部回復），版本較舊時會依序執行 down 操作
+func (d *Database) MigrateTo(target uint, dryRun bool) (*MigrationPlan, error) {
+	return d.migrate(dryRun, func(set *migrationSet, current uint) (*MigrationPlan, error) {
+		return set.plan(current, target)
+	})
+}
+
+// MigrateSteps 相對目前版本前進（正數）或回復（負數）n 個遷移
+func (d *Database) MigrateSteps(n int, dryRun bool) (*MigrationPlan, error) {
+	if n == 0 {
+		return nil, newValidationError("steps", "steps must not be zero")
+	}
+	return d.migrate(dryRun, func(set *migrationSet, current uint) (*MigrationPlan, error) {
+		idx := set.index(current)
+		if idx == -2 {
+			return nil, fmt.Errorf("current version %d has no migration", current)
+		}
+		next := idx + n
+		if next < -1 || next >= len(set.migrations) {
+			return nil, newValidationError("steps", fmt.Sprintf("cannot move %d step(s) from version %d", n, current))
+		}
+		if next == -1 {
+			return set.plan(current, 0)
+		}
+		return set.plan(current, set.migrations[next].Version)
+	})
+}
+
+// RedoMigration 回復目前版本後再重新套用一次
+func (d *Database) RedoMigration(dryRun bool) (*MigrationPlan, error) {
+	return d.migrate(dryRun, func(set *migrationSet, current uint) (*MigrationPlan, error) {
+		idx := set.index(current)
+		if idx < 0 {
+			return nil, fmt.Errorf("no applied migration to redo (current version %d)", current)
+		}
+		down, err := set.step(set.migrations[idx], MigrationDirectionDown)
+		if err != nil {
+			return nil, err
+		}
+		up, err := set.step(set.migrations[idx], MigrationDirectionUp)
+		if err != nil {
+			return nil, err
+		}
+		return &MigrationPlan{FromVersion: current, ToVersion: current, Steps: []MigrationStep{down, up}}, nil
+	})
+}
+
+// ForceMigrationVersion 不執行任何操作，直接將版本標記為 version 並清除 dirty（確認資料正確後使用）
+func (d *Database) ForceMigrationVersion(version uint) error {
+	return d.withMigrationLock("force", func(context.Context) error {
+		return d.forceMigrationVersion(version)
+	})
+}
+
+// forceMigrationVersion ForceMigrationVersion 的實作，呼叫端需持有遷移鎖
+func (d *Database) forceMigrationVersion(version uint) error {
+	set, err := d.loadMigrationSet()
+	if err != nil {
+		return err
+	}
+	idx := set.index(version)
+	if idx == -2 {
+		return newValidationError("version", fmt.Sprintf("version %d does not exist", version))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	current, dirty, err := d.readMigrationState(ctx, set)
+	if err != nil {
+		return err
+	}
+	if err := d.writeMigrationState(ctx, version, false); err != nil {
+		return err
+	}
+
+	name, checksum := "", ""
+	if idx >= 0 {
+		name, checksum = set.migrations[idx].Name, set.migrations[idx].Checksum
+	}
+	d.recordMigration(ctx, version, name, MigrationDirectionForce, checksum, time.Now(), 0, nil)
+	logFor("migration").Warn("Forced migration version", "from", current, "dirty", dirty, "to", version)
+	return nil
+}
+
+// migrate 依 buildPlan 產生計畫；dry run 不修改資料庫，直接執行，
+// 實際執行時在遷移鎖內進行，讀取目前版本與套用遷移之間不會被其他執行個體插入
+func (d *Database) migrate(dryRun bool, buildPlan func(set *migrationSet, current uint) (*MigrationPlan, error)) (*MigrationPlan, error) {
+	if dryRun {
+		return d.migrateUnlocked(context.Background(), true, buildPlan)
+	}
+	var plan *MigrationPlan
+	err := d.withMigrationLock("migrate", func(ctx context.Context) error {
+		var err error
+		plan, err = d.migrateUnlocked(ctx, false, buildPlan)
+		return err
+	})
+	return plan, err
+}
+
+// migrateUnlocked migrate 的實作，非 dryRun 時呼叫端需持有遷移鎖；ctx 被取消時不再執行後續的步驟
+func (d *Database) migrateUnlocked(ctx context.Context, dryRun bool, buildPlan func(set *migrationSet, current uint) (*MigrationPlan, error)) (*MigrationPlan, error) {
+	set, err := d.loadMigrationSet()
+	if err != nil {
+		return nil, err
+	}
+
+	readCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	current, dirty, err := d.readMigrationState(readCtx, set)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	if dirty {
+		return nil, fmt.Errorf("database is dirty at version %d, fix the failed migration and force a version before migrating", current)
+	}
+
+	plan, err := buildPlan(set, current)
+	if err != nil {
+		return nil, err
+	}
+	plan.DryRun = dryRun
+	logMigrationPlan(plan)
+	if dryRun || len(plan.Steps) == 0 {
+		return plan, nil
+	}
+
+	start := time.Now()
+	for _, step := range plan.Steps {
+		if ctx.Err() != nil {
+			return plan, fmt.Errorf("migration stopped before version %d: %w", step.Version, context.Cause(ctx))
+		}
+		if err := d.runMigrationStep(set, step); err != nil {
+			return plan, err
+		}
+	}
+	logOperation("migration", "migrate", start, nil, "Database migrated", "from", plan.FromVersion, "to", plan.ToVersion)
+	return plan, nil
+}
+
+// runMigrationStep 執行單一步驟：先標記目標版本為 dirty，成功後才清除，失敗時維持 dirty 並記錄錯誤
+func (d *Database) runMigrationStep(set *migrationSet, step MigrationStep) error {
+	migration := step.migration
+	target := migration.Version
+	if step.Direction == MigrationDirectionDown {
+		target = set.previous(set.index(migration.Version))
+	}
+
+	db, err := d.database()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), migrationStepTimeout)
+	defer cancel()
+
+	if err := d.writeMigrationState(ctx, target, true); err != nil {
+		return err
+	}
+
+	logFor("migration").Info("Running migration", "version", migration.Version, "name", migration.Name, "direction", step.Direction)
+	started := time.Now()
+	runErr := migration.run(ctx, db, step.Direction)
+	d.recordMigration(ctx, migration.Version, migration.Name, step.Direction, migration.Checksum, started, time.Since(started), runErr)
+	if runErr != nil {
+		return fmt.Errorf("failed to run migration %d (%s): %w", migration.Version, step.Direction, runErr)
+	}
+
+	if err := d.writeMigrationState(ctx, target, false); err != nil {
+		return err
+	}
+	logOperation("migration", "migrate."+step.Direction, started, nil, "Migration completed", "version", migration.Version, "name", migration.Name)
+	return nil
+}
+
+// logMigrationPlan 將計畫寫入日誌，列出每個步驟將執行的操作
+func logMigrationPlan(plan *MigrationPlan) {
+	title := "Applying migration plan"
+	if plan.DryRun {
+		title = "Migration plan (dry run)"
+	}
+	logFor("migration").Info(title, "from", plan.FromVersion, "to", plan.ToVersion, "steps", len(plan.Steps))
+	for _, step := range plan.Steps {
+		logFor("migration").Info("Migration step", "direction", step.Direction, "version", step.Version, "name", step.Name)
+		if plan.DryRun {
+			for _, op := range step.Operations {
+				logFor("migration").Info("Migration step operation (dry run)", "version", step.Version, "operation", op)
+			}
+		}
+	}
+}
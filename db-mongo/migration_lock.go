@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrMigrationLockTimeout 等待其他執行個體釋放遷移鎖逾時
+var ErrMigrationLockTimeout = errors.New("timed out waiting for migration lock")
+
+// ErrMigrationLockLost 持有遷移鎖期間續約失敗，租約可能已被其他執行個體接手，進行中的操作會被中止
+var ErrMigrationLockLost = errors.New("migration lock lost")
+
+// migrationLockPollInterval 鎖被其他執行個體持有時的重試間隔；等待逾時與租約長度由 DB_MIGRATION_LOCK_TIMEOUT、DB_MIGRATION_LOCK_TTL 設定
+const migrationLockPollInterval = time.Second
+
+// migrationLock 跨執行個體的遷移鎖；MongoDB 以租約文件實作
+type migrationLock interface {
+	// tryAcquire 嘗試取得鎖，已被他人持有時回傳 false 與持有者說明
+	tryAcquire(ctx context.Context) (bool, string, error)
+	// renew 延長租約
+	renew(ctx context.Context) error
+	// release 釋放鎖
+	release(ctx context.Context) error
+}
+
+// migrationLockOwner 本執行個體的鎖持有者 ID（主機名稱-PID-隨機值）
+var migrationLockOwner = newMigrationLockOwner()
+
+func newMigrationLockOwner() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// withMigrationLock 取得遷移鎖後執行 fn；鎖被其他執行個體持有時每秒重試，
+// 超過 DB_MIGRATION_LOCK_TIMEOUT 回傳 ErrMigrationLockTimeout。持有期間定期續約，結束後一定釋放。
+// 續約失敗時取消傳給 fn 的 ctx，fn 應在下一個安全的中斷點停止；此時回傳 ErrMigrationLockLost
+func (d *Database) withMigrationLock(operation string, fn func(ctx context.Context) error) error {
+	timeout := appConfig().MigrationLockTimeout
+	ttl := appConfig().MigrationLockTTL
+
+	lock, err := d.newMigrationLock(ttl)
+	if err != nil {
+		return fmt.Errorf("failed to create migration lock: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	waiting := false
+	for {
+		acquired, holder, err := lock.tryAcquire(ctx)
+		if err != nil {
+			lock.release(context.Background())
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		if acquired {
+			break
+		}
+		if !waiting {
+			logFor("migration").Info("Waiting for migration lock", "holder", holder, LogKeyOperation, operation)
+			waiting = true
+		}
+
+		select {
+		case <-ctx.Done():
+			lock.release(context.Background())
+			return fmt.Errorf("%w after %s (held by %s)", ErrMigrationLockTimeout, timeout, holder)
+		case <-time.After(migrationLockPollInterval):
+		}
+	}
+	logFor("migration").Info("Acquired migration lock", "owner", migrationLockOwner, LogKeyOperation, operation)
+
+	// 持有期間以 TTL 的三分之一為間隔續約，避免長時間的遷移被視為過期；續約失敗就不能再假設只有自己在遷移
+	lockCtx, abort := context.WithCancelCause(context.Background())
+	defer abort(nil)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				renewCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				err := lock.renew(renewCtx)
+				cancel()
+				if err != nil {
+					logFor("migration").Error("Failed to renew migration lock, aborting", "error", err, LogKeyOperation, operation)
+					abort(fmt.Errorf("%w: %v", ErrMigrationLockLost, err))
+					return
+				}
+			}
+		}
+	}()
+
+	defer func() {
+		close(done)
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := lock.release(releaseCtx); err != nil {
+			logFor("migration").Warn("Failed to release migration lock", "error", err)
+			return
+		}
+		logFor("migration").Info("Released migration lock")
+	}()
+
+	err = fn(lockCtx)
+	if cause := context.Cause(lockCtx); errors.Is(cause, ErrMigrationLockLost) {
+		if err != nil {
+			return fmt.Errorf("%s aborted: %w (last error: %v)", operation, cause, err)
+		}
+		return fmt.Errorf("%s aborted: %w", operation, cause)
+	}
+	return err
+}
+
+// 遷移鎖的租約文件
+const (
+	migrationLockCollection = "migration_lock"
+	migrationLockID         = "migrations"
+)
+
+// leaseMigrationLock 以 migration_lock 集合中的租約文件實作的遷移鎖；
+// 持有者中斷而未釋放時，租約過期後其他執行個體即可接手，TTL 索引也會清除過期的文件
+type leaseMigrationLock struct {
+	collection *mongo.Collection
+	ttl        time.Duration
+	held       bool
+}
+
+// newMigrationLock 建立以租約文件實作的遷移鎖
+func (d *Database) newMigrationLock(ttl time.Duration) (migrationLock, error) {
+	collection, err := d.collection(migrationLockCollection)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lock TTL index: %w", err)
+	}
+	return &leaseMigrationLock{collection: collection, ttl: ttl}, nil
+}
+
+// tryAcquire 只有在沒有租約、租約已過期或本來就由自己持有時才會寫入；
+// 文件被他人持有時 upsert 會因 _id 重複而失敗
+func (l *leaseMigrationLock) tryAcquire(ctx context.Context) (bool, string, error) {
+	now := time.Now()
+	host, _ := os.Hostname()
+	_, err := l.collection.UpdateOne(ctx,
+		bson.M{
+			"_id": migrationLockID,
+			"$or": bson.A{
+				bson.M{"expires_at": bson.M{"$lt": now}},
+				bson.M{"owner": migrationLockOwner},
+			},
+		},
+		bson.M{"$set": bson.M{
+			"owner":       migrationLockOwner,
+			"host":        host,
+			"pid":         os.Getpid(),
+			"acquired_at": now,
+			"expires_at":  now.Add(l.ttl),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err == nil {
+		l.held = true
+		return true, "", nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return false, "", err
+	}
+
+	var holder struct {
+		Owner     string    `bson:"owner"`
+		ExpiresAt time.Time `bson:"expires_at"`
+	}
+	if err := l.collection.FindOne(ctx, bson.M{"_id": migrationLockID}).Decode(&holder); err != nil {
+		return false, "another instance", nil
+	}
+	return false, fmt.Sprintf("%s until %s", holder.Owner, holder.ExpiresAt.Local().Format(time.RFC3339)), nil
+}
+
+func (l *leaseMigrationLock) renew(ctx context.Context) error {
+	res, err := l.collection.UpdateOne(ctx,
+		bson.M{"_id": migrationLockID, "owner": migrationLockOwner},
+		bson.M{"$set": bson.M{"expires_at": time.Now().Add(l.ttl)}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("migration lock was taken over by another instance")
+	}
+	return nil
+}
+
+func (l *leaseMigrationLock) release(ctx context.Context) error {
+	if !l.held {
+		return nil
+	}
+	l.held = false
+	_, err := l.collection.DeleteOne(ctx, bson.M{"_id": migrationLockID, "owner": migrationLockOwner})
+	return err
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// TestLegacyDatabaseUpgrade 舊版 migrations 集合記錄版本 1 的資料庫，轉換後應依序套用之後的遷移，
+// 並以只涵蓋未刪除用戶的 email_live 取代 email_1
+func TestLegacyDatabaseUpgrade(t *testing.T) {
+	loadTestConfig(t)
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("upgrade", func(mt *mtest.T) {
+		d := newMockDatabase(mt)
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.schema_migrations", mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "test.migrations", mtest.FirstBatch,
+				bson.D{{Key: "version", Value: 1}, {Key: "applied_at", Value: time.Now()}}),
+		)
+		for i := 0; i < 40; i++ {
+			mt.AddMockResponses(mtest.CreateSuccessResponse())
+		}
+
+		plan, err := d.migrateUnlocked(context.Background(), false, func(set *migrationSet, current uint) (*MigrationPlan, error) {
+			return set.plan(current, set.latest())
+		})
+		if err != nil {
+			mt.Fatalf("migrateUnlocked: %v", err)
+		}
+		var versions []uint
+		for _, step := range plan.Steps {
+			versions = append(versions, step.Version)
+		}
+		if plan.FromVersion != 1 || len(versions) != 4 || versions[0] != 2 || versions[3] != 5 {
+			mt.Fatalf("plan from %d = %v, want versions 2 to 5 from 1", plan.FromVersion, versions)
+		}
+
+		names, commands := startedCommands(mt)
+		var droppedEmail1, createdEmailLive, backfilled bool
+		var lastVersion int64
+		for i, name := range names {
+			cmd := commands[i]
+			switch name {
+			case "update":
+				update := cmd.Lookup("updates").Array().Index(0).Value().Document()
+				if cmd.Lookup("update").StringValue() == "users" &&
+					update.Lookup("u", "$set", "deleted_at").Type == bson.TypeNull {
+					backfilled = true
+				}
+				if cmd.Lookup("update").StringValue() == migrationStateCollection {
+					lastVersion = update.Lookup("u", "$set", "version").Int64()
+				}
+			case "dropIndexes":
+				if cmd.Lookup("index").StringValue() == "email_1" {
+					droppedEmail1 = true
+				}
+			case "createIndexes":
+				index := cmd.Lookup("indexes").Array().Index(0).Value().Document()
+				if index.Lookup("name").StringValue() == "email_live" {
+					createdEmailLive = index.Lookup("unique").Boolean() &&
+						index.Lookup("partialFilterExpression", "deleted_at", "$type").StringValue() == "null"
+				}
+			}
+		}
+		if !backfilled || !droppedEmail1 || !createdEmailLive {
+			mt.Fatalf("backfilled %v, dropped email_1 %v, created partial email_live %v; commands %v",
+				backfilled, droppedEmail1, createdEmailLive, names)
+		}
+		if lastVersion != 5 {
+			mt.Fatalf("final recorded version = %d, want 5", lastVersion)
+		}
+	})
+}
+
+func TestLoadMigrationFile(t *testing.T) {
+	const valid = `{
+  "description": "example",
+  "up": [
+    {"op": "createIndex", "collection": "users", "keys": {"email": 1, "age": -1}, "unique": true, "partialFilter": {"deleted_at": {"$type": "null"}}},
+    {"op": "backfill", "collection": "users", "filter": {"deleted_at": {"$exists": false}}, "set": {"deleted_at": null}}
+  ],
+  "down": [
+    {"op": "dropIndex", "collection": "users", "keys": {"email": 1, "age": -1}}
+  ]
+}`
+	fsys := fstest.MapFS{
+		"1_valid.json":         {Data: []byte(valid)},
+		"2_invalid_json.json":  {Data: []byte(`{"up": [`)},
+		"3_no_up.json":         {Data: []byte(`{"down": [{"op": "dropCollection", "collection": "users"}]}`)},
+		"4_unknown_op.json":    {Data: []byte(`{"up": [{"op": "dropDatabase", "collection": "users"}]}`)},
+		"5_missing_keys.json":  {Data: []byte(`{"up": [{"op": "createIndex", "collection": "users"}]}`)},
+		"6_bad_down.json":      {Data: []byte(`{"up": [{"op": "createCollection", "collection": "x"}], "down": [{"op": "renameField", "collection": "x", "from": "a"}]}`)},
+		"7_missing_collection": {Data: []byte(`{"up": [{"op": "unsetField", "fields": ["a"]}]}`)},
+	}
+
+	migration, err := loadMigrationFile(fsys, "1_valid.json", 1, "valid")
+	if err != nil {
+		t.Fatalf("loadMigrationFile: %v", err)
+	}
+	if migration.Version != 1 || migration.Name != "valid" || migration.Source != "1_valid.json" {
+		t.Fatalf("migration = %d %q from %q", migration.Version, migration.Name, migration.Source)
+	}
+	if len(migration.Up) != 2 || len(migration.Down) != 1 || !migration.hasDown() {
+		t.Fatalf("got %d up and %d down operations, want 2 and 1", len(migration.Up), len(migration.Down))
+	}
+	// 索引欄位的順序必須與檔案相同
+	create := migration.Up[0]
+	wantKeys := bson.D{{Key: "email", Value: int32(1)}, {Key: "age", Value: int32(-1)}}
+	if !reflect.DeepEqual(create.Keys, wantKeys) || !create.Unique || create.indexName() != "email_1_age_-1" {
+		t.Fatalf("createIndex = %+v (name %q)", create, create.indexName())
+	}
+	if got := create.Partial; len(got) != 1 || got[0].Key != "deleted_at" {
+		t.Fatalf("partialFilter = %v", got)
+	}
+	if got := migration.Down[0].indexName(); got != "email_1_age_-1" {
+		t.Fatalf("dropIndex name = %q, want the name derived from the keys", got)
+	}
+
+	tests := []struct {
+		file    string
+		wantErr string
+	}{
+		{"2_invalid_json.json", "failed to parse migration"},
+		{"3_no_up.json", "has no up operations"},
+		{"4_unknown_op.json", `unknown op "dropDatabase"`},
+		{"5_missing_keys.json", "keys are required"},
+		{"6_bad_down.json", "from and to are required"},
+		{"7_missing_collection", "collection is required"},
+		{"8_missing.json", "failed to read migration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			_, err := loadMigrationFile(fsys, tt.file, 1, "x")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMigrationChecksum(t *testing.T) {
+	// 空內容的 SHA-256，確保演算法與編碼不會被改變（改變會讓所有已套用的遷移被視為已修改）
+	if got := migrationChecksum(nil); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Fatalf("migrationChecksum(nil) = %s", got)
+	}
+
+	data := []byte(`{"up": [{"op": "createCollection", "collection": "users"}]}`)
+	fsys := fstest.MapFS{
+		"1_a.json": {Data: data},
+		"2_b.json": {Data: []byte(`{"up": [{"op": "createCollection",  "collection": "users"}]}`)},
+	}
+	first, err := loadMigrationFile(fsys, "1_a.json", 1, "a")
+	if err != nil {
+		t.Fatalf("loadMigrationFile: %v", err)
+	}
+	second, err := loadMigrationFile(fsys, "1_a.json", 1, "a")
+	if err != nil {
+		t.Fatalf("loadMigrationFile: %v", err)
+	}
+	if first.Checksum != second.Checksum || first.Checksum != migrationChecksum(data) {
+		t.Fatalf("checksums differ between loads: %s, %s", first.Checksum, second.Checksum)
+	}
+	// checksum 取自檔案原始內容，連空白的差異也會被偵測
+	edited, err := loadMigrationFile(fsys, "2_b.json", 1, "a")
+	if err != nil {
+		t.Fatalf("loadMigrationFile: %v", err)
+	}
+	if edited.Checksum == first.Checksum {
+		t.Fatal("whitespace change did not change the checksum")
+	}
+
+	// 嵌入的遷移與 Go 遷移在每次載入時的 checksum 都相同
+	loadTestConfig(t)
+	d := &Database{}
+	a, err := d.loadMigrationSet()
+	if err != nil {
+		t.Fatalf("loadMigrationSet: %v", err)
+	}
+	b, err := d.loadMigrationSet()
+	if err != nil {
+		t.Fatalf("loadMigrationSet: %v", err)
+	}
+	for i, migration := range a.migrations {
+		if migration.Checksum == "" || migration.Checksum != b.migrations[i].Checksum {
+			t.Fatalf("migration %d checksum %q changed to %q", migration.Version, migration.Checksum, b.migrations[i].Checksum)
+		}
+	}
+}
+
+func TestMigrationSetPlan(t *testing.T) {
+	loadTestConfig(t)
+	set, err := (&Database{}).loadMigrationSet()
+	if err != nil {
+		t.Fatalf("loadMigrationSet: %v", err)
+	}
+	var versions []uint
+	for _, migration := range set.migrations {
+		versions = append(versions, migration.Version)
+	}
+	if !reflect.DeepEqual(versions, []uint{1, 2, 3, 4, 5}) {
+		t.Fatalf("versions = %v, want 1 to 5 (3 is the Go migration)", versions)
+	}
+	if set.migrations[2].Source != "go" {
+		t.Fatalf("migration 3 source = %q, want go", set.migrations[2].Source)
+	}
+
+	plan, err := set.plan(5, 2)
+	if err != nil {
+		t.Fatalf("plan(5, 2): %v", err)
+	}
+	var steps []string
+	for _, step := range plan.Steps {
+		steps = append(steps, fmt.Sprintf("%d %s", step.Version, step.Direction))
+	}
+	if want := []string{"5 down", "4 down", "3 down"}; !reflect.DeepEqual(steps, want) {
+		t.Fatalf("plan(5, 2) = %v, want %v", steps, want)
+	}
+
+	var verr *ValidationError
+	if _, err := set.plan(5, 9); !errors.As(err, &verr) {
+		t.Fatalf("plan to a missing version: err = %v, want *ValidationError", err)
+	}
+	if _, err := set.plan(9, 5); err == nil || !strings.Contains(err.Error(), "has no migration") {
+		t.Fatalf("plan from a missing version: err = %v", err)
+	}
+
+	noDown := &migrationSet{migrations: []*mongoMigration{{Version: 1, Name: "one_way", Up: []migrationOp{{Op: migrationOpCreateCollection, Collection: "x"}}}}}
+	if _, err := noDown.plan(1, 0); err == nil || !strings.Contains(err.Error(), "has no down operations") {
+		t.Fatalf("plan down through a one-way migration: err = %v", err)
+	}
+}
+
+func TestConvertLegacyMigrations(t *testing.T) {
+	loadTestConfig(t)
+	set, err := (&Database{}).loadMigrationSet()
+	if err != nil {
+		t.Fatalf("loadMigrationSet: %v", err)
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("legacy version", func(mt *mtest.T) {
+		d := newMockDatabase(mt)
+		applied := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.migrations", mtest.FirstBatch,
+				bson.D{{Key: "version", Value: 2}, {Key: "applied_at", Value: applied}}),
+			mtest.CreateSuccessResponse(), // baseline 1
+			mtest.CreateSuccessResponse(), // baseline 2
+			mtest.CreateSuccessResponse(), // schema_migrations
+			mtest.CreateSuccessResponse(), // drop migrations
+		)
+
+		version, err := d.convertLegacyMigrations(context.Background(), set)
+		if err != nil {
+			mt.Fatalf("convertLegacyMigrations: %v", err)
+		}
+		if version != 2 {
+			mt.Fatalf("version = %d, want 2", version)
+		}
+
+		names, commands := startedCommands(mt)
+		if want := []string{"find", "insert", "insert", "update", "drop"}; !reflect.DeepEqual(names, want) {
+			mt.Fatalf("commands = %v, want %v", names, want)
+		}
+		for i, migration := range set.migrations[:2] {
+			record := commands[i+1].Lookup("documents").Array().Index(0).Value().Document()
+			if record.Lookup("version").Int64() != int64(migration.Version) ||
+				record.Lookup("direction").StringValue() != MigrationDirectionBaseline ||
+				record.Lookup("checksum").StringValue() != migration.Checksum ||
+				!record.Lookup("applied_at").Time().Equal(applied) {
+				mt.Fatalf("baseline record %d = %v", i+1, record)
+			}
+		}
+		state := commands[3].Lookup("updates").Array().Index(0).Value().Document()
+		if state.Lookup("u", "$set", "version").Int64() != 2 || state.Lookup("u", "$set", "dirty").Boolean() {
+			mt.Fatalf("state update = %v, want version 2 and not dirty", state)
+		}
+		if commands[4].Lookup("drop").StringValue() != legacyMigrationCollection {
+			mt.Fatalf("dropped %v, want %s", commands[4].Lookup("drop"), legacyMigrationCollection)
+		}
+	})
+
+	mt.Run("no legacy collection", func(mt *mtest.T) {
+		d := newMockDatabase(mt)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.migrations", mtest.FirstBatch))
+
+		version, err := d.convertLegacyMigrations(context.Background(), set)
+		if err != nil || version != 0 {
+			mt.Fatalf("convertLegacyMigrations = %d, %v; want 0 without error", version, err)
+		}
+		if names, _ := startedCommands(mt); len(names) != 1 {
+			mt.Fatalf("commands = %v, want only the lookup", names)
+		}
+	})
+}
+
+func TestAppliedChecksums(t *testing.T) {
+	loadTestConfig(t)
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("history", func(mt *mtest.T) {
+		d := newMockDatabase(mt)
+		record := func(version int64, direction, checksum string) bson.D {
+			return bson.D{{Key: "version", Value: version}, {Key: "direction", Value: direction},
+				{Key: "checksum", Value: checksum}, {Key: "success", Value: true}}
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.migration_history", mtest.FirstBatch,
+			record(1, MigrationDirectionBaseline, "a"),
+			record(2, MigrationDirectionUp, "b"),
+			record(2, MigrationDirectionDown, "b"),
+			record(3, MigrationDirectionUp, "c"),
+			record(3, MigrationDirectionForce, ""),
+			record(2, MigrationDirectionUp, "b2"),
+		))
+
+		checksums, err := d.appliedChecksums(context.Background())
+		if err != nil {
+			mt.Fatalf("appliedChecksums: %v", err)
+		}
+		if want := map[uint]string{1: "a", 2: "b2", 3: "c"}; !reflect.DeepEqual(checksums, want) {
+			mt.Fatalf("checksums = %v, want %v", checksums, want)
+		}
+	})
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+)
+
+// 以 CommandMonitor 將每個 MongoDB 命令送到 observeQuery 並建立 span；耗時為驅動程式量測的命令往返時間
+
+// mongoCommands 統計中個別列出的命令，其餘（查詢主控台可執行任意命令）歸為 other
+var mongoCommands = map[string]bool{
+	"find": true, "getMore": true, "aggregate": true, "count": true, "distinct": true,
+	"insert": true, "update": true, "delete": true, "findAndModify": true,
+	"create": true, "drop": true, "collMod": true, "renameCollection": true, "dropDatabase": true,
+	"createIndexes": true, "dropIndexes": true, "listIndexes": true, "listCollections": true, "listDatabases": true,
+	"commitTransaction": true, "abortTransaction": true, "killCursors": true, "explain": true,
+	"ping": true, "dbStats": true, "collStats": true, "serverStatus": true,
+}
+
+// ignoredMongoCommands 連線交握與驗證的命令不列入統計（驗證命令的內容驅動程式也不會提供）
+var ignoredMongoCommands = map[string]bool{
+	"hello": true, "isMaster": true, "ismaster": true, "saslStart": true, "saslContinue": true,
+	"authenticate": true, "getnonce": true, "endSessions": true,
+}
+
+// maxLoggedCommandLength 慢查詢日誌中命令的最大長度
+const maxLoggedCommandLength = 1000
+
+// pendingCommand 已送出、尚未完成的命令
+type pendingCommand struct {
+	operation string
+	statement string
+	params    int
+	span      querySpan
+}
+
+// mongoCommandMonitor 建立 client 使用的 CommandMonitor
+func mongoCommandMonitor() *event.CommandMonitor {
+	var pending sync.Map // RequestID -> pendingCommand
+	finish := func(evt event.CommandFinishedEvent, rows int64, err error) {
+		v, ok := pending.LoadAndDelete(evt.RequestID)
+		if !ok {
+			return
+		}
+		cmd := v.(pendingCommand)
+		cmd.span.end(rows, err)
+		observeQuery(queryObservation{Operation: cmd.operation, Command: mongoCommandName(evt.CommandName), Statement: cmd.statement,
+			Params: cmd.params, Duration: evt.Duration, Rows: rows, Err: err})
+	}
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			if ignoredMongoCommands[evt.CommandName] || isUnobserved(ctx) {
+				return
+			}
+			statement, params := redactCommand(evt.Command)
+			// ctx 為發出命令時傳給驅動程式的 context，操作名稱由 Database 方法以 withOperation 放入
+			cmd := pendingCommand{operation: operationFrom(ctx), statement: statement, params: params}
+			attrs := []attribute.KeyValue{semconv.DBNamespace(evt.DatabaseName)}
+			if collection, ok := evt.Command.Lookup(evt.CommandName).StringValueOK(); ok {
+				attrs = append(attrs, semconv.DBCollectionName(collection))
+			}
+			cmd.span = startQuerySpan(ctx, time.Now(), cmd.operation, mongoCommandName(evt.CommandName), statement, attrs...)
+			pending.Store(evt.RequestID, cmd)
+		},
+		Succeeded: func(_ context.Context, evt *event.CommandSucceededEvent) {
+			finish(evt.CommandFinishedEvent, replyRows(evt.Reply), nil)
+		},
+		Failed: func(_ context.Context, evt *event.CommandFailedEvent) {
+			finish(evt.CommandFinishedEvent, 0, errors.New(evt.Failure))
+		},
+	}
+}
+
+// mongoCommandName 統計與 span 使用的命令名稱
+func mongoCommandName(name string) string {
+	if !mongoCommands[name] {
+		return "other"
+	}
+	return name
+}
+
+// redactCommand 將命令轉為一行文字：保留命令名稱、集合與欄位名稱，值一律以 ? 取代；回傳遮罩的值個數
+func redactCommand(cmd bson.Raw) (string, int) {
+	elems, err := cmd.Elements()
+	if err != nil || len(elems) == 0 {
+		return "", 0
+	}
+	var b strings.Builder
+	params := 0
+	b.WriteString("{")
+	written := 0
+	for i, elem := range elems {
+		key := elem.Key()
+		// 驅動程式加上的工作階段與叢集資訊與查詢無關
+		if strings.HasPrefix(key, "$") || key == "lsid" || key == "txnNumber" || key == "autocommit" || key == "startTransaction" {
+			continue
+		}
+		if written > 0 {
+			b.WriteString(", ")
+		}
+		written++
+		b.WriteString(key)
+		b.WriteString(": ")
+		if i == 0 && elem.Value().Type == bsontype.String {
+			b.WriteString(elem.Value().StringValue()) // 命令的目標集合
+			continue
+		}
+		params += writeRedactedValue(&b, elem.Value())
+	}
+	b.WriteString("}")
+
+	statement := b.String()
+	if len(statement) > maxLoggedCommandLength {
+		statement = statement[:maxLoggedCommandLength] + " ..."
+	}
+	return statement, params
+}
+
+// writeRedactedValue 寫入遮罩後的值：文件保留欄位名稱，陣列只列出前幾個元素
+func writeRedactedValue(b *strings.Builder, v bson.RawValue) int {
+	switch v.Type {
+	case bsontype.EmbeddedDocument:
+		elems, err := v.Document().Elements()
+		if err != nil {
+			b.WriteString("?")
+			return 1
+		}
+		params := 0
+		b.WriteString("{")
+		for i, elem := range elems {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(elem.Key())
+			b.WriteString(": ")
+			params += writeRedactedValue(b, elem.Value())
+		}
+		b.WriteString("}")
+		return params
+	case bsontype.Array:
+		values, err := v.Array().Values()
+		if err != nil {
+			b.WriteString("?")
+			return 1
+		}
+		const shown = 3
+		params := 0
+		b.WriteString("[")
+		for i, value := range values {
+			if i == shown {
+				b.WriteString(", ...")
+				break
+			}
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			params += writeRedactedValue(b, value)
+		}
+		b.WriteString("]")
+		return params
+	default:
+		b.WriteString("?")
+		return 1
+	}
+}
+
+// replyRows 由命令的回應取得影響或回傳的筆數：n、cursor 的批次大小或 findAndModify 的 lastErrorObject.n
+func replyRows(reply bson.Raw) int64 {
+	if n, ok := rawInt(reply.Lookup("n")); ok {
+		return n
+	}
+	for _, batch := range []string{"firstBatch", "nextBatch"} {
+		if arr, ok := reply.Lookup("cursor", batch).ArrayOK(); ok {
+			values, err := arr.Values()
+			if err == nil {
+				return int64(len(values))
+			}
+		}
+	}
+	if n, ok := rawInt(reply.Lookup("lastErrorObject", "n")); ok {
+		return n
+	}
+	return 0
+}
+
+// rawInt 讀取數值型別的 BSON 值
+func rawInt(v bson.RawValue) (int64, bool) {
+	switch v.Type {
+	case bsontype.Int32:
+		return int64(v.Int32()), true
+	case bsontype.Int64:
+		return v.Int64(), true
+	case bsontype.Double:
+		return int64(v.Double()), true
+	}
+	return 0, false
+}
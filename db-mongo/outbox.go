@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OutboxEvent 寫入 user_outbox、由 relay 送到訊息代理的用戶事件
+type OutboxEvent struct {
+	EventID    string                 `json:"eventId"` // 消費端以此去除重複的訊息
+	Type       string                 `json:"type"`    // user.created、user.updated 或 user.deleted
+	UserID     string                 `json:"userId"`
+	Actor      string                 `json:"actor"`
+	OccurredAt time.Time              `json:"occurredAt"`
+	User       map[string]interface{} `json:"user"` // 異動後的資料，刪除時為刪除前的資料
+}
+
+// recordUserChange 寫入稽核紀錄，DB_OUTBOX 啟用時同時寫入 user_outbox；在 WithTx 中以 session context 呼叫時
+// 與異動在同一個交易中提交，提交後事件一定會被 relay 送出（單機部署沒有交易，在異動成功後寫入）
+func (d *Database) recordUserChange(ctx context.Context, userID primitive.ObjectID, action string, before, after bson.M) error {
+	if err := d.writeAudit(ctx, userID, action, before, after); err != nil {
+		return err
+	}
+	if !appConfig().Outbox {
+		return nil
+	}
+
+	snapshot := after
+	if snapshot == nil {
+		snapshot = before
+	}
+	eventID, err := uuid.NewRandom()
+	if err != nil {
+		return fmt.Errorf("failed to generate event ID: %w", err)
+	}
+	event := OutboxEvent{
+		EventID:    eventID.String(),
+		Type:       auditChangeType(action),
+		UserID:     userID.Hex(),
+		Actor:      d.Actor(),
+		OccurredAt: time.Now().UTC(),
+		User:       normalizeUserDoc(maps.Clone(snapshot)), // normalizeUserDoc 會修改傳入的文件
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox event: %w", err)
+	}
+
+	doc := bson.M{
+		"event_id":   event.EventID,
+		"event_type": event.Type,
+		"user_id":    userID,
+		"payload":    string(payload),
+		"created_at": time.Now(),
+		"attempts":   0,
+	}
+	collection, err := d.collection("user_outbox")
+	if err != nil {
+		return err
+	}
+	if _, err := collection.InsertOne(ctx, doc); err != nil {
+		return fmt.Errorf("failed to write outbox event: %w", err)
+	}
+	return nil
+}
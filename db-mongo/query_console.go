@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// 查詢主控台的執行模式
+const (
+	QueryModeRead    = "read"
+	QueryModeWrite   = "write"
+	QueryModeExplain = "explain"
+)
+
+// 查詢主控台的預設限制
+const (
+	queryHistoryLimit = 200
+)
+
+// queryReadCommands 不會修改資料的命令（名稱為小寫）；其餘命令一律視為寫入
+var queryReadCommands = map[string]bool{
+	"find":             true,
+	"aggregate":        true,
+	"count":            true,
+	"distinct":         true,
+	"listcollections":  true,
+	"listindexes":      true,
+	"dbstats":          true,
+	"collstats":        true,
+	"datasize":         true,
+	"explain":          true,
+	"buildinfo":        true,
+	"ping":             true,
+	"hello":            true,
+	"ismaster":         true,
+	"serverstatus":     true,
+	"connectionstatus": true,
+}
+
+// queryCursorCommands 回傳 cursor 的命令，結果逐筆讀取到筆數上限為止
+var queryCursorCommands = map[string]bool{
+	"find":            true,
+	"aggregate":       true,
+	"listcollections": true,
+	"listindexes":     true,
+}
+
+// queryTimedCommands 支援 maxTimeMS 的讀取命令，未指定時以查詢時間上限填入，讓伺服器也會中止
+var queryTimedCommands = map[string]bool{
+	"find":      true,
+	"aggregate": true,
+	"count":     true,
+	"distinct":  true,
+}
+
+// queryWriteModeMu 保護 Database.QueryWriteMode，綁定方法可能被前端並行呼叫
+var queryWriteModeMu sync.RWMutex
+
+// queryHistoryMu 保護查詢紀錄檔的讀寫
+var queryHistoryMu sync.Mutex
+
+// QueryColumn 結果文件的頂層欄位與出現過的 BSON 型別（多種型別以 | 分隔）
+type QueryColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// QueryResult 查詢主控台的執行結果；文件以 relaxed extended JSON 的結構回傳，
+// 非 cursor 的命令（含寫入命令）回傳伺服器的回應文件
+type QueryResult struct {
+	Mode         string                   `json:"mode"`
+	Command      string                   `json:"command"`
+	Columns      []QueryColumn            `json:"columns"`
+	Documents    []map[string]interface{} `json:"documents" ts_type:"Array<Record<string, any>>"`
+	RowCount     int                      `json:"rowCount"`
+	Truncated    bool                     `json:"truncated"`
+	RowsAffected int64                    `json:"rowsAffected"`
+	DurationMs   int64                    `json:"durationMs"`
+}
+
+// QueryHistoryEntry 查詢紀錄；Error 為空表示執行成功
+type QueryHistoryEntry struct {
+	ExecutedAt string        `json:"executedAt"`
+	Mode       string        `json:"mode"`
+	Command    string        `json:"command"`
+	Query      string        `json:"query"`
+	Params     []interface{} `json:"params,omitempty"`
+	Rows       int64         `json:"rows"`
+	DurationMs int64         `json:"durationMs"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// parseConsoleCommand 解析 extended JSON 的命令文件並代入參數；{"$param": n} 代表 params 的第 n 個值（從 1 起算）
+func parseConsoleCommand(text string, params []interface{}) (bson.D, string, error) {
+	var cmd bson.D
+	if err := bson.UnmarshalExtJSON([]byte(strings.TrimSpace(text)), false, &cmd); err != nil {
+		return nil, "", fmt.Errorf("query must be a JSON command document such as {\"find\": \"users\"}: %v", err)
+	}
+	if len(cmd) == 0 {
+		return nil, "", fmt.Errorf("query is empty")
+	}
+
+	values := make([]interface{}, len(params))
+	for i, p := range params {
+		value, err := browseArg("", p)
+		if err != nil {
+			return nil, "", fmt.Errorf("param %d: %v", i+1, err)
+		}
+		values[i] = value
+	}
+	bound, err := bindConsoleParams(cmd, values)
+	if err != nil {
+		return nil, "", err
+	}
+	return bound.(bson.D), cmd[0].Key, nil
+}
+
+// bindConsoleParams 遞迴替換命令中的 {"$param": n}
+func bindConsoleParams(value interface{}, params []interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case bson.D:
+		if len(v) == 1 && v[0].Key == "$param" {
+			var n int64
+			switch index := v[0].Value.(type) {
+			case int32:
+				n = int64(index)
+			case int64:
+				n = index
+			case float64:
+				n = int64(index)
+			default:
+				return nil, fmt.Errorf("$param must be a number")
+			}
+			if n < 1 || int(n) > len(params) {
+				return nil, fmt.Errorf("$param %d is out of range (%d param(s) given)", n, len(params))
+			}
+			return params[n-1], nil
+		}
+		bound := make(bson.D, len(v))
+		for i, elem := range v {
+			child, err := bindConsoleParams(elem.Value, params)
+			if err != nil {
+				return nil, err
+			}
+			bound[i] = bson.E{Key: elem.Key, Value: child}
+		}
+		return bound, nil
+	case bson.A:
+		bound := make(bson.A, len(v))
+		for i, elem := range v {
+			child, err := bindConsoleParams(elem, params)
+			if err != nil {
+				return nil, err
+			}
+			bound[i] = child
+		}
+		return bound, nil
+	}
+	return value, nil
+}
+
+// isWriteCommand 判斷命令是否會修改資料；aggregate 含 $out 或 $merge 階段時視為寫入
+func isWriteCommand(cmd bson.D) bool {
+	name := strings.ToLower(cmd[0].Key)
+	if !queryReadCommands[name] {
+		return true
+	}
+	if name != "aggregate" {
+		return false
+	}
+	for _, elem := range cmd {
+		if elem.Key != "pipeline" {
+			continue
+		}
+		stages, _ := elem.Value.(bson.A)
+		for _, stage := range stages {
+			doc, ok := stage.(bson.D)
+			if !ok {
+				continue
+			}
+			for _, op := range doc {
+				if op.Key == "$out" || op.Key == "$merge" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// QueryWriteModeEnabled 回傳查詢主控台是否允許寫入命令
+func (d *Database) QueryWriteModeEnabled() bool {
+	queryWriteModeMu.RLock()
+	defer queryWriteModeMu.RUnlock()
+	return d.QueryWriteMode
+}
+
+// SetQueryWriteMode 開啟或關閉查詢主控台的寫入模式
+func (d *Database) SetQueryWriteMode(enabled bool) {
+	queryWriteModeMu.Lock()
+	d.QueryWriteMode = enabled
+	queryWriteModeMu.Unlock()
+	logFor("query").Info("Query console write mode changed", "enabled", enabled, "actor", d.Actor())
+}
+
+// queryLimits 查詢主控台的筆數上限（DB_QUERY_MAX_ROWS）與執行時間上限（DB_QUERY_TIMEOUT）
+func queryLimits() (int, time.Duration) {
+	cfg := appConfig()
+	return cfg.QueryMaxRows, cfg.QueryTimeout
+}
+
+// ExecuteQuery 對目前的資料庫執行一個命令文件，例如 {"find": "users", "filter": {"age": {"$gte": {"$param": 1}}}}；
+// 讀取命令受筆數與時間上限限制，寫入命令必須先開啟寫入模式
+func (d *Database) ExecuteQuery(text string, params []interface{}) (*QueryResult, error) {
+	cmd, name, err := parseConsoleCommand(text, params)
+	if err != nil {
+		return nil, newValidationError("query", err.Error())
+	}
+	mode := QueryModeRead
+	if isWriteCommand(cmd) {
+		if !d.QueryWriteModeEnabled() {
+			return nil, newValidationError("query", fmt.Sprintf("%s is not allowed unless write mode is enabled", name))
+		}
+		mode = QueryModeWrite
+	}
+	return d.runConsoleQuery(withOperation(context.Background(), "ExecuteQuery"), mode, name, text, params, cmd)
+}
+
+// ExplainQuery 以 queryPlanner 模式回傳命令的執行計畫（不實際執行命令），寫入命令也可以查看
+func (d *Database) ExplainQuery(text string, params []interface{}) (*QueryResult, error) {
+	cmd, name, err := parseConsoleCommand(text, params)
+	if err != nil {
+		return nil, newValidationError("query", err.Error())
+	}
+	if strings.EqualFold(name, "explain") {
+		return nil, newValidationError("query", "query is already an explain command")
+	}
+	explain := bson.D{{Key: "explain", Value: cmd}, {Key: "verbosity", Value: "queryPlanner"}}
+	return d.runConsoleQuery(withOperation(context.Background(), "ExplainQuery"), QueryModeExplain, name, text, params, explain)
+}
+
+// runConsoleQuery 執行命令並寫入查詢紀錄
+func (d *Database) runConsoleQuery(ctx context.Context, mode, name, text string, params []interface{}, cmd bson.D) (*QueryResult, error) {
+	maxRows, timeout := queryLimits()
+
+	started := time.Now()
+	result, err := d.executeConsoleCommand(ctx, cmd, maxRows, timeout)
+	duration := time.Since(started)
+
+	entry := QueryHistoryEntry{
+		ExecutedAt: started.Format(time.RFC3339),
+		Mode:       mode,
+		Command:    name,
+		Query:      text,
+		Params:     params,
+		DurationMs: duration.Milliseconds(),
+	}
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("query exceeded the %s time limit: %w", timeout, err)
+		}
+		entry.Error = err.Error()
+	} else {
+		result.Mode, result.Command, result.DurationMs = mode, name, duration.Milliseconds()
+		entry.Rows = int64(result.RowCount)
+		if mode == QueryModeWrite {
+			entry.Rows = result.RowsAffected
+		}
+	}
+	if histErr := appendQueryHistory(entry); histErr != nil {
+		logFor("query").Warn("Failed to record query history", "error", histErr)
+	}
+	if mode == QueryModeWrite {
+		logOperation("query", "query."+name, started, err, "Query console write",
+			"actor", d.Actor(), "query", strings.TrimSpace(text), "documents", entry.Rows)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	return result, nil
+}
+
+func (d *Database) executeConsoleCommand(ctx context.Context, cmd bson.D, maxRows int, timeout time.Duration) (*QueryResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	name := strings.ToLower(cmd[0].Key)
+	if queryTimedCommands[name] && !hasKey(cmd, "maxTimeMS") {
+		cmd = append(cmd, bson.E{Key: "maxTimeMS", Value: timeout.Milliseconds()})
+	}
+
+	db, err := d.database()
+	if err != nil {
+		return nil, err
+	}
+	result := &QueryResult{Columns: []QueryColumn{}, Documents: []map[string]interface{}{}}
+	columns := newQueryColumnSet()
+
+	if queryCursorCommands[name] {
+		cursor, err := db.RunCommandCursor(ctx, cmd)
+		if err != nil {
+			return nil, err
+		}
+		defer cursor.Close(ctx)
+		for cursor.Next(ctx) {
+			if len(result.Documents) == maxRows {
+				result.Truncated = true
+				break
+			}
+			if err := result.addDocument(cursor.Current, columns); err != nil {
+				return nil, err
+			}
+		}
+		if err := cursor.Err(); err != nil {
+			return nil, err
+		}
+	} else {
+		reply, err := db.RunCommand(ctx, cmd).Raw()
+		if err != nil {
+			return nil, err
+		}
+		if err := result.addDocument(reply, columns); err != nil {
+			return nil, err
+		}
+		// insert / update / delete 的回應以 n 表示影響的文件數
+		if n, ok := reply.Lookup("n").AsInt64OK(); ok {
+			result.RowsAffected = n
+		}
+	}
+	result.Columns = columns.list()
+	result.RowCount = len(result.Documents)
+	return result, nil
+}
+
+func hasKey(doc bson.D, key string) bool {
+	for _, elem := range doc {
+		if elem.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// queryColumnSet 依出現順序記錄頂層欄位與型別
+type queryColumnSet struct {
+	order []string
+	types map[string][]string
+}
+
+func newQueryColumnSet() *queryColumnSet {
+	return &queryColumnSet{types: map[string][]string{}}
+}
+
+func (s *queryColumnSet) list() []QueryColumn {
+	columns := make([]QueryColumn, 0, len(s.order))
+	for _, name := range s.order {
+		columns = append(columns, QueryColumn{Name: name, Type: strings.Join(s.types[name], "|")})
+	}
+	return columns
+}
+
+// addDocument 加入一份結果文件並記錄其頂層欄位
+func (r *QueryResult) addDocument(raw bson.Raw, columns *queryColumnSet) error {
+	elements, err := raw.Elements()
+	if err != nil {
+		return fmt.Errorf("failed to read document: %w", err)
+	}
+	for _, element := range elements {
+		key, typeName := element.Key(), element.Value().Type.String()
+		known, seen := columns.types[key]
+		if !seen {
+			columns.order = append(columns.order, key)
+		}
+		if !containsString(known, typeName) {
+			columns.types[key] = append(known, typeName)
+		}
+	}
+	doc, err := browseDocument(raw)
+	if err != nil {
+		return fmt.Errorf("failed to decode document: %w", err)
+	}
+	r.Documents = append(r.Documents, doc)
+	return nil
+}
+
+// queryHistoryPath 查詢紀錄檔的位置（DB_QUERY_HISTORY_FILE，預設 query_history.jsonl），每行一筆 JSON
+func queryHistoryPath() string {
+	return appConfig().QueryHistoryFile
+}
+
+// appendQueryHistory 寫入一筆查詢紀錄
+func appendQueryHistory(entry QueryHistoryEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	queryHistoryMu.Lock()
+	defer queryHistoryMu.Unlock()
+
+	f, err := os.OpenFile(queryHistoryPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// GetQueryHistory 回傳最近的查詢紀錄（新的在前），limit 小於 1 或超過上限時使用 queryHistoryLimit
+func GetQueryHistory(limit int) ([]QueryHistoryEntry, error) {
+	if limit < 1 || limit > queryHistoryLimit {
+		limit = queryHistoryLimit
+	}
+	queryHistoryMu.Lock()
+	defer queryHistoryMu.Unlock()
+
+	entries := []QueryHistoryEntry{}
+	f, err := os.Open(queryHistoryPath())
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open query history: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var entry QueryHistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+		if len(entries) > limit {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read query history: %w", err)
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// ClearQueryHistory 刪除所有查詢紀錄
+func ClearQueryHistory() error {
+	queryHistoryMu.Lock()
+	defer queryHistoryMu.Unlock()
+	if err := os.Remove(queryHistoryPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear query history: %w", err)
+	}
+	return nil
+}
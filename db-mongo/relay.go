@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// relayUsage relay 子命令的說明
+const relayUsage = `Usage: <app> [config flags] relay
+
+Publishes the user events written to user_outbox (DB_OUTBOX=true) to the broker
+set by RELAY_BROKER until interrupted, instead of opening the window. An event
+is marked published only after the broker confirms it, so consumers receive
+every event at least once and should drop duplicates by eventId. The window and
+the serve command also run the relay when RELAY_BROKER is not none.`
+
+// relay 的輪詢設定
+const (
+	relayBatchSize      = 100
+	relayClaimTTL       = time.Minute // 領取事件的租約，執行個體中斷後由其他執行個體在租約過期後接手
+	relayRetryBaseDelay = time.Second
+	relayPurgeInterval  = 10 * time.Minute
+)
+
+// outboxRow user_outbox 中一筆尚未發送的事件
+type outboxRow struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	EventID       string             `bson:"event_id"`
+	EventType     string             `bson:"event_type"`
+	Payload       string             `bson:"payload"`
+	Attempts      int                `bson:"attempts"`
+	NextAttemptAt *time.Time         `bson:"next_attempt_at"`
+}
+
+// outboxRelay relay 的狀態
+type outboxRelay struct {
+	opts      RelayOptions
+	publisher Publisher
+	d         *Database
+	outbox    *mongo.Collection // 本輪使用的 user_outbox，資料庫無法使用時為 nil
+	lastPurge time.Time
+	failing   bool
+}
+
+// StartRelay 在背景執行 RunRelay 直到 ctx 結束；RELAY_BROKER=none 時不啟動
+func StartRelay(ctx context.Context) {
+	opts := appConfig().relayOptions()
+	if opts.Broker == RelayBrokerNone {
+		return
+	}
+	go func() {
+		if err := RunRelay(ctx, opts); err != nil {
+			logFor("relay").Error("Relay stopped", "error", err)
+		}
+	}()
+}
+
+// RunRelay 依 id 順序將 user_outbox 中尚未發送的事件送到訊息代理，直到 ctx 結束。
+// 代理確認後才標記為已發送；發送失敗的事件以指數退避重試，重試前不發送其後的事件以維持順序
+func RunRelay(ctx context.Context, opts RelayOptions) error {
+	publisher, err := newPublisher(opts)
+	if err != nil {
+		return err
+	}
+	r := &outboxRelay{opts: opts, publisher: publisher}
+	defer publisher.Close()
+	ctx = unobserved(ctx)
+	if !appConfig().Outbox {
+		logFor("relay").Warn("DB_OUTBOX is disabled; only events already in user_outbox will be published")
+	}
+	logFor("relay").Info("Relaying user events", "broker", opts.Broker, "target", relayTarget(opts))
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+		more, err := r.relayBatch(ctx)
+		if err == nil {
+			err = r.purge(ctx)
+		}
+		switch {
+		case err != nil && ctx.Err() == nil:
+			if !r.failing {
+				r.failing = true
+				logFor("relay").Warn("Failed to read user_outbox", "error", err)
+			}
+		case err == nil && r.failing:
+			r.failing = false
+			logFor("relay").Info("Reading user_outbox resumed")
+		}
+
+		if more {
+			timer.Reset(0)
+		} else {
+			timer.Reset(opts.PollInterval)
+		}
+	}
+}
+
+// relayBatch 依序發送一批到期的事件，回傳是否可能還有待發送的事件
+func (r *outboxRelay) relayBatch(ctx context.Context) (bool, error) {
+	r.d, r.outbox = currentDatabase(), nil
+	if r.d == nil || r.d.Client == nil {
+		return false, nil
+	}
+	outbox, err := r.d.collection("user_outbox")
+	if err != nil {
+		return false, err
+	}
+	r.outbox = outbox
+
+	batch, err := r.pending(ctx)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	for _, row := range batch {
+		if row.NextAttemptAt != nil && row.NextAttemptAt.After(now) {
+			return false, nil
+		}
+		claimed, err := r.claim(ctx, row.ID)
+		if err != nil || !claimed {
+			// 其他執行個體正在發送這筆事件，等它完成後再繼續
+			return false, err
+		}
+
+		publishCtx, cancel := context.WithTimeout(ctx, relayPublishTimeout)
+		err = r.publisher.Publish(publishCtx, OutboxMessage{EventID: row.EventID, Type: row.EventType, Payload: []byte(row.Payload)})
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return false, nil
+			}
+			return false, r.retryLater(ctx, row, err)
+		}
+		if err := r.markPublished(ctx, row.ID); err != nil {
+			// 事件已送出但未標記，之後會再送一次
+			return false, err
+		}
+	}
+	return len(batch) == relayBatchSize, nil
+}
+
+// pending 讀取最前面的一批尚未發送的事件
+func (r *outboxRelay) pending(ctx context.Context) ([]outboxRow, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(relayBatchSize)
+	cursor, err := r.outbox.Find(ctx, bson.M{"published_at": nil}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox events: %w", err)
+	}
+	var batch []outboxRow
+	if err := cursor.All(ctx, &batch); err != nil {
+		return nil, fmt.Errorf("failed to read outbox events: %w", err)
+	}
+	return batch, nil
+}
+
+// claim 領取一筆事件，租約期間其他執行個體不會發送；事件已發送或由其他執行個體持有時回傳 false
+func (r *outboxRelay) claim(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	now := time.Now()
+	filter := bson.M{
+		"_id":          id,
+		"published_at": nil,
+		"$or": bson.A{
+			bson.M{"claimed_until": nil},
+			bson.M{"claimed_until": bson.M{"$lt": now}},
+			bson.M{"claimed_by": migrationLockOwner},
+		},
+	}
+	update := bson.M{"$set": bson.M{"claimed_by": migrationLockOwner, "claimed_until": now.Add(relayClaimTTL)}}
+	result, err := r.outbox.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim outbox event: %w", err)
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// markPublished 標記事件已發送並釋放租約
+func (r *outboxRelay) markPublished(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.M{
+		"$set":   bson.M{"published_at": time.Now()},
+		"$inc":   bson.M{"attempts": 1},
+		"$unset": bson.M{"last_error": "", "claimed_by": "", "claimed_until": ""},
+	}
+	if _, err := r.outbox.UpdateByID(ctx, id, update); err != nil {
+		return fmt.Errorf("failed to mark outbox event published: %w", err)
+	}
+	return nil
+}
+
+// retryLater 記錄發送失敗，依嘗試次數決定下次發送的時間並釋放租約
+func (r *outboxRelay) retryLater(ctx context.Context, row outboxRow, publishErr error) error {
+	attempts := row.Attempts + 1
+	delay := relayRetryDelay(attempts, r.opts.RetryMaxDelay)
+	logFor("relay").Warn("Failed to publish user event", "event_id", row.EventID, "type", row.EventType,
+		"attempts", attempts, "retry_in", delay, "error", publishErr)
+
+	update := bson.M{
+		"$set":   bson.M{"attempts": attempts, "last_error": publishErr.Error(), "next_attempt_at": time.Now().Add(delay)},
+		"$unset": bson.M{"claimed_by": "", "claimed_until": ""},
+	}
+	if _, err := r.outbox.UpdateByID(ctx, row.ID, update); err != nil {
+		return fmt.Errorf("failed to record outbox publish failure: %w", err)
+	}
+	return nil
+}
+
+// relayRetryDelay 第 attempts 次失敗後的等待時間：1s、2s、4s…，最長 maxDelay
+func relayRetryDelay(attempts int, maxDelay time.Duration) time.Duration {
+	delay := relayRetryBaseDelay
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// purge 每 relayPurgeInterval 刪除一次超過 RELAY_RETENTION 的已發送事件
+func (r *outboxRelay) purge(ctx context.Context) error {
+	if r.outbox == nil || time.Since(r.lastPurge) < relayPurgeInterval {
+		return nil
+	}
+	result, err := r.outbox.DeleteMany(ctx, bson.M{"published_at": bson.M{"$lt": time.Now().Add(-r.opts.Retention)}})
+	if err != nil {
+		return fmt.Errorf("failed to purge published outbox events: %w", err)
+	}
+	r.lastPurge = time.Now()
+	if result.DeletedCount > 0 {
+		logFor("relay").Info("Purged published outbox events", "count", result.DeletedCount, "retention", r.opts.Retention)
+	}
+	return nil
+}
+
+// runRelayCommand 處理 `relay` 子命令：發送 user_outbox 的事件直到收到 SIGINT / SIGTERM，回傳程式結束代碼
+func runRelayCommand(args []string) int {
+	for _, arg := range args {
+		if arg == "-h" || arg == "--help" || arg == "help" {
+			fmt.Println(relayUsage)
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "unexpected argument %q\n\n%s\n", arg, relayUsage)
+		return 2
+	}
+
+	opts := appConfig().relayOptions()
+	if opts.Broker == RelayBrokerNone {
+		fmt.Fprintln(os.Stderr, "RELAY_BROKER must be amqp, mqtt or file to run the relay")
+		return 2
+	}
+
+	// 先連線並套用遷移，與桌面版啟動時相同
+	_ = GetDBInstance()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := RunRelay(ctx, opts); err != nil {
+		logFor("relay").Error("Relay stopped", "error", err)
+		return 1
+	}
+	logFor("relay").Info("Relay stopped")
+	return 0
+}
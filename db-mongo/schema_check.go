@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Schema 差異的種類；missing 表示遷移後應該存在但實際資料庫沒有，extra 則相反
+const (
+	SchemaMissingCollection = "missing_collection"
+	SchemaExtraCollection   = "extra_collection"
+	SchemaMissingIndex      = "missing_index"
+	SchemaExtraIndex        = "extra_index"
+	SchemaIndexChanged      = "index_changed"
+)
+
+// schemaCheckIgnoredCollections 遷移工具自己使用的集合，不列入比對
+var schemaCheckIgnoredCollections = map[string]bool{
+	migrationStateCollection:   true,
+	migrationHistoryCollection: true,
+	legacyMigrationCollection:  true,
+	migrationLockCollection:    true,
+}
+
+// SchemaDifference 一項 schema 差異；Field 只在 index_changed 時指出不同的屬性
+type SchemaDifference struct {
+	Kind       string `json:"kind"`
+	Collection string `json:"collection"`
+	Name       string `json:"name,omitempty"`
+	Field      string `json:"field,omitempty"`
+	Expected   string `json:"expected,omitempty"`
+	Actual     string `json:"actual,omitempty"`
+}
+
+// SchemaReport 實際 schema 與「在暫存資料庫套用遷移到相同版本」後的 schema 比對結果
+type SchemaReport struct {
+	CurrentVersion uint               `json:"currentVersion"`
+	LatestVersion  uint               `json:"latestVersion"`
+	Dirty          bool               `json:"dirty"`
+	Scratch        string             `json:"scratch"`
+	InSync         bool               `json:"inSync"`
+	Differences    []SchemaDifference `json:"differences"`
+	CheckedAt      string             `json:"checkedAt"`
+}
+
+// schemaIndex 索引定義；Keys 為依欄位順序輸出的 extended JSON
+type schemaIndex struct {
+	Name               string
+	Keys               string
+	Unique             bool
+	Sparse             bool
+	ExpireAfterSeconds string
+}
+
+// schemaSnapshot 集合名稱對應索引（以索引名稱為 key）
+type schemaSnapshot map[string]map[string]schemaIndex
+
+func (i schemaIndex) describe() string {
+	desc := i.Keys
+	if i.Unique {
+		desc += " unique"
+	}
+	if i.Sparse {
+		desc += " sparse"
+	}
+	if i.ExpireAfterSeconds != "" {
+		desc += " expireAfterSeconds=" + i.ExpireAfterSeconds
+	}
+	return desc
+}
+
+// randomSuffix 產生暫存資料庫名稱使用的隨機字串
+func randomSuffix() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// readSchema 讀取資料庫中所有集合與索引
+func readSchema(ctx context.Context, db *mongo.Database) (schemaSnapshot, error) {
+	names, err := db.ListCollectionNames(ctx, bson.M{"type": "collection"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+
+	snapshot := schemaSnapshot{}
+	for _, name := range names {
+		specs, err := db.Collection(name).Indexes().ListSpecifications(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list indexes of %s: %w", name, err)
+		}
+		indexes := map[string]schemaIndex{}
+		for _, spec := range specs {
+			idx := schemaIndex{
+				Name:   spec.Name,
+				Keys:   extJSON(spec.KeysDocument),
+				Unique: spec.Unique != nil && *spec.Unique,
+				Sparse: spec.Sparse != nil && *spec.Sparse,
+			}
+			if spec.ExpireAfterSeconds != nil {
+				idx.ExpireAfterSeconds = fmt.Sprint(*spec.ExpireAfterSeconds)
+			}
+			indexes[spec.Name] = idx
+		}
+		snapshot[name] = indexes
+	}
+	return snapshot, nil
+}
+
+// CheckSchema 在暫存資料庫套用遷移到目前版本，再與實際資料庫的集合與索引比對
+func (d *Database) CheckSchema() (*SchemaReport, error) {
+	set, err := d.loadMigrationSet()
+	if err != nil {
+		return nil, err
+	}
+	db, err := d.database()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(withOperation(context.Background(), "CheckSchema"), 30*time.Second)
+	defer cancel()
+
+	current, dirty, err := d.readMigrationState(ctx, set)
+	if err != nil {
+		return nil, err
+	}
+	if current > set.latest() {
+		return nil, fmt.Errorf("database version %d is newer than the latest migration %d", current, set.latest())
+	}
+
+	actual, err := readSchema(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database schema: %w", err)
+	}
+
+	// 暫存資料庫與實際資料庫共用同一個連線，結束後整個刪除
+	scratchName := fmt.Sprintf("%s_schema_check_%s", d.DBName, randomSuffix())
+	scratch := &Database{DBName: scratchName, Client: d.Client, DB: d.Client.Database(scratchName), actor: d.actor}
+	defer func() {
+		dropCtx, dropCancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer dropCancel()
+		if err := scratch.DB.Drop(dropCtx); err != nil {
+			logFor("schema").Warn("Failed to drop scratch database", "database", scratchName, "error", err)
+		}
+	}()
+
+	if current > 0 {
+		_, err := scratch.migrateUnlocked(context.Background(), false, func(set *migrationSet, from uint) (*MigrationPlan, error) {
+			return set.plan(from, current)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate scratch database to version %d: %w", current, err)
+		}
+	}
+
+	expected, err := readSchema(ctx, scratch.DB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scratch schema: %w", err)
+	}
+
+	report := &SchemaReport{
+		CurrentVersion: current,
+		LatestVersion:  set.latest(),
+		Dirty:          dirty,
+		Scratch:        scratchName,
+		Differences:    diffSchemas(expected, actual),
+		CheckedAt:      time.Now().Format(time.RFC3339),
+	}
+	report.InSync = len(report.Differences) == 0
+
+	logFor("schema").Info("Schema check finished", "version", current, "differences", len(report.Differences))
+	for _, diff := range report.Differences {
+		logFor("schema").Info("Schema difference",
+			"kind", diff.Kind, "collection", diff.Collection, "name", diff.Name, "field", diff.Field, "expected", diff.Expected, "actual", diff.Actual)
+	}
+	return report, nil
+}
+
+// diffSchemas 比對預期與實際的集合與索引，依名稱排序輸出
+func diffSchemas(expected, actual schemaSnapshot) []SchemaDifference {
+	diffs := []SchemaDifference{}
+
+	names := map[string]bool{}
+	for name := range expected {
+		names[name] = true
+	}
+	for name := range actual {
+		names[name] = true
+	}
+	collections := make([]string, 0, len(names))
+	for name := range names {
+		if !schemaCheckIgnoredCollections[name] {
+			collections = append(collections, name)
+		}
+	}
+	sort.Strings(collections)
+
+	for _, name := range collections {
+		exp, expOK := expected[name]
+		act, actOK := actual[name]
+		switch {
+		case !actOK:
+			diffs = append(diffs, SchemaDifference{Kind: SchemaMissingCollection, Collection: name})
+			continue
+		case !expOK:
+			diffs = append(diffs, SchemaDifference{Kind: SchemaExtraCollection, Collection: name})
+			continue
+		}
+		diffs = append(diffs, diffIndexes(name, exp, act)...)
+	}
+	return diffs
+}
+
+// diffIndexes 以索引名稱比對鍵值、唯一性、sparse 與 TTL
+func diffIndexes(collection string, expected, actual map[string]schemaIndex) []SchemaDifference {
+	var diffs []SchemaDifference
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		exp := expected[name]
+		act, ok := actual[name]
+		if !ok {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaMissingIndex, Collection: collection, Name: name, Expected: exp.describe()})
+			continue
+		}
+		if exp.Keys != act.Keys {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaIndexChanged, Collection: collection, Name: name, Field: "keys", Expected: exp.Keys, Actual: act.Keys})
+		}
+		if exp.Unique != act.Unique {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaIndexChanged, Collection: collection, Name: name, Field: "unique",
+				Expected: fmt.Sprint(exp.Unique), Actual: fmt.Sprint(act.Unique)})
+		}
+		if exp.Sparse != act.Sparse {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaIndexChanged, Collection: collection, Name: name, Field: "sparse",
+				Expected: fmt.Sprint(exp.Sparse), Actual: fmt.Sprint(act.Sparse)})
+		}
+		if exp.ExpireAfterSeconds != act.ExpireAfterSeconds {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaIndexChanged, Collection: collection, Name: name, Field: "expireAfterSeconds",
+				Expected: exp.ExpireAfterSeconds, Actual: act.ExpireAfterSeconds})
+		}
+	}
+
+	extra := make([]string, 0)
+	for name := range actual {
+		if _, ok := expected[name]; !ok {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		diffs = append(diffs, SchemaDifference{Kind: SchemaExtraIndex, Collection: collection, Name: name, Actual: actual[name].describe()})
+	}
+	return diffs
+}
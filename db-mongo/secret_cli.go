@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const secretUsage = `Usage: <app> [config flags] secret <command>
+
+Commands:
+  list           list the names of stored secrets (file backend only)
+  set NAME       store a secret; the value is read from stdin, or prompted
+                 without echo on a terminal
+  delete NAME    remove a secret
+
+The backend is chosen with APP_SECRET_BACKEND (file or keyring). The file
+backend keeps secrets in APP_SECRET_FILE, encrypted with a key derived from
+APP_SECRET_PASSPHRASE (prompted on a terminal when unset).
+
+Reference a stored secret from any setting, for example:
+  DB_PASSWORD=secret://prod-db`
+
+// runSecretCommand 處理 `secret` 子命令（不啟動視窗），回傳程式結束代碼
+func runSecretCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, secretUsage)
+		return 2
+	}
+	command, rest := args[0], args[1:]
+	if command == "-h" || command == "--help" || command == "help" {
+		fmt.Println(secretUsage)
+		return 0
+	}
+
+	wantArgs := map[string]int{"list": 0, "set": 1, "delete": 1}
+	n, ok := wantArgs[command]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown secret command %q\n\n%s\n", command, secretUsage)
+		return 2
+	}
+	if len(rest) != n {
+		fmt.Fprintf(os.Stderr, "secret %s takes %d argument(s)\n\n%s\n", command, n, secretUsage)
+		return 2
+	}
+
+	provider, err := openSecretProvider(appConfig())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	switch command {
+	case "list":
+		names, err := provider.List()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	case "set":
+		if err := validateSecretName(rest[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		value, err := readSecretValue(rest[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if err := provider.Set(rest[0], value); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Stored secret %q; reference it as %s%s\n", rest[0], secretRefPrefix, rest[0])
+	case "delete":
+		if err := provider.Delete(rest[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Deleted secret %q\n", rest[0])
+	}
+	return 0
+}
+
+// readSecretValue 讀取要儲存的機密值：終端機上不回顯並要求輸入兩次，否則讀取整個 stdin（去掉結尾換行）
+func readSecretValue(name string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret from stdin: %w", err)
+		}
+		value := strings.TrimRight(string(data), "\r\n")
+		if value == "" {
+			return "", fmt.Errorf("secret value must not be empty")
+		}
+		return value, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Value for %s: ", name)
+	first, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Repeat value for %s: ", name)
+	second, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	if string(first) != string(second) {
+		return "", fmt.Errorf("values do not match")
+	}
+	if len(first) == 0 {
+		return "", fmt.Errorf("secret value must not be empty")
+	}
+	return string(first), nil
+}
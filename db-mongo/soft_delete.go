@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetDeletedUsers 獲取所有已軟刪除的用戶（依刪除時間降序）
+func (d *Database) GetDeletedUsers() ([]map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(withOperation(context.Background(), "GetDeletedUsers"), 10*time.Second)
+	defer cancel()
+
+	collection, err := d.collection("users")
+	if err != nil {
+		return nil, err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "deleted_at", Value: -1}})
+	cursor, err := collection.Find(ctx, bson.M{"deleted_at": bson.M{"$ne": nil}}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deleted users: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	users := []map[string]interface{}{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("failed to decode deleted users: %w", err)
+	}
+	for i := range users {
+		normalizeUserDoc(users[i])
+	}
+
+	return users, nil
+}
+
+// RestoreUser 還原已軟刪除的用戶；email 已被其他未刪除的用戶使用時回傳 ErrDuplicateEmail
+func (d *Database) RestoreUser(id string) error {
+	_, err := d.restoreUser(withOperation(context.Background(), "RestoreUser"), id)
+	return err
+}
+
+// RestoreUserReturning 還原已軟刪除的用戶並回傳還原後的用戶（與還原在同一個交易中讀取）
+func (d *Database) RestoreUserReturning(id string) (map[string]interface{}, error) {
+	return d.restoreUser(withOperation(context.Background(), "RestoreUserReturning"), id)
+}
+
+// restoreUser RestoreUser 與 RestoreUserReturning 共用的實作
+func (d *Database) restoreUser(ctx context.Context, id string) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var user map[string]interface{}
+	err := d.WithTx(ctx, func(tx Repo) error {
+		if err := tx.RestoreUser(id); err != nil {
+			return err
+		}
+		var err error
+		user, err = tx.GetUserByID(id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// PurgeDeleted 永久刪除已軟刪除超過 olderThanDays 天的用戶（0 表示全部），回傳刪除筆數
+func (d *Database) PurgeDeleted(olderThanDays int) (int, error) {
+	if olderThanDays < 0 {
+		return 0, newValidationError("olderThanDays", "must not be negative")
+	}
+
+	ctx, cancel := context.WithTimeout(withOperation(context.Background(), "PurgeDeleted"), time.Minute)
+	defer cancel()
+
+	filter := bson.M{"deleted_at": bson.M{"$ne": nil}}
+	if olderThanDays > 0 {
+		filter["deleted_at"] = bson.M{"$ne": nil, "$lt": time.Now().AddDate(0, 0, -olderThanDays)}
+	}
+
+	collection, err := d.collection("users")
+	if err != nil {
+		return 0, err
+	}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query deleted users: %w", err)
+	}
+	var snapshots []bson.M
+	if err := cursor.All(ctx, &snapshots); err != nil {
+		return 0, fmt.Errorf("failed to decode deleted users: %w", err)
+	}
+
+	purged := 0
+	for _, snapshot := range snapshots {
+		objectID, ok := snapshot["_id"].(primitive.ObjectID)
+		if !ok {
+			return purged, fmt.Errorf("unexpected user id %v", snapshot["_id"])
+		}
+		// 再次確認仍為軟刪除狀態，避免刪除到期間被還原的用戶
+		result, err := collection.DeleteOne(ctx, bson.M{"_id": objectID, "deleted_at": bson.M{"$ne": nil}})
+		if err != nil {
+			return purged, fmt.Errorf("failed to purge user %s: %w", objectID.Hex(), err)
+		}
+		if result.DeletedCount == 0 {
+			continue
+		}
+		purged++
+		if err := d.recordUserChange(ctx, objectID, AuditActionPurge, snapshot, nil); err != nil {
+			return purged, err
+		}
+	}
+
+	logFor("users").Info("Purged soft-deleted users", "count", purged)
+	return purged, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLS 模式，命名與 PostgreSQL 的 sslmode 一致
+const (
+	TLSModeDisable    = "disable"     // 不加密
+	TLSModeRequire    = "require"     // 加密但不驗證伺服器憑證
+	TLSModeVerifyCA   = "verify-ca"   // 驗證伺服器憑證由信任的 CA 簽發
+	TLSModeVerifyFull = "verify-full" // 另外驗證憑證上的主機名稱
+)
+
+// TLSOptions 連線的 TLS 設定；CAFile 留空時使用系統信任的 CA，
+// ServerName 留空時以連線的主機名稱驗證憑證
+type TLSOptions struct {
+	Mode       string `json:"mode"`
+	CAFile     string `json:"caFile,omitempty"`
+	CertFile   string `json:"certFile,omitempty"`
+	KeyFile    string `json:"keyFile,omitempty"`
+	ServerName string `json:"serverName,omitempty"`
+}
+
+// envTLSOptions 依設定建立 TLS 設定
+func envTLSOptions() TLSOptions {
+	cfg := appConfig()
+	return TLSOptions{
+		Mode:       cfg.TLSMode,
+		CAFile:     cfg.TLSCAFile,
+		CertFile:   cfg.TLSCertFile,
+		KeyFile:    cfg.TLSKeyFile,
+		ServerName: cfg.TLSServerName,
+	}
+}
+
+// enabled 是否使用 TLS
+func (o TLSOptions) enabled() bool {
+	return o.Mode != "" && o.Mode != TLSModeDisable
+}
+
+// validate 檢查 TLS 設定，錯誤加入 verr
+func (o TLSOptions) validate(verr *ValidationError) {
+	switch o.Mode {
+	case "", TLSModeDisable, TLSModeRequire, TLSModeVerifyCA, TLSModeVerifyFull:
+	default:
+		verr.Add("tls.mode", fmt.Sprintf("must be one of %s, %s, %s, %s",
+			TLSModeDisable, TLSModeRequire, TLSModeVerifyCA, TLSModeVerifyFull))
+	}
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		verr.Add("tls.certFile", "client certificate and key must be set together")
+	}
+	if !o.enabled() && (o.CAFile != "" || o.CertFile != "" || o.ServerName != "") {
+		verr.Add("tls.mode", "TLS files or server name are set but TLS is disabled")
+	}
+}
+
+// config 建立 tls.Config；未啟用 TLS 時回傳 nil
+func (o TLSOptions) config(host string) (*tls.Config, error) {
+	if !o.enabled() {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: host}
+	if o.ServerName != "" {
+		cfg.ServerName = o.ServerName
+	}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in TLS CA file %s", o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if o.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	switch o.Mode {
+	case TLSModeRequire:
+		cfg.InsecureSkipVerify = true
+	case TLSModeVerifyCA:
+		// 只驗證憑證鏈，不比對主機名稱（例如以 IP 連線、憑證只有內部名稱）
+		cfg.InsecureSkipVerify = true
+		roots := cfg.RootCAs
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("server did not present a certificate")
+			}
+			opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// 部署是否支援多文件交易的偵測結果
+const (
+	txSupportUnknown int32 = iota
+	txSupported
+	txUnsupported
+)
+
+// Repo 用戶資料的操作；WithTx 傳入的 Repo 所有操作都在同一個交易中，任何一步失敗整個交易都會回復
+type Repo interface {
+	// InsertUser 插入用戶並回傳新的 id
+	InsertUser(name, email string, age int) (string, error)
+	// GetUserByID 讀取未刪除的用戶，不存在時回傳 ErrNotFound
+	GetUserByID(id string) (map[string]interface{}, error)
+	// PatchUser 以樂觀鎖部分更新用戶，回傳更新後的資料
+	PatchUser(id string, patch UserPatch) (map[string]interface{}, error)
+	// DeleteUser 刪除用戶（軟刪除模式下只標記 deleted_at）
+	DeleteUser(id string) error
+	// RestoreUser 還原已軟刪除的用戶；email 已被其他未刪除的用戶使用時回傳 ErrDuplicateEmail
+	RestoreUser(id string) error
+	// Context 回傳綁定交易的 context，以此 context 操作其他集合即可加入同一個交易
+	Context() context.Context
+}
+
+// mongoRepo 以 session context 實作 Repo；單機部署時 ctx 為一般 context，操作各自生效
+type mongoRepo struct {
+	d   *Database
+	ctx context.Context
+}
+
+// supportsTransactions 檢查部署是否為 replica set 或 sharded cluster（單機部署不支援多文件交易），結果會快取
+func (d *Database) supportsTransactions(ctx context.Context) (bool, error) {
+	switch atomic.LoadInt32(&d.txSupport) {
+	case txSupported:
+		return true, nil
+	case txUnsupported:
+		return false, nil
+	}
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := d.Client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false, fmt.Errorf("failed to detect deployment topology: %w", err)
+	}
+
+	supported := hello.SetName != "" || hello.Msg == "isdbgrid"
+	if supported {
+		atomic.StoreInt32(&d.txSupport, txSupported)
+	} else {
+		atomic.StoreInt32(&d.txSupport, txUnsupported)
+		logFor("tx").Warn("MongoDB is a standalone server, WithTx runs without a transaction (deploy a replica set for atomic multi-document writes)")
+	}
+	return supported, nil
+}
+
+// WithTx 在交易中執行 fn：fn 回傳 nil 時提交，回傳錯誤時中止。
+// 交易使用 snapshot read concern 與 majority write concern，遇到 TransientTransactionError 或
+// UnknownTransactionCommitResult 時由驅動程式重試整個 fn（直到 ctx 結束或 120 秒），因此 fn 除了資料庫操作外不應有其他副作用。
+// 單機部署不支援交易，fn 會直接執行，已完成的操作不會回復
+func (d *Database) WithTx(ctx context.Context, fn func(tx Repo) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, err := d.database(); err != nil {
+		return err
+	}
+
+	supported, err := d.supportsTransactions(ctx)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return fn(&mongoRepo{d: d, ctx: ctx})
+	}
+
+	session, err := d.Client.StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(context.Background())
+
+	opts := options.Transaction().
+		SetReadConcern(readconcern.Snapshot()).
+		SetWriteConcern(writeconcern.Majority())
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(&mongoRepo{d: d, ctx: sc})
+	}, opts)
+	return err
+}
+
+// Context 回傳綁定交易的 context
+func (r *mongoRepo) Context() context.Context {
+	return r.ctx
+}
+
+// InsertUser 插入用戶並寫入稽核紀錄
+func (r *mongoRepo) InsertUser(name, email string, age int) (string, error) {
+	if err := validateUser(name, email, age); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	user := bson.M{
+		"name":       name,
+		"email":      email,
+		"age":        age,
+		"created_at": now,
+		"updated_at": now,
+		"deleted_at": nil,
+		"version":    1,
+	}
+
+	collection, err := r.d.collection("users")
+	if err != nil {
+		return "", err
+	}
+	result, err := collection.InsertOne(r.ctx, user)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return "", ErrDuplicateEmail
+		}
+		return "", fmt.Errorf("failed to insert user: %w", err)
+	}
+
+	objectID := result.InsertedID.(primitive.ObjectID)
+	user["_id"] = objectID
+	if err := r.d.recordUserChange(r.ctx, objectID, AuditActionInsert, nil, user); err != nil {
+		return "", err
+	}
+	return objectID.Hex(), nil
+}
+
+// GetUserByID 讀取未刪除的用戶
+func (r *mongoRepo) GetUserByID(id string) (map[string]interface{}, error) {
+	return r.d.getUserByID(r.ctx, id)
+}
+
+// PatchUser 以樂觀鎖部分更新用戶並寫入稽核紀錄
+func (r *mongoRepo) PatchUser(id string, patch UserPatch) (map[string]interface{}, error) {
+	if err := validateUserPatch(patch); err != nil {
+		return nil, err
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, newValidationError("id", "invalid user ID")
+	}
+
+	set := bson.M{"updated_at": time.Now()}
+	if patch.Name != nil {
+		set["name"] = *patch.Name
+	}
+	if patch.Email != nil {
+		set["email"] = *patch.Email
+	}
+	if patch.Age != nil {
+		set["age"] = *patch.Age
+	}
+
+	collection, err := r.d.collection("users")
+	if err != nil {
+		return nil, err
+	}
+
+	// 版本號作為更新條件，比對與遞增在同一個原子操作中完成
+	var before bson.M
+	err = collection.FindOneAndUpdate(r.ctx,
+		bson.M{"_id": objectID, "deleted_at": nil, "version": patch.Version},
+		bson.M{"$set": set, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		current, err := r.d.findUserDoc(r.ctx, bson.M{"_id": objectID, "deleted_at": nil})
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to query user: %w", err)
+		}
+		return nil, &ConflictError{Expected: patch.Version, Current: docVersion(current)}
+	}
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrDuplicateEmail
+		}
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	after, err := r.d.findUserDoc(r.ctx, bson.M{"_id": objectID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+	if err := r.d.recordUserChange(r.ctx, objectID, AuditActionUpdate, before, after); err != nil {
+		return nil, err
+	}
+
+	// 稽核紀錄保留原始 BSON 快照，回傳給前端的資料另外轉換
+	result := make(map[string]interface{}, len(after))
+	for k, v := range after {
+		result[k] = v
+	}
+	return normalizeUserDoc(result), nil
+}
+
+// DeleteUser 刪除用戶並寫入稽核紀錄
+func (r *mongoRepo) DeleteUser(id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return newValidationError("id", "invalid user ID")
+	}
+
+	collection, err := r.d.collection("users")
+	if err != nil {
+		return err
+	}
+
+	var before bson.M
+	if r.d.SoftDelete {
+		err = collection.FindOneAndUpdate(r.ctx, bson.M{"_id": objectID, "deleted_at": nil},
+			bson.M{"$set": bson.M{"deleted_at": time.Now(), "updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
+			options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(&before)
+	} else {
+		err = collection.FindOneAndDelete(r.ctx, bson.M{"_id": objectID, "deleted_at": nil}).Decode(&before)
+	}
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	var after bson.M
+	if r.d.SoftDelete {
+		if after, err = r.d.findUserDoc(r.ctx, bson.M{"_id": objectID}); err != nil {
+			return fmt.Errorf("failed to query user: %w", err)
+		}
+	}
+	return r.d.recordUserChange(r.ctx, objectID, AuditActionDelete, before, after)
+}
+
+// RestoreUser 還原已軟刪除的用戶並寫入稽核紀錄
+func (r *mongoRepo) RestoreUser(id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return newValidationError("id", "invalid user ID")
+	}
+
+	collection, err := r.d.collection("users")
+	if err != nil {
+		return err
+	}
+
+	var before bson.M
+	err = collection.FindOneAndUpdate(r.ctx,
+		bson.M{"_id": objectID, "deleted_at": bson.M{"$ne": nil}},
+		bson.M{"$set": bson.M{"deleted_at": nil, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDuplicateEmail
+		}
+		return fmt.Errorf("failed to restore user: %w", err)
+	}
+
+	after, err := r.d.findUserDoc(r.ctx, bson.M{"_id": objectID})
+	if err != nil {
+		return fmt.Errorf("failed to query user: %w", err)
+	}
+	return r.d.recordUserChange(r.ctx, objectID, AuditActionRestore, before, after)
+}
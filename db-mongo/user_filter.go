@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 過濾條件支援的運算子
+const (
+	FilterOpEq      = "eq"
+	FilterOpNe      = "ne"
+	FilterOpGt      = "gt"
+	FilterOpGte     = "gte"
+	FilterOpLt      = "lt"
+	FilterOpLte     = "lte"
+	FilterOpLike    = "like"
+	FilterOpIn      = "in"
+	FilterOpBetween = "between"
+)
+
+// 條件群組的組合方式
+const (
+	FilterLogicAnd = "and"
+	FilterLogicOr  = "or"
+)
+
+// maxFilterDepth 限制群組巢狀層數，避免前端傳入過深的條件樹
+const maxFilterDepth = 5
+
+// FilterCondition 單一欄位的比較條件
+// in 使用 Values 作為清單；between 的 Values 必須恰好兩個值，依序為下界與上界（含）
+type FilterCondition struct {
+	Field  string        `json:"field"`
+	Op     string        `json:"op"`
+	Value  interface{}   `json:"value"`
+	Values []interface{} `json:"values"`
+}
+
+// UserFilter 結構化的用戶查詢條件
+// Conditions 與 Groups 依 Logic（and / or，預設 and）組合；Keyword 會以 AND 套用在整組條件上
+type UserFilter struct {
+	Logic      string            `json:"logic"`
+	Keyword    string            `json:"keyword"`
+	Conditions []FilterCondition `json:"conditions"`
+	Groups     []UserFilter      `json:"groups"`
+}
+
+// filterFieldType 可過濾欄位的值型別
+type filterFieldType int
+
+const (
+	filterFieldInt filterFieldType = iota
+	filterFieldString
+	filterFieldTime
+	filterFieldObjectID
+)
+
+// userFilterFields 允許過濾的欄位白名單，避免前端傳入任意欄位或 $ 運算子
+var userFilterFields = map[string]filterFieldType{
+	"id":         filterFieldObjectID,
+	"name":       filterFieldString,
+	"email":      filterFieldString,
+	"age":        filterFieldInt,
+	"created_at": filterFieldTime,
+}
+
+// checkFilterOp 檢查運算子是否適用於該欄位型別
+func checkFilterOp(field string, fieldType filterFieldType, op string) error {
+	switch op {
+	case FilterOpEq, FilterOpNe, FilterOpIn:
+		return nil
+	case FilterOpGt, FilterOpGte, FilterOpLt, FilterOpLte, FilterOpBetween:
+		if fieldType == filterFieldString || fieldType == filterFieldObjectID {
+			return fmt.Errorf("operator %q is not supported on field %q", op, field)
+		}
+		return nil
+	case FilterOpLike:
+		if fieldType != filterFieldString {
+			return fmt.Errorf("operator %q is not supported on field %q", op, field)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown filter operator %q", op)
+	}
+}
+
+// coerceFilterValue 將前端傳入的值（JSON 解碼後多為 float64 / string）轉換為欄位型別
+func coerceFilterValue(field string, fieldType filterFieldType, value interface{}) (interface{}, error) {
+	switch fieldType {
+	case filterFieldInt:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case int64:
+			return int(v), nil
+		case float64:
+			if v != math.Trunc(v) {
+				return nil, fmt.Errorf("field %q expects an integer, got %v", field, v)
+			}
+			return int(v), nil
+		case json.Number:
+			n, err := strconv.Atoi(v.String())
+			if err != nil {
+				return nil, fmt.Errorf("field %q expects an integer, got %q", field, v)
+			}
+			return n, nil
+		case string:
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("field %q expects an integer, got %q", field, v)
+			}
+			return n, nil
+		}
+	case filterFieldString:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case filterFieldTime:
+		switch v := value.(type) {
+		case time.Time:
+			return v, nil
+		case string:
+			for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+				if t, err := time.ParseInLocation(layout, strings.TrimSpace(v), time.Local); err == nil {
+					return t, nil
+				}
+			}
+			return nil, fmt.Errorf("field %q expects a date (YYYY-MM-DD or RFC3339), got %q", field, v)
+		}
+	case filterFieldObjectID:
+		if v, ok := value.(string); ok {
+			objectID, err := primitive.ObjectIDFromHex(v)
+			if err != nil {
+				return nil, fmt.Errorf("field %q expects an ObjectID hex string, got %q", field, v)
+			}
+			return objectID, nil
+		}
+	}
+	return nil, fmt.Errorf("field %q has unsupported value %v (%T)", field, value, value)
+}
+
+// userFilterDocFields 對應到 MongoDB 文件中的實際欄位名稱
+var userFilterDocFields = map[string]string{
+	"id": "_id",
+}
+
+// keywordRegex 建立不分大小寫的子字串比對，關鍵字中的正則特殊字元會被跳脫
+func keywordRegex(keyword string) primitive.Regex {
+	return primitive.Regex{Pattern: regexp.QuoteMeta(keyword), Options: "i"}
+}
+
+// buildUserFilter 將 UserFilter 轉換為 MongoDB 查詢文件
+func buildUserFilter(filter UserFilter) (bson.M, error) {
+	doc, err := buildUserFilterGroup(filter, 1)
+	if err != nil {
+		return nil, err
+	}
+	// 一律排除已軟刪除的用戶
+	if doc == nil {
+		return bson.M{"deleted_at": nil}, nil
+	}
+	return bson.M{"$and": []bson.M{{"deleted_at": nil}, doc}}, nil
+}
+
+func buildUserFilterGroup(filter UserFilter, depth int) (bson.M, error) {
+	if depth > maxFilterDepth {
+		return nil, fmt.Errorf("filter groups are nested deeper than %d levels", maxFilterDepth)
+	}
+
+	logicKey := "$and"
+	switch strings.ToLower(filter.Logic) {
+	case "", FilterLogicAnd:
+	case FilterLogicOr:
+		logicKey = "$or"
+	default:
+		return nil, fmt.Errorf("unknown filter logic %q", filter.Logic)
+	}
+
+	var clauses []bson.M
+	for _, cond := range filter.Conditions {
+		clause, err := buildUserFilterCondition(cond)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	for _, sub := range filter.Groups {
+		clause, err := buildUserFilterGroup(sub, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if clause != nil {
+			clauses = append(clauses, clause)
+		}
+	}
+
+	var combined bson.M
+	switch len(clauses) {
+	case 0:
+	case 1:
+		combined = clauses[0]
+	default:
+		combined = bson.M{logicKey: clauses}
+	}
+
+	if keyword := strings.TrimSpace(filter.Keyword); keyword != "" {
+		keywordClause := bson.M{
+			"$or": []bson.M{
+				{"name": keywordRegex(keyword)},
+				{"email": keywordRegex(keyword)},
+			},
+		}
+		if combined == nil {
+			return keywordClause, nil
+		}
+		return bson.M{"$and": []bson.M{keywordClause, combined}}, nil
+	}
+
+	return combined, nil
+}
+
+func buildUserFilterCondition(cond FilterCondition) (bson.M, error) {
+	field := strings.ToLower(strings.TrimSpace(cond.Field))
+	fieldType, ok := userFilterFields[field]
+	if !ok {
+		return nil, fmt.Errorf("unknown filter field %q", cond.Field)
+	}
+	op := strings.ToLower(cond.Op)
+	if err := checkFilterOp(field, fieldType, op); err != nil {
+		return nil, err
+	}
+
+	docField := field
+	if mapped, ok := userFilterDocFields[field]; ok {
+		docField = mapped
+	}
+
+	switch op {
+	case FilterOpIn:
+		if len(cond.Values) == 0 {
+			return nil, fmt.Errorf("operator %q on field %q requires at least one value", op, field)
+		}
+		values := make([]interface{}, 0, len(cond.Values))
+		for _, raw := range cond.Values {
+			value, err := coerceFilterValue(field, fieldType, raw)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return bson.M{docField: bson.M{"$in": values}}, nil
+
+	case FilterOpBetween:
+		if len(cond.Values) != 2 {
+			return nil, fmt.Errorf("operator %q on field %q requires exactly two values", op, field)
+		}
+		low, err := coerceFilterValue(field, fieldType, cond.Values[0])
+		if err != nil {
+			return nil, err
+		}
+		high, err := coerceFilterValue(field, fieldType, cond.Values[1])
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{docField: bson.M{"$gte": low, "$lte": high}}, nil
+
+	case FilterOpLike:
+		value, err := coerceFilterValue(field, fieldType, cond.Value)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{docField: keywordRegex(value.(string))}, nil
+	}
+
+	value, err := coerceFilterValue(field, fieldType, cond.Value)
+	if err != nil {
+		return nil, err
+	}
+	operators := map[string]string{
+		FilterOpEq:  "$eq",
+		FilterOpNe:  "$ne",
+		FilterOpGt:  "$gt",
+		FilterOpGte: "$gte",
+		FilterOpLt:  "$lt",
+		FilterOpLte: "$lte",
+	}
+	return bson.M{docField: bson.M{operators[op]: value}}, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBuildUserFilter(t *testing.T) {
+	id := primitive.NewObjectID()
+	live := bson.M{"deleted_at": nil}
+	and := func(doc bson.M) bson.M { return bson.M{"$and": []bson.M{live, doc}} }
+	keyword := func(pattern string) bson.M {
+		regex := primitive.Regex{Pattern: pattern, Options: "i"}
+		return bson.M{"$or": []bson.M{{"name": regex}, {"email": regex}}}
+	}
+
+	tests := []struct {
+		name   string
+		filter UserFilter
+		want   bson.M
+	}{
+		{
+			name:   "no conditions",
+			filter: UserFilter{},
+			want:   live,
+		},
+		{
+			name:   "keyword only",
+			filter: UserFilter{Keyword: " b "},
+			want:   and(keyword("b")),
+		},
+		{
+			name:   "regex metacharacters are escaped",
+			filter: UserFilter{Keyword: `a.b*(c)+[d]$^|\`},
+			want:   and(keyword(`a\.b\*\(c\)\+\[d\]\$\^\|\\`)),
+		},
+		{
+			name:   "eq",
+			filter: UserFilter{Conditions: []FilterCondition{{Field: "name", Op: "eq", Value: "Alice"}}},
+			want:   and(bson.M{"name": bson.M{"$eq": "Alice"}}),
+		},
+		{
+			name:   "ne",
+			filter: UserFilter{Conditions: []FilterCondition{{Field: "email", Op: "ne", Value: "a@example.com"}}},
+			want:   and(bson.M{"email": bson.M{"$ne": "a@example.com"}}),
+		},
+		{
+			name:   "gt",
+			filter: UserFilter{Conditions: []FilterCondition{{Field: "age", Op: "gt", Value: "3"}}},
+			want:   and(bson.M{"age": bson.M{"$gt": 3}}),
+		},
+		{
+			name:   "gte on time",
+			filter: UserFilter{Conditions: []FilterCondition{{Field: "created_at", Op: "gte", Value: "2024-01-02T03:04:05Z"}}},
+			want:   and(bson.M{"created_at": bson.M{"$gte": time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}}),
+		},
+		{
+			name:   "lt",
+			filter: UserFilter{Conditions: []FilterCondition{{Field: "age", Op: "lt", Value: 60.0}}},
+			want:   and(bson.M{"age": bson.M{"$lt": 60}}),
+		},
+		{
+			name:   "lte on date",
+			filter: UserFilter{Conditions: []FilterCondition{{Field: "created_at", Op: "lte", Value: "2024-01-02"}}},
+			want:   and(bson.M{"created_at": bson.M{"$lte": time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)}}),
+		},
+		{
+			name:   "like escapes the value",
+			filter: UserFilter{Conditions: []FilterCondition{{Field: "email", Op: "like", Value: "+1@example.com"}}},
+			want:   and(bson.M{"email": primitive.Regex{Pattern: `\+1@example\.com`, Options: "i"}}),
+		},
+		{
+			name:   "in on id",
+			filter: UserFilter{Conditions: []FilterCondition{{Field: "id", Op: "in", Values: []interface{}{id.Hex()}}}},
+			want:   and(bson.M{"_id": bson.M{"$in": []interface{}{id}}}),
+		},
+		{
+			name:   "between",
+			filter: UserFilter{Conditions: []FilterCondition{{Field: "age", Op: "between", Values: []interface{}{10.0, "60"}}}},
+			want:   and(bson.M{"age": bson.M{"$gte": 10, "$lte": 60}}),
+		},
+		{
+			name: "nested group with keyword",
+			filter: UserFilter{
+				Logic:      "or",
+				Conditions: []FilterCondition{{Field: "name", Op: "eq", Value: "Alice"}},
+				Groups:     []UserFilter{{Keyword: "x", Conditions: []FilterCondition{{Field: "age", Op: "gt", Value: "3"}}}},
+			},
+			want: and(bson.M{"$or": []bson.M{
+				{"name": bson.M{"$eq": "Alice"}},
+				{"$and": []bson.M{keyword("x"), {"age": bson.M{"$gt": 3}}}},
+			}}),
+		},
+		{
+			name: "keyword with several conditions",
+			filter: UserFilter{
+				Keyword: "b",
+				Conditions: []FilterCondition{
+					{Field: "age", Op: "gte", Value: 18.0},
+					{Field: "name", Op: "ne", Value: "Bot"},
+				},
+			},
+			want: and(bson.M{"$and": []bson.M{
+				keyword("b"),
+				{"$and": []bson.M{{"age": bson.M{"$gte": 18}}, {"name": bson.M{"$ne": "Bot"}}}},
+			}}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildUserFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("buildUserFilter: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filter =\n  %#v\nwant\n  %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildUserFilterErrors(t *testing.T) {
+	deep := UserFilter{}
+	for i := 0; i < maxFilterDepth; i++ {
+		deep = UserFilter{Groups: []UserFilter{deep}}
+	}
+	tests := []struct {
+		name    string
+		filter  UserFilter
+		wantErr string
+	}{
+		{"unknown field", UserFilter{Conditions: []FilterCondition{{Field: "password", Op: "eq", Value: "x"}}}, "unknown filter field"},
+		{"operator injection", UserFilter{Conditions: []FilterCondition{{Field: "$where", Op: "eq", Value: "1"}}}, "unknown filter field"},
+		{"unknown operator", UserFilter{Conditions: []FilterCondition{{Field: "age", Op: "$gt", Value: 1.0}}}, "unknown filter operator"},
+		{"like on integer", UserFilter{Conditions: []FilterCondition{{Field: "age", Op: "like", Value: "1"}}}, "not supported"},
+		{"range on string", UserFilter{Conditions: []FilterCondition{{Field: "name", Op: "gt", Value: "a"}}}, "not supported"},
+		{"range on id", UserFilter{Conditions: []FilterCondition{{Field: "id", Op: "lt", Value: primitive.NewObjectID().Hex()}}}, "not supported"},
+		{"fractional integer", UserFilter{Conditions: []FilterCondition{{Field: "age", Op: "eq", Value: 1.5}}}, "expects an integer"},
+		{"invalid object id", UserFilter{Conditions: []FilterCondition{{Field: "id", Op: "eq", Value: "42"}}}, "expects an ObjectID"},
+		{"invalid date", UserFilter{Conditions: []FilterCondition{{Field: "created_at", Op: "gt", Value: "yesterday"}}}, "expects a date"},
+		{"between needs two values", UserFilter{Conditions: []FilterCondition{{Field: "age", Op: "between", Values: []interface{}{1.0}}}}, "exactly two values"},
+		{"between rejects three values", UserFilter{Conditions: []FilterCondition{{Field: "age", Op: "between", Values: []interface{}{1.0, 2.0, 3.0}}}}, "exactly two values"},
+		{"empty in", UserFilter{Conditions: []FilterCondition{{Field: "id", Op: "in"}}}, "at least one value"},
+		{"unknown logic", UserFilter{Logic: "xor"}, "unknown filter logic"},
+		{"too deep", deep, "nested deeper"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := buildUserFilter(tt.filter)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
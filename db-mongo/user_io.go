@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 匯入 / 匯出支援的檔案格式
+const (
+	FormatCSV    = "csv"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+// 匯入時遇到 email 已存在的處理方式
+const (
+	ImportModeUpsert = "upsert" // 以檔案內容更新既有用戶
+	ImportModeSkip   = "skip"   // 略過既有用戶
+	ImportModeFail   = "fail"   // 任一列衝突或不合法即中止並回滾
+)
+
+// importBatchSize 每批次寫入的筆數
+const importBatchSize = 200
+
+// ImportRowError 單列匯入失敗的原因
+type ImportRowError struct {
+	Line    int          `json:"line"`
+	Email   string       `json:"email"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// ImportReport 匯入結果（dry-run 時為預估結果）
+type ImportReport struct {
+	Format   string           `json:"format"`
+	Mode     string           `json:"mode"`
+	DryRun   bool             `json:"dryRun"`
+	Total    int              `json:"total"`
+	Inserted int              `json:"inserted"`
+	Updated  int              `json:"updated"`
+	Skipped  int              `json:"skipped"`
+	Failed   int              `json:"failed"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+// addError 記錄單列錯誤
+func (r *ImportReport) addError(rec importRecord, err error) {
+	rowErr := ImportRowError{Line: rec.Line, Email: rec.Email, Message: err.Error()}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		rowErr.Fields = validationErr.Fields
+	}
+	r.Failed++
+	r.Errors = append(r.Errors, rowErr)
+}
+
+// ExportReport 匯出結果
+type ExportReport struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	Count  int    `json:"count"`
+}
+
+// importRecord 從檔案讀出的一列用戶資料，Err 為該列的解析錯誤
+type importRecord struct {
+	Line  int
+	Name  string
+	Email string
+	Age   int
+	Err   error
+}
+
+// exportRecord 匯出檔案中的一列用戶資料
+type exportRecord struct {
+	ID        interface{} `json:"id"`
+	Name      string      `json:"name"`
+	Email     string      `json:"email"`
+	Age       int         `json:"age"`
+	CreatedAt string      `json:"created_at"`
+}
+
+// resolveFormat 未指定格式時依副檔名判斷
+func resolveFormat(path, format string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		if format == "jsonl" {
+			format = FormatNDJSON
+		}
+	}
+	switch format {
+	case FormatCSV, FormatJSON, FormatNDJSON:
+		return format, nil
+	}
+	return "", newValidationError("format", fmt.Sprintf("unsupported format %q (csv, json, ndjson)", format))
+}
+
+// resolveImportMode 檢查匯入模式，預設為 fail
+func resolveImportMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "":
+		return ImportModeFail, nil
+	case ImportModeUpsert, ImportModeSkip, ImportModeFail:
+		return mode, nil
+	}
+	return "", newValidationError("mode", fmt.Sprintf("unsupported import mode %q (upsert, skip, fail)", mode))
+}
+
+// readImportFile 逐列讀取匯入檔並呼叫 fn，不會一次載入整個檔案
+func readImportFile(path, format string, fn func(importRecord) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open import file: %w", err)
+	}
+	defer file.Close()
+
+	switch format {
+	case FormatCSV:
+		return readCSVRecords(file, fn)
+	case FormatJSON:
+		return readJSONRecords(file, fn)
+	default:
+		return readNDJSONRecords(file, fn)
+	}
+}
+
+func readCSVRecords(r io.Reader, fn func(importRecord) error) error {
+	reader := csv.NewReader(bufio.NewReader(r))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"name", "email"} {
+		if _, ok := columns[required]; !ok {
+			return fmt.Errorf("CSV header is missing column %q", required)
+		}
+	}
+	cell := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read CSV line %d: %w", line, err)
+		}
+		rec := importRecord{Line: line, Name: cell(row, "name"), Email: cell(row, "email")}
+		if age := cell(row, "age"); age != "" {
+			rec.Age, rec.Err = parseImportAge(age)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+func readJSONRecords(r io.Reader, fn func(importRecord) error) error {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	decoder.UseNumber()
+
+	token, err := decoder.Token()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read JSON: %w", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("JSON import file must contain an array of users")
+	}
+
+	for index := 1; decoder.More(); index++ {
+		var obj map[string]interface{}
+		if err := decoder.Decode(&obj); err != nil {
+			return fmt.Errorf("failed to decode JSON element %d: %w", index, err)
+		}
+		if err := fn(recordFromObject(index, obj)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readNDJSONRecords(r io.Reader, fn func(importRecord) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+		var obj map[string]interface{}
+		rec := importRecord{Line: line}
+		if err := decoder.Decode(&obj); err != nil {
+			rec.Err = fmt.Errorf("invalid JSON: %w", err)
+		} else {
+			rec = recordFromObject(line, obj)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read NDJSON: %w", err)
+	}
+	return nil
+}
+
+// recordFromObject 將 JSON 物件轉換為匯入列
+func recordFromObject(line int, obj map[string]interface{}) importRecord {
+	rec := importRecord{Line: line}
+	rec.Name, _ = obj["name"].(string)
+	rec.Email, _ = obj["email"].(string)
+	rec.Name = strings.TrimSpace(rec.Name)
+	rec.Email = strings.TrimSpace(rec.Email)
+	if age, ok := obj["age"]; ok && age != nil {
+		value, err := coerceFilterValue("age", filterFieldInt, age)
+		if err != nil {
+			rec.Err = newValidationError("age", err.Error())
+		} else {
+			rec.Age = value.(int)
+		}
+	}
+	return rec
+}
+
+// parseImportAge 解析 CSV 的 age 欄位
+func parseImportAge(s string) (int, error) {
+	value, err := coerceFilterValue("age", filterFieldInt, s)
+	if err != nil {
+		return 0, newValidationError("age", err.Error())
+	}
+	return value.(int), nil
+}
+
+// userRecordWriter 依格式逐筆寫出匯出資料
+type userRecordWriter interface {
+	Write(rec exportRecord) error
+	Close() error
+}
+
+// exportFile 先寫入暫存檔，成功後才更名為目標檔案，避免留下不完整的匯出檔
+type exportFile struct {
+	file   *os.File
+	buf    *bufio.Writer
+	path   string
+	writer userRecordWriter
+}
+
+func createExportFile(path, format string) (*exportFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export file: %w", err)
+	}
+	out := &exportFile{file: file, buf: bufio.NewWriter(file), path: path}
+	switch format {
+	case FormatCSV:
+		out.writer = newCSVRecordWriter(out.buf)
+	case FormatJSON:
+		out.writer = &jsonRecordWriter{w: out.buf}
+	default:
+		out.writer = &ndjsonRecordWriter{enc: json.NewEncoder(out.buf)}
+	}
+	return out, nil
+}
+
+// Write 寫出一筆用戶資料
+func (f *exportFile) Write(rec exportRecord) error {
+	return f.writer.Write(rec)
+}
+
+// Commit 寫完所有資料後更名為目標檔案
+func (f *exportFile) Commit() error {
+	if err := f.writer.Close(); err != nil {
+		f.Abort()
+		return fmt.Errorf("failed to finish export: %w", err)
+	}
+	if err := f.buf.Flush(); err != nil {
+		f.Abort()
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	if err := f.file.Close(); err != nil {
+		os.Remove(f.file.Name())
+		return fmt.Errorf("failed to close export file: %w", err)
+	}
+	if err := os.Rename(f.file.Name(), f.path); err != nil {
+		os.Remove(f.file.Name())
+		return fmt.Errorf("failed to move export file into place: %w", err)
+	}
+	return nil
+}
+
+// Abort 放棄匯出並刪除暫存檔
+func (f *exportFile) Abort() {
+	f.file.Close()
+	os.Remove(f.file.Name())
+}
+
+type csvRecordWriter struct {
+	w *csv.Writer
+}
+
+func newCSVRecordWriter(w io.Writer) *csvRecordWriter {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"id", "name", "email", "age", "created_at"})
+	return &csvRecordWriter{w: cw}
+}
+
+func (c *csvRecordWriter) Write(rec exportRecord) error {
+	return c.w.Write([]string{fmt.Sprint(rec.ID), rec.Name, rec.Email, fmt.Sprint(rec.Age), rec.CreatedAt})
+}
+
+func (c *csvRecordWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonRecordWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonRecordWriter) Write(rec exportRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	prefix := ",\n  "
+	if j.count == 0 {
+		prefix = "[\n  "
+	}
+	j.count++
+	if _, err := io.WriteString(j.w, prefix); err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonRecordWriter) Close() error {
+	closing := "\n]\n"
+	if j.count == 0 {
+		closing = "[]\n"
+	}
+	_, err := io.WriteString(j.w, closing)
+	return err
+}
+
+type ndjsonRecordWriter struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonRecordWriter) Write(rec exportRecord) error {
+	return n.enc.Encode(rec)
+}
+
+func (n *ndjsonRecordWriter) Close() error {
+	return nil
+}
+
+// formatExportTime 統一匯出檔的時間格式
+func formatExportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS user_audit;
+
+ALTER TABLE users
+    ADD UNIQUE INDEX email (email),
+    DROP INDEX idx_users_email,
+    DROP INDEX idx_users_email_live,
+    DROP COLUMN live_email;
+
+DROP INDEX idx_users_deleted_at ON users;
+
+ALTER TABLE users DROP COLUMN deleted_at;
\ No newline at end of file
@@ -0,0 +1,20 @@
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL;
+
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
+
+ALTER TABLE users
+    ADD COLUMN live_email VARCHAR(255) AS (IF(deleted_at IS NULL, email, NULL)) STORED INVISIBLE,
+    ADD UNIQUE INDEX idx_users_email_live (live_email),
+    ADD INDEX idx_users_email (email),
+    DROP INDEX email;
+
+CREATE TABLE IF NOT EXISTS user_audit (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    before_data JSON NULL,
+    after_data JSON NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_user_audit_user_id (user_id, created_at)
+);
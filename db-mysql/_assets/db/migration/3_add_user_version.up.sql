@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN updated_at TIMESTAMP NULL DEFAULT NULL;
+
+UPDATE users SET updated_at = created_at WHERE updated_at IS NULL;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS user_outbox (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    event_id VARCHAR(36) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    user_id INT NOT NULL,
+    payload JSON NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NULL DEFAULT NULL,
+    last_error TEXT NULL,
+    claimed_by VARCHAR(255) NULL,
+    claimed_until TIMESTAMP NULL DEFAULT NULL,
+    published_at TIMESTAMP NULL DEFAULT NULL,
+    UNIQUE INDEX idx_user_outbox_event_id (event_id),
+    INDEX idx_user_outbox_pending (published_at, id)
+);
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"strings"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 // App struct
@@ -20,10 +22,26 @@ func NewApp() *App {
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
-	
+
+	// 連線狀態變化轉送給前端
+	SetConnectionListener(func(state ConnectionState) {
+		runtime.EventsEmit(a.ctx, ConnectionStateEvent, state)
+	})
+	// 新日誌轉送給前端
+	SetLogListener(func(entry LogEntry) {
+		runtime.EventsEmit(a.ctx, LogEntryEvent, entry)
+	})
+
+	// 任何程序的用戶異動轉送給前端（user.created、user.updated、user.deleted）
+	SetUserChangeListener(func(event UserChangeEvent) {
+		runtime.EventsEmit(a.ctx, event.Type, event)
+	})
+
 	// 初始化資料庫
 	_ = GetDBInstance()
-	log.Println("Database initialized via migration")
+	logFor("app").Info("Database initialized via migration")
+	go WatchUserChanges(ctx)
+	StartRelay(ctx)
 }
 
 // Greet returns a greeting for the given name
@@ -40,17 +58,29 @@ type User struct {
 }
 
 // CreateUser 創建新用戶
-func (a *App) CreateUser(name, email string, age int) (string, error) {
+func (a *App) CreateUser(name, email string, age int) (_ string, err error) {
+	defer traceBinding("CreateUser", &err)()
 	db := GetDBInstance()
-	err := db.InsertUser(name, email, age)
+	err = db.InsertUser(name, email, age)
 	if err != nil {
 		return "", fmt.Errorf("failed to create user: %w", err)
 	}
 	return "User created successfully", nil
 }
 
+// CreateUserReturning 創建新用戶並回傳新用戶的資料；CreateUser 只回傳訊息，保留給既有的呼叫端
+func (a *App) CreateUserReturning(name, email string, age int) (_ map[string]interface{}, err error) {
+	defer traceBinding("CreateUserReturning", &err)()
+	user, err := GetDBInstance().InsertUserReturning(name, email, age)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return user, nil
+}
+
 // GetAllUsers 獲取所有用戶
-func (a *App) GetAllUsers() ([]map[string]interface{}, error) {
+func (a *App) GetAllUsers() (_ []map[string]interface{}, err error) {
+	defer traceBinding("GetAllUsers", &err)()
 	db := GetDBInstance()
 	users, err := db.GetAllUsers()
 	if err != nil {
@@ -60,7 +90,8 @@ func (a *App) GetAllUsers() ([]map[string]interface{}, error) {
 }
 
 // GetUser 根據 ID 獲取用戶
-func (a *App) GetUser(id int) (map[string]interface{}, error) {
+func (a *App) GetUser(id int) (_ map[string]interface{}, err error) {
+	defer traceBinding("GetUser", &err)()
 	db := GetDBInstance()
 	user, err := db.GetUserByID(id)
 	if err != nil {
@@ -69,20 +100,33 @@ func (a *App) GetUser(id int) (map[string]interface{}, error) {
 	return user, nil
 }
 
-// UpdateUser 更新用戶
-func (a *App) UpdateUser(id int, name, email string, age int) (string, error) {
+// UpdateUser 更新用戶，version 為讀取用戶時取得的版本號
+func (a *App) UpdateUser(id int, name, email string, age int, version int64) (_ string, err error) {
+	defer traceBinding("UpdateUser", &err)()
 	db := GetDBInstance()
-	err := db.UpdateUser(id, name, email, age)
+	err = db.UpdateUser(id, name, email, age, version)
 	if err != nil {
 		return "", fmt.Errorf("failed to update user: %w", err)
 	}
 	return "User updated successfully", nil
 }
 
+// PatchUser 部分更新用戶，只修改有提供的欄位，回傳更新後的資料
+func (a *App) PatchUser(id int, patch UserPatch) (_ map[string]interface{}, err error) {
+	defer traceBinding("PatchUser", &err)()
+	db := GetDBInstance()
+	user, err := db.PatchUser(id, patch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	return user, nil
+}
+
 // DeleteUser 刪除用戶
-func (a *App) DeleteUser(id int) (string, error) {
+func (a *App) DeleteUser(id int) (_ string, err error) {
+	defer traceBinding("DeleteUser", &err)()
 	db := GetDBInstance()
-	err := db.DeleteUser(id)
+	err = db.DeleteUser(id)
 	if err != nil {
 		return "", fmt.Errorf("failed to delete user: %w", err)
 	}
@@ -90,7 +134,8 @@ func (a *App) DeleteUser(id int) (string, error) {
 }
 
 // SearchUsers 搜尋用戶（支援分頁）
-func (a *App) SearchUsers(keyword string, page, pageSize int) (map[string]interface{}, error) {
+func (a *App) SearchUsers(keyword string, page, pageSize int) (_ map[string]interface{}, err error) {
+	defer traceBinding("SearchUsers", &err)()
 	db := GetDBInstance()
 	users, total, err := db.SearchUsers(keyword, page, pageSize)
 	if err != nil {
@@ -106,3 +151,384 @@ func (a *App) SearchUsers(keyword string, page, pageSize int) (map[string]interf
 	
 	return result, nil
 }
+
+// FilterUsers 依結構化條件查詢用戶（支援分頁）
+func (a *App) FilterUsers(filter UserFilter, page, pageSize int) (_ map[string]interface{}, err error) {
+	defer traceBinding("FilterUsers", &err)()
+	db := GetDBInstance()
+	users, total, err := db.FilterUsers(filter, page, pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter users: %w", err)
+	}
+
+	result := map[string]interface{}{
+		"users":    users,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	}
+
+	return result, nil
+}
+
+// ImportUsers 從 CSV / JSON / NDJSON 檔案匯入用戶（mode: upsert / skip / fail）
+func (a *App) ImportUsers(path, format, mode string) (_ *ImportReport, err error) {
+	defer traceBinding("ImportUsers", &err)()
+	db := GetDBInstance()
+	report, err := db.ImportUsers(path, format, mode, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import users: %w", err)
+	}
+	return report, nil
+}
+
+// PreviewImport 模擬匯入並回報會失敗的列，不寫入資料庫
+func (a *App) PreviewImport(path, format, mode string) (_ *ImportReport, err error) {
+	defer traceBinding("PreviewImport", &err)()
+	db := GetDBInstance()
+	report, err := db.ImportUsers(path, format, mode, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to preview import: %w", err)
+	}
+	return report, nil
+}
+
+// ExportUsers 將符合條件的用戶匯出到檔案
+func (a *App) ExportUsers(filter UserFilter, format, path string) (_ *ExportReport, err error) {
+	defer traceBinding("ExportUsers", &err)()
+	db := GetDBInstance()
+	report, err := db.ExportUsers(filter, format, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export users: %w", err)
+	}
+	return report, nil
+}
+
+// GetDeletedUsers 獲取已軟刪除的用戶
+func (a *App) GetDeletedUsers() (_ []map[string]interface{}, err error) {
+	defer traceBinding("GetDeletedUsers", &err)()
+	db := GetDBInstance()
+	users, err := db.GetDeletedUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deleted users: %w", err)
+	}
+	return users, nil
+}
+
+// RestoreUser 還原已軟刪除的用戶
+func (a *App) RestoreUser(id int) (_ string, err error) {
+	defer traceBinding("RestoreUser", &err)()
+	db := GetDBInstance()
+	err = db.RestoreUser(id)
+	if err != nil {
+		return "", fmt.Errorf("failed to restore user: %w", err)
+	}
+	return "User restored successfully", nil
+}
+
+// RestoreUserReturning 還原已軟刪除的用戶並回傳還原後的資料；RestoreUser 只回傳訊息，保留給既有的呼叫端
+func (a *App) RestoreUserReturning(id int) (_ map[string]interface{}, err error) {
+	defer traceBinding("RestoreUserReturning", &err)()
+	user, err := GetDBInstance().RestoreUserReturning(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore user: %w", err)
+	}
+	return user, nil
+}
+
+// PurgeDeleted 永久刪除軟刪除超過指定天數的用戶（0 表示全部）
+func (a *App) PurgeDeleted(olderThanDays int) (_ int, err error) {
+	defer traceBinding("PurgeDeleted", &err)()
+	db := GetDBInstance()
+	count, err := db.PurgeDeleted(olderThanDays)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted users: %w", err)
+	}
+	return count, nil
+}
+
+// GetUserAudit 獲取用戶的稽核紀錄
+func (a *App) GetUserAudit(id int) (_ []AuditEntry, err error) {
+	defer traceBinding("GetUserAudit", &err)()
+	db := GetDBInstance()
+	entries, err := db.GetUserAudit(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit records: %w", err)
+	}
+	return entries, nil
+}
+
+// SetActor 設定寫入稽核紀錄的操作者名稱
+func (a *App) SetActor(name string) (_ string, err error) {
+	defer traceBinding("SetActor", &err)()
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", newValidationError("actor", "actor is required")
+	}
+	GetDBInstance().SetActor(name)
+	return "Actor updated successfully", nil
+}
+
+// GetMigrationStatus 獲取資料庫遷移狀態（目前版本、已套用與待套用的遷移）
+func (a *App) GetMigrationStatus() (_ *MigrationStatus, err error) {
+	defer traceBinding("GetMigrationStatus", &err)()
+	db := GetDBInstance()
+	status, err := db.GetMigrationStatus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get migration status: %w", err)
+	}
+	return status, nil
+}
+
+// MigrateTo 遷移到指定版本；dryRun 為 true 時只回傳將執行的 SQL
+func (a *App) MigrateTo(target int, dryRun bool) (_ *MigrationPlan, err error) {
+	defer traceBinding("MigrateTo", &err)()
+	if target < 0 {
+		return nil, newValidationError("target", "target version must not be negative")
+	}
+	db := GetDBInstance()
+	plan, err := db.MigrateTo(uint(target), dryRun)
+	if err != nil {
+		return plan, fmt.Errorf("failed to migrate: %w", err)
+	}
+	return plan, nil
+}
+
+// MigrateSteps 前進（正數）或回復（負數）n 個遷移；dryRun 為 true 時只回傳將執行的 SQL
+func (a *App) MigrateSteps(n int, dryRun bool) (_ *MigrationPlan, err error) {
+	defer traceBinding("MigrateSteps", &err)()
+	db := GetDBInstance()
+	plan, err := db.MigrateSteps(n, dryRun)
+	if err != nil {
+		return plan, fmt.Errorf("failed to migrate: %w", err)
+	}
+	return plan, nil
+}
+
+// RedoMigration 回復並重新套用目前版本的遷移；dryRun 為 true 時只回傳將執行的 SQL
+func (a *App) RedoMigration(dryRun bool) (_ *MigrationPlan, err error) {
+	defer traceBinding("RedoMigration", &err)()
+	db := GetDBInstance()
+	plan, err := db.RedoMigration(dryRun)
+	if err != nil {
+		return plan, fmt.Errorf("failed to redo migration: %w", err)
+	}
+	return plan, nil
+}
+
+// InspectDirtyMigration 比對 dirty 版本的遷移檔案與目前 schema
+func (a *App) InspectDirtyMigration() (_ *DirtyReport, err error) {
+	defer traceBinding("InspectDirtyMigration", &err)()
+	db := GetDBInstance()
+	report, err := db.InspectDirtyMigration()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect dirty migration: %w", err)
+	}
+	return report, nil
+}
+
+// RecoverDirtyMigration 以 roll-forward / roll-back / force 策略修復 dirty 狀態；dryRun 為 true 時只回報會執行的語句
+func (a *App) RecoverDirtyMigration(strategy string, dryRun bool) (_ *RecoveryResult, err error) {
+	defer traceBinding("RecoverDirtyMigration", &err)()
+	db := GetDBInstance()
+	result, err := db.RecoverDirtyMigration(strategy, dryRun)
+	if err != nil {
+		return result, fmt.Errorf("failed to recover dirty migration: %w", err)
+	}
+	return result, nil
+}
+
+// CheckSchema 比對實際 schema 與遷移檔案預期的 schema，回傳逐項差異
+func (a *App) CheckSchema() (_ *SchemaReport, err error) {
+	defer traceBinding("CheckSchema", &err)()
+	db := GetDBInstance()
+	report, err := db.CheckSchema()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check schema: %w", err)
+	}
+	return report, nil
+}
+
+// Backup 備份整個資料庫到指定檔案，path 為空時寫入 DB_BACKUP_DIR 下以時間命名的檔案
+func (a *App) Backup(path string) (_ *BackupInfo, err error) {
+	defer traceBinding("Backup", &err)()
+	db := GetDBInstance()
+	info, err := db.Backup(path)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Restore 以備份檔取代目前的資料庫，完成後回傳還原後各資料表的筆數
+func (a *App) Restore(path string) (_ *BackupInfo, err error) {
+	defer traceBinding("Restore", &err)()
+	db := GetDBInstance()
+	info, err := db.Restore(path)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ListTables 列出資料庫中所有資料表與筆數
+func (a *App) ListTables() (_ []TableSummary, err error) {
+	defer traceBinding("ListTables", &err)()
+	db := GetDBInstance()
+	tables, err := db.ListTables()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	return tables, nil
+}
+
+// DescribeTable 回傳資料表的欄位、索引與筆數
+func (a *App) DescribeTable(table string) (_ *TableDescription, err error) {
+	defer traceBinding("DescribeTable", &err)()
+	db := GetDBInstance()
+	desc, err := db.DescribeTable(table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe table: %w", err)
+	}
+	return desc, nil
+}
+
+// BrowseTable 以唯讀交易分頁瀏覽任意資料表，條件與排序欄位必須是資料表的欄位
+func (a *App) BrowseTable(table string, query TableQuery) (_ *TablePage, err error) {
+	defer traceBinding("BrowseTable", &err)()
+	db := GetDBInstance()
+	page, err := db.BrowseTable(table, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to browse table: %w", err)
+	}
+	return page, nil
+}
+
+// ExecuteQuery 在查詢主控台執行單一 SQL 敘述，params 依序綁定；寫入敘述必須先開啟寫入模式
+func (a *App) ExecuteQuery(text string, params []interface{}) (_ *QueryResult, err error) {
+	defer traceBinding("ExecuteQuery", &err)()
+	db := GetDBInstance()
+	result, err := db.ExecuteQuery(text, params)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ExplainQuery 回傳查詢的執行計畫，不實際執行
+func (a *App) ExplainQuery(text string, params []interface{}) (_ *QueryResult, err error) {
+	defer traceBinding("ExplainQuery", &err)()
+	db := GetDBInstance()
+	result, err := db.ExplainQuery(text, params)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetQueryWriteMode 回傳查詢主控台是否允許寫入敘述
+func (a *App) GetQueryWriteMode() bool {
+	return GetDBInstance().QueryWriteModeEnabled()
+}
+
+// SetQueryWriteMode 開啟或關閉查詢主控台的寫入模式
+func (a *App) SetQueryWriteMode(enabled bool) bool {
+	db := GetDBInstance()
+	db.SetQueryWriteMode(enabled)
+	return db.QueryWriteModeEnabled()
+}
+
+// GetQueryHistory 回傳最近的查詢紀錄（新的在前）
+func (a *App) GetQueryHistory(limit int) (_ []QueryHistoryEntry, err error) {
+	defer traceBinding("GetQueryHistory", &err)()
+	return GetQueryHistory(limit)
+}
+
+// ClearQueryHistory 清除查詢紀錄
+func (a *App) ClearQueryHistory() (_ string, err error) {
+	defer traceBinding("ClearQueryHistory", &err)()
+	if err := ClearQueryHistory(); err != nil {
+		return "", err
+	}
+	return "Query history cleared", nil
+}
+
+// ListConnectionProfiles 列出儲存的連線設定（密碼以 *** 表示）
+func (a *App) ListConnectionProfiles() (_ []ConnectionProfile, err error) {
+	defer traceBinding("ListConnectionProfiles", &err)()
+	profiles, err := LoadConnectionProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for i := range profiles {
+		profiles[i] = profiles[i].masked()
+	}
+	return profiles, nil
+}
+
+// SaveConnectionProfile 新增或更新連線設定；密碼留空時沿用已儲存的密碼
+func (a *App) SaveConnectionProfile(profile ConnectionProfile) (_ string, err error) {
+	defer traceBinding("SaveConnectionProfile", &err)()
+	if err := SaveConnectionProfile(profile); err != nil {
+		return "", err
+	}
+	return "Connection profile saved", nil
+}
+
+// DeleteConnectionProfile 刪除連線設定
+func (a *App) DeleteConnectionProfile(name string) (_ string, err error) {
+	defer traceBinding("DeleteConnectionProfile", &err)()
+	if err := DeleteConnectionProfile(name); err != nil {
+		return "", err
+	}
+	return "Connection profile deleted", nil
+}
+
+// TestConnection 測試連線設定是否可以連線（只給名稱時使用儲存的設定）
+func (a *App) TestConnection(profile ConnectionProfile) (_ string, err error) {
+	defer traceBinding("TestConnection", &err)()
+	if err := TestConnection(profile); err != nil {
+		return "", err
+	}
+	return "Connection succeeded", nil
+}
+
+// SwitchConnection 切換到指定的連線設定，失敗時維持目前的連線
+func (a *App) SwitchConnection(profile ConnectionProfile) (_ *ConnectionState, err error) {
+	defer traceBinding("SwitchConnection", &err)()
+	state, err := SwitchConnection(profile)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// GetConnectionState 回傳目前的連線狀態
+func (a *App) GetConnectionState() ConnectionState {
+	return GetDBInstance().ConnectionState()
+}
+
+// Reconnect 立即嘗試重新連線，不等待重試間隔
+func (a *App) Reconnect() ConnectionState {
+	defer traceBinding("Reconnect", nil)()
+	return GetDBInstance().Reconnect()
+}
+
+// GetEffectiveConfig 列出目前生效的設定值與來源（密碼等機密欄位以 *** 表示）
+func (a *App) GetEffectiveConfig() []ConfigEntry {
+	return EffectiveConfig()
+}
+
+// GetRecentLogs 取得最近的日誌（由舊到新），level 為最低層級（debug、info、warn、error，空字串表示全部），limit <= 0 表示全部
+func (a *App) GetRecentLogs(limit int, level string) ([]LogEntry, error) {
+	entries, err := RecentLogs(limit, level)
+	if err != nil {
+		return nil, newValidationError("level", err.Error())
+	}
+	return entries, nil
+}
+
+// GetQueryMetrics 取得各操作的資料庫呼叫統計（次數、錯誤、慢查詢、筆數與耗時），依總耗時排序
+func (a *App) GetQueryMetrics() []QueryMetric {
+	return QueryMetrics()
+}
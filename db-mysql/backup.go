@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BackupTable 備份中單一資料表的列數
+type BackupTable struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+}
+
+// BackupInfo 備份或還原的結果；還原時 Tables 為還原後實際資料庫的列數
+type BackupInfo struct {
+	Path          string        `json:"path"`
+	Format        string        `json:"format"`
+	SchemaVersion uint          `json:"schemaVersion"`
+	Dirty         bool          `json:"dirty"`
+	Tables        []BackupTable `json:"tables"`
+	Size          int64         `json:"size"`
+	CreatedAt     string        `json:"createdAt"`
+	DurationMs    int64         `json:"durationMs"`
+}
+
+// defaultBackupPath 未指定路徑時的備份檔名：DB_BACKUP_DIR（預設 backups）下的 <名稱>-<時間>
+func (d *Database) defaultBackupPath() string {
+	name := fmt.Sprintf("%s-%s%s", d.backupName(), time.Now().Format("20060102-150405"), backupFileExt)
+	return filepath.Join(appConfig().BackupDir, name)
+}
+
+// Backup 將整個資料庫（含 schema_migrations 的版本）備份到 path，path 為空時使用預設路徑；
+// 先寫入暫存檔，完成後才改名，中斷時不會留下不完整的備份
+func (d *Database) Backup(path string) (*BackupInfo, error) {
+	if path == "" {
+		path = d.defaultBackupPath()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	started := time.Now()
+	partial := path + ".partial"
+	info, err := d.writeBackup(withOperation(context.Background(), "Backup"), partial)
+	if err != nil {
+		os.Remove(partial)
+		return nil, fmt.Errorf("failed to back up database: %w", err)
+	}
+	if err := os.Rename(partial, path); err != nil {
+		os.Remove(partial)
+		return nil, fmt.Errorf("failed to move backup into place: %w", err)
+	}
+	if stat, err := os.Stat(path); err == nil {
+		info.Size = stat.Size()
+	}
+	info.Path = path
+	info.CreatedAt = started.Format(time.RFC3339)
+	info.DurationMs = time.Since(started).Milliseconds()
+
+	logFor("backup").Info("Database backed up", LogKeyOperation, "backup", LogKeyDuration, info.DurationMs,
+		"path", path, "version", info.SchemaVersion, "tables", len(info.Tables), "bytes", info.Size)
+	return info, nil
+}
+
+// Restore 以備份檔取代整個資料庫（備份中沒有的資料表會被刪除）；
+// 還原會改變 schema 版本，因此在遷移鎖內執行
+func (d *Database) Restore(path string) (*BackupInfo, error) {
+	if path == "" {
+		return nil, newValidationError("path", "backup path is required")
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, newValidationError("path", fmt.Sprintf("cannot read backup %s: %v", path, err))
+	}
+
+	var info *BackupInfo
+	started := time.Now()
+	err = d.withMigrationLock("restore", func(ctx context.Context) error {
+		var err error
+		info, err = d.restoreBackup(withOperation(ctx, "Restore"), path)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore database: %w", err)
+	}
+	info.Path = path
+	info.Size = stat.Size()
+	info.CreatedAt = started.Format(time.RFC3339)
+	info.DurationMs = time.Since(started).Milliseconds()
+
+	logFor("backup").Info("Database restored", LogKeyOperation, "restore", LogKeyDuration, info.DurationMs,
+		"path", path, "version", info.SchemaVersion, "tables", len(info.Tables))
+	return info, nil
+}
+
+// backupBeforeMigration 設定 DB_BACKUP_BEFORE_MIGRATE=true 時，在自動遷移套用任何變更前先備份；備份失敗則不遷移
+func (d *Database) backupBeforeMigration(from uint, to int) error {
+	if !appConfig().BackupBeforeMigrate {
+		return nil
+	}
+	logFor("backup").Info("Backing up database before migrating", "from", from, "to", to)
+	if _, err := d.Backup(""); err != nil {
+		return fmt.Errorf("automatic backup before migration failed: %w", err)
+	}
+	return nil
+}
+
+// readBackupInfo 讀取 schema 版本與每個資料表的列數
+func readBackupInfo(ctx context.Context, q sqlExecutor) (*BackupInfo, error) {
+	tables, err := listTables(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	info := &BackupInfo{Format: backupFormat, Tables: []BackupTable{}}
+	for _, table := range tables {
+		var rows int64
+		if err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+quoteIdent(table)).Scan(&rows); err != nil {
+			return nil, fmt.Errorf("failed to count rows of %s: %w", table, err)
+		}
+		info.Tables = append(info.Tables, BackupTable{Name: table, Rows: rows})
+
+		if table == "schema_migrations" {
+			var version int64
+			var dirty bool
+			err := q.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations").Scan(&version, &dirty)
+			if err != nil && err != sql.ErrNoRows {
+				return nil, fmt.Errorf("failed to read schema version: %w", err)
+			}
+			info.SchemaVersion, info.Dirty = uint(version), dirty
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 用戶異動的事件名稱，同時作為送給前端的 Wails 事件名稱
+const (
+	UserCreatedEvent = "user.created"
+	UserUpdatedEvent = "user.updated"
+	UserDeletedEvent = "user.deleted"
+)
+
+// 變更通知的輪詢設定
+const (
+	changeFeedBatchSize  = 500
+	changeFeedGapTimeout = 10 * time.Second // 稽核紀錄的 id 缺號超過此時間視為交易已回復，不再等待
+)
+
+// UserChangeEvent 一筆用戶異動；User 為異動後的資料，永久刪除時為刪除前的資料
+type UserChangeEvent struct {
+	Type string                 `json:"type"`
+	ID   int64                  `json:"id"`
+	User map[string]interface{} `json:"user"`
+}
+
+var (
+	// userChangeListener 接收用戶異動，由 App 轉送為 Wails 事件
+	userChangeListenerMu sync.RWMutex
+	userChangeListener   func(UserChangeEvent)
+)
+
+// SetUserChangeListener 設定用戶異動的接收者（nil 表示不通知）
+func SetUserChangeListener(fn func(UserChangeEvent)) {
+	userChangeListenerMu.Lock()
+	userChangeListener = fn
+	userChangeListenerMu.Unlock()
+}
+
+// notifyUserChange 通知用戶異動
+func notifyUserChange(event UserChangeEvent) {
+	userChangeListenerMu.RLock()
+	fn := userChangeListener
+	userChangeListenerMu.RUnlock()
+	if fn != nil {
+		fn(event)
+	}
+}
+
+// auditFeed 輪詢 user_audit 的進度。每個異動都與稽核紀錄在同一個交易中寫入，因此稽核紀錄就是異動的 outbox；
+// 不使用 user_outbox 是因為它只在 DB_OUTBOX 啟用時寫入，且已發送的事件會被 relay 清除。
+// user_audit 不會被清除（PurgeDeleted 也只新增稽核紀錄），id 只會在還原備份時倒退，見 checkRewind。
+// 其他程序的交易可能晚於較大的 id 提交，cursor 只推進到連續處理過的 id，之後已處理的 id 記在 seen
+type auditFeed struct {
+	d        *Database
+	db       *sql.DB
+	cursor   int64
+	seen     map[int64]bool
+	gapSince time.Time
+	failing  bool
+}
+
+// WatchUserChanges 輪詢 user_audit，把任何程序寫入的用戶異動送給 SetUserChangeListener 設定的接收者，直到 ctx 結束。
+// 只通知啟動之後的異動；切換連線時從新資料庫目前的最後一筆開始
+func WatchUserChanges(ctx context.Context) {
+	cfg := appConfig()
+	if !cfg.ChangeFeed {
+		return
+	}
+	ctx = unobserved(ctx)
+	feed := &auditFeed{}
+	defer feed.close()
+	logFor("changes").Info("Watching user changes", "source", "user_audit", "interval", cfg.ChangePollInterval)
+
+	ticker := time.NewTicker(cfg.ChangePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := feed.poll(ctx); err != nil && ctx.Err() == nil {
+			feed.close()
+			if !feed.failing {
+				feed.failing = true
+				logFor("changes").Warn("Failed to poll user changes", "error", err)
+			}
+			continue
+		}
+		if feed.failing {
+			feed.failing = false
+			logFor("changes").Info("Polling user changes resumed")
+		}
+	}
+}
+
+// poll 讀取 cursor 之後的稽核紀錄並逐筆通知
+func (f *auditFeed) poll(ctx context.Context) error {
+	d := currentDatabase()
+	if d == nil {
+		return nil
+	}
+	if d != f.d {
+		f.close()
+		f.d, f.seen = d, nil
+	}
+	if f.db == nil {
+		db, err := d.OpenDB()
+		if err != nil {
+			return err
+		}
+		f.db = db
+		if f.seen == nil {
+			if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM user_audit`).Scan(&f.cursor); err != nil {
+				return fmt.Errorf("failed to read the latest audit record: %w", err)
+			}
+			f.seen = map[int64]bool{}
+		}
+	}
+
+	rows, err := f.db.QueryContext(ctx, `SELECT id, user_id, action, before_data, after_data FROM user_audit WHERE id > `+
+		placeholder(1)+` ORDER BY id LIMIT `+placeholder(2), f.cursor, changeFeedBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to query audit records: %w", err)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		count++
+		var (
+			id, userID    int64
+			action        string
+			before, after sql.NullString
+		)
+		if err := rows.Scan(&id, &userID, &action, &before, &after); err != nil {
+			return fmt.Errorf("failed to scan audit record: %w", err)
+		}
+		if f.seen[id] {
+			continue
+		}
+		f.seen[id] = true
+
+		snapshot := after
+		if !snapshot.Valid {
+			snapshot = before
+		}
+		event := UserChangeEvent{Type: auditChangeType(action), ID: userID}
+		if snapshot.Valid {
+			if err := json.Unmarshal([]byte(snapshot.String), &event.User); err != nil {
+				logFor("changes").Warn("Failed to decode audit snapshot", "audit_id", id, "error", err)
+			}
+		}
+		notifyUserChange(event)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read audit records: %w", err)
+	}
+	if count == 0 {
+		rows.Close()
+		return f.checkRewind(ctx)
+	}
+	f.advance(time.Now())
+	return nil
+}
+
+// checkRewind 在沒有新的稽核紀錄時確認 user_audit 的最大 id 沒有小於 cursor。還原備份會把 user_audit 換成較舊的內容，
+// 之後的紀錄會重用 cursor 之前的 id；不重設 cursor 的話這些異動都不會通知
+func (f *auditFeed) checkRewind(ctx context.Context) error {
+	var latest int64
+	if err := f.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM user_audit`).Scan(&latest); err != nil {
+		return fmt.Errorf("failed to read the latest audit record: %w", err)
+	}
+	if latest < f.cursor {
+		logFor("changes").Info("Audit records were rewound; resuming from the latest record", "cursor", f.cursor, "latest", latest)
+		f.cursor, f.seen, f.gapSince = latest, map[int64]bool{}, time.Time{}
+	}
+	return nil
+}
+
+// advance 將 cursor 推進到連續處理過的最後一個 id；缺號等待 changeFeedGapTimeout 後跳過
+func (f *auditFeed) advance(now time.Time) {
+	for {
+		for f.seen[f.cursor+1] {
+			delete(f.seen, f.cursor+1)
+			f.cursor++
+		}
+		if len(f.seen) == 0 {
+			f.gapSince = time.Time{}
+			return
+		}
+		if f.gapSince.IsZero() {
+			f.gapSince = now
+		}
+		if now.Sub(f.gapSince) < changeFeedGapTimeout {
+			return
+		}
+		next := int64(0)
+		for id := range f.seen {
+			if next == 0 || id < next {
+				next = id
+			}
+		}
+		f.cursor = next - 1
+		f.gapSince = time.Time{}
+	}
+}
+
+// close 關閉輪詢使用的連線；下次輪詢時重新開啟
+func (f *auditFeed) close() {
+	if f.db != nil {
+		f.db.Close()
+		f.db = nil
+	}
+}
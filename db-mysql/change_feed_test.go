@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestAuditFeedAdvance(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name         string
+		cursor       int64
+		seen         []int64
+		gapSince     time.Time
+		wantCursor   int64
+		wantSeen     []int64
+		wantGapSince time.Time
+	}{
+		{"nothing new", 4, nil, time.Time{}, 4, nil, time.Time{}},
+		{"contiguous ids", 0, []int64{1, 2, 3}, time.Time{}, 3, nil, time.Time{}},
+		{"late commit fills the gap", 1, []int64{2, 3}, now.Add(-5 * time.Second), 3, nil, time.Time{}},
+		{"new gap starts waiting", 0, []int64{2, 3}, time.Time{}, 0, []int64{2, 3}, now},
+		{"gap within timeout", 0, []int64{2, 3}, now.Add(-5 * time.Second), 0, []int64{2, 3}, now.Add(-5 * time.Second)},
+		{"gap timed out", 0, []int64{2, 3}, now.Add(-changeFeedGapTimeout), 3, nil, time.Time{}},
+		{"timed out gap followed by a new gap", 0, []int64{2, 5}, now.Add(-changeFeedGapTimeout), 2, []int64{5}, now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &auditFeed{cursor: tt.cursor, seen: map[int64]bool{}, gapSince: tt.gapSince}
+			for _, id := range tt.seen {
+				f.seen[id] = true
+			}
+			f.advance(now)
+
+			var seen []int64
+			for id := range f.seen {
+				seen = append(seen, id)
+			}
+			sort.Slice(seen, func(i, j int) bool { return seen[i] < seen[j] })
+			if f.cursor != tt.wantCursor || !reflect.DeepEqual(seen, tt.wantSeen) || !f.gapSince.Equal(tt.wantGapSince) {
+				t.Fatalf("advance: cursor %d, seen %v, gapSince %v; want cursor %d, seen %v, gapSince %v",
+					f.cursor, seen, f.gapSince, tt.wantCursor, tt.wantSeen, tt.wantGapSince)
+			}
+		})
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// 設定值的來源；設定檔與 .env 檔的來源記錄為檔案路徑
+const (
+	ConfigSourceDefault = "default"
+	ConfigSourceEnv     = "env"
+	ConfigSourceFlag    = "flag"
+)
+
+// 未指定時嘗試載入的設定檔與 .env 檔，不存在時略過；明確指定的檔案不存在則視為錯誤
+var (
+	defaultConfigFiles = []string{"config.yaml", "config.yml", "config.toml"}
+	defaultEnvFiles    = []string{".env", ".env.local"}
+)
+
+// ConfigEntry 生效中的單一設定值，密碼等機密欄位的值已遮罩
+type ConfigEntry struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	Secret bool   `json:"secret"`
+}
+
+// configField Config 中一個欄位的標籤資訊
+type configField struct {
+	index  int
+	key    string
+	def    string
+	usage  string
+	oneOf  []string
+	min    string
+	max    string
+	secret bool
+}
+
+// flagName 設定鍵對應的命令列旗標名稱，例如 DB_HOST 為 --db-host
+func (f configField) flagName() string {
+	return strings.ToLower(strings.ReplaceAll(f.key, "_", "-"))
+}
+
+var (
+	configFieldsOnce sync.Once
+	configFieldList  []configField
+
+	configMu      sync.RWMutex
+	currentConfig *Config
+)
+
+// configFields 讀取 Config 欄位上的 env、default、oneof、min、max、secret、usage 標籤
+func configFields() []configField {
+	configFieldsOnce.Do(func() {
+		t := reflect.TypeOf(Config{})
+		for i := 0; i < t.NumField(); i++ {
+			tag := t.Field(i).Tag
+			key := tag.Get("env")
+			if key == "" {
+				continue
+			}
+			field := configField{
+				index:  i,
+				key:    key,
+				def:    tag.Get("default"),
+				usage:  tag.Get("usage"),
+				min:    tag.Get("min"),
+				max:    tag.Get("max"),
+				secret: tag.Get("secret") == "true",
+			}
+			if oneOf := tag.Get("oneof"); oneOf != "" {
+				field.oneOf = strings.Split(oneOf, ",")
+			}
+			configFieldList = append(configFieldList, field)
+		}
+	})
+	return configFieldList
+}
+
+// stringList 可重複指定的旗標
+type stringList []string
+
+// String 實作 flag.Value
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+// Set 實作 flag.Value，每次指定都附加一個值
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// configLoader 依優先順序收集原始字串值
+type configLoader struct {
+	values  map[string]string
+	sources map[string]string
+	known   map[string]bool
+	verr    *ValidationError
+}
+
+// set 記錄設定值與來源，覆寫較低優先順序的值
+func (l *configLoader) set(key, value, source string) {
+	l.values[key] = value
+	l.sources[key] = source
+}
+
+// LoadConfig 依序套用預設值、設定檔（YAML/TOML）、.env 檔、環境變數與 args 中的旗標，後者覆寫前者；
+// 回傳設定與旗標之後剩下的參數（子命令）。所有不合法的設定鍵會一次列在 ValidationError 中
+func LoadConfig(args []string) (*Config, []string, error) {
+	fields := configFields()
+	l := &configLoader{
+		values:  map[string]string{},
+		sources: map[string]string{},
+		known:   map[string]bool{},
+		verr:    &ValidationError{},
+	}
+	for _, f := range fields {
+		l.known[f.key] = true
+		l.set(f.key, f.def, ConfigSourceDefault)
+	}
+
+	// 命令列旗標：--config、--env-file 與每個設定鍵各一個旗標
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	configFile := fs.String("config", "", "config file (YAML or TOML, default config.yaml / config.yml / config.toml)")
+	var envFiles stringList
+	fs.Var(&envFiles, "env-file", "dotenv file to load, may be repeated (default .env and .env.local)")
+	flagValues := make(map[string]*string, len(fields))
+	for _, f := range fields {
+		usage := f.usage
+		if f.def != "" {
+			usage += fmt.Sprintf(" (default %s)", f.def)
+		}
+		flagValues[f.key] = fs.String(f.flagName(), "", fmt.Sprintf("%s [%s]", usage, f.key))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	// 設定檔
+	if *configFile == "" {
+		*configFile = os.Getenv("APP_CONFIG")
+	}
+	if *configFile != "" {
+		l.loadFile(*configFile)
+	} else {
+		for _, path := range defaultConfigFiles {
+			if _, err := os.Stat(path); err == nil {
+				l.loadFile(path)
+				break
+			}
+		}
+	}
+
+	// .env 檔，後面的檔案覆寫前面的檔案
+	explicitEnvFiles := len(envFiles) > 0
+	if !explicitEnvFiles {
+		if value := os.Getenv("APP_ENV_FILES"); value != "" {
+			envFiles = strings.Split(value, ",")
+			explicitEnvFiles = true
+		} else {
+			envFiles = defaultEnvFiles
+		}
+	}
+	for _, path := range envFiles {
+		l.loadEnvFile(strings.TrimSpace(path), explicitEnvFiles)
+	}
+
+	// 環境變數：有設定即生效，空字串也算設定
+	for _, f := range fields {
+		if value, ok := os.LookupEnv(f.key); ok {
+			l.set(f.key, value, ConfigSourceEnv)
+		}
+	}
+
+	// 旗標
+	fs.Visit(func(fl *flag.Flag) {
+		for _, f := range fields {
+			if fl.Name == f.flagName() {
+				l.set(f.key, *flagValues[f.key], ConfigSourceFlag)
+			}
+		}
+	})
+
+	cfg := l.decode(fields)
+	cfg.validate(l.verr)
+	// secret 子命令用來管理密碼庫本身，不解析參照（參照的機密可能還不存在）
+	if rest := fs.Args(); len(l.verr.Fields) == 0 && (len(rest) == 0 || rest[0] != "secret") {
+		l.resolveSecrets(cfg, fields)
+	}
+	if len(l.verr.Fields) > 0 {
+		return nil, nil, l.verr
+	}
+	return cfg, fs.Args(), nil
+}
+
+// loadFile 讀取 YAML 或 TOML 設定檔；巢狀的鍵以底線連接後轉為大寫，例如 db.tls.mode 對應 DB_TLS_MODE
+func (l *configLoader) loadFile(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		l.verr.Add(path, fmt.Sprintf("failed to read config file: %v", err))
+		return
+	}
+
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		err = fmt.Errorf("unsupported config file extension (use .yaml, .yml or .toml)")
+	}
+	if err != nil {
+		l.verr.Add(path, fmt.Sprintf("failed to parse config file: %v", err))
+		return
+	}
+
+	flat := map[string]string{}
+	l.flatten(path, "", raw, flat)
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !l.known[key] {
+			l.verr.Add(key, fmt.Sprintf("unknown key in %s", path))
+			continue
+		}
+		l.set(key, flat[key], path)
+	}
+}
+
+// flatten 將巢狀設定展開成設定鍵與字串值
+func (l *configLoader) flatten(path, prefix string, raw map[string]interface{}, out map[string]string) {
+	for name, value := range raw {
+		key := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			l.flatten(path, key, v, out)
+		case []interface{}:
+			l.verr.Add(key, fmt.Sprintf("lists are not supported in %s", path))
+		case nil:
+			out[key] = ""
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+// loadEnvFile 讀取 .env 檔；不屬於設定的鍵會被略過（.env 可能與其他工具共用）
+func (l *configLoader) loadEnvFile(path string, required bool) {
+	if _, err := os.Stat(path); err != nil {
+		if required || !os.IsNotExist(err) {
+			l.verr.Add(path, fmt.Sprintf("failed to open env file: %v", err))
+		}
+		return
+	}
+	values, err := godotenv.Read(path)
+	if err != nil {
+		l.verr.Add(path, fmt.Sprintf("failed to parse env file: %v", err))
+		return
+	}
+	for key, value := range values {
+		if l.known[key] {
+			l.set(key, value, path)
+		}
+	}
+}
+
+// decode 將字串值轉為 Config 的欄位型別並檢查 oneof、min、max
+func (l *configLoader) decode(fields []configField) *Config {
+	cfg := &Config{sources: l.sources, secretRefs: map[string]string{}}
+	v := reflect.ValueOf(cfg).Elem()
+	for _, f := range fields {
+		raw := l.values[f.key]
+		fail := func(format string, args ...interface{}) {
+			l.verr.Add(f.key, fmt.Sprintf("%s (from %s)", fmt.Sprintf(format, args...), l.sources[f.key]))
+		}
+
+		field := v.Field(f.index)
+		switch field.Interface().(type) {
+		case string:
+			if len(f.oneOf) > 0 && raw != "" && !containsString(f.oneOf, raw) {
+				fail("must be one of %s, got %q", strings.Join(f.oneOf, ", "), raw)
+				continue
+			}
+			field.SetString(raw)
+		case bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				fail("must be true or false, got %q", raw)
+				continue
+			}
+			field.SetBool(b)
+		case int:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				fail("must be an integer, got %q", raw)
+				continue
+			}
+			if min, err := strconv.Atoi(f.min); err == nil && n < min {
+				fail("must be at least %d, got %d", min, n)
+				continue
+			}
+			if max, err := strconv.Atoi(f.max); err == nil && n > max {
+				fail("must be at most %d, got %d", max, n)
+				continue
+			}
+			field.SetInt(int64(n))
+		case time.Duration:
+			d, err := time.ParseDuration(raw)
+			if err != nil || d <= 0 {
+				fail("must be a positive duration such as 30s or 2m, got %q", raw)
+				continue
+			}
+			field.SetInt(int64(d))
+		}
+	}
+	return cfg
+}
+
+// resolveSecrets 將 secret://名稱 形式的字串設定值替換為密碼庫中的值，並記錄參照供 EffectiveConfig 顯示
+func (l *configLoader) resolveSecrets(cfg *Config, fields []configField) {
+	v := reflect.ValueOf(cfg).Elem()
+	for _, f := range fields {
+		field := v.Field(f.index)
+		if field.Kind() != reflect.String || !isSecretRef(field.String()) {
+			continue
+		}
+		ref := field.String()
+		if strings.HasPrefix(f.key, "APP_SECRET_") {
+			l.verr.Add(f.key, fmt.Sprintf("cannot reference a secret (from %s)", l.sources[f.key]))
+			continue
+		}
+		value, err := resolveSecretRef(cfg, ref)
+		if err != nil {
+			l.verr.Add(f.key, fmt.Sprintf("failed to resolve %s: %v (from %s)", ref, err, l.sources[f.key]))
+			continue
+		}
+		field.SetString(value)
+		registerSecret(value)
+		cfg.secretRefs[f.key] = ref
+	}
+}
+
+// containsString 判斷 list 是否包含 s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// setConfig 設定目前生效的設定，由 main 在啟動時呼叫
+func setConfig(cfg *Config) {
+	configMu.Lock()
+	currentConfig = cfg
+	configMu.Unlock()
+}
+
+// appConfig 回傳目前生效的設定；尚未載入時（例如不經過 main 的呼叫端）以預設檔案與環境變數載入一次
+func appConfig() *Config {
+	configMu.RLock()
+	cfg := currentConfig
+	configMu.RUnlock()
+	if cfg != nil {
+		return cfg
+	}
+
+	cfg, _, err := LoadConfig(nil)
+	if err != nil {
+		logFor("config").Error("Invalid configuration, using defaults", "error", err)
+		l := &configLoader{values: map[string]string{}, sources: map[string]string{}, verr: &ValidationError{}}
+		for _, f := range configFields() {
+			l.set(f.key, f.def, ConfigSourceDefault)
+		}
+		cfg = l.decode(configFields())
+	}
+	setConfig(cfg)
+	return cfg
+}
+
+// EffectiveConfig 列出所有設定鍵目前的值與來源，機密欄位遮罩為 ***，以 secret:// 參照設定的鍵顯示參照
+func EffectiveConfig() []ConfigEntry {
+	cfg := appConfig()
+	v := reflect.ValueOf(cfg).Elem()
+	entries := make([]ConfigEntry, 0, len(configFields()))
+	for _, f := range configFields() {
+		value := fmt.Sprint(v.Field(f.index).Interface())
+		if ref, ok := cfg.secretRefs[f.key]; ok {
+			value = ref
+		} else if f.secret && value != "" {
+			value = maskedSecret
+		}
+		source := cfg.sources[f.key]
+		if source == "" {
+			source = ConfigSourceDefault
+		}
+		entries = append(entries, ConfigEntry{Key: f.key, Value: value, Source: source, Secret: f.secret})
+	}
+	return entries
+}
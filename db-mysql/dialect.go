@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// 此檔集中 MySQL 方言的差異，讓查詢組裝邏輯可在各 SQL 模組間共用
+
+// placeholder 回傳第 n 個（從 1 起算）綁定參數的佔位符
+func placeholder(n int) string {
+	return "?"
+}
+
+// likeOperator 回傳不分大小寫的模糊比對運算子（utf8mb4 預設 collation 已不分大小寫）
+func likeOperator() string {
+	return "LIKE"
+}
+
+// castText 將欄位轉為文字，讓任意型別的欄位都能做模糊比對（MySQL 不支援 CAST AS TEXT）
+func castText(expr string) string {
+	return "CAST(" + expr + " AS CHAR)"
+}
+
+// SQL 文字的字串規則，供查詢主控台判斷敘述種類：sqlBackslashEscapes 表示字串中的反斜線為跳脫字元（MySQL 預設將反斜線視為跳脫字元），
+// sqlDollarQuotes 表示支援 $tag$...$tag$ 字串，sqlHashComments 表示 # 開頭為註解（MySQL 另有會被執行的 /*! */ 註解）
+const (
+	sqlBackslashEscapes = true
+	sqlDollarQuotes     = false
+	sqlHashComments     = true
+)
+
+// explainPrefix 查詢主控台取得執行計畫時加在敘述前的關鍵字
+const explainPrefix = "EXPLAIN "
+
+// guardReadOnly 唯讀交易已由 START TRANSACTION READ ONLY 保證，不需額外處理
+func guardReadOnly(ctx context.Context, tx *sql.Tx) error {
+	return nil
+}
+
+// timeArg 將時間轉換為可直接與 created_at 比較的參數
+func timeArg(t time.Time) interface{} {
+	return t
+}
+
+// emailUniqueKeys users.email 的唯一索引：遷移 2 起為 live_email 產生欄位上的索引，之前為建表時的 UNIQUE。
+// MySQL 8.0.19 起錯誤訊息中的索引名稱帶有資料表名稱
+var emailUniqueKeys = map[string]bool{
+	"users.idx_users_email_live": true,
+	"idx_users_email_live":       true,
+	"users.email":                true,
+	"email":                      true,
+}
+
+// translateDBError 將驅動程式錯誤碼轉換為領域錯誤；唯一索引依名稱區分，只有 email 的索引才是 ErrDuplicateEmail
+func translateDBError(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 { // ER_DUP_ENTRY
+		key := duplicateEntryKey(mysqlErr.Message)
+		if emailUniqueKeys[key] {
+			return ErrDuplicateEmail
+		}
+		return &UniqueViolationError{Constraint: key}
+	}
+	return err
+}
+
+// duplicateEntryKey 取出 "Duplicate entry '...' for key 'users.idx_users_email_live'" 中的索引名稱，格式不符時回傳空字串
+func duplicateEntryKey(message string) string {
+	const marker = " for key '"
+	i := strings.LastIndex(message, marker)
+	if i < 0 || !strings.HasSuffix(message, "'") {
+		return ""
+	}
+	return message[i+len(marker) : len(message)-1]
+}
+
+// isRetryableTxError 死結（1213）與等待鎖逾時（1205）時整個交易重試即可成功
+func isRetryableTxError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && (mysqlErr.Number == 1213 || mysqlErr.Number == 1205)
+}
+
+// insertUserRow 插入一筆用戶並回傳自動產生的 id
+func insertUserRow(ctx context.Context, q sqlExecutor, name, email string, age int) (int64, error) {
+	result, err := q.ExecContext(ctx, `INSERT INTO users (name, email, age, updated_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)`, name, email, age)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// schemaTableExists 檢查目前資料庫是否有指定的資料表
+func schemaTableExists(ctx context.Context, q sqlExecutor, table string) (bool, error) {
+	return schemaCount(ctx, q, `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?`, table)
+}
+
+// schemaColumnExists 檢查資料表是否有指定的欄位
+func schemaColumnExists(ctx context.Context, q sqlExecutor, table, column string) (bool, error) {
+	return schemaCount(ctx, q, `SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`, table, column)
+}
+
+// schemaIndexExists 檢查是否有指定名稱的索引
+func schemaIndexExists(ctx context.Context, q sqlExecutor, index string) (bool, error) {
+	return schemaCount(ctx, q, `SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND index_name = ?`, index)
+}
+
+// advisoryMigrationLock 以 GET_LOCK 實作的遷移鎖；鎖綁定在單一連線上，程式中斷時連線關閉即自動釋放
+type advisoryMigrationLock struct {
+	db   *sql.DB
+	conn *sql.Conn
+	name string
+	held bool
+}
+
+// newMigrationLock 建立以 MySQL 具名鎖實作的遷移鎖（不需要租約，ttl 不使用）
+func (d *Database) newMigrationLock(ttl time.Duration) (migrationLock, error) {
+	db, err := d.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open lock connection: %w", err)
+	}
+
+	// 具名鎖最長 64 個字元
+	name := "migrations:" + d.DBName
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return &advisoryMigrationLock{db: db, conn: conn, name: name}, nil
+}
+
+func (l *advisoryMigrationLock) tryAcquire(ctx context.Context) (bool, string, error) {
+	var got sql.NullInt64
+	if err := l.conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, 0)`, l.name).Scan(&got); err != nil {
+		return false, "", err
+	}
+	if got.Valid && got.Int64 == 1 {
+		l.held = true
+		return true, "", nil
+	}
+
+	var holder sql.NullInt64
+	if err := l.conn.QueryRowContext(ctx, `SELECT IS_USED_LOCK(?)`, l.name).Scan(&holder); err != nil || !holder.Valid {
+		return false, "another connection", nil
+	}
+	return false, fmt.Sprintf("connection %d", holder.Int64), nil
+}
+
+// renew 確認鎖仍由這條連線持有；連線中斷時具名鎖已被釋放
+func (l *advisoryMigrationLock) renew(ctx context.Context) error {
+	var owned sql.NullBool
+	if err := l.conn.QueryRowContext(ctx, `SELECT IS_USED_LOCK(?) = CONNECTION_ID()`, l.name).Scan(&owned); err != nil {
+		return err
+	}
+	if !owned.Valid || !owned.Bool {
+		return fmt.Errorf("migration lock is no longer held by this connection")
+	}
+	return nil
+}
+
+func (l *advisoryMigrationLock) release(ctx context.Context) error {
+	var err error
+	if l.held {
+		_, err = l.conn.ExecContext(ctx, `SELECT RELEASE_LOCK(?)`, l.name)
+		l.held = false
+	}
+	l.conn.Close()
+	l.db.Close()
+	return err
+}
+
+// quoteIdent 以反引號引用識別字
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// readSchema 讀取目前資料庫的欄位（含 COLUMN_TYPE 與 EXTRA）與索引
+func readSchema(ctx context.Context, q sqlExecutor) (schemaSnapshot, error) {
+	snapshot := schemaSnapshot{}
+
+	rows, err := q.QueryContext(ctx, `SELECT TABLE_NAME, COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COALESCE(COLUMN_DEFAULT, ''), EXTRA
+		FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() ORDER BY TABLE_NAME, ORDINAL_POSITION`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, nullable, extra string
+		var col schemaColumn
+		if err := rows.Scan(&table, &col.Name, &col.Type, &nullable, &col.Default, &extra); err != nil {
+			return nil, err
+		}
+		col.Nullable = nullable == "YES"
+		if extra != "" {
+			col.Type += " " + extra
+		}
+		t := snapshot.table(table)
+		t.Columns = append(t.Columns, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	idxRows, err := q.QueryContext(ctx, `SELECT TABLE_NAME, INDEX_NAME, NON_UNIQUE, COLUMN_NAME
+		FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX`)
+	if err != nil {
+		return nil, err
+	}
+	defer idxRows.Close()
+	for idxRows.Next() {
+		var table, index string
+		var nonUnique int
+		var column sql.NullString
+		if err := idxRows.Scan(&table, &index, &nonUnique, &column); err != nil {
+			return nil, err
+		}
+		if !column.Valid {
+			column.String = "(expression)"
+		}
+		snapshot.addIndexColumn(table, index, column.String, nonUnique == 0)
+	}
+	return snapshot, idxRows.Err()
+}
+
+// newScratchDatabase 建立比對 schema 用的暫存資料庫（需要 CREATE / DROP DATABASE 權限），回傳的 cleanup 會刪除它
+func (d *Database) newScratchDatabase(ctx context.Context) (*Database, string, func(), error) {
+	scratch, cleanup, err := d.newTempDatabase(ctx, "schema_check", "schema")
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return scratch, "database " + scratch.DBName, cleanup, nil
+}
+
+// newTempDatabase 建立名為「資料庫名稱_purpose_隨機值」的暫存資料庫，回傳的 cleanup 會刪除它，刪除失敗時記錄在 component 的日誌
+func (d *Database) newTempDatabase(ctx context.Context, purpose, component string) (*Database, func(), error) {
+	prefix := d.DBName
+	if len(prefix) > 40 {
+		prefix = prefix[:40]
+	}
+	name := prefix + "_" + purpose + "_" + randomSuffix()
+
+	db, err := d.OpenDB()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := db.ExecContext(ctx, "CREATE DATABASE "+quoteIdent(name)); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	temp := *d
+	temp.conn = nil
+	temp.DBName = name
+	cleanup := func() {
+		if _, err := db.ExecContext(ctx, "DROP DATABASE IF EXISTS "+quoteIdent(name)); err != nil {
+			logFor(component).Warn("Failed to drop temporary database", "database", name, "error", err)
+		}
+		db.Close()
+	}
+	return &temp, cleanup, nil
+}
+
+// 備份格式：由程式產生的 SQL 邏輯備份，不依賴 mysqldump
+const (
+	backupFormat  = "mysql"
+	backupFileExt = ".sql"
+)
+
+// 還原前後在同一條連線上執行的設定：還原期間暫停外鍵與唯一性檢查（還原到暫存資料庫，見 restoreBackup）
+var (
+	restorePreamble  = []string{"SET NAMES utf8mb4", "SET FOREIGN_KEY_CHECKS = 0", "SET UNIQUE_CHECKS = 0"}
+	restorePostamble = []string{"SET UNIQUE_CHECKS = 1", "SET FOREIGN_KEY_CHECKS = 1"}
+)
+
+// mysqlStringEscaper 跳脫字串字面值，換行以 \n 表示，讓每筆 INSERT 保持在同一行
+var mysqlStringEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`, "\x00", `\0`, "\x1a", `\Z`)
+
+// backupName 預設備份檔名使用的資料庫名稱
+func (d *Database) backupName() string {
+	return d.DBName
+}
+
+func (d *Database) writeBackup(ctx context.Context, path string) (*BackupInfo, error) {
+	return d.writeLogicalBackup(ctx, path)
+}
+
+// restoreBackup MySQL 的 DDL 會自動提交，無法像 PostgreSQL 在交易中還原：先將備份完整還原到暫存資料庫，
+// 成功後以單一 RENAME TABLE 換入所有資料表（RENAME TABLE 是原子操作），原有的資料表移到另一個暫存資料庫後刪除。
+// 還原失敗時目前的資料庫不受影響；需要 CREATE / DROP DATABASE 權限
+func (d *Database) restoreBackup(ctx context.Context, path string) (*BackupInfo, error) {
+	staging, dropStaging, err := d.newTempDatabase(ctx, "restore", "backup")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging database: %w", err)
+	}
+	defer dropStaging()
+	if _, err := staging.restoreLogicalBackup(ctx, path); err != nil {
+		return nil, fmt.Errorf("failed to restore into staging database (current database unchanged): %w", err)
+	}
+
+	replaced, dropReplaced, err := d.newTempDatabase(ctx, "replaced", "backup")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database for the replaced tables: %w", err)
+	}
+	defer dropReplaced()
+
+	db, err := d.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	current, err := listTables(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	restored, err := listSchemaTables(ctx, db, staging.DBName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list restored tables: %w", err)
+	}
+	renames := make([]string, 0, len(current)+len(restored))
+	for _, table := range current {
+		renames = append(renames, quoteIdent(d.DBName)+"."+quoteIdent(table)+" TO "+quoteIdent(replaced.DBName)+"."+quoteIdent(table))
+	}
+	for _, table := range restored {
+		renames = append(renames, quoteIdent(staging.DBName)+"."+quoteIdent(table)+" TO "+quoteIdent(d.DBName)+"."+quoteIdent(table))
+	}
+	if len(renames) > 0 {
+		if _, err := db.ExecContext(ctx, "RENAME TABLE "+strings.Join(renames, ", ")); err != nil {
+			return nil, fmt.Errorf("failed to swap in restored tables (current database unchanged): %w", err)
+		}
+	}
+	return readBackupInfo(ctx, db)
+}
+
+// listTables 列出目前資料庫的資料表（不含 view）
+func listTables(ctx context.Context, q sqlExecutor) ([]string, error) {
+	return queryTableNames(ctx, q, `SELECT TABLE_NAME FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME`)
+}
+
+// listSchemaTables 列出指定資料庫的資料表（不含 view）
+func listSchemaTables(ctx context.Context, q sqlExecutor, schema string) ([]string, error) {
+	return queryTableNames(ctx, q, `SELECT TABLE_NAME FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME`, schema)
+}
+
+// queryTableNames 執行回傳單一資料表名稱欄位的查詢
+func queryTableNames(ctx context.Context, q sqlExecutor, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+func dropTableSQL(table string) string {
+	return "DROP TABLE IF EXISTS " + quoteIdent(table)
+}
+
+// dumpTableSchema 以 SHOW CREATE TABLE 取得完整定義（已含索引、外鍵與 AUTO_INCREMENT 目前值）
+func dumpTableSchema(ctx context.Context, q sqlExecutor, table string) (*tableDefinition, error) {
+	var name, create string
+	if err := q.QueryRowContext(ctx, "SHOW CREATE TABLE "+quoteIdent(table)).Scan(&name, &create); err != nil {
+		return nil, err
+	}
+	return &tableDefinition{Create: []string{create}}, nil
+}
+
+// sqlLiteral 將查詢取得的值轉為 MySQL 字面值；二進位欄位以十六進位輸出，數值欄位不加引號
+func sqlLiteral(v interface{}, dbType string) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case uint64:
+		return strconv.FormatUint(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(val), 'g', -1, 32)
+	case bool:
+		if val {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		if val.IsZero() {
+			return "'0000-00-00 00:00:00'"
+		}
+		if dbType == "DATE" {
+			return "'" + val.Format("2006-01-02") + "'"
+		}
+		return "'" + val.Format("2006-01-02 15:04:05.999999") + "'"
+	case []byte:
+		switch strings.TrimPrefix(dbType, "UNSIGNED ") {
+		case "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BINARY", "VARBINARY", "BIT", "GEOMETRY":
+			return "X'" + hex.EncodeToString(val) + "'"
+		case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "DECIMAL", "FLOAT", "DOUBLE", "YEAR":
+			return string(val)
+		}
+		return "'" + mysqlStringEscaper.Replace(string(val)) + "'"
+	case string:
+		return "'" + mysqlStringEscaper.Replace(val) + "'"
+	default:
+		return "'" + mysqlStringEscaper.Replace(fmt.Sprint(val)) + "'"
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestTranslateDBError(t *testing.T) {
+	plain := errors.New("connection reset")
+	tests := []struct {
+		name       string
+		err        error
+		want       error
+		constraint string
+	}{
+		{"email index", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a@example.com' for key 'users.idx_users_email_live'"}, ErrDuplicateEmail, ""},
+		{"email index before 8.0.19", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a@example.com' for key 'idx_users_email_live'"}, ErrDuplicateEmail, ""},
+		{"legacy email unique", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a@example.com' for key 'users.email'"}, ErrDuplicateEmail, ""},
+		{"wrapped", fmt.Errorf("insert: %w", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'x' for key 'users.email'"}), ErrDuplicateEmail, ""},
+		{"other unique key", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'abc' for key 'user_outbox.event_id'"}, ErrDuplicateValue, "user_outbox.event_id"},
+		{"unparsable message", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, ErrDuplicateValue, ""},
+		{"other error number", &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, nil, ""},
+		{"not a driver error", plain, plain, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := translateDBError(tt.err)
+			want := tt.want
+			if want == nil {
+				want = tt.err
+			}
+			if !errors.Is(got, want) {
+				t.Fatalf("translateDBError() = %v, want %v", got, want)
+			}
+			var uniqueErr *UniqueViolationError
+			if errors.As(got, &uniqueErr) && uniqueErr.Constraint != tt.constraint {
+				t.Fatalf("constraint = %q, want %q", uniqueErr.Constraint, tt.constraint)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSQLStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"empty", "  \n-- only a comment\n", nil},
+		{"two statements", "CREATE TABLE a (id INT);\nDROP TABLE b;", []string{"CREATE TABLE a (id INT)", "DROP TABLE b"}},
+		{"missing trailing semicolon", "SELECT 1;\nSELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"line comments", "-- create a;\nCREATE TABLE a (id INT); -- done;\n", []string{"CREATE TABLE a (id INT)"}},
+		{"semicolon in quotes", "INSERT INTO t VALUES ('a;b', \"c;d\", `e;f`);", []string{"INSERT INTO t VALUES ('a;b', \"c;d\", `e;f`)"}},
+		{"comment marker in quotes", "INSERT INTO t VALUES ('--not a comment');", []string{"INSERT INTO t VALUES ('--not a comment')"}},
+		{
+			"dollar quoted body",
+			"CREATE FUNCTION f() RETURNS trigger AS $$ BEGIN RETURN NEW; END; $$ LANGUAGE plpgsql;\nSELECT 1;",
+			[]string{"CREATE FUNCTION f() RETURNS trigger AS $$ BEGIN RETURN NEW; END; $$ LANGUAGE plpgsql", "SELECT 1"},
+		},
+		{
+			"tagged dollar quote",
+			"DO $body$ BEGIN PERFORM 1; END $body$;",
+			[]string{"DO $body$ BEGIN PERFORM 1; END $body$"},
+		},
+		{"positional parameter is not a dollar quote", "SELECT $1; SELECT 2;", []string{"SELECT $1", "SELECT 2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitSQLStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("splitSQLStatements(%q) = %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 邏輯備份檔案格式：開頭為 "-- key: value" 的標頭，之後每個敘述以行尾的 ";" 結束，
+// 資料列的 INSERT 一定寫在同一行（字串中的換行以跳脫字元表示），最後一行為結束標記
+const (
+	logicalBackupMagic   = "-- example logical backup"
+	logicalBackupEnd     = "-- end of backup"
+	logicalBackupBatch   = 100
+	logicalBackupMaxLine = 64 << 20
+)
+
+// logicalBackupHeader 備份檔的標頭
+type logicalBackupHeader struct {
+	Format        string
+	SchemaVersion uint
+	Tables        []string
+}
+
+// tableDefinition 資料表的 DDL：Create 在寫入資料前執行，Indexes（含主鍵、唯一與檢查約束）
+// 與 ForeignKeys 在所有資料寫入後才執行，載入較快，也不受資料表順序影響
+type tableDefinition struct {
+	Create      []string
+	Indexes     []string
+	ForeignKeys []string
+}
+
+// writeLogicalBackup 在唯讀的 REPEATABLE READ 交易中匯出所有資料表的結構與資料，所有資料表取自同一個快照
+func (d *Database) writeLogicalBackup(ctx context.Context, path string) (*BackupInfo, error) {
+	db, err := d.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start snapshot transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	info, err := readBackupInfo(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	names := make([]string, 0, len(info.Tables))
+	for _, t := range info.Tables {
+		names = append(names, t.Name)
+	}
+	fmt.Fprintln(w, logicalBackupMagic)
+	fmt.Fprintf(w, "-- format: %s\n", backupFormat)
+	fmt.Fprintf(w, "-- database: %s\n", d.backupName())
+	fmt.Fprintf(w, "-- schema_version: %d\n", info.SchemaVersion)
+	fmt.Fprintf(w, "-- dirty: %t\n", info.Dirty)
+	fmt.Fprintf(w, "-- created_at: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(w, "-- tables: %s\n\n", strings.Join(names, ","))
+
+	var indexes, foreignKeys []string
+	for _, t := range info.Tables {
+		def, err := dumpTableSchema(ctx, tx, t.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read definition of %s: %w", t.Name, err)
+		}
+		indexes = append(indexes, def.Indexes...)
+		foreignKeys = append(foreignKeys, def.ForeignKeys...)
+
+		fmt.Fprintf(w, "-- table: %s (%d rows)\n", t.Name, t.Rows)
+		fmt.Fprintf(w, "%s;\n", dropTableSQL(t.Name))
+		for _, stmt := range def.Create {
+			fmt.Fprintf(w, "%s;\n", stmt)
+		}
+		if err := dumpTableRows(ctx, tx, w, t.Name); err != nil {
+			return nil, fmt.Errorf("failed to dump rows of %s: %w", t.Name, err)
+		}
+		fmt.Fprintln(w)
+	}
+	if post := append(indexes, foreignKeys...); len(post) > 0 {
+		fmt.Fprintln(w, "-- constraints, indexes and sequence values")
+		for _, stmt := range post {
+			fmt.Fprintf(w, "%s;\n", stmt)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w, logicalBackupEnd)
+
+	if err := w.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write backup file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to write backup file: %w", err)
+	}
+	return info, nil
+}
+
+// dumpTableRows 以每行最多 logicalBackupBatch 列的 INSERT 匯出資料表內容
+func dumpTableRows(ctx context.Context, q sqlExecutor, w io.Writer, table string) error {
+	rows, err := q.QueryContext(ctx, "SELECT * FROM "+quoteIdent(table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	columns := make([]string, len(types))
+	for i, ct := range types {
+		columns[i] = quoteIdent(ct.Name())
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", quoteIdent(table), strings.Join(columns, ", "))
+
+	values := make([]interface{}, len(types))
+	dest := make([]interface{}, len(types))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	var batch []string
+	flush := func() {
+		if len(batch) > 0 {
+			fmt.Fprintf(w, "%s%s;\n", prefix, strings.Join(batch, ", "))
+			batch = batch[:0]
+		}
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		literals := make([]string, len(values))
+		for i, v := range values {
+			literals[i] = sqlLiteral(v, types[i].DatabaseTypeName())
+		}
+		batch = append(batch, "("+strings.Join(literals, ", ")+")")
+		if len(batch) == logicalBackupBatch {
+			flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	flush()
+	return nil
+}
+
+// readLogicalBackupHeader 讀取並檢查標頭；結束標記不存在表示檔案不完整，拒絕還原
+func readLogicalBackupHeader(path string) (*logicalBackupHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	first, _ := r.ReadString('\n')
+	if strings.TrimSpace(first) != logicalBackupMagic {
+		return nil, fmt.Errorf("%s is not a logical backup file", path)
+	}
+
+	header := &logicalBackupHeader{}
+	for {
+		line, err := r.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" || !strings.HasPrefix(line, "-- ") || err != nil {
+			break
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "-- "), ": ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "format":
+			header.Format = value
+		case "schema_version":
+			version, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid schema_version %q in backup header", value)
+			}
+			header.SchemaVersion = uint(version)
+		case "tables":
+			if value != "" {
+				header.Tables = strings.Split(value, ",")
+			}
+		}
+	}
+	if header.Format != backupFormat {
+		return nil, fmt.Errorf("backup format %q does not match this database (%s)", header.Format, backupFormat)
+	}
+
+	// 檢查檔案結尾，避免只還原一半
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	tail := make([]byte, len(logicalBackupEnd)+2)
+	offset := stat.Size() - int64(len(tail))
+	if offset < 0 {
+		offset = 0
+	}
+	n, _ := f.ReadAt(tail, offset)
+	if !strings.Contains(string(tail[:n]), logicalBackupEnd) {
+		return nil, fmt.Errorf("backup %s is incomplete (missing end marker)", path)
+	}
+	return header, nil
+}
+
+// restoreLogicalBackup 在同一條連線上依序執行備份中的敘述；備份中沒有的資料表先刪除，讓結果與備份時一致
+func (d *Database) restoreLogicalBackup(ctx context.Context, path string) (*BackupInfo, error) {
+	header, err := readLogicalBackupHeader(path)
+	if err != nil {
+		return nil, err
+	}
+	logFor("backup").Info("Restoring backup", "format", header.Format, "version", header.SchemaVersion, "tables", len(header.Tables))
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	db, err := d.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open connection: %w", err)
+	}
+	defer conn.Close()
+
+	exec := func(stmt string) error {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			summary := firstLine(stmt)
+			if len(summary) > 200 {
+				summary = summary[:200] + " ..."
+			}
+			return fmt.Errorf("%w (statement: %s)", err, summary)
+		}
+		return nil
+	}
+	fail := func(err error) (*BackupInfo, error) {
+		// PostgreSQL 在交易中還原，回復後資料庫維持原狀；MySQL 的 DDL 無法回復，因此 MySQL 先還原到暫存資料庫（見 restoreBackup）
+		conn.ExecContext(ctx, "ROLLBACK")
+		return nil, err
+	}
+
+	existing, err := listTables(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	for _, stmt := range restorePreamble {
+		if err := exec(stmt); err != nil {
+			return fail(err)
+		}
+	}
+	keep := map[string]bool{}
+	for _, table := range header.Tables {
+		keep[table] = true
+	}
+	for _, table := range existing {
+		if !keep[table] {
+			logFor("backup").Info("Dropping table not in backup", "table", table)
+			if err := exec(dropTableSQL(table)); err != nil {
+				return fail(err)
+			}
+		}
+	}
+
+	r := bufio.NewReaderSize(f, 1<<20)
+	var stmt strings.Builder
+	for {
+		line, readErr := r.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return fail(fmt.Errorf("failed to read backup: %w", readErr))
+		}
+		trimmed := strings.TrimRight(line, "\r\n")
+		if stmt.Len() == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "--")) {
+			if readErr == io.EOF {
+				break
+			}
+			continue
+		}
+		if stmt.Len()+len(trimmed) > logicalBackupMaxLine {
+			return fail(fmt.Errorf("statement in backup exceeds %d bytes", logicalBackupMaxLine))
+		}
+		stmt.WriteString(trimmed)
+		if strings.HasSuffix(trimmed, ";") {
+			if err := exec(strings.TrimSuffix(stmt.String(), ";")); err != nil {
+				return fail(err)
+			}
+			stmt.Reset()
+		} else {
+			stmt.WriteString("\n")
+		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+	if stmt.Len() > 0 {
+		return fail(fmt.Errorf("backup ends with an unterminated statement"))
+	}
+
+	for _, stmt := range restorePostamble {
+		if err := exec(stmt); err != nil {
+			return fail(err)
+		}
+	}
+	return readBackupInfo(ctx, db)
+}
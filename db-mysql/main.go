@@ -2,8 +2,10 @@ package main
 
 import (
 	"embed"
-	"log"
-
+	"errors"
+	"flag"
+	"fmt"
+	"os"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -14,16 +16,69 @@ import (
 var assets embed.FS
 
 func main() {
-	// 載入 .env 檔案
-	if err := LoadEnvFile(); err != nil {
-		log.Printf("警告: 無法載入 .env 檔案。將依賴實際的環境變數。原因: %v", err)
+	// 載入設定：預設值 < 設定檔 < .env 檔 < 環境變數 < 命令列旗標
+	cfg, args, err := LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		printConfigError(err)
+		os.Exit(2)
+	}
+	setConfig(cfg)
+	if err := InitLogger(cfg.logOptions()); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid log configuration: %v\n", err)
+		os.Exit(2)
+	}
+	defer CloseLogger()
+
+	// 命令列子命令：migrate 只管理資料庫遷移，不啟動視窗
+	if len(args) > 0 && args[0] == "migrate" {
+		code := runMigrateCommand(args[1:])
+		CloseLogger()
+		os.Exit(code)
+	}
+	// secret 子命令管理密碼庫
+	if len(args) > 0 && args[0] == "secret" {
+		code := runSecretCommand(args[1:])
+		CloseLogger()
+		os.Exit(code)
+	}
+
+	// Prometheus 指標端點（METRICS_ADDR 未設定時不啟動）
+	if err := StartMetricsServer(cfg.MetricsAddr); err != nil {
+		logFor("metrics").Error("Failed to start metrics server", "error", err)
+	}
+	defer StopMetricsServer()
+
+	// 追蹤（TRACE_EXPORTER=none 時不建立 span）
+	if err := InitTracing(cfg.traceOptions()); err != nil {
+		logFor("trace").Error("Failed to initialize tracing", "error", err)
+	}
+	defer ShutdownTracing()
+
+	// serve 子命令以 HTTP JSON API 提供用戶操作，不啟動視窗
+	if len(args) > 0 && args[0] == "serve" {
+		code := runServeCommand(args[1:])
+		ShutdownTracing()
+		StopMetricsServer()
+		CloseLogger()
+		os.Exit(code)
+	}
+	// relay 子命令只發送 user_outbox 的事件，不啟動視窗
+	if len(args) > 0 && args[0] == "relay" {
+		code := runRelayCommand(args[1:])
+		ShutdownTracing()
+		StopMetricsServer()
+		CloseLogger()
+		os.Exit(code)
 	}
 
 	// Create an instance of the app structure
 	app := NewApp()
 
 	// Create application with options
-	err := wails.Run(&options.App{
+	err = wails.Run(&options.App{
 		Title:  "example",
 		Width:  1024,
 		Height: 768,
@@ -32,12 +87,26 @@ func main() {
 		},
 		BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
 		OnStartup:        app.startup,
+		ErrorFormatter:   formatBindingError,
 		Bind: []interface{}{
 			app,
 		},
 	})
 
 	if err != nil {
-		println("Error:", err.Error())
+		logFor("app").Error("Application error", "error", err)
+	}
+}
+
+// printConfigError 逐行列出設定錯誤
+func printConfigError(err error) {
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, "Invalid configuration:")
+	for _, f := range verr.Fields {
+		fmt.Fprintf(os.Stderr, "  %s: %s\n", f.Field, f.Message)
 	}
 }
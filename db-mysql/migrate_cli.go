@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const migrateUsage = `Usage: <app> [config flags] migrate <command> [--dry-run] [--yes]
+
+Commands:
+  status         show current version and applied / pending migrations
+  up [N]         apply all pending migrations, or the next N
+  down [N]       roll back the last N migrations (default 1)
+  goto V         migrate up or down to version V (0 rolls back everything)
+  redo           roll back the current migration and apply it again
+  inspect        compare a dirty migration with the current schema
+  recover S      recover a dirty migration with strategy S
+                 (roll-forward, roll-back or force)
+  check [FILE]   compare the live schema with the migrations applied to a
+                 scratch database; writes a JSON diff to FILE (or stdout),
+                 exit code 3 on drift
+  backup [FILE]  back up the whole database to FILE
+                 (default: a timestamped file in DB_BACKUP_DIR)
+  restore FILE   replace the whole database with the contents of a backup
+
+Flags:
+  --dry-run      print the SQL that would run without executing it
+  --yes, -y      skip the confirmation prompt`
+
+// runMigrateCommand 處理 `migrate` 子命令（不啟動視窗），回傳程式結束代碼
+func runMigrateCommand(args []string) int {
+	var (
+		positional []string
+		dryRun     bool
+		yes        bool
+	)
+	for _, arg := range args {
+		switch arg {
+		case "--dry-run":
+			dryRun = true
+		case "--yes", "-y":
+			yes = true
+		case "-h", "--help", "help":
+			fmt.Println(migrateUsage)
+			return 0
+		default:
+			if strings.HasPrefix(arg, "-") {
+				fmt.Fprintf(os.Stderr, "unknown flag %q\n\n%s\n", arg, migrateUsage)
+				return 2
+			}
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	d := newDatabaseFromEnv()
+	command, rest := positional[0], positional[1:]
+
+	if command == "status" {
+		status, err := d.GetMigrationStatus()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		printMigrationStatus(status)
+		return 0
+	}
+
+	if command == "check" {
+		return runCheckCommand(d, rest)
+	}
+	if command == "backup" {
+		return runBackupCommand(d, rest)
+	}
+	if command == "restore" {
+		return runRestoreCommand(d, rest, yes)
+	}
+	if command == "inspect" {
+		report, err := d.InspectDirtyMigration()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		printDirtyReport(report)
+		return 0
+	}
+	if command == "recover" {
+		return runRecoverCommand(d, rest, dryRun, yes)
+	}
+
+	run, err := migrateCommandFunc(d, command, rest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n%s\n", err, migrateUsage)
+		return 2
+	}
+
+	// 先以 dry run 列出計畫與 SQL，確認後才實際執行
+	plan, err := run(true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if len(plan.Steps) == 0 {
+		fmt.Println("Nothing to migrate")
+		return 0
+	}
+	if dryRun {
+		return 0
+	}
+	if !yes && !confirm(fmt.Sprintf("Apply %d step(s) from version %d to %d?", len(plan.Steps), plan.FromVersion, plan.ToVersion)) {
+		fmt.Println("Aborted")
+		return 1
+	}
+
+	if _, err := run(false); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// migrateCommandFunc 將子命令轉換為可重複呼叫的遷移函式（dry run 與實際執行共用）
+func migrateCommandFunc(d *Database, command string, args []string) (func(dryRun bool) (*MigrationPlan, error), error) {
+	arg := func(def int) (int, error) {
+		if len(args) == 0 {
+			return def, nil
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number %q", args[0])
+		}
+		return n, nil
+	}
+
+	switch command {
+	case "up":
+		n, err := arg(0)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return func(dryRun bool) (*MigrationPlan, error) {
+				status, err := d.GetMigrationStatus()
+				if err != nil {
+					return nil, err
+				}
+				return d.MigrateTo(status.LatestVersion, dryRun)
+			}, nil
+		}
+		return func(dryRun bool) (*MigrationPlan, error) { return d.MigrateSteps(n, dryRun) }, nil
+	case "down":
+		n, err := arg(1)
+		if err != nil {
+			return nil, err
+		}
+		return func(dryRun bool) (*MigrationPlan, error) { return d.MigrateSteps(-n, dryRun) }, nil
+	case "goto":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("goto requires a target version")
+		}
+		v, err := arg(0)
+		if err != nil {
+			return nil, err
+		}
+		return func(dryRun bool) (*MigrationPlan, error) { return d.MigrateTo(uint(v), dryRun) }, nil
+	case "redo":
+		return d.RedoMigration, nil
+	}
+	return nil, fmt.Errorf("unknown command %q", command)
+}
+
+// printMigrationStatus 輸出目前版本與每個遷移檔案的狀態
+func printMigrationStatus(status *MigrationStatus) {
+	fmt.Printf("Current version: %d (dirty: %t)\n", status.CurrentVersion, status.Dirty)
+	fmt.Printf("Latest version:  %d\n", status.LatestVersion)
+	if status.Ahead {
+		fmt.Println("Warning: database version is newer than the latest migration file")
+	}
+	for _, info := range status.Applied {
+		fmt.Printf("  [applied] %d_%s\n", info.Version, info.Name)
+	}
+	for _, info := range status.Pending {
+		fmt.Printf("  [pending] %d_%s\n", info.Version, info.Name)
+	}
+}
+
+// runRecoverCommand 先以 dry run 列出各語句會執行或略過，確認後才修復 dirty 狀態
+func runRecoverCommand(d *Database, args []string, dryRun, yes bool) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: recover requires a strategy (%s, %s or %s)\n", RecoverRollForward, RecoverRollBack, RecoverForce)
+		return 2
+	}
+	strategy := args[0]
+
+	preview, err := d.RecoverDirtyMigration(strategy, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	printRecoveryResult(preview)
+	if dryRun {
+		return 0
+	}
+	if !yes && !confirm(fmt.Sprintf("Recover dirty migration %d with %s?", preview.Version, strategy)) {
+		fmt.Println("Aborted")
+		return 1
+	}
+
+	result, err := d.RecoverDirtyMigration(strategy, false)
+	if result != nil {
+		printRecoveryResult(result)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// printDirtyReport 輸出 dirty 版本每個語句的檢查結果
+func printDirtyReport(report *DirtyReport) {
+	if !report.Dirty {
+		fmt.Println(report.Message)
+		return
+	}
+	fmt.Printf("Dirty version: %d_%s\n", report.Version, report.Name)
+	for _, stmt := range report.Statements {
+		check := stmt.Check
+		if check == "" {
+			check = "(cannot be inspected)"
+		}
+		fmt.Printf("  %2d [%s] %s\n", stmt.Index, stmt.State, check)
+	}
+	fmt.Println(report.Message)
+	fmt.Printf("Suggested: migrate recover %s\n", report.Suggested)
+}
+
+// printRecoveryResult 輸出修復時每個語句的處理結果，失敗的語句會附上完整 SQL 與錯誤
+func printRecoveryResult(result *RecoveryResult) {
+	if result.DryRun {
+		fmt.Printf("Recovery plan (%s) for dirty version %d:\n", result.Strategy, result.Version)
+	} else {
+		fmt.Printf("Recovery (%s) for dirty version %d:\n", result.Strategy, result.Version)
+	}
+	for _, stmt := range result.Statements {
+		fmt.Printf("  %2d [%s] %s\n", stmt.Index, stmt.Result, firstLine(stmt.SQL))
+		if stmt.Error != "" {
+			fmt.Printf("     SQL:   %s\n     Error: %s\n", stmt.SQL, stmt.Error)
+		}
+	}
+	if !result.DryRun && !result.Dirty {
+		fmt.Printf("Database is now at version %d\n", result.NewVersion)
+	}
+}
+
+// firstLine 回傳語句的第一行，供摘要輸出使用
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i] + " ..."
+	}
+	return s
+}
+
+// runCheckCommand 輸出 JSON 格式的 schema 比對結果（指定檔案時寫入檔案，避免與日誌混在一起）；
+// 有差異時回傳 3，方便在 CI 中判斷
+func runCheckCommand(d *Database, args []string) int {
+	report, err := d.CheckSchema()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if len(args) > 0 {
+		if err := os.WriteFile(args[0], append(out, '\n'), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Schema check: %d difference(s), report written to %s\n", len(report.Differences), args[0])
+	} else {
+		fmt.Println(string(out))
+	}
+	if !report.InSync {
+		return 3
+	}
+	return 0
+}
+
+// runBackupCommand 備份資料庫，未指定檔案時寫入 DB_BACKUP_DIR
+func runBackupCommand(d *Database, args []string) int {
+	path := ""
+	if len(args) > 0 {
+		path = args[0]
+	}
+	info, err := d.Backup(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Backup written to %s\n", info.Path)
+	printBackupInfo(info)
+	return 0
+}
+
+// runRestoreCommand 確認後以備份檔取代目前的資料庫
+func runRestoreCommand(d *Database, args []string, yes bool) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: restore requires a backup file")
+		return 2
+	}
+	if !yes && !confirm(fmt.Sprintf("Replace the current database with %s?", args[0])) {
+		fmt.Println("Aborted")
+		return 1
+	}
+	info, err := d.Restore(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Restored from %s\n", info.Path)
+	printBackupInfo(info)
+	return 0
+}
+
+// printBackupInfo 輸出備份的格式、schema 版本與每個資料表的筆數
+func printBackupInfo(info *BackupInfo) {
+	fmt.Printf("Format: %s, schema version: %d (dirty: %t), size: %d bytes, took %dms\n",
+		info.Format, info.SchemaVersion, info.Dirty, info.Size, info.DurationMs)
+	for _, t := range info.Tables {
+		fmt.Printf("  %-28s %d\n", t.Name, t.Rows)
+	}
+}
+
+// confirm 在終端機詢問是否繼續，只有輸入 y / yes 才回傳 true
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
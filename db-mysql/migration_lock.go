@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// ErrMigrationLockTimeout 等待其他執行個體釋放遷移鎖逾時
+var ErrMigrationLockTimeout = errors.New("timed out waiting for migration lock")
+
+// ErrMigrationLockLost 持有遷移鎖期間續約失敗，租約可能已被其他執行個體接手，進行中的操作會被中止
+var ErrMigrationLockLost = errors.New("migration lock lost")
+
+// migrationLockPollInterval 鎖被其他執行個體持有時的重試間隔；等待逾時與租約長度由 DB_MIGRATION_LOCK_TIMEOUT、DB_MIGRATION_LOCK_TTL 設定
+const migrationLockPollInterval = time.Second
+
+// migrationLock 跨執行個體的遷移鎖；不同資料庫以 advisory lock 或租約文件 / 資料列實作
+type migrationLock interface {
+	// tryAcquire 嘗試取得鎖，已被他人持有時回傳 false 與持有者說明
+	tryAcquire(ctx context.Context) (bool, string, error)
+	// renew 延長租約；advisory lock 綁定連線不需要續約，只確認持有鎖的連線仍然存在
+	renew(ctx context.Context) error
+	// release 釋放鎖並關閉使用的連線
+	release(ctx context.Context) error
+}
+
+// migrationLockOwner 本執行個體的鎖持有者 ID（主機名稱-PID-隨機值）
+var migrationLockOwner = newMigrationLockOwner()
+
+func newMigrationLockOwner() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// withMigrationLock 取得遷移鎖後執行 fn；鎖被其他執行個體持有時每秒重試，
+// 超過 DB_MIGRATION_LOCK_TIMEOUT 回傳 ErrMigrationLockTimeout。持有期間定期續約，結束後一定釋放。
+// 續約失敗時取消傳給 fn 的 ctx，fn 應在下一個安全的中斷點停止；此時回傳 ErrMigrationLockLost
+func (d *Database) withMigrationLock(operation string, fn func(ctx context.Context) error) error {
+	timeout := appConfig().MigrationLockTimeout
+	ttl := appConfig().MigrationLockTTL
+
+	lock, err := d.newMigrationLock(ttl)
+	if err != nil {
+		return fmt.Errorf("failed to create migration lock: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	waiting := false
+	for {
+		acquired, holder, err := lock.tryAcquire(ctx)
+		if err != nil {
+			lock.release(context.Background())
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		if acquired {
+			break
+		}
+		if !waiting {
+			logFor("migration").Info("Waiting for migration lock", "holder", holder, LogKeyOperation, operation)
+			waiting = true
+		}
+
+		select {
+		case <-ctx.Done():
+			lock.release(context.Background())
+			return fmt.Errorf("%w after %s (held by %s)", ErrMigrationLockTimeout, timeout, holder)
+		case <-time.After(migrationLockPollInterval):
+		}
+	}
+	logFor("migration").Info("Acquired migration lock", "owner", migrationLockOwner, LogKeyOperation, operation)
+
+	// 持有期間以 TTL 的三分之一為間隔續約，避免長時間的遷移被視為過期；續約失敗就不能再假設只有自己在遷移
+	lockCtx, abort := context.WithCancelCause(context.Background())
+	defer abort(nil)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				renewCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				err := lock.renew(renewCtx)
+				cancel()
+				if err != nil {
+					logFor("migration").Error("Failed to renew migration lock, aborting", "error", err, LogKeyOperation, operation)
+					abort(fmt.Errorf("%w: %v", ErrMigrationLockLost, err))
+					return
+				}
+			}
+		}
+	}()
+
+	defer func() {
+		close(done)
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := lock.release(releaseCtx); err != nil {
+			logFor("migration").Warn("Failed to release migration lock", "error", err)
+			return
+		}
+		logFor("migration").Info("Released migration lock")
+	}()
+
+	err = fn(lockCtx)
+	if cause := context.Cause(lockCtx); errors.Is(cause, ErrMigrationLockLost) {
+		if err != nil {
+			return fmt.Errorf("%s aborted: %w (last error: %v)", operation, cause, err)
+		}
+		return fmt.Errorf("%s aborted: %w", operation, cause)
+	}
+	return err
+}
+
+// stopOnLockLoss 在 ctx 被取消（遷移鎖遺失）時要求 m 於目前的遷移完成後停止，回傳的函式結束監看
+func stopOnLockLoss(ctx context.Context, m *migrate.Migrate) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.GracefulStop <- true
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
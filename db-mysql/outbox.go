@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutboxEvent 寫入 user_outbox、由 relay 送到訊息代理的用戶事件
+type OutboxEvent struct {
+	EventID    string                 `json:"eventId"` // 消費端以此去除重複的訊息
+	Type       string                 `json:"type"`    // user.created、user.updated 或 user.deleted
+	UserID     int64                  `json:"userId"`
+	Actor      string                 `json:"actor"`
+	OccurredAt time.Time              `json:"occurredAt"`
+	User       map[string]interface{} `json:"user"` // 異動後的資料，刪除時為刪除前的資料
+}
+
+// recordUserChange 寫入稽核紀錄，DB_OUTBOX 啟用時同時寫入 user_outbox；應與異動本身在同一個交易中呼叫，
+// 交易回復時兩者一起回復，提交後事件一定會被 relay 送出
+func recordUserChange(ctx context.Context, q sqlExecutor, userID int64, action string, before, after map[string]interface{}, actor string) error {
+	if err := writeAudit(ctx, q, userID, action, before, after, actor); err != nil {
+		return err
+	}
+	if !appConfig().Outbox {
+		return nil
+	}
+
+	snapshot := after
+	if snapshot == nil {
+		snapshot = before
+	}
+	eventID, err := uuid.NewRandom()
+	if err != nil {
+		return fmt.Errorf("failed to generate event ID: %w", err)
+	}
+	event := OutboxEvent{
+		EventID:    eventID.String(),
+		Type:       auditChangeType(action),
+		UserID:     userID,
+		Actor:      actor,
+		OccurredAt: time.Now().UTC(),
+		User:       snapshot,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox event: %w", err)
+	}
+
+	outboxSQL := fmt.Sprintf(`INSERT INTO user_outbox (event_id, event_type, user_id, payload) VALUES (%s, %s, %s, %s)`,
+		placeholder(1), placeholder(2), placeholder(3), placeholder(4))
+	if _, err := q.ExecContext(ctx, outboxSQL, event.EventID, event.Type, userID, string(payload)); err != nil {
+		return fmt.Errorf("failed to write outbox event: %w", err)
+	}
+	return nil
+}
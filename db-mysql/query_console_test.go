@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestAnalyzeSQL(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantVerb  string
+		wantWrite bool
+	}{
+		{"select", "SELECT * FROM users", "SELECT", false},
+		{"lowercase with semicolon", "  select 1;", "SELECT", false},
+		{"trailing comment", "SELECT 1; -- done", "SELECT", false},
+		{"leading line comment", "-- DELETE FROM users\nSELECT 1", "SELECT", false},
+		{"block comment", "/* DELETE FROM users */ SELECT 1", "SELECT", false},
+		{"keyword in string", "SELECT 'DELETE FROM users'", "SELECT", false},
+		{"doubled quote", "SELECT 'it''s; DELETE FROM users'", "SELECT", false},
+		{"quoted identifier", `SELECT "update" FROM t`, "SELECT", false},
+		{"show", "SHOW TABLES", "SHOW", false},
+		{"delete", "DELETE FROM users", "DELETE", true},
+		{"update", "update users set age = 1", "UPDATE", true},
+		{"create", "CREATE TABLE t (id INT)", "CREATE", true},
+		{"unknown verb", "VACUUM", "VACUUM", true},
+		{"with delete", "WITH x AS (DELETE FROM users RETURNING id) SELECT * FROM x", "WITH", true},
+		{"select into", "SELECT * INTO backup FROM users", "SELECT", true},
+		{"select for update", "SELECT * FROM users FOR UPDATE", "SELECT", true},
+		{"explain analyze delete", "EXPLAIN ANALYZE DELETE FROM users", "EXPLAIN", true},
+		{"hash comment", "# DELETE FROM users\nSELECT 1", "SELECT", false},
+		{"backslash escape", `SELECT 'a\'; DELETE FROM users; --'`, "SELECT", false},
+		{"executable comment", "/*!40000 DELETE FROM users */", "/*!", true},
+		{"executable comment after select", "SELECT 1 /*! , SLEEP(10) */", "SELECT", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := analyzeSQL(tt.query)
+			if err != nil {
+				t.Fatalf("analyzeSQL(%q): %v", tt.query, err)
+			}
+			if got.Verb != tt.wantVerb || got.Write != tt.wantWrite {
+				t.Fatalf("analyzeSQL(%q) = %+v, want verb %s write %v", tt.query, *got, tt.wantVerb, tt.wantWrite)
+			}
+		})
+	}
+}
+
+func TestAnalyzeSQLRejects(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"-- only a comment",
+		"SELECT 1; SELECT 2",
+		"SELECT 1; DROP TABLE users",
+		"SELECT 'unterminated",
+		"SELECT 1 /* unterminated",
+	} {
+		if _, err := analyzeSQL(query); err == nil {
+			t.Errorf("analyzeSQL(%q) succeeded, want an error", query)
+		}
+	}
+}
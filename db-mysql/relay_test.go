@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRelayRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		maxDelay time.Duration
+		want     time.Duration
+	}{
+		{1, time.Minute, time.Second},
+		{2, time.Minute, 2 * time.Second},
+		{4, time.Minute, 8 * time.Second},
+		{7, time.Minute, time.Minute},
+		{1000, time.Minute, time.Minute},
+		{1, 500 * time.Millisecond, 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := relayRetryDelay(tt.attempts, tt.maxDelay); got != tt.want {
+			t.Errorf("relayRetryDelay(%d, %s) = %s, want %s", tt.attempts, tt.maxDelay, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 過濾條件支援的運算子
+const (
+	FilterOpEq      = "eq"
+	FilterOpNe      = "ne"
+	FilterOpGt      = "gt"
+	FilterOpGte     = "gte"
+	FilterOpLt      = "lt"
+	FilterOpLte     = "lte"
+	FilterOpLike    = "like"
+	FilterOpIn      = "in"
+	FilterOpBetween = "between"
+)
+
+// 條件群組的組合方式
+const (
+	FilterLogicAnd = "and"
+	FilterLogicOr  = "or"
+)
+
+// maxFilterDepth 限制群組巢狀層數，避免前端傳入過深的條件樹
+const maxFilterDepth = 5
+
+// FilterCondition 單一欄位的比較條件
+// in 使用 Values 作為清單；between 的 Values 必須恰好兩個值，依序為下界與上界（含）
+type FilterCondition struct {
+	Field  string        `json:"field"`
+	Op     string        `json:"op"`
+	Value  interface{}   `json:"value"`
+	Values []interface{} `json:"values"`
+}
+
+// UserFilter 結構化的用戶查詢條件
+// Conditions 與 Groups 依 Logic（and / or，預設 and）組合；Keyword 會以 AND 套用在整組條件上
+type UserFilter struct {
+	Logic      string            `json:"logic"`
+	Keyword    string            `json:"keyword"`
+	Conditions []FilterCondition `json:"conditions"`
+	Groups     []UserFilter      `json:"groups"`
+}
+
+// filterFieldType 可過濾欄位的值型別
+type filterFieldType int
+
+const (
+	filterFieldInt filterFieldType = iota
+	filterFieldString
+	filterFieldTime
+)
+
+// userFilterFields 允許過濾的欄位白名單，欄位名稱不會直接拼入 SQL
+var userFilterFields = map[string]filterFieldType{
+	"id":         filterFieldInt,
+	"name":       filterFieldString,
+	"email":      filterFieldString,
+	"age":        filterFieldInt,
+	"created_at": filterFieldTime,
+}
+
+// checkFilterOp 檢查運算子是否適用於該欄位型別
+func checkFilterOp(field string, fieldType filterFieldType, op string) error {
+	switch op {
+	case FilterOpEq, FilterOpNe, FilterOpIn:
+		return nil
+	case FilterOpGt, FilterOpGte, FilterOpLt, FilterOpLte, FilterOpBetween:
+		if fieldType == filterFieldString {
+			return fmt.Errorf("operator %q is not supported on field %q", op, field)
+		}
+		return nil
+	case FilterOpLike:
+		if fieldType != filterFieldString {
+			return fmt.Errorf("operator %q is not supported on field %q", op, field)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown filter operator %q", op)
+	}
+}
+
+// coerceFilterValue 將前端傳入的值（JSON 解碼後多為 float64 / string）轉換為欄位型別
+func coerceFilterValue(field string, fieldType filterFieldType, value interface{}) (interface{}, error) {
+	switch fieldType {
+	case filterFieldInt:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case int64:
+			return int(v), nil
+		case float64:
+			if v != math.Trunc(v) {
+				return nil, fmt.Errorf("field %q expects an integer, got %v", field, v)
+			}
+			return int(v), nil
+		case json.Number:
+			n, err := strconv.Atoi(v.String())
+			if err != nil {
+				return nil, fmt.Errorf("field %q expects an integer, got %q", field, v)
+			}
+			return n, nil
+		case string:
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("field %q expects an integer, got %q", field, v)
+			}
+			return n, nil
+		}
+	case filterFieldString:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case filterFieldTime:
+		switch v := value.(type) {
+		case time.Time:
+			return v, nil
+		case string:
+			for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+				if t, err := time.ParseInLocation(layout, strings.TrimSpace(v), time.Local); err == nil {
+					return t, nil
+				}
+			}
+			return nil, fmt.Errorf("field %q expects a date (YYYY-MM-DD or RFC3339), got %q", field, v)
+		}
+	}
+	return nil, fmt.Errorf("field %q has unsupported value %v (%T)", field, value, value)
+}
+
+// escapeLikePattern 跳脫 LIKE 的萬用字元，搭配 ESCAPE '!' 使用
+func escapeLikePattern(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+// sqlFilterBuilder 將 UserFilter 轉換為參數化的 SQL 條件
+type sqlFilterBuilder struct {
+	args []interface{}
+}
+
+// bind 加入一個綁定參數並回傳對應的佔位符；回傳的佔位符必須依呼叫順序出現在 SQL 中
+func (b *sqlFilterBuilder) bind(value interface{}) string {
+	b.args = append(b.args, value)
+	return placeholder(len(b.args))
+}
+
+// bindValue 綁定欄位值，時間欄位會依方言轉換
+func (b *sqlFilterBuilder) bindValue(fieldType filterFieldType, value interface{}) string {
+	if t, ok := value.(time.Time); ok && fieldType == filterFieldTime {
+		return b.bind(timeArg(t))
+	}
+	return b.bind(value)
+}
+
+// where 回傳含 WHERE 關鍵字的條件字串，一律排除已軟刪除的用戶
+func (b *sqlFilterBuilder) where(filter UserFilter) (string, error) {
+	clause, err := b.group(filter, 1)
+	if err != nil {
+		return "", err
+	}
+	if clause == "" {
+		return " WHERE deleted_at IS NULL", nil
+	}
+	return " WHERE deleted_at IS NULL AND " + clause, nil
+}
+
+func (b *sqlFilterBuilder) group(filter UserFilter, depth int) (string, error) {
+	if depth > maxFilterDepth {
+		return "", fmt.Errorf("filter groups are nested deeper than %d levels", maxFilterDepth)
+	}
+
+	joiner := " AND "
+	switch strings.ToLower(filter.Logic) {
+	case "", FilterLogicAnd:
+	case FilterLogicOr:
+		joiner = " OR "
+	default:
+		return "", fmt.Errorf("unknown filter logic %q", filter.Logic)
+	}
+
+	var clauses []string
+	for _, cond := range filter.Conditions {
+		clause, err := b.condition(cond)
+		if err != nil {
+			return "", err
+		}
+		clauses = append(clauses, clause)
+	}
+	for _, sub := range filter.Groups {
+		clause, err := b.group(sub, depth+1)
+		if err != nil {
+			return "", err
+		}
+		if clause != "" {
+			clauses = append(clauses, clause)
+		}
+	}
+
+	combined := ""
+	if len(clauses) > 0 {
+		combined = "(" + strings.Join(clauses, joiner) + ")"
+	}
+
+	if keyword := strings.TrimSpace(filter.Keyword); keyword != "" {
+		pattern := "%" + escapeLikePattern(keyword) + "%"
+		like := likeOperator()
+		keywordClause := fmt.Sprintf("(name %s %s ESCAPE '!' OR email %s %s ESCAPE '!')",
+			like, b.bind(pattern), like, b.bind(pattern))
+		if combined == "" {
+			return keywordClause, nil
+		}
+		// 關鍵字的參數在條件之後綁定，子句也須放在後面：MySQL / SQLite 的 ? 依出現的位置對應參數
+		return "(" + combined + " AND " + keywordClause + ")", nil
+	}
+
+	return combined, nil
+}
+
+func (b *sqlFilterBuilder) condition(cond FilterCondition) (string, error) {
+	field := strings.ToLower(strings.TrimSpace(cond.Field))
+	fieldType, ok := userFilterFields[field]
+	if !ok {
+		return "", fmt.Errorf("unknown filter field %q", cond.Field)
+	}
+	op := strings.ToLower(cond.Op)
+	if err := checkFilterOp(field, fieldType, op); err != nil {
+		return "", err
+	}
+
+	switch op {
+	case FilterOpIn:
+		if len(cond.Values) == 0 {
+			return "", fmt.Errorf("operator %q on field %q requires at least one value", op, field)
+		}
+		holders := make([]string, 0, len(cond.Values))
+		for _, raw := range cond.Values {
+			value, err := coerceFilterValue(field, fieldType, raw)
+			if err != nil {
+				return "", err
+			}
+			holders = append(holders, b.bindValue(fieldType, value))
+		}
+		return fmt.Sprintf("%s IN (%s)", field, strings.Join(holders, ", ")), nil
+
+	case FilterOpBetween:
+		if len(cond.Values) != 2 {
+			return "", fmt.Errorf("operator %q on field %q requires exactly two values", op, field)
+		}
+		low, err := coerceFilterValue(field, fieldType, cond.Values[0])
+		if err != nil {
+			return "", err
+		}
+		high, err := coerceFilterValue(field, fieldType, cond.Values[1])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s BETWEEN %s AND %s", field,
+			b.bindValue(fieldType, low), b.bindValue(fieldType, high)), nil
+
+	case FilterOpLike:
+		value, err := coerceFilterValue(field, fieldType, cond.Value)
+		if err != nil {
+			return "", err
+		}
+		pattern := "%" + escapeLikePattern(value.(string)) + "%"
+		return fmt.Sprintf("%s %s %s ESCAPE '!'", field, likeOperator(), b.bind(pattern)), nil
+	}
+
+	value, err := coerceFilterValue(field, fieldType, cond.Value)
+	if err != nil {
+		return "", err
+	}
+	operators := map[string]string{
+		FilterOpEq:  "=",
+		FilterOpNe:  "<>",
+		FilterOpGt:  ">",
+		FilterOpGte: ">=",
+		FilterOpLt:  "<",
+		FilterOpLte: "<=",
+	}
+	return fmt.Sprintf("%s %s %s", field, operators[op], b.bindValue(fieldType, value)), nil
+}
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS user_audit;
+
+DROP INDEX IF EXISTS idx_users_email_live;
+
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+
+DROP INDEX IF EXISTS idx_users_deleted_at;
+
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
\ No newline at end of file
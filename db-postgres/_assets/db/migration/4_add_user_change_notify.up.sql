@@ -0,0 +1,28 @@
+CREATE OR REPLACE FUNCTION notify_user_change() RETURNS trigger AS $$
+DECLARE
+    change_type TEXT;
+    changed_row JSON;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        change_type := 'user.created';
+        changed_row := row_to_json(NEW);
+    ELSIF TG_OP = 'DELETE' THEN
+        change_type := 'user.deleted';
+        changed_row := row_to_json(OLD);
+    ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+        change_type := 'user.deleted';
+        changed_row := row_to_json(NEW);
+    ELSE
+        change_type := 'user.updated';
+        changed_row := row_to_json(NEW);
+    END IF;
+    PERFORM pg_notify('user_changes', json_build_object('type', change_type, 'user', changed_row)::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS users_notify_change ON users;
+
+CREATE TRIGGER users_notify_change
+    AFTER INSERT OR UPDATE OR DELETE ON users
+    FOR EACH ROW EXECUTE FUNCTION notify_user_change();
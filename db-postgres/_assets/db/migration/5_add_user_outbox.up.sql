@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS user_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_id VARCHAR(36) NOT NULL UNIQUE,
+    event_type VARCHAR(50) NOT NULL,
+    user_id INTEGER NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NULL,
+    last_error TEXT NULL,
+    claimed_by VARCHAR(255) NULL,
+    claimed_until TIMESTAMP NULL,
+    published_at TIMESTAMP NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_outbox_pending ON user_outbox (published_at, id);
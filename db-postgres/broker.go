@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// relay 使用的訊息代理
+const (
+	RelayBrokerNone = "none"
+	RelayBrokerAMQP = "amqp"
+	RelayBrokerMQTT = "mqtt"
+	RelayBrokerFile = "file" // 每則訊息一行 JSON，附加到檔案，用於沒有訊息代理時的本機測試
+)
+
+// relayPublishTimeout 連線與等待代理確認一則訊息的時間
+const relayPublishTimeout = 10 * time.Second
+
+// RelayOptions relay 的設定
+type RelayOptions struct {
+	Broker        string        // none、amqp、mqtt 或 file
+	URL           string        // amqp://、tcp:// 等代理網址；file 代理為寫入的檔案
+	Exchange      string        // AMQP topic exchange，routing key 為事件名稱
+	Topic         string        // MQTT topic 前綴，訊息送到 <前綴>/<事件名稱>
+	PollInterval  time.Duration // 沒有待發送事件時的輪詢間隔
+	RetryMaxDelay time.Duration // 發送失敗後重試的最長等待時間
+	Retention     time.Duration // 已發送的事件保留多久
+}
+
+// OutboxMessage 一則待發送的訊息
+type OutboxMessage struct {
+	EventID string // 事件 ID，消費端以此去除重複的訊息
+	Type    string // 事件名稱，例如 user.created
+	Payload []byte // JSON 內容
+}
+
+// Publisher 將訊息送到訊息代理。Publish 回傳 nil 表示代理已確認收到（AMQP 的 publisher confirm、MQTT QoS 1 的 PUBACK），
+// 回傳錯誤時訊息可能已送達也可能沒有，relay 會再送一次。連線在第一次發送時建立，發送失敗後關閉，下次發送時重新連線
+type Publisher interface {
+	Publish(ctx context.Context, msg OutboxMessage) error
+	Close() error
+}
+
+// newPublisher 依 opts.Broker 建立 Publisher（不會立即連線）
+func newPublisher(opts RelayOptions) (Publisher, error) {
+	switch opts.Broker {
+	case RelayBrokerAMQP:
+		return &amqpPublisher{url: opts.URL, exchange: opts.Exchange}, nil
+	case RelayBrokerMQTT:
+		return newMQTTPublisher(opts.URL, opts.Topic)
+	case RelayBrokerFile:
+		return &filePublisher{path: opts.URL}, nil
+	}
+	return nil, fmt.Errorf("unknown relay broker %q (use amqp, mqtt or file)", opts.Broker)
+}
+
+// relayTarget 記錄於日誌的發送目標，網址中的密碼以 xxxxx 取代
+func relayTarget(opts RelayOptions) string {
+	if opts.Broker == RelayBrokerFile {
+		return opts.URL
+	}
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return "(invalid URL)"
+	}
+	return u.Redacted()
+}
+
+// region <-- AMQP -->
+
+// amqpPublisher 以 persistent 訊息送到 durable topic exchange，並以 publisher confirm 等待代理確認
+type amqpPublisher struct {
+	url      string
+	exchange string
+	conn     *amqp.Connection
+	ch       *amqp.Channel
+}
+
+// connect 連線、宣告 exchange 並開啟 confirm 模式
+func (p *amqpPublisher) connect() error {
+	conn, err := amqp.DialConfig(p.url, amqp.Config{Dial: amqp.DefaultDial(relayPublishTimeout)})
+	if err != nil {
+		return fmt.Errorf("failed to connect to AMQP broker: %w", err)
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to open AMQP channel: %w", err)
+	}
+	if err := ch.ExchangeDeclare(p.exchange, amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to declare exchange %q: %w", p.exchange, err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	p.conn, p.ch = conn, ch
+	return nil
+}
+
+// Publish 實作 Publisher
+func (p *amqpPublisher) Publish(ctx context.Context, msg OutboxMessage) error {
+	if p.ch == nil || p.ch.IsClosed() {
+		p.Close()
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+	confirm, err := p.ch.PublishWithDeferredConfirmWithContext(ctx, p.exchange, msg.Type, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    msg.EventID,
+		Type:         msg.Type,
+		Timestamp:    time.Now(),
+		Body:         msg.Payload,
+	})
+	if err != nil {
+		p.Close()
+		return fmt.Errorf("failed to publish to AMQP broker: %w", err)
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		p.Close()
+		return fmt.Errorf("failed to wait for AMQP broker confirmation: %w", err)
+	}
+	if !acked {
+		return errors.New("AMQP broker rejected the message")
+	}
+	return nil
+}
+
+// Close 實作 Publisher
+func (p *amqpPublisher) Close() error {
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn, p.ch = nil, nil
+	if errors.Is(err, amqp.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// endregion
+
+// region <-- MQTT -->
+
+// mqttPublisher 以 QoS 1 送出訊息，收到 PUBACK 才算完成
+type mqttPublisher struct {
+	opts   *mqtt.ClientOptions
+	topic  string
+	client mqtt.Client
+}
+
+// newMQTTPublisher 解析代理網址；網址中的帳號密碼作為 MQTT 的帳號密碼
+func newMQTTPublisher(rawURL, topic string) (*mqttPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MQTT broker URL: %w", err)
+	}
+	opts := mqtt.NewClientOptions()
+	if u.User != nil {
+		opts.SetUsername(u.User.Username())
+		if password, ok := u.User.Password(); ok {
+			opts.SetPassword(password)
+		}
+		u.User = nil
+	}
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("failed to generate MQTT client ID: %w", err)
+	}
+	opts.AddBroker(u.String()).
+		SetClientID("relay-" + hex.EncodeToString(suffix)).
+		SetCleanSession(true).
+		SetAutoReconnect(false).
+		SetConnectTimeout(relayPublishTimeout).
+		SetWriteTimeout(relayPublishTimeout)
+	return &mqttPublisher{opts: opts, topic: strings.TrimSuffix(topic, "/")}, nil
+}
+
+// Publish 實作 Publisher
+func (p *mqttPublisher) Publish(ctx context.Context, msg OutboxMessage) error {
+	if p.client == nil || !p.client.IsConnectionOpen() {
+		p.Close()
+		client := mqtt.NewClient(p.opts)
+		if err := waitToken(ctx, client.Connect()); err != nil {
+			return fmt.Errorf("failed to connect to MQTT broker: %w", err)
+		}
+		p.client = client
+	}
+	if err := waitToken(ctx, p.client.Publish(p.topic+"/"+msg.Type, 1, false, msg.Payload)); err != nil {
+		p.Close()
+		return fmt.Errorf("failed to publish to MQTT broker: %w", err)
+	}
+	return nil
+}
+
+// Close 實作 Publisher
+func (p *mqttPublisher) Close() error {
+	if p.client != nil {
+		p.client.Disconnect(250)
+		p.client = nil
+	}
+	return nil
+}
+
+// waitToken 等待 MQTT 操作完成或 ctx 結束
+func waitToken(ctx context.Context, token mqtt.Token) error {
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// endregion
+
+// region <-- 檔案 -->
+
+// filePublisher 每則訊息以一行 JSON 附加到檔案，寫入成功即視為代理已確認
+type filePublisher struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// fileMessage filePublisher 寫入的一行
+type fileMessage struct {
+	MessageID string          `json:"messageId"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// Publish 實作 Publisher
+func (p *filePublisher) Publish(ctx context.Context, msg OutboxMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.f == nil {
+		f, err := os.OpenFile(p.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open relay file: %w", err)
+		}
+		p.f = f
+	}
+	line, err := json.Marshal(fileMessage{MessageID: msg.EventID, Type: msg.Type, Payload: msg.Payload})
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	if _, err := p.f.Write(append(line, '\n')); err != nil {
+		p.f.Close()
+		p.f = nil
+		return fmt.Errorf("failed to write relay file: %w", err)
+	}
+	return nil
+}
+
+// Close 實作 Publisher
+func (p *filePublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.f == nil {
+		return nil
+	}
+	err := p.f.Close()
+	p.f = nil
+	return err
+}
+
+// endregion
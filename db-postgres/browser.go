@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// 資料表瀏覽額外支援的運算子（其餘沿用 FilterCondition 的運算子）
+const (
+	FilterOpIsNull  = "isnull"
+	FilterOpNotNull = "notnull"
+)
+
+// 瀏覽資料表的分頁大小
+const (
+	defaultBrowsePageSize = 50
+	maxBrowsePageSize     = 500
+)
+
+// TableSummary 資料表名稱與列數
+type TableSummary struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+}
+
+// TableColumn 欄位定義
+type TableColumn struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+	Default  string `json:"default,omitempty"`
+}
+
+// TableIndex 索引定義
+type TableIndex struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+}
+
+// TableDescription 資料表的欄位、索引與列數
+type TableDescription struct {
+	Name    string        `json:"name"`
+	Rows    int64         `json:"rows"`
+	Columns []TableColumn `json:"columns"`
+	Indexes []TableIndex  `json:"indexes"`
+}
+
+// TableQuery 瀏覽資料表的條件；Conditions 以 AND 組合，欄位必須是資料表的欄位，
+// OrderBy 為空時依第一個欄位排序
+type TableQuery struct {
+	Conditions []FilterCondition `json:"conditions"`
+	OrderBy    string            `json:"orderBy"`
+	Desc       bool              `json:"desc"`
+	Page       int               `json:"page"`
+	PageSize   int               `json:"pageSize"`
+}
+
+// TablePage 一頁資料；Columns 為欄位順序，Rows 以欄位名稱為 key
+type TablePage struct {
+	Table    string                   `json:"table"`
+	Columns  []string                 `json:"columns"`
+	Rows     []map[string]interface{} `json:"rows" ts_type:"Array<Record<string, any>>"`
+	Total    int64                    `json:"total"`
+	Page     int                      `json:"page"`
+	PageSize int                      `json:"pageSize"`
+}
+
+// withReadOnlyTx 在唯讀交易中執行 fn，瀏覽資料表不會修改任何資料；fn 中的呼叫應使用同一個 ctx
+func (d *Database) withReadOnlyTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	db, err := d.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to start read-only transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := guardReadOnly(ctx, tx); err != nil {
+		return err
+	}
+	return fn(tx)
+}
+
+// ListTables 列出所有資料表與列數
+func (d *Database) ListTables() ([]TableSummary, error) {
+	ctx := withOperation(context.Background(), "ListTables")
+	summaries := []TableSummary{}
+	err := d.withReadOnlyTx(ctx, func(tx *sql.Tx) error {
+		tables, err := listTables(ctx, tx)
+		if err != nil {
+			return fmt.Errorf("failed to list tables: %w", err)
+		}
+		for _, table := range tables {
+			var rows int64
+			if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+quoteIdent(table)).Scan(&rows); err != nil {
+				return fmt.Errorf("failed to count rows of %s: %w", table, err)
+			}
+			summaries = append(summaries, TableSummary{Name: table, Rows: rows})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// describeTable 讀取資料表定義，資料表不存在時回傳驗證錯誤
+func describeTable(ctx context.Context, q sqlExecutor, table string) (*TableDescription, error) {
+	snapshot, err := readSchema(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	t, ok := snapshot[table]
+	if !ok || len(t.Columns) == 0 {
+		return nil, newValidationError("table", fmt.Sprintf("unknown table %q", table))
+	}
+
+	desc := &TableDescription{Name: table, Columns: []TableColumn{}, Indexes: []TableIndex{}}
+	for _, c := range t.Columns {
+		desc.Columns = append(desc.Columns, TableColumn{Name: c.Name, Type: c.Type, Nullable: c.Nullable, Default: c.Default})
+	}
+	for _, idx := range t.Indexes {
+		desc.Indexes = append(desc.Indexes, TableIndex{Name: idx.Name, Columns: idx.Columns, Unique: idx.Unique})
+	}
+	sort.Slice(desc.Indexes, func(i, j int) bool { return desc.Indexes[i].Name < desc.Indexes[j].Name })
+	return desc, nil
+}
+
+// DescribeTable 回傳資料表的欄位、索引與列數
+func (d *Database) DescribeTable(table string) (*TableDescription, error) {
+	ctx := withOperation(context.Background(), "DescribeTable")
+	var desc *TableDescription
+	err := d.withReadOnlyTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		desc, err = describeTable(ctx, tx, table)
+		if err != nil {
+			return err
+		}
+		return tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+quoteIdent(table)).Scan(&desc.Rows)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return desc, nil
+}
+
+// BrowseTable 分頁讀取任意資料表的資料；欄位名稱以資料表定義驗證後才拼入 SQL，值一律以參數綁定
+func (d *Database) BrowseTable(table string, query TableQuery) (*TablePage, error) {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 {
+		query.PageSize = defaultBrowsePageSize
+	}
+	if query.PageSize > maxBrowsePageSize {
+		query.PageSize = maxBrowsePageSize
+	}
+
+	page := &TablePage{Table: table, Page: query.Page, PageSize: query.PageSize, Rows: []map[string]interface{}{}}
+	ctx := withOperation(context.Background(), "BrowseTable")
+	err := d.withReadOnlyTx(ctx, func(tx *sql.Tx) error {
+		desc, err := describeTable(ctx, tx, table)
+		if err != nil {
+			return err
+		}
+		columns := map[string]bool{}
+		for _, c := range desc.Columns {
+			columns[c.Name] = true
+		}
+
+		builder := &sqlFilterBuilder{}
+		var clauses []string
+		for _, cond := range query.Conditions {
+			clause, err := builder.tableCondition(columns, cond)
+			if err != nil {
+				return newValidationError("conditions", err.Error())
+			}
+			clauses = append(clauses, clause)
+		}
+		whereSQL := ""
+		if len(clauses) > 0 {
+			whereSQL = " WHERE " + strings.Join(clauses, " AND ")
+		}
+
+		orderBy := query.OrderBy
+		if orderBy == "" {
+			orderBy = desc.Columns[0].Name
+		}
+		if !columns[orderBy] {
+			return newValidationError("orderBy", fmt.Sprintf("unknown column %q", orderBy))
+		}
+		direction := "ASC"
+		if query.Desc {
+			direction = "DESC"
+		}
+
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+quoteIdent(table)+whereSQL, builder.args...).Scan(&page.Total); err != nil {
+			return fmt.Errorf("failed to count rows: %w", err)
+		}
+
+		querySQL := fmt.Sprintf("SELECT * FROM %s%s ORDER BY %s %s LIMIT %s OFFSET %s",
+			quoteIdent(table), whereSQL, quoteIdent(orderBy), direction,
+			builder.bind(query.PageSize), builder.bind((query.Page-1)*query.PageSize))
+		rows, err := tx.QueryContext(ctx, querySQL, builder.args...)
+		if err != nil {
+			return fmt.Errorf("failed to query %s: %w", table, err)
+		}
+		defer rows.Close()
+
+		page.Columns, err = rows.Columns()
+		if err != nil {
+			return fmt.Errorf("failed to get columns: %w", err)
+		}
+		for rows.Next() {
+			values := make([]interface{}, len(page.Columns))
+			valuePtrs := make([]interface{}, len(page.Columns))
+			for i := range values {
+				valuePtrs[i] = &values[i]
+			}
+			if err := rows.Scan(valuePtrs...); err != nil {
+				return fmt.Errorf("failed to scan row: %w", err)
+			}
+			row := make(map[string]interface{}, len(page.Columns))
+			for i, column := range page.Columns {
+				row[column] = browseValue(values[i])
+			}
+			page.Rows = append(page.Rows, row)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// tableCondition 將條件轉為 SQL；欄位必須存在於 columns，值不做型別轉換，由資料庫依欄位型別比較
+func (b *sqlFilterBuilder) tableCondition(columns map[string]bool, cond FilterCondition) (string, error) {
+	if !columns[cond.Field] {
+		return "", fmt.Errorf("unknown column %q", cond.Field)
+	}
+	column := quoteIdent(cond.Field)
+
+	switch op := strings.ToLower(cond.Op); op {
+	case FilterOpIsNull:
+		return column + " IS NULL", nil
+	case FilterOpNotNull:
+		return column + " IS NOT NULL", nil
+	case FilterOpLike:
+		pattern := "%" + escapeLikePattern(fmt.Sprint(cond.Value)) + "%"
+		return fmt.Sprintf("%s %s %s ESCAPE '!'", castText(column), likeOperator(), b.bind(pattern)), nil
+	case FilterOpIn:
+		if len(cond.Values) == 0 {
+			return "", fmt.Errorf("operator %q on column %q requires at least one value", op, cond.Field)
+		}
+		holders := make([]string, 0, len(cond.Values))
+		for _, value := range cond.Values {
+			holders = append(holders, b.bind(browseArg(value)))
+		}
+		return fmt.Sprintf("%s IN (%s)", column, strings.Join(holders, ", ")), nil
+	case FilterOpBetween:
+		if len(cond.Values) != 2 {
+			return "", fmt.Errorf("operator %q on column %q requires exactly two values", op, cond.Field)
+		}
+		return fmt.Sprintf("%s BETWEEN %s AND %s", column, b.bind(browseArg(cond.Values[0])), b.bind(browseArg(cond.Values[1]))), nil
+	default:
+		operators := map[string]string{
+			FilterOpEq:  "=",
+			FilterOpNe:  "<>",
+			FilterOpGt:  ">",
+			FilterOpGte: ">=",
+			FilterOpLt:  "<",
+			FilterOpLte: "<=",
+		}
+		sqlOp, ok := operators[op]
+		if !ok {
+			return "", fmt.Errorf("unknown filter operator %q", cond.Op)
+		}
+		if cond.Value == nil {
+			return "", fmt.Errorf("operator %q on column %q requires a value", op, cond.Field)
+		}
+		return fmt.Sprintf("%s %s %s", column, sqlOp, b.bind(browseArg(cond.Value))), nil
+	}
+}
+
+// browseArg 前端傳入的整數（JSON 解碼後為 float64）轉為 int64，避免以 5.0 之類的字串比較
+func browseArg(value interface{}) interface{} {
+	if f, ok := value.(float64); ok && f == float64(int64(f)) {
+		return int64(f)
+	}
+	return value
+}
+
+// browseValue 將查詢取得的值轉為前端可顯示的型別；非 UTF-8 的二進位資料以十六進位字串表示
+func browseValue(value interface{}) interface{} {
+	b, ok := value.([]byte)
+	if !ok {
+		return value
+	}
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	return "0x" + hex.EncodeToString(b)
+}
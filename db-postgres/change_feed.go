@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// 用戶異動的事件名稱，同時作為送給前端的 Wails 事件名稱
+const (
+	UserCreatedEvent = "user.created"
+	UserUpdatedEvent = "user.updated"
+	UserDeletedEvent = "user.deleted"
+)
+
+// userChangeChannel 觸發程序 notify_user_change 送出通知的頻道（見遷移 4_add_user_change_notify）
+const userChangeChannel = "user_changes"
+
+// changeFeedCheckInterval 檢查是否已切換連線並 ping 監聽連線的間隔
+const changeFeedCheckInterval = 10 * time.Second
+
+// UserChangeEvent 一筆用戶異動；User 為異動後的資料，永久刪除時為刪除前的資料
+type UserChangeEvent struct {
+	Type string                 `json:"type"`
+	ID   int64                  `json:"id"`
+	User map[string]interface{} `json:"user"`
+}
+
+var (
+	// userChangeListener 接收用戶異動，由 App 轉送為 Wails 事件
+	userChangeListenerMu sync.RWMutex
+	userChangeListener   func(UserChangeEvent)
+)
+
+// SetUserChangeListener 設定用戶異動的接收者（nil 表示不通知）
+func SetUserChangeListener(fn func(UserChangeEvent)) {
+	userChangeListenerMu.Lock()
+	userChangeListener = fn
+	userChangeListenerMu.Unlock()
+}
+
+// notifyUserChange 通知用戶異動
+func notifyUserChange(event UserChangeEvent) {
+	userChangeListenerMu.RLock()
+	fn := userChangeListener
+	userChangeListenerMu.RUnlock()
+	if fn != nil {
+		fn(event)
+	}
+}
+
+// WatchUserChanges 以 LISTEN 接收 users 觸發程序送出的通知，把任何程序（包括查詢主控台與其他工具）的用戶異動
+// 送給 SetUserChangeListener 設定的接收者，直到 ctx 結束。監聽連線斷線期間的異動不會補送
+func WatchUserChanges(ctx context.Context) {
+	if !appConfig().ChangeFeed {
+		return
+	}
+	ticker := time.NewTicker(changeFeedCheckInterval)
+	defer ticker.Stop()
+
+	var (
+		d        *Database
+		listener *pq.Listener
+	)
+	defer func() {
+		if listener != nil {
+			listener.Close()
+		}
+	}()
+	for {
+		if current := currentDatabase(); current != nil && current != d {
+			if listener != nil {
+				listener.Close()
+			}
+			d, listener = current, newUserChangeListener(current)
+		}
+		var notifications <-chan *pq.Notification
+		if listener != nil {
+			notifications = listener.Notify
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if listener != nil {
+				// 沒有通知時以 ping 確認連線仍在，斷線時由 pq.Listener 重新連線
+				_ = listener.Ping()
+			}
+		case n := <-notifications:
+			if n == nil {
+				continue // 重新連線後送出的 nil
+			}
+			event, err := decodeUserChange(n.Extra)
+			if err != nil {
+				logFor("changes").Warn("Failed to decode user change notification", "error", err)
+				continue
+			}
+			notifyUserChange(event)
+		}
+	}
+}
+
+// newUserChangeListener 建立監聽 userChangeChannel 的連線；連線失敗時由 pq.Listener 在背景重試
+func newUserChangeListener(d *Database) *pq.Listener {
+	log := logFor("changes")
+	listener := pq.NewListener(d.connString(), reconnectBaseDelay, appConfig().ReconnectMaxDelay,
+		func(event pq.ListenerEventType, err error) {
+			switch event {
+			case pq.ListenerEventConnected:
+				log.Info("Watching user changes", "source", "LISTEN "+userChangeChannel)
+			case pq.ListenerEventDisconnected:
+				log.Warn("User change listener disconnected, changes are not delivered until it reconnects", "error", err)
+			case pq.ListenerEventReconnected:
+				log.Info("User change listener reconnected")
+			}
+		})
+	go func() {
+		// Listen 等到連線建立才回傳；監聽器先被關閉時回傳錯誤
+		if err := listener.Listen(userChangeChannel); err != nil {
+			log.Debug("Stopped listening for user changes", "error", err)
+		}
+	}()
+	return listener
+}
+
+// decodeUserChange 解析 notify_user_change 送出的 {"type": ..., "user": {...}}
+func decodeUserChange(payload string) (UserChangeEvent, error) {
+	var event UserChangeEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		return event, err
+	}
+	if id, ok := event.User["id"].(float64); ok {
+		event.ID = int64(id)
+	}
+	return event, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// captureConnectionStates 記錄送給前端的連線狀態，測試結束時移除
+func captureConnectionStates(t *testing.T) func() []ConnectionState {
+	t.Helper()
+	var mu sync.Mutex
+	var states []ConnectionState
+	SetConnectionListener(func(state ConnectionState) {
+		mu.Lock()
+		states = append(states, state)
+		mu.Unlock()
+	})
+	t.Cleanup(func() { SetConnectionListener(nil) })
+	return func() []ConnectionState {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]ConnectionState(nil), states...)
+	}
+}
+
+// unreachableProfile 指向沒有服務的本機連接埠，連線會立即被拒絕
+func unreachableProfile(name string) ConnectionProfile {
+	return ConnectionProfile{Name: name, Host: "127.0.0.1", Port: "1", User: "test", DBName: "test", SSLMode: "disable"}
+}
+
+func TestOpenDBBacksOffWhileDisconnected(t *testing.T) {
+	loadTestConfig(t)
+	states := captureConnectionStates(t)
+	d := newDatabase(unreachableProfile("down"))
+
+	if _, err := d.OpenDB(); err == nil || errors.Is(err, ErrUnavailable) {
+		t.Fatalf("first OpenDB: err = %v, want the dial error", err)
+	}
+	state := d.ConnectionState()
+	if state.Status != ConnectionDisconnected || state.Failures != 1 || state.RetryAt == nil {
+		t.Fatalf("state after a failed dial = %+v", state)
+	}
+
+	// 等待時間內不再嘗試連線，直接回傳 ErrUnavailable
+	if _, err := d.OpenDB(); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("OpenDB during backoff: err = %v, want ErrUnavailable", err)
+	}
+	if got := d.ConnectionState().Failures; got != 1 {
+		t.Fatalf("failures = %d after a gated call, want 1", got)
+	}
+
+	// Reconnect 忽略等待時間；再次失敗時等待時間加倍
+	before := time.Now()
+	state = d.Reconnect()
+	if state.Failures != 2 || state.RetryAt.Before(before.Add(2*time.Second)) || state.RetryAt.After(time.Now().Add(2*time.Second)) {
+		t.Fatalf("state after the second failure = %+v, want a 2s backoff", state)
+	}
+
+	// 連線恢復後狀態回到 connected，失敗次數歸零，不再擋下呼叫
+	d.conn.record(nil)
+	if state = d.ConnectionState(); state.Status != ConnectionConnected || state.Failures != 0 || state.RetryAt != nil {
+		t.Fatalf("state after recovery = %+v", state)
+	}
+	if err := d.conn.gate(); err != nil {
+		t.Fatalf("gate after recovery: %v", err)
+	}
+
+	var statuses []string
+	for _, s := range states() {
+		statuses = append(statuses, s.Status)
+	}
+	if want := []string{ConnectionDisconnected, ConnectionDisconnected, ConnectionConnected}; !slices.Equal(statuses, want) {
+		t.Fatalf("notified statuses = %v, want %v", statuses, want)
+	}
+}
+
+func TestFailedSwitchKeepsCurrentConnection(t *testing.T) {
+	loadTestConfig(t)
+	current := newDatabase(unreachableProfile("current"))
+	current.conn.record(nil)
+	states := captureConnectionStates(t)
+	dbInstanceMu.Lock()
+	previous := dbInstance
+	dbInstance = current
+	dbInstanceMu.Unlock()
+	t.Cleanup(func() {
+		dbInstanceMu.Lock()
+		dbInstance = previous
+		dbInstanceMu.Unlock()
+	})
+
+	// 切換期間進行中的呼叫一律拿到目前的連線
+	stop := make(chan struct{})
+	var wrong sync.Once
+	var got *Database
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if d := GetDBInstance(); d != current {
+					wrong.Do(func() { got = d })
+					return
+				}
+			}
+		}()
+	}
+
+	_, err := SwitchConnection(unreachableProfile("other"))
+	close(stop)
+	wg.Wait()
+	if err == nil || !strings.Contains(err.Error(), `profile "other"`) {
+		t.Fatalf("SwitchConnection to an unreachable server: err = %v", err)
+	}
+	if got != nil {
+		t.Fatalf("a call during the switch got %p, want the current database %p", got, current)
+	}
+	if GetDBInstance() != current {
+		t.Fatal("failed switch replaced the current database")
+	}
+
+	// 候選連線的失敗不通知前端；目前的連線仍會通知
+	current.conn.record(errors.New("connection reset"))
+	notified := states()
+	if len(notified) != 1 || notified[0].Profile != "current" || notified[0].Status != ConnectionDisconnected {
+		t.Fatalf("notified states = %+v, want only the current profile going down", notified)
+	}
+}
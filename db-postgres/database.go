@@ -1,132 +1,310 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"embed"
 	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strconv"
-	"sync"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
-	_ "github.com/lib/pq"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/lib/pq"
 )
 
-var SQL_MIGRATION_PATH string
+// embeddedMigrations 編譯時嵌入的遷移檔案，打包後的執行檔不需要依賴工作目錄
+//
+//go:embed _assets/db/migration/*.sql
+var embeddedMigrations embed.FS
+
+// embeddedMigrationDir 嵌入檔案中遷移檔案所在的目錄
+const embeddedMigrationDir = "_assets/db/migration"
 
 // Database 結構體封裝所有資料庫操作
 type Database struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	DBName   string
-	SSLMode  string
+	Host           string
+	Port           string
+	User           string
+	Password       string
+	DBName         string
+	SSLMode        string
+	TLS            TLSOptions
+	SoftDelete     bool         // 為 true 時 DeleteUser 只標記 deleted_at
+	AutoMigrate    bool         // 為 false 時啟動不自動執行遷移，改由 migrate 子命令或綁定方法管理
+	QueryWriteMode bool         // 為 true 時查詢主控台允許寫入敘述
+	actor          string       // 寫入稽核紀錄的操作者
+	searchPath     string       // 非空時連線改用此 schema（CheckSchema 的暫存 schema）
+	conn           *connTracker // 連線狀態與重新連線的等待時間
 }
 
-// 使用 sync.Once 來確保 Singleton 實例只被創建一次
-var once sync.Once
-var dbInstance *Database
-
-// GetDBInstance 獲取 Singleton 實例
-func GetDBInstance() *Database {
-	once.Do(func() {
-		// 讀取環境變數並記錄
-		host := getEnv("DB_HOST", "localhost")
-		port := getEnv("DB_PORT", "5432")
-		user := getEnv("DB_USER", "postgres")
-		password := getEnv("DB_PASSWORD", "")
-		dbName := getEnv("DB_NAME", "postgres")
-		sslMode := getEnv("DB_SSLMODE", "disable")
-		
-		// 記錄讀取到的配置（密碼只顯示長度）
-		passwordMask := "***"
-		if password != "" {
-			passwordMask = fmt.Sprintf("*** (%d chars)", len(password))
-		}
-		WriteAppLog(fmt.Sprintf("Database config - Host: %s, Port: %s, User: %s, Password: %s, DB: %s, SSL: %s", 
-			host, port, user, passwordMask, dbName, sslMode), true)
-		
-		dbInstance = &Database{
-			Host:     host,
-			Port:     port,
-			User:     user,
-			Password: password,
-			DBName:   dbName,
-			SSLMode:  sslMode,
-		}
-		dbInstance.Initialize()
-	})
-	return dbInstance
+// ConnectionProfile 連線設定，可儲存於 DB_PROFILES_FILE 並在執行期間切換
+type ConnectionProfile struct {
+	Name     string     `json:"name"`
+	Host     string     `json:"host"`
+	Port     string     `json:"port"`
+	User     string     `json:"user"`
+	Password string     `json:"password,omitempty"`
+	DBName   string     `json:"dbName"`
+	SSLMode  string     `json:"sslMode"`
+	TLS      TLSOptions `json:"tls"`
+}
+
+// envConnectionProfile 依設定建立預設的連線設定
+func envConnectionProfile() ConnectionProfile {
+	cfg := appConfig()
+	return ConnectionProfile{
+		Name:     defaultProfileName,
+		Host:     cfg.DBHost,
+		Port:     strconv.Itoa(cfg.DBPort),
+		User:     cfg.DBUser,
+		Password: cfg.DBPassword,
+		DBName:   cfg.DBName,
+		SSLMode:  cfg.SSLMode,
+		TLS:      envTLSOptions(),
+	}
+}
+
+// withDefaultsFrom 以儲存的設定補上留空的欄位
+func (p ConnectionProfile) withDefaultsFrom(saved ConnectionProfile) ConnectionProfile {
+	if p.Host == "" {
+		p.Host = saved.Host
+	}
+	if p.Port == "" {
+		p.Port = saved.Port
+	}
+	if p.User == "" {
+		p.User = saved.User
+	}
+	if p.DBName == "" {
+		p.DBName = saved.DBName
+	}
+	if p.SSLMode == "" {
+		p.SSLMode = saved.SSLMode
+	}
+	if p.TLS == (TLSOptions{}) {
+		p.TLS = saved.TLS
+	}
+	return p.withSecretsFrom(saved)
+}
+
+// withSecretsFrom 密碼留空時沿用儲存的密碼，前端編輯設定時不需要重新輸入
+func (p ConnectionProfile) withSecretsFrom(saved ConnectionProfile) ConnectionProfile {
+	if p.Password == "" || p.Password == maskedSecret {
+		p.Password = saved.Password
+	}
+	return p
 }
 
-// getEnv 獲取環境變數，如果不存在則返回預設值
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// masked 回傳隱藏密碼的副本，供前端顯示；secret:// 參照不是密碼本身，照常顯示
+func (p ConnectionProfile) masked() ConnectionProfile {
+	if p.Password != "" && !isSecretRef(p.Password) {
+		p.Password = maskedSecret
 	}
-	return defaultValue
+	return p
 }
 
+// validate 檢查連線必要的欄位
+func (p ConnectionProfile) validate() error {
+	verr := &ValidationError{}
+	if p.Host == "" {
+		verr.Add("host", "is required")
+	}
+	if p.Port == "" {
+		verr.Add("port", "is required")
+	}
+	if p.DBName == "" {
+		verr.Add("dbName", "is required")
+	}
+	validateTLS(p.SSLMode, p.TLS, verr)
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// newDatabaseFromEnv 依設定建立 Database，不連線也不執行遷移
+func newDatabaseFromEnv() *Database {
+	profile := envConnectionProfile()
+
+	// 記錄讀取到的配置（密碼一律以固定的遮罩顯示，不透露長度）
+	logFor("database").Info("Database config", "host", profile.Host, "port", profile.Port, "user", profile.User,
+		"password", "***", "database", profile.DBName, "sslmode", profile.SSLMode)
+
+	return newDatabase(profile)
+}
+
+// newDatabase 以連線設定建立 Database，其餘設定讀取 appConfig
+func newDatabase(profile ConnectionProfile) *Database {
+	registerSecret(profile.Password)
+	cfg := appConfig()
+	sslMode := profile.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	return &Database{
+		Host:           profile.Host,
+		Port:           profile.Port,
+		User:           profile.User,
+		Password:       profile.Password,
+		DBName:         profile.DBName,
+		SSLMode:        sslMode,
+		TLS:            profile.TLS,
+		SoftDelete:     cfg.SoftDelete,
+		AutoMigrate:    cfg.AutoMigrate,
+		QueryWriteMode: cfg.QueryWriteMode,
+		actor:          resolveActor(),
+		conn:           newConnTracker(profile.Name),
+	}
+}
+
+// Profile 回傳目前的連線設定
+func (d *Database) Profile() ConnectionProfile {
+	return ConnectionProfile{
+		Name:     d.conn.snapshot().Profile,
+		Host:     d.Host,
+		Port:     d.Port,
+		User:     d.User,
+		Password: d.Password,
+		DBName:   d.DBName,
+		SSLMode:  d.SSLMode,
+		TLS:      d.TLS,
+	}
+}
 
 // Initialize 初始化資料庫
 func (d *Database) Initialize() {
-	SQL_MIGRATION_PATH = "_assets/db/migration"
+	if !d.AutoMigrate {
+		logFor("migration").Info("Automatic migration disabled (DB_AUTO_MIGRATE=false)")
+		// 仍先連線一次，讓前端取得連線狀態
+		if db, err := d.OpenDB(); err == nil {
+			db.Close()
+		}
+		return
+	}
 
 	if err := d.runMigrations(); err != nil {
-		WriteAppLog(fmt.Sprintf("Failed to run migrations: %v", err), true)
+		logFor("migration").Error("Failed to run migrations", "error", err)
+		d.initializeFailed()
+	}
+}
+
+// connString 以 net/url 建立連線 URL，使用者名稱與密碼會被正確跳脫；lib/pq 與 golang-migrate 共用同一個 URL
+func (d *Database) connString() string {
+	query := url.Values{}
+	query.Set("sslmode", d.SSLMode)
+	if d.TLS.CAFile != "" {
+		query.Set("sslrootcert", d.TLS.CAFile)
+	}
+	if d.TLS.CertFile != "" {
+		query.Set("sslcert", d.TLS.CertFile)
+		query.Set("sslkey", d.TLS.KeyFile)
+	}
+	if d.searchPath != "" {
+		query.Set("search_path", d.searchPath)
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(d.User, d.Password),
+		Host:     net.JoinHostPort(d.Host, d.Port),
+		Path:     "/" + d.DBName,
+		RawQuery: query.Encode(),
 	}
+	return u.String()
 }
 
-// OpenDB 開啟資料庫連接
-func (d *Database) OpenDB() (*sql.DB, error) {
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		d.Host, d.Port, d.User, d.Password, d.DBName, d.SSLMode)
-	fmt.Println(dsn)
-	db, err := sql.Open("postgres", dsn)
+// dial 開啟資料庫連接並確認可以連線
+func (d *Database) dial(ctx context.Context) (*sql.DB, error) {
+	db, err := openInstrumented(&pq.Driver{}, d.connString())
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
-	
+
 	// 測試連接
-	if err := db.Ping(); err != nil {
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
-	
+
 	return db, nil
 }
 
 // region <-- Migration 相關函式-->
+// migrationFS 回傳遷移檔案來源與說明：設定 DB_MIGRATION_DIR 時使用外部目錄（緊急修補用），否則使用嵌入的檔案
+func migrationFS() (fs.FS, string, error) {
+	if dir := appConfig().MigrationDir; dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to open migration dir %s: %w", dir, err)
+		}
+		if !info.IsDir() {
+			return nil, "", fmt.Errorf("migration dir %s is not a directory", dir)
+		}
+		return os.DirFS(dir), dir, nil
+	}
+
+	sub, err := fs.Sub(embeddedMigrations, embeddedMigrationDir)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open embedded migrations: %w", err)
+	}
+	return sub, "embedded", nil
+}
+
+// openMigrationSource 以 iofs 開啟遷移檔案來源，呼叫端負責 Close
+func openMigrationSource() (source.Driver, error) {
+	fsys, _, err := migrationFS()
+	if err != nil {
+		return nil, err
+	}
+	src, err := iofs.New(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open migration source: %w", err)
+	}
+	return src, nil
+}
+
+// newMigrate 建立 golang-migrate 實例，呼叫端負責 Close
+func (d *Database) newMigrate() (*migrate.Migrate, error) {
+	src, err := openMigrationSource()
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", src, d.connString())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migrate instance: %w", err)
+	}
+	return m, nil
+}
+
 // 執行資料庫 migration
 func (d *Database) runMigrations() error {
-	WriteAppLog("Initializing database migration...", true)
-	WriteAppLog(fmt.Sprintf("DB Host: %s, Port: %s, DB: %s", d.Host, d.Port, d.DBName), true)
-	WriteAppLog("Migration Path: "+SQL_MIGRATION_PATH, true)
-
-	// Convert relative path to absolute path to avoid issues with migrate
-	absMigrationPath, err := filepath.Abs(SQL_MIGRATION_PATH)
+	logFor("migration").Info("Initializing database migration")
+	logFor("migration").Info("Migration target", "host", d.Host, "port", d.Port, "database", d.DBName)
+	_, migrationSource, err := migrationFS()
 	if err != nil {
-		return fmt.Errorf("failed to get absolute migration path: %w", err)
+		return err
 	}
-	
-	// Ensure path uses forward slashes for file:// URL on Windows
-	absMigrationPath = filepath.ToSlash(absMigrationPath)
+	logFor("migration").Info("Migration source", "source", migrationSource)
 
-	// 構建 PostgreSQL 連接字串
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		d.User, d.Password, d.Host, d.Port, d.DBName, d.SSLMode)
+	return d.withMigrationLock("startup migration", d.migrateToLatest)
+}
 
-	m, err := migrate.New(
-		"file://"+absMigrationPath,
-		dsn,
-	)
+// migrateToLatest 處理 dirty 狀態後套用所有待處理的遷移，呼叫端需持有遷移鎖；ctx 被取消時在目前的遷移完成後停止
+func (d *Database) migrateToLatest(ctx context.Context) error {
+	m, err := d.newMigrate()
 	if err != nil {
-		return fmt.Errorf("failed to create migrate instance: %w", err)
+		return err
 	}
 	defer m.Close()
+	defer stopOnLockLoss(ctx, m)()
 
 	// 檢查當前版本
 	version, dirty, err := m.Version()
@@ -135,33 +313,44 @@ func (d *Database) runMigrations() error {
 	}
 
 	if err == migrate.ErrNilVersion {
-		WriteAppLog("Database is empty, will run all migrations", true)
+		logFor("migration").Info("Database is empty, will run all migrations")
 	} else {
-		WriteAppLog(fmt.Sprintf("Current database version: %d, dirty: %t", version, dirty), true)
+		logFor("migration").Info("Current database version", "version", version, "dirty", dirty)
 
-		// 如果資料庫是 dirty 狀態，嘗試修復
+		// dirty 狀態預設不自動修復，只有明確設定 DB_DIRTY_STRATEGY 時才處理
 		if dirty {
-			WriteAppLog("Database is dirty, attempting to fix...", true)
-			if err := d.fixDirtyDatabase(m, version); err != nil {
-				return fmt.Errorf("failed to fix dirty database: %w", err)
+			if err := d.handleDirtyDatabase(ctx, version); err != nil {
+				return err
 			}
 		}
 	}
 
-	maxVer, err := maxMigrationVersion(SQL_MIGRATION_PATH)
+	fsys, _, err := migrationFS()
+	if err != nil {
+		return err
+	}
+	maxVer, err := maxMigrationVersion(fsys)
 	if err != nil {
 		return fmt.Errorf("failed to scan migration dir: %w", err)
 	}
-	WriteAppLog(fmt.Sprintf("Max migration file %d", maxVer), true)
+	logFor("migration").Info("Latest migration file", "version", maxVer)
 
 	if int(version) > maxVer {
 		// 預設不 downgrade
-		WriteAppLog(fmt.Sprintf("DB version %d > max migration file %d — migration files missing", version, maxVer), true)
+		logFor("migration").Warn("Database version is newer than the latest migration file, migration files missing",
+			"version", version, "latest", maxVer)
 	} else {
+		// 已有資料且有待套用的遷移時，依設定先備份
+		if version > 0 && int(version) < maxVer {
+			if err := d.backupBeforeMigration(version, maxVer); err != nil {
+				return err
+			}
+		}
+
 		// 檢查是否有可用的 migration
 		if err := m.Up(); err != nil {
 			if err == migrate.ErrNoChange {
-				WriteAppLog("Database is already up to date", true)
+				logFor("migration").Info("Database is already up to date")
 				return nil
 			}
 			return fmt.Errorf("failed to run migrations: %w", err)
@@ -174,13 +363,14 @@ func (d *Database) runMigrations() error {
 		return fmt.Errorf("failed to get new version: %w", err)
 	}
 
-	WriteAppLog(fmt.Sprintf("Database successfully migrated to version: %d, dirty: %t", newVersion, newDirty), true)
+	logFor("migration").Info("Database migrated", "version", newVersion, "dirty", newDirty)
 
 	return nil
 }
 
-func maxMigrationVersion(migPath string) (int, error) {
-	entries, err := os.ReadDir(migPath)
+// maxMigrationVersion 回傳遷移來源中最大的版本號，嵌入檔案與外部目錄皆適用
+func maxMigrationVersion(fsys fs.FS) (int, error) {
+	entries, err := fs.ReadDir(fsys, ".")
 	if err != nil {
 		return 0, err
 	}
@@ -205,44 +395,76 @@ func maxMigrationVersion(migPath string) (int, error) {
 	return max, nil
 }
 
-// 修復 dirty 狀態的資料庫
-func (d *Database) fixDirtyDatabase(m *migrate.Migrate, currentVersion uint) error {
-	// 方法1: 強制設定版本為當前版本（清除 dirty 標記）
-	if err := m.Force(int(currentVersion)); err != nil {
-		return fmt.Errorf("failed to force version %d: %w", currentVersion, err)
+// handleDirtyDatabase 依 DB_DIRTY_STRATEGY 處理 dirty 狀態；未設定時只回報檢查結果並拒絕繼續
+func (d *Database) handleDirtyDatabase(ctx context.Context, version uint) error {
+	strategy := appConfig().DirtyStrategy
+	if strategy == "" {
+		report, err := d.InspectDirtyMigration()
+		if err != nil {
+			return fmt.Errorf("database is dirty at version %d and could not be inspected: %w", version, err)
+		}
+		for _, stmt := range report.Statements {
+			check := stmt.Check
+			if check == "" {
+				check = firstLine(stmt.SQL)
+			}
+			logFor("migration").Info("Dirty migration statement", "state", stmt.State, "statement", stmt.Index, "check", check)
+		}
+		return fmt.Errorf("database is dirty at version %d: %s; refusing to auto-fix (suggested strategy: %s, run `migrate recover %s` or set DB_DIRTY_STRATEGY)",
+			version, report.Message, report.Suggested, report.Suggested)
 	}
 
-	WriteAppLog(fmt.Sprintf("Successfully forced database version to %d", currentVersion), true)
+	logFor("migration").Warn("Database is dirty, recovering", "version", version, "strategy", strategy)
+	if _, err := d.recoverDirtyMigration(ctx, strategy, false); err != nil {
+		return fmt.Errorf("failed to recover dirty database: %w", err)
+	}
 	return nil
 }
+
 // endregion
 
 // InsertUser 插入用戶資料
 func (d *Database) InsertUser(name, email string, age int) error {
-	db, err := d.OpenDB()
-	if err != nil {
-		return err
+	_, err := d.insertUser(withOperation(context.Background(), "InsertUser"), name, email, age)
+	return err
+}
+
+// InsertUserReturning 插入用戶資料並回傳新用戶（與插入在同一個交易中讀取）
+func (d *Database) InsertUserReturning(name, email string, age int) (map[string]interface{}, error) {
+	return d.insertUser(withOperation(context.Background(), "InsertUserReturning"), name, email, age)
+}
+
+// insertUser InsertUser 與 InsertUserReturning 共用的實作
+func (d *Database) insertUser(ctx context.Context, name, email string, age int) (map[string]interface{}, error) {
+	if err := validateUser(name, email, age); err != nil {
+		return nil, err
 	}
-	defer db.Close()
 
-	insertSQL := `INSERT INTO users (name, email, age) VALUES ($1, $2, $3)`
-	_, err = db.Exec(insertSQL, name, email, age)
+	var user map[string]interface{}
+	err := d.WithTx(ctx, func(tx Repo) error {
+		id, err := tx.InsertUser(name, email, age)
+		if err != nil {
+			return err
+		}
+		user, err = tx.GetUserByID(int(id))
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to insert user: %w", err)
+		return nil, err
 	}
-
-	return nil
+	return user, nil
 }
 
 // GetAllUsers 獲取所有用戶
 func (d *Database) GetAllUsers() ([]map[string]interface{}, error) {
+	ctx := withOperation(context.Background(), "GetAllUsers")
 	db, err := d.OpenDB()
 	if err != nil {
 		return nil, err
 	}
 	defer db.Close()
 
-	rows, err := db.Query("SELECT * FROM users ORDER BY created_at DESC")
+	rows, err := db.QueryContext(ctx, "SELECT * FROM users WHERE deleted_at IS NULL ORDER BY created_at DESC")
 	if err != nil {
 		return nil, fmt.Errorf("failed to query users: %w", err)
 	}
@@ -277,20 +499,21 @@ func (d *Database) GetAllUsers() ([]map[string]interface{}, error) {
 
 // GetUserByID 根據 ID 獲取用戶
 func (d *Database) GetUserByID(id int) (map[string]interface{}, error) {
+	ctx := withOperation(context.Background(), "GetUserByID")
 	db, err := d.OpenDB()
 	if err != nil {
 		return nil, err
 	}
 	defer db.Close()
 
-	rows, err := db.Query("SELECT * FROM users WHERE id = $1", id)
+	rows, err := db.QueryContext(ctx, "SELECT * FROM users WHERE id = $1 AND deleted_at IS NULL", id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query user: %w", err)
 	}
 	defer rows.Close()
 
 	if !rows.Next() {
-		return nil, fmt.Errorf("user not found")
+		return nil, ErrNotFound
 	}
 
 	columns, err := rows.Columns()
@@ -316,60 +539,53 @@ func (d *Database) GetUserByID(id int) (map[string]interface{}, error) {
 	return user, nil
 }
 
-// UpdateUser 更新用戶資料
-func (d *Database) UpdateUser(id int, name, email string, age int) error {
+// GetUserByEmail 以 email 讀取未刪除的用戶
+func (d *Database) GetUserByEmail(email string) (map[string]interface{}, error) {
+	ctx := withOperation(context.Background(), "GetUserByEmail")
 	db, err := d.OpenDB()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer db.Close()
 
-	updateSQL := `UPDATE users SET name = $1, email = $2, age = $3 WHERE id = $4`
-	result, err := db.Exec(updateSQL, name, email, age, id)
-	if err != nil {
-		return fmt.Errorf("failed to update user: %w", err)
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
-	}
+	return fetchUserRowByEmail(ctx, db, email)
+}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("user not found")
+// UpdateUser 以樂觀鎖更新用戶資料，expectedVersion 與資料庫不符時回傳 ErrConflict
+func (d *Database) UpdateUser(id int, name, email string, age int, expectedVersion int64) error {
+	if err := validateUser(name, email, age); err != nil {
+		return err
 	}
-
-	return nil
+	_, err := d.patchUser(withOperation(context.Background(), "UpdateUser"), id,
+		UserPatch{Name: &name, Email: &email, Age: &age, Version: expectedVersion})
+	return err
 }
 
-// DeleteUser 刪除用戶
+// DeleteUser 刪除用戶（軟刪除模式下只標記 deleted_at，可再還原）
 func (d *Database) DeleteUser(id int) error {
-	db, err := d.OpenDB()
-	if err != nil {
-		return err
-	}
-	defer db.Close()
+	return d.WithTx(withOperation(context.Background(), "DeleteUser"), func(tx Repo) error {
+		return tx.DeleteUser(id)
+	})
+}
 
-	deleteSQL := `DELETE FROM users WHERE id = $1`
-	result, err := db.Exec(deleteSQL, id)
-	if err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
-	}
+// SearchUsers 搜尋用戶（支援分頁）
+func (d *Database) SearchUsers(keyword string, page, pageSize int) ([]map[string]interface{}, int, error) {
+	return d.filterUsers(withOperation(context.Background(), "SearchUsers"), UserFilter{Keyword: keyword}, page, pageSize)
+}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
-	}
+// FilterUsers 依結構化條件查詢用戶（支援分頁）
+func (d *Database) FilterUsers(filter UserFilter, page, pageSize int) ([]map[string]interface{}, int, error) {
+	return d.filterUsers(withOperation(context.Background(), "FilterUsers"), filter, page, pageSize)
+}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("user not found")
+// filterUsers SearchUsers 與 FilterUsers 共用的實作
+func (d *Database) filterUsers(ctx context.Context, filter UserFilter, page, pageSize int) ([]map[string]interface{}, int, error) {
+	builder := &sqlFilterBuilder{}
+	whereSQL, err := builder.where(filter)
+	if err != nil {
+		return nil, 0, newValidationError("filter", err.Error())
 	}
 
-	return nil
-}
-
-// SearchUsers 搜尋用戶（支援分頁）
-func (d *Database) SearchUsers(keyword string, page, pageSize int) ([]map[string]interface{}, int, error) {
 	db, err := d.OpenDB()
 	if err != nil {
 		return nil, 0, err
@@ -378,17 +594,17 @@ func (d *Database) SearchUsers(keyword string, page, pageSize int) ([]map[string
 
 	// 計算總數
 	var count int
-	countSQL := `SELECT COUNT(*) FROM users WHERE name LIKE $1 OR email LIKE $2`
-	searchPattern := "%" + keyword + "%"
-	err = db.QueryRow(countSQL, searchPattern, searchPattern).Scan(&count)
+	countSQL := `SELECT COUNT(*) FROM users` + whereSQL
+	err = db.QueryRowContext(ctx, countSQL, builder.args...).Scan(&count)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to count users: %w", err)
 	}
 
 	// 查詢分頁資料
 	offset := (page - 1) * pageSize
-	querySQL := `SELECT * FROM users WHERE name LIKE $1 OR email LIKE $2 ORDER BY created_at DESC LIMIT $3 OFFSET $4`
-	rows, err := db.Query(querySQL, searchPattern, searchPattern, pageSize, offset)
+	querySQL := `SELECT * FROM users` + whereSQL +
+		` ORDER BY created_at DESC LIMIT ` + builder.bind(pageSize) + ` OFFSET ` + builder.bind(offset)
+	rows, err := db.QueryContext(ctx, querySQL, builder.args...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to query users: %w", err)
 	}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// 此檔集中 PostgreSQL 方言的差異，讓查詢組裝邏輯可在各 SQL 模組間共用
+
+// placeholder 回傳第 n 個（從 1 起算）綁定參數的佔位符
+func placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// likeOperator 回傳不分大小寫的模糊比對運算子
+func likeOperator() string {
+	return "ILIKE"
+}
+
+// castText 將欄位轉為文字，讓任意型別的欄位都能做模糊比對（ILIKE 只能用於文字）
+func castText(expr string) string {
+	return "CAST(" + expr + " AS TEXT)"
+}
+
+// SQL 文字的字串規則，供查詢主控台判斷敘述種類：sqlBackslashEscapes 表示字串中的反斜線為跳脫字元（E'...' 字串另外判斷），
+// sqlDollarQuotes 表示支援 $tag$...$tag$ 字串，sqlHashComments 表示 # 開頭為註解（MySQL 另有會被執行的 /*! */ 註解）
+const (
+	sqlBackslashEscapes = false
+	sqlDollarQuotes     = true
+	sqlHashComments     = false
+)
+
+// explainPrefix 查詢主控台取得執行計畫時加在敘述前的關鍵字
+const explainPrefix = "EXPLAIN "
+
+// guardReadOnly 唯讀交易已由 BEGIN READ ONLY 保證，不需額外處理
+func guardReadOnly(ctx context.Context, tx *sql.Tx) error {
+	return nil
+}
+
+// timeArg 將時間轉換為可直接與 created_at 比較的參數
+func timeArg(t time.Time) interface{} {
+	return t
+}
+
+// emailUniqueConstraints users.email 的唯一約束：遷移 2 起為只涵蓋未刪除用戶的 partial index，之前為建表時的 UNIQUE
+var emailUniqueConstraints = map[string]bool{
+	"idx_users_email_live": true,
+	"users_email_key":      true,
+}
+
+// translateDBError 將驅動程式錯誤碼轉換為領域錯誤；唯一約束依名稱區分，只有 email 的約束才是 ErrDuplicateEmail
+func translateDBError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+		if emailUniqueConstraints[pqErr.Constraint] {
+			return ErrDuplicateEmail
+		}
+		return &UniqueViolationError{Constraint: pqErr.Constraint}
+	}
+	return err
+}
+
+// isRetryableTxError 序列化失敗（40001）與死結（40P01）時整個交易重試即可成功
+func isRetryableTxError(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "40001" || pqErr.Code == "40P01")
+}
+
+// insertUserRow 插入一筆用戶並回傳自動產生的 id（lib/pq 不支援 LastInsertId，改用 RETURNING）
+func insertUserRow(ctx context.Context, q sqlExecutor, name, email string, age int) (int64, error) {
+	var id int64
+	err := q.QueryRowContext(ctx, `INSERT INTO users (name, email, age, updated_at) VALUES ($1, $2, $3, CURRENT_TIMESTAMP) RETURNING id`, name, email, age).Scan(&id)
+	return id, err
+}
+
+// schemaTableExists 檢查目前 schema 是否有指定的資料表
+func schemaTableExists(ctx context.Context, q sqlExecutor, table string) (bool, error) {
+	return schemaCount(ctx, q, `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1`, table)
+}
+
+// schemaColumnExists 檢查資料表是否有指定的欄位
+func schemaColumnExists(ctx context.Context, q sqlExecutor, table, column string) (bool, error) {
+	return schemaCount(ctx, q, `SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2`, table, column)
+}
+
+// schemaIndexExists 檢查是否有指定名稱的索引
+func schemaIndexExists(ctx context.Context, q sqlExecutor, index string) (bool, error) {
+	return schemaCount(ctx, q, `SELECT COUNT(*) FROM pg_indexes WHERE schemaname = current_schema() AND indexname = $1`, index)
+}
+
+// advisoryMigrationLock 以 pg_advisory_lock 實作的遷移鎖；鎖綁定在單一連線上，程式中斷時連線關閉即自動釋放
+type advisoryMigrationLock struct {
+	db   *sql.DB
+	conn *sql.Conn
+	key  int64
+	held bool
+}
+
+// newMigrationLock 建立以 session advisory lock 實作的遷移鎖（不需要租約，ttl 不使用）
+// key 與 golang-migrate 內部使用的 advisory lock 不同，兩者不會互相阻擋
+func (d *Database) newMigrationLock(ttl time.Duration) (migrationLock, error) {
+	db, err := d.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open lock connection: %w", err)
+	}
+
+	key := int64(crc32.ChecksumIEEE([]byte("migrations:" + d.DBName)))
+	return &advisoryMigrationLock{db: db, conn: conn, key: key}, nil
+}
+
+func (l *advisoryMigrationLock) tryAcquire(ctx context.Context) (bool, string, error) {
+	var got bool
+	if err := l.conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, l.key).Scan(&got); err != nil {
+		return false, "", err
+	}
+	if got {
+		l.held = true
+		return true, "", nil
+	}
+
+	var pid int64
+	err := l.conn.QueryRowContext(ctx, `SELECT pid FROM pg_locks
+		WHERE locktype = 'advisory' AND granted AND ((classid::bigint << 32) | objid::bigint) = $1 LIMIT 1`, l.key).Scan(&pid)
+	if err != nil {
+		return false, "another session", nil
+	}
+	return false, fmt.Sprintf("backend pid %d", pid), nil
+}
+
+// renew 確認持有鎖的連線仍然存在；session 層級的 advisory lock 在連線中斷時已被釋放
+func (l *advisoryMigrationLock) renew(ctx context.Context) error {
+	_, err := l.conn.ExecContext(ctx, `SELECT 1`)
+	return err
+}
+
+func (l *advisoryMigrationLock) release(ctx context.Context) error {
+	var err error
+	if l.held {
+		_, err = l.conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, l.key)
+		l.held = false
+	}
+	l.conn.Close()
+	l.db.Close()
+	return err
+}
+
+// quoteIdent 以雙引號引用識別字
+func quoteIdent(name string) string {
+	return pq.QuoteIdentifier(name)
+}
+
+// readSchema 讀取目前 schema（search_path 的第一個）的欄位與索引，型別使用 format_type 的完整寫法
+func readSchema(ctx context.Context, q sqlExecutor) (schemaSnapshot, error) {
+	snapshot := schemaSnapshot{}
+
+	rows, err := q.QueryContext(ctx, `SELECT c.relname, a.attname, format_type(a.atttypid, a.atttypmod), NOT a.attnotnull,
+			COALESCE(pg_get_expr(d.adbin, d.adrelid), '')
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE n.nspname = current_schema() AND c.relkind IN ('r', 'p') AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY c.relname, a.attnum`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		var col schemaColumn
+		if err := rows.Scan(&table, &col.Name, &col.Type, &col.Nullable, &col.Default); err != nil {
+			return nil, err
+		}
+		t := snapshot.table(table)
+		t.Columns = append(t.Columns, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	idxRows, err := q.QueryContext(ctx, `SELECT t.relname, i.relname, ix.indisunique, COALESCE(a.attname, '(expression)')
+		FROM pg_index ix
+		JOIN pg_class t ON t.oid = ix.indrelid
+		JOIN pg_class i ON i.oid = ix.indexrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		CROSS JOIN LATERAL unnest(ix.indkey::int2[]) WITH ORDINALITY AS k(attnum, ord)
+		LEFT JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE n.nspname = current_schema()
+		ORDER BY t.relname, i.relname, k.ord`)
+	if err != nil {
+		return nil, err
+	}
+	defer idxRows.Close()
+	for idxRows.Next() {
+		var table, index, column string
+		var unique bool
+		if err := idxRows.Scan(&table, &index, &unique, &column); err != nil {
+			return nil, err
+		}
+		snapshot.addIndexColumn(table, index, column, unique)
+	}
+	return snapshot, idxRows.Err()
+}
+
+// newScratchDatabase 在同一個資料庫中建立暫存 schema 並以 search_path 指向它（需要 CREATE 權限），
+// 遷移檔案不帶 schema 名稱，因此會建立在暫存 schema 中；回傳的 cleanup 會刪除它
+func (d *Database) newScratchDatabase(ctx context.Context) (*Database, string, func(), error) {
+	name := "schema_check_" + randomSuffix()
+
+	db, err := d.OpenDB()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if _, err := db.ExecContext(ctx, "CREATE SCHEMA "+quoteIdent(name)); err != nil {
+		db.Close()
+		return nil, "", nil, err
+	}
+
+	scratch := *d
+	scratch.conn = nil
+	scratch.searchPath = name
+	cleanup := func() {
+		if _, err := db.ExecContext(ctx, "DROP SCHEMA IF EXISTS "+quoteIdent(name)+" CASCADE"); err != nil {
+			logFor("schema").Warn("Failed to drop scratch schema", "schema", name, "error", err)
+		}
+		db.Close()
+	}
+	return &scratch, "schema " + name, cleanup, nil
+}
+
+// 備份格式：由程式產生的 SQL 邏輯備份，不依賴 pg_dump
+const (
+	backupFormat  = "postgres"
+	backupFileExt = ".sql"
+)
+
+// 還原在單一交易中執行，任何敘述失敗時整個回復（PostgreSQL 的 DDL 可在交易中執行）
+var (
+	restorePreamble  = []string{"BEGIN"}
+	restorePostamble = []string{"COMMIT"}
+)
+
+// backupName 預設備份檔名使用的資料庫名稱
+func (d *Database) backupName() string {
+	return d.DBName
+}
+
+func (d *Database) writeBackup(ctx context.Context, path string) (*BackupInfo, error) {
+	return d.writeLogicalBackup(ctx, path)
+}
+
+func (d *Database) restoreBackup(ctx context.Context, path string) (*BackupInfo, error) {
+	return d.restoreLogicalBackup(ctx, path)
+}
+
+// listTables 列出目前 schema 的資料表
+func listTables(ctx context.Context, q sqlExecutor) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `SELECT c.relname FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = current_schema() AND c.relkind = 'r'
+		ORDER BY c.relname`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+func dropTableSQL(table string) string {
+	return "DROP TABLE IF EXISTS " + quoteIdent(table) + " CASCADE"
+}
+
+// dumpTableSchema 由系統目錄組出資料表定義：SERIAL 使用的序列先建立，欄位、約束與索引分開，
+// 序列目前值在資料寫入後以 setval 設定
+func dumpTableSchema(ctx context.Context, q sqlExecutor, table string) (*tableDefinition, error) {
+	ident := quoteIdent(table)
+	def := &tableDefinition{}
+
+	seqRows, err := q.QueryContext(ctx, `SELECT s.relname, a.attname, ps.data_type::text, ps.start_value, ps.increment_by,
+			ps.min_value, ps.max_value, ps.cycle, ps.last_value
+		FROM pg_depend dep
+		JOIN pg_class s ON s.oid = dep.objid AND s.relkind = 'S'
+		JOIN pg_namespace n ON n.oid = s.relnamespace
+		JOIN pg_attribute a ON a.attrelid = dep.refobjid AND a.attnum = dep.refobjsubid
+		JOIN pg_sequences ps ON ps.schemaname = n.nspname AND ps.sequencename = s.relname
+		WHERE dep.refobjid = $1::regclass AND dep.deptype = 'a'
+		ORDER BY s.relname`, ident)
+	if err != nil {
+		return nil, err
+	}
+	var owned []string
+	for seqRows.Next() {
+		var name, column, dataType string
+		var start, increment, min, max int64
+		var cycle bool
+		var last sql.NullInt64
+		if err := seqRows.Scan(&name, &column, &dataType, &start, &increment, &min, &max, &cycle, &last); err != nil {
+			seqRows.Close()
+			return nil, err
+		}
+		cycleClause := "NO CYCLE"
+		if cycle {
+			cycleClause = "CYCLE"
+		}
+		seq := quoteIdent(name)
+		def.Create = append(def.Create,
+			"DROP SEQUENCE IF EXISTS "+seq+" CASCADE",
+			fmt.Sprintf("CREATE SEQUENCE %s AS %s START WITH %d INCREMENT BY %d MINVALUE %d MAXVALUE %d %s",
+				seq, dataType, start, increment, min, max, cycleClause))
+		owned = append(owned, fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s.%s", seq, ident, quoteIdent(column)))
+		if last.Valid {
+			def.Indexes = append(def.Indexes, fmt.Sprintf("SELECT setval(%s, %d, true)", sqlLiteral(seq, ""), last.Int64))
+		}
+	}
+	seqRows.Close()
+	if err := seqRows.Err(); err != nil {
+		return nil, err
+	}
+
+	colRows, err := q.QueryContext(ctx, `SELECT a.attname, format_type(a.atttypid, a.atttypmod), a.attnotnull,
+			COALESCE(pg_get_expr(d.adbin, d.adrelid), ''), a.attidentity::text
+		FROM pg_attribute a
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum`, ident)
+	if err != nil {
+		return nil, err
+	}
+	var columns []string
+	for colRows.Next() {
+		var name, dataType, defaultExpr, identity string
+		var notNull bool
+		if err := colRows.Scan(&name, &dataType, &notNull, &defaultExpr, &identity); err != nil {
+			colRows.Close()
+			return nil, err
+		}
+		column := quoteIdent(name) + " " + dataType
+		switch identity {
+		case "a":
+			column += " GENERATED ALWAYS AS IDENTITY"
+		case "d":
+			column += " GENERATED BY DEFAULT AS IDENTITY"
+		}
+		if identity != "" {
+			// IDENTITY 的序列隨資料表建立，資料寫入後依最大值調整
+			def.Indexes = append(def.Indexes, fmt.Sprintf("SELECT setval(pg_get_serial_sequence(%s, %s), COALESCE((SELECT MAX(%s) FROM %s), 0) + 1, false)",
+				sqlLiteral(ident, ""), sqlLiteral(name, ""), quoteIdent(name), ident))
+		} else if defaultExpr != "" {
+			column += " DEFAULT " + defaultExpr
+		}
+		if notNull {
+			column += " NOT NULL"
+		}
+		columns = append(columns, column)
+	}
+	colRows.Close()
+	if err := colRows.Err(); err != nil {
+		return nil, err
+	}
+	def.Create = append(def.Create, fmt.Sprintf("CREATE TABLE %s (%s)", ident, strings.Join(columns, ", ")))
+	def.Create = append(def.Create, owned...)
+
+	// 約束（NOT NULL 已寫在欄位上）：主鍵、唯一、檢查約束與索引一起建立，外鍵最後才加
+	conRows, err := q.QueryContext(ctx, `SELECT conname, contype::text, pg_get_constraintdef(oid)
+		FROM pg_constraint
+		WHERE conrelid = $1::regclass AND contype <> 'n'
+		ORDER BY CASE contype WHEN 'p' THEN 0 WHEN 'u' THEN 1 ELSE 2 END, conname`, ident)
+	if err != nil {
+		return nil, err
+	}
+	for conRows.Next() {
+		var name, kind, definition string
+		if err := conRows.Scan(&name, &kind, &definition); err != nil {
+			conRows.Close()
+			return nil, err
+		}
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s", ident, quoteIdent(name), definition)
+		if kind == "f" {
+			def.ForeignKeys = append(def.ForeignKeys, stmt)
+		} else {
+			def.Indexes = append(def.Indexes, stmt)
+		}
+	}
+	conRows.Close()
+	if err := conRows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 不屬於約束的索引；pg_get_indexdef 會加上 schema 名稱，去掉後才能還原到其他 schema
+	idxRows, err := q.QueryContext(ctx, `SELECT replace(pg_get_indexdef(i.indexrelid), ' ON ' || quote_ident(current_schema()) || '.', ' ON ')
+		FROM pg_index i
+		WHERE i.indrelid = $1::regclass AND NOT EXISTS (
+			SELECT 1 FROM pg_constraint c
+			WHERE c.conindid = i.indexrelid AND c.conrelid = i.indrelid AND c.contype IN ('p', 'u', 'x'))
+		ORDER BY i.indexrelid`, ident)
+	if err != nil {
+		return nil, err
+	}
+	for idxRows.Next() {
+		var stmt string
+		if err := idxRows.Scan(&stmt); err != nil {
+			idxRows.Close()
+			return nil, err
+		}
+		def.Indexes = append(def.Indexes, stmt)
+	}
+	idxRows.Close()
+	if err := idxRows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 觸發器（例如遷移 4 的 users_notify_change）隨 DROP TABLE 一起刪除，資料寫入後才重建，還原時不會觸發；
+	// 觸發器呼叫的函式不屬於資料表，還原後仍在，因此只匯出觸發器本身
+	trgRows, err := q.QueryContext(ctx, `SELECT replace(pg_get_triggerdef(t.oid), ' ON ' || quote_ident(current_schema()) || '.', ' ON ')
+		FROM pg_trigger t
+		WHERE t.tgrelid = $1::regclass AND NOT t.tgisinternal
+		ORDER BY t.tgname`, ident)
+	if err != nil {
+		return nil, err
+	}
+	defer trgRows.Close()
+	for trgRows.Next() {
+		var stmt string
+		if err := trgRows.Scan(&stmt); err != nil {
+			return nil, err
+		}
+		def.Indexes = append(def.Indexes, stmt)
+	}
+	return def, trgRows.Err()
+}
+
+// sqlLiteral 將查詢取得的值轉為 PostgreSQL 字面值；含反斜線或換行的字串改用 E'...' 跳脫，bytea 以十六進位解碼
+func sqlLiteral(v interface{}, dbType string) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		switch {
+		case math.IsNaN(val):
+			return "'NaN'"
+		case math.IsInf(val, 1):
+			return "'Infinity'"
+		case math.IsInf(val, -1):
+			return "'-Infinity'"
+		}
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case bool:
+		if val {
+			return "TRUE"
+		}
+		return "FALSE"
+	case time.Time:
+		layout := "2006-01-02 15:04:05.999999"
+		switch dbType {
+		case "DATE":
+			layout = "2006-01-02"
+		case "TIME":
+			layout = "15:04:05.999999"
+		case "TIMETZ":
+			layout = "15:04:05.999999-07:00"
+		case "TIMESTAMPTZ":
+			layout = "2006-01-02 15:04:05.999999-07:00"
+		}
+		return "'" + val.Format(layout) + "'"
+	case []byte:
+		if dbType == "BYTEA" {
+			return "decode('" + hex.EncodeToString(val) + "', 'hex')"
+		}
+		return quoteStringLiteral(string(val))
+	case string:
+		return quoteStringLiteral(val)
+	default:
+		return quoteStringLiteral(fmt.Sprint(val))
+	}
+}
+
+// quoteStringLiteral 引用字串，需要跳脫時改用 E'...' 語法，讓每筆 INSERT 保持在同一行
+func quoteStringLiteral(s string) string {
+	if !strings.ContainsAny(s, "\\\n\r") {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	return "E'" + postgresStringEscaper.Replace(s) + "'"
+}
+
+// postgresStringEscaper E'...' 字串中需要跳脫的字元
+var postgresStringEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`)
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestTranslateDBError(t *testing.T) {
+	plain := errors.New("connection reset")
+	tests := []struct {
+		name       string
+		err        error
+		want       error
+		constraint string
+	}{
+		{"email partial index", &pq.Error{Code: "23505", Constraint: "idx_users_email_live"}, ErrDuplicateEmail, ""},
+		{"legacy email unique", &pq.Error{Code: "23505", Constraint: "users_email_key"}, ErrDuplicateEmail, ""},
+		{"wrapped", fmt.Errorf("insert: %w", &pq.Error{Code: "23505", Constraint: "users_email_key"}), ErrDuplicateEmail, ""},
+		{"other unique constraint", &pq.Error{Code: "23505", Constraint: "user_outbox_event_id_key"}, ErrDuplicateValue, "user_outbox_event_id_key"},
+		{"other error code", &pq.Error{Code: "40001"}, nil, ""},
+		{"not a driver error", plain, plain, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := translateDBError(tt.err)
+			want := tt.want
+			if want == nil {
+				want = tt.err
+			}
+			if !errors.Is(got, want) {
+				t.Fatalf("translateDBError() = %v, want %v", got, want)
+			}
+			var uniqueErr *UniqueViolationError
+			if errors.As(got, &uniqueErr) && uniqueErr.Constraint != tt.constraint {
+				t.Fatalf("constraint = %q, want %q", uniqueErr.Constraint, tt.constraint)
+			}
+		})
+	}
+}
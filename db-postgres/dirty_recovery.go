@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// dirty 狀態的修復策略
+const (
+	RecoverRollForward = "roll-forward" // 重新執行 up 檔案中尚未生效的語句
+	RecoverRollBack    = "roll-back"    // 執行 down 檔案，回到上一個版本
+	RecoverForce       = "force"        // 不修改 schema，只清除 dirty 標記
+)
+
+// 語句對 schema 的預期結果是否已生效
+const (
+	StatementApplied = "applied"
+	StatementMissing = "missing"
+	StatementUnknown = "unknown" // 無法從 schema 判斷（例如 UPDATE / INSERT）
+)
+
+// 修復時每個語句的處理結果
+const (
+	StatementSkipped  = "skipped"
+	StatementPending  = "pending" // dry run 時將會執行
+	StatementExecuted = "executed"
+	StatementFailed   = "failed"
+	StatementNotRun   = "not_run"
+)
+
+// DirtyStatement 遷移檔案中的單一語句與其檢查 / 執行結果
+type DirtyStatement struct {
+	Index  int    `json:"index"`
+	SQL    string `json:"sql"`
+	Check  string `json:"check,omitempty"`
+	State  string `json:"state"`
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// DirtyReport 比對 dirty 版本的 up 檔案與目前 schema 的結果
+type DirtyReport struct {
+	Dirty      bool             `json:"dirty"`
+	Version    uint             `json:"version"`
+	Name       string           `json:"name"`
+	Statements []DirtyStatement `json:"statements"`
+	Suggested  string           `json:"suggested"`
+	Message    string           `json:"message"`
+}
+
+// RecoveryResult 執行修復策略的結果；失敗時 Statements 會標出失敗的語句與錯誤
+type RecoveryResult struct {
+	Strategy   string           `json:"strategy"`
+	DryRun     bool             `json:"dryRun"`
+	Version    uint             `json:"version"`
+	NewVersion uint             `json:"newVersion"`
+	Dirty      bool             `json:"dirty"`
+	Statements []DirtyStatement `json:"statements"`
+}
+
+// schemaCount 執行 COUNT 查詢並回傳是否大於 0
+func schemaCount(ctx context.Context, q sqlExecutor, query string, args ...interface{}) (bool, error) {
+	var count int
+	if err := q.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	return count > 0, nil
+}
+
+// dollarQuoteRe PostgreSQL 的 $$ / $tag$ 字串開頭
+var dollarQuoteRe = regexp.MustCompile(`^\$\w*\$`)
+
+// splitSQLStatements 將遷移檔案切分為單一語句，會略過註解並保留引號與 $$ 區塊內的分號
+func splitSQLStatements(script string) []string {
+	var (
+		statements []string
+		current    strings.Builder
+		quote      byte
+		dollarTag  string
+	)
+	flush := func() {
+		if stmt := strings.TrimSpace(current.String()); stmt != "" {
+			statements = append(statements, stmt)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case dollarTag != "":
+			if strings.HasPrefix(script[i:], dollarTag) {
+				current.WriteString(dollarTag)
+				i += len(dollarTag) - 1
+				dollarTag = ""
+				continue
+			}
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '$':
+			if tag := dollarQuoteRe.FindString(script[i:]); tag != "" {
+				dollarTag = tag
+				current.WriteString(tag)
+				i += len(tag) - 1
+				continue
+			}
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			current.WriteByte('\n')
+			continue
+		case c == ';':
+			flush()
+			continue
+		}
+		current.WriteByte(c)
+	}
+	flush()
+	return statements
+}
+
+const sqlIdent = "[`\"]?(\\w+)[`\"]?"
+
+// statementChecks 可從 schema 判斷是否生效的語句形式；present 表示生效後物件應存在
+var statementChecks = []struct {
+	re      *regexp.Regexp
+	kind    string
+	present bool
+}{
+	{regexp.MustCompile(`(?is)^CREATE\s+TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?` + sqlIdent), "table", true},
+	{regexp.MustCompile(`(?is)^DROP\s+TABLE\s+(?:IF\s+EXISTS\s+)?` + sqlIdent), "table", false},
+	{regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+` + sqlIdent + `\s+ADD\s+(?:COLUMN\s+)?(?:IF\s+NOT\s+EXISTS\s+)?` + sqlIdent), "column", true},
+	{regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+` + sqlIdent + `\s+DROP\s+(?:COLUMN\s+)?(?:IF\s+EXISTS\s+)?` + sqlIdent), "column", false},
+	{regexp.MustCompile(`(?is)^CREATE\s+(?:UNIQUE\s+)?INDEX\s+(?:IF\s+NOT\s+EXISTS\s+)?` + sqlIdent), "index", true},
+	{regexp.MustCompile(`(?is)^DROP\s+INDEX\s+(?:IF\s+EXISTS\s+)?` + sqlIdent), "index", false},
+}
+
+// inspectStatement 依語句形式檢查 schema，判斷該語句的效果是否已存在
+func inspectStatement(ctx context.Context, q sqlExecutor, index int, stmt string) (DirtyStatement, error) {
+	result := DirtyStatement{Index: index, SQL: stmt, State: StatementUnknown}
+	for _, check := range statementChecks {
+		m := check.re.FindStringSubmatch(stmt)
+		if m == nil {
+			continue
+		}
+
+		var (
+			exists bool
+			err    error
+		)
+		switch check.kind {
+		case "table":
+			exists, err = schemaTableExists(ctx, q, m[1])
+			result.Check = fmt.Sprintf("table %s", m[1])
+		case "column":
+			exists, err = schemaColumnExists(ctx, q, m[1], m[2])
+			result.Check = fmt.Sprintf("column %s.%s", m[1], m[2])
+		case "index":
+			exists, err = schemaIndexExists(ctx, q, m[1])
+			result.Check = fmt.Sprintf("index %s", m[1])
+		}
+		if err != nil {
+			return result, err
+		}
+
+		if check.present {
+			result.Check += " exists"
+		} else {
+			result.Check += " is absent"
+		}
+		if exists == check.present {
+			result.State = StatementApplied
+		} else {
+			result.State = StatementMissing
+		}
+		return result, nil
+	}
+	return result, nil
+}
+
+// inspectScript 逐一檢查遷移檔案中的語句
+func inspectScript(ctx context.Context, q sqlExecutor, script string) ([]DirtyStatement, error) {
+	statements := []DirtyStatement{}
+	for i, stmt := range splitSQLStatements(script) {
+		checked, err := inspectStatement(ctx, q, i+1, stmt)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, checked)
+	}
+	return statements, nil
+}
+
+// InspectDirtyMigration 比對 dirty 版本的 up 檔案與目前 schema，回報哪些語句已生效、哪些缺少
+func (d *Database) InspectDirtyMigration() (*DirtyReport, error) {
+	ctx := withOperation(context.Background(), "InspectDirtyMigration")
+	set, err := openMigrationSet()
+	if err != nil {
+		return nil, err
+	}
+	defer set.close()
+
+	m, err := d.newMigrate()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+
+	version, dirty, err := currentMigrationVersion(m)
+	if err != nil {
+		return nil, err
+	}
+	report := &DirtyReport{Dirty: dirty, Version: version, Statements: []DirtyStatement{}}
+	if !dirty {
+		report.Message = fmt.Sprintf("database is clean at version %d", version)
+		return report, nil
+	}
+
+	idx := set.index(version)
+	if idx < 0 {
+		report.Suggested = RecoverForce
+		report.Message = fmt.Sprintf("no migration file for dirty version %d, schema cannot be inspected", version)
+		return report, nil
+	}
+	info := set.migrations[idx]
+	report.Name = info.Name
+
+	up, err := set.step(info, MigrationDirectionUp)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := d.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	report.Statements, err = inspectScript(ctx, db, up.SQL)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, missing, unknown := 0, 0, 0
+	firstMissing := 0
+	for _, stmt := range report.Statements {
+		switch stmt.State {
+		case StatementApplied:
+			applied++
+		case StatementMissing:
+			missing++
+			if firstMissing == 0 {
+				firstMissing = stmt.Index
+			}
+		default:
+			unknown++
+		}
+	}
+
+	switch {
+	case missing == 0 && unknown > 0:
+		// 無法檢查的語句（例如資料回填）可能就是失敗的那一句，重新執行比直接標記完成安全
+		report.Suggested = RecoverRollForward
+		report.Message = fmt.Sprintf("all checkable statements of migration %d are applied; %d statement(s) cannot be inspected and will be re-run by roll-forward", version, unknown)
+	case missing == 0:
+		report.Suggested = RecoverForce
+		report.Message = fmt.Sprintf("all statements of migration %d are applied; only the dirty flag needs to be cleared", version)
+		if idx+1 < len(set.migrations) {
+			report.Message += fmt.Sprintf(" (if rolling back version %d failed, inspect its down file before forcing)", set.migrations[idx+1].Version)
+		}
+	case applied == 0:
+		report.Suggested = RecoverRollForward
+		report.Message = fmt.Sprintf("migration %d made no detectable changes; statement %d is the first one missing", version, firstMissing)
+	default:
+		report.Suggested = RecoverRollForward
+		if info.HasDown {
+			report.Suggested = RecoverRollBack
+		}
+		report.Message = fmt.Sprintf("migration %d is partially applied (%d applied, %d missing); statement %d is the first one missing", version, applied, missing, firstMissing)
+	}
+	return report, nil
+}
+
+// RecoverDirtyMigration 以指定策略修復 dirty 狀態；dryRun 時只回報各語句會被執行或略過，實際修復前先取得遷移鎖
+func (d *Database) RecoverDirtyMigration(strategy string, dryRun bool) (*RecoveryResult, error) {
+	if dryRun {
+		return d.recoverDirtyMigration(withOperation(context.Background(), "RecoverDirtyMigration"), strategy, true)
+	}
+	var result *RecoveryResult
+	err := d.withMigrationLock("recover "+strategy, func(ctx context.Context) error {
+		var err error
+		result, err = d.recoverDirtyMigration(withOperation(ctx, "RecoverDirtyMigration"), strategy, false)
+		return err
+	})
+	return result, err
+}
+
+// recoverDirtyMigration 修復 dirty 狀態的實作，非 dryRun 時呼叫端需持有遷移鎖
+func (d *Database) recoverDirtyMigration(ctx context.Context, strategy string, dryRun bool) (*RecoveryResult, error) {
+	switch strategy {
+	case RecoverRollForward, RecoverRollBack, RecoverForce:
+	default:
+		return nil, newValidationError("strategy", fmt.Sprintf("unknown strategy %q (use %s, %s or %s)", strategy, RecoverRollForward, RecoverRollBack, RecoverForce))
+	}
+
+	set, err := openMigrationSet()
+	if err != nil {
+		return nil, err
+	}
+	defer set.close()
+
+	m, err := d.newMigrate()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+
+	version, dirty, err := currentMigrationVersion(m)
+	if err != nil {
+		return nil, err
+	}
+	if !dirty {
+		return nil, fmt.Errorf("database is not dirty (version %d)", version)
+	}
+
+	result := &RecoveryResult{Strategy: strategy, DryRun: dryRun, Version: version, NewVersion: version, Dirty: true, Statements: []DirtyStatement{}}
+
+	// 回復後的版本：上一個遷移，沒有上一個時為 -1（golang-migrate 的 NilVersion）
+	target := int(version)
+	idx := set.index(version)
+	if strategy == RecoverRollBack {
+		if idx < 0 {
+			return nil, fmt.Errorf("no migration file for dirty version %d", version)
+		}
+		target = -1
+		if idx > 0 {
+			target = int(set.migrations[idx-1].Version)
+		}
+	}
+
+	if strategy != RecoverForce {
+		if idx < 0 {
+			return nil, fmt.Errorf("no migration file for dirty version %d", version)
+		}
+		direction := MigrationDirectionUp
+		if strategy == RecoverRollBack {
+			direction = MigrationDirectionDown
+		}
+		step, err := set.step(set.migrations[idx], direction)
+		if err != nil {
+			return nil, err
+		}
+
+		db, err := d.OpenDB()
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+
+		result.Statements, err = inspectScript(ctx, db, step.SQL)
+		if err != nil {
+			return nil, err
+		}
+
+		// 已生效的語句略過，其餘依序執行；遇到失敗就停止並保留 dirty 狀態
+		failed := false
+		for i := range result.Statements {
+			stmt := &result.Statements[i]
+			switch {
+			case failed:
+				stmt.Result = StatementNotRun
+			case stmt.State == StatementApplied:
+				stmt.Result = StatementSkipped
+			case dryRun:
+				stmt.Result = StatementPending
+			default:
+				if _, err := db.ExecContext(ctx, stmt.SQL); err != nil {
+					stmt.Result = StatementFailed
+					stmt.Error = err.Error()
+					failed = true
+					logFor("migration").Error("Recovery statement failed", "statement", stmt.Index, "error", err, "sql", stmt.SQL)
+					continue
+				}
+				stmt.Result = StatementExecuted
+			}
+		}
+		if failed {
+			return result, fmt.Errorf("%s of migration %d failed, database is still dirty", strategy, version)
+		}
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	if err := m.Force(target); err != nil {
+		return result, fmt.Errorf("failed to set version %d: %w", target, err)
+	}
+	if target >= 0 {
+		result.NewVersion = uint(target)
+	} else {
+		result.NewVersion = 0
+	}
+	result.Dirty = false
+
+	logFor("migration").Info("Recovered dirty migration", "version", version, "strategy", strategy, "new_version", result.NewVersion)
+	return result, nil
+}
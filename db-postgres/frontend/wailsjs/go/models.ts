@@ -0,0 +1,972 @@
+export namespace main {
+	
+	export class AuditEntry {
+	    id: number;
+	    userId: number;
+	    action: string;
+	    actor: string;
+	    before: {[key: string]: any};
+	    after: {[key: string]: any};
+	    createdAt: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new AuditEntry(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.userId = source["userId"];
+	        this.action = source["action"];
+	        this.actor = source["actor"];
+	        this.before = source["before"];
+	        this.after = source["after"];
+	        this.createdAt = source["createdAt"];
+	    }
+	}
+	export class BackupTable {
+	    name: string;
+	    rows: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new BackupTable(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.rows = source["rows"];
+	    }
+	}
+	export class BackupInfo {
+	    path: string;
+	    format: string;
+	    schemaVersion: number;
+	    dirty: boolean;
+	    tables: BackupTable[];
+	    size: number;
+	    createdAt: string;
+	    durationMs: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new BackupInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.format = source["format"];
+	        this.schemaVersion = source["schemaVersion"];
+	        this.dirty = source["dirty"];
+	        this.tables = this.convertValues(source["tables"], BackupTable);
+	        this.size = source["size"];
+	        this.createdAt = source["createdAt"];
+	        this.durationMs = source["durationMs"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	export class ConfigEntry {
+	    key: string;
+	    value: string;
+	    source: string;
+	    secret: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new ConfigEntry(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.key = source["key"];
+	        this.value = source["value"];
+	        this.source = source["source"];
+	        this.secret = source["secret"];
+	    }
+	}
+	export class TLSOptions {
+	    caFile?: string;
+	    certFile?: string;
+	    keyFile?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TLSOptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.caFile = source["caFile"];
+	        this.certFile = source["certFile"];
+	        this.keyFile = source["keyFile"];
+	    }
+	}
+	export class ConnectionProfile {
+	    name: string;
+	    host: string;
+	    port: string;
+	    user: string;
+	    password?: string;
+	    dbName: string;
+	    sslMode: string;
+	    tls: TLSOptions;
+	
+	    static createFrom(source: any = {}) {
+	        return new ConnectionProfile(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.host = source["host"];
+	        this.port = source["port"];
+	        this.user = source["user"];
+	        this.password = source["password"];
+	        this.dbName = source["dbName"];
+	        this.sslMode = source["sslMode"];
+	        this.tls = this.convertValues(source["tls"], TLSOptions);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ConnectionState {
+	    profile: string;
+	    status: string;
+	    error?: string;
+	    failures: number;
+	    // Go type: time
+	    retryAt?: any;
+	    // Go type: time
+	    since: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new ConnectionState(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.profile = source["profile"];
+	        this.status = source["status"];
+	        this.error = source["error"];
+	        this.failures = source["failures"];
+	        this.retryAt = this.convertValues(source["retryAt"], null);
+	        this.since = this.convertValues(source["since"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class DirtyStatement {
+	    index: number;
+	    sql: string;
+	    check?: string;
+	    state: string;
+	    result?: string;
+	    error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new DirtyStatement(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.index = source["index"];
+	        this.sql = source["sql"];
+	        this.check = source["check"];
+	        this.state = source["state"];
+	        this.result = source["result"];
+	        this.error = source["error"];
+	    }
+	}
+	export class DirtyReport {
+	    dirty: boolean;
+	    version: number;
+	    name: string;
+	    statements: DirtyStatement[];
+	    suggested: string;
+	    message: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new DirtyReport(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.dirty = source["dirty"];
+	        this.version = source["version"];
+	        this.name = source["name"];
+	        this.statements = this.convertValues(source["statements"], DirtyStatement);
+	        this.suggested = source["suggested"];
+	        this.message = source["message"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	export class ExportReport {
+	    path: string;
+	    format: string;
+	    count: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ExportReport(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.format = source["format"];
+	        this.count = source["count"];
+	    }
+	}
+	export class FieldError {
+	    field: string;
+	    message: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new FieldError(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.field = source["field"];
+	        this.message = source["message"];
+	    }
+	}
+	export class FilterCondition {
+	    field: string;
+	    op: string;
+	    value: any;
+	    values: any[];
+	
+	    static createFrom(source: any = {}) {
+	        return new FilterCondition(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.field = source["field"];
+	        this.op = source["op"];
+	        this.value = source["value"];
+	        this.values = source["values"];
+	    }
+	}
+	export class ImportRowError {
+	    line: number;
+	    email: string;
+	    message: string;
+	    fields?: FieldError[];
+	
+	    static createFrom(source: any = {}) {
+	        return new ImportRowError(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.line = source["line"];
+	        this.email = source["email"];
+	        this.message = source["message"];
+	        this.fields = this.convertValues(source["fields"], FieldError);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ImportReport {
+	    format: string;
+	    mode: string;
+	    dryRun: boolean;
+	    total: number;
+	    inserted: number;
+	    updated: number;
+	    skipped: number;
+	    failed: number;
+	    errors: ImportRowError[];
+	
+	    static createFrom(source: any = {}) {
+	        return new ImportReport(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.format = source["format"];
+	        this.mode = source["mode"];
+	        this.dryRun = source["dryRun"];
+	        this.total = source["total"];
+	        this.inserted = source["inserted"];
+	        this.updated = source["updated"];
+	        this.skipped = source["skipped"];
+	        this.failed = source["failed"];
+	        this.errors = this.convertValues(source["errors"], ImportRowError);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	export class LogEntry {
+	    // Go type: time
+	    time: any;
+	    level: string;
+	    message: string;
+	    component?: string;
+	    attrs?: {[key: string]: string};
+	
+	    static createFrom(source: any = {}) {
+	        return new LogEntry(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.time = this.convertValues(source["time"], null);
+	        this.level = source["level"];
+	        this.message = source["message"];
+	        this.component = source["component"];
+	        this.attrs = source["attrs"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class MigrationInfo {
+	    version: number;
+	    name: string;
+	    applied: boolean;
+	    hasDown: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new MigrationInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.version = source["version"];
+	        this.name = source["name"];
+	        this.applied = source["applied"];
+	        this.hasDown = source["hasDown"];
+	    }
+	}
+	export class MigrationStep {
+	    version: number;
+	    name: string;
+	    direction: string;
+	    sql: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new MigrationStep(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.version = source["version"];
+	        this.name = source["name"];
+	        this.direction = source["direction"];
+	        this.sql = source["sql"];
+	    }
+	}
+	export class MigrationPlan {
+	    fromVersion: number;
+	    toVersion: number;
+	    dryRun: boolean;
+	    steps: MigrationStep[];
+	
+	    static createFrom(source: any = {}) {
+	        return new MigrationPlan(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.fromVersion = source["fromVersion"];
+	        this.toVersion = source["toVersion"];
+	        this.dryRun = source["dryRun"];
+	        this.steps = this.convertValues(source["steps"], MigrationStep);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class MigrationStatus {
+	    currentVersion: number;
+	    dirty: boolean;
+	    latestVersion: number;
+	    ahead: boolean;
+	    applied: MigrationInfo[];
+	    pending: MigrationInfo[];
+	
+	    static createFrom(source: any = {}) {
+	        return new MigrationStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.currentVersion = source["currentVersion"];
+	        this.dirty = source["dirty"];
+	        this.latestVersion = source["latestVersion"];
+	        this.ahead = source["ahead"];
+	        this.applied = this.convertValues(source["applied"], MigrationInfo);
+	        this.pending = this.convertValues(source["pending"], MigrationInfo);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	export class QueryColumn {
+	    name: string;
+	    type: string;
+	    nullable?: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new QueryColumn(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.type = source["type"];
+	        this.nullable = source["nullable"];
+	    }
+	}
+	export class QueryHistoryEntry {
+	    executedAt: string;
+	    mode: string;
+	    statement: string;
+	    query: string;
+	    params?: any[];
+	    rows: number;
+	    durationMs: number;
+	    error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new QueryHistoryEntry(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.executedAt = source["executedAt"];
+	        this.mode = source["mode"];
+	        this.statement = source["statement"];
+	        this.query = source["query"];
+	        this.params = source["params"];
+	        this.rows = source["rows"];
+	        this.durationMs = source["durationMs"];
+	        this.error = source["error"];
+	    }
+	}
+	export class QueryMetric {
+	    operation: string;
+	    command: string;
+	    count: number;
+	    errors: number;
+	    slow: number;
+	    rows: number;
+	    totalMs: number;
+	    avgMs: number;
+	    maxMs: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new QueryMetric(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.operation = source["operation"];
+	        this.command = source["command"];
+	        this.count = source["count"];
+	        this.errors = source["errors"];
+	        this.slow = source["slow"];
+	        this.rows = source["rows"];
+	        this.totalMs = source["totalMs"];
+	        this.avgMs = source["avgMs"];
+	        this.maxMs = source["maxMs"];
+	    }
+	}
+	export class QueryResult {
+	    mode: string;
+	    statement: string;
+	    columns: QueryColumn[];
+	    rows: any[][];
+	    rowCount: number;
+	    truncated: boolean;
+	    rowsAffected: number;
+	    durationMs: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new QueryResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.mode = source["mode"];
+	        this.statement = source["statement"];
+	        this.columns = this.convertValues(source["columns"], QueryColumn);
+	        this.rows = source["rows"];
+	        this.rowCount = source["rowCount"];
+	        this.truncated = source["truncated"];
+	        this.rowsAffected = source["rowsAffected"];
+	        this.durationMs = source["durationMs"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class RecoveryResult {
+	    strategy: string;
+	    dryRun: boolean;
+	    version: number;
+	    newVersion: number;
+	    dirty: boolean;
+	    statements: DirtyStatement[];
+	
+	    static createFrom(source: any = {}) {
+	        return new RecoveryResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.strategy = source["strategy"];
+	        this.dryRun = source["dryRun"];
+	        this.version = source["version"];
+	        this.newVersion = source["newVersion"];
+	        this.dirty = source["dirty"];
+	        this.statements = this.convertValues(source["statements"], DirtyStatement);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class SchemaDifference {
+	    kind: string;
+	    table: string;
+	    name?: string;
+	    field?: string;
+	    expected?: string;
+	    actual?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SchemaDifference(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.kind = source["kind"];
+	        this.table = source["table"];
+	        this.name = source["name"];
+	        this.field = source["field"];
+	        this.expected = source["expected"];
+	        this.actual = source["actual"];
+	    }
+	}
+	export class SchemaReport {
+	    currentVersion: number;
+	    latestVersion: number;
+	    dirty: boolean;
+	    scratch: string;
+	    inSync: boolean;
+	    differences: SchemaDifference[];
+	    checkedAt: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SchemaReport(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.currentVersion = source["currentVersion"];
+	        this.latestVersion = source["latestVersion"];
+	        this.dirty = source["dirty"];
+	        this.scratch = source["scratch"];
+	        this.inSync = source["inSync"];
+	        this.differences = this.convertValues(source["differences"], SchemaDifference);
+	        this.checkedAt = source["checkedAt"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	export class TableColumn {
+	    name: string;
+	    type: string;
+	    nullable: boolean;
+	    default?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TableColumn(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.type = source["type"];
+	        this.nullable = source["nullable"];
+	        this.default = source["default"];
+	    }
+	}
+	export class TableIndex {
+	    name: string;
+	    columns: string[];
+	    unique: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new TableIndex(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.columns = source["columns"];
+	        this.unique = source["unique"];
+	    }
+	}
+	export class TableDescription {
+	    name: string;
+	    rows: number;
+	    columns: TableColumn[];
+	    indexes: TableIndex[];
+	
+	    static createFrom(source: any = {}) {
+	        return new TableDescription(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.rows = source["rows"];
+	        this.columns = this.convertValues(source["columns"], TableColumn);
+	        this.indexes = this.convertValues(source["indexes"], TableIndex);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	export class TablePage {
+	    table: string;
+	    columns: string[];
+	    rows: Array<Record<string, any>>;
+	    total: number;
+	    page: number;
+	    pageSize: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new TablePage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.table = source["table"];
+	        this.columns = source["columns"];
+	        this.rows = source["rows"];
+	        this.total = source["total"];
+	        this.page = source["page"];
+	        this.pageSize = source["pageSize"];
+	    }
+	}
+	export class TableQuery {
+	    conditions: FilterCondition[];
+	    orderBy: string;
+	    desc: boolean;
+	    page: number;
+	    pageSize: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new TableQuery(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.conditions = this.convertValues(source["conditions"], FilterCondition);
+	        this.orderBy = source["orderBy"];
+	        this.desc = source["desc"];
+	        this.page = source["page"];
+	        this.pageSize = source["pageSize"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class TableSummary {
+	    name: string;
+	    rows: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new TableSummary(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.rows = source["rows"];
+	    }
+	}
+	export class UserFilter {
+	    logic: string;
+	    keyword: string;
+	    conditions: FilterCondition[];
+	    groups: UserFilter[];
+	
+	    static createFrom(source: any = {}) {
+	        return new UserFilter(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.logic = source["logic"];
+	        this.keyword = source["keyword"];
+	        this.conditions = this.convertValues(source["conditions"], FilterCondition);
+	        this.groups = this.convertValues(source["groups"], UserFilter);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class UserPatch {
+	    name?: string;
+	    email?: string;
+	    age?: number;
+	    version: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new UserPatch(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.email = source["email"];
+	        this.age = source["age"];
+	        this.version = source["version"];
+	    }
+	}
+
+}
+
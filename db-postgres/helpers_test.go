@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loadTestConfig 以暫存目錄中的檔案載入設定並設為目前的設定；flags 為額外的命令列旗標
+func loadTestConfig(t *testing.T, flags ...string) *Config {
+	t.Helper()
+	dir := t.TempDir()
+	args := append([]string{
+		"--db-backup-dir", filepath.Join(dir, "backups"),
+		"--db-query-history-file", filepath.Join(dir, "query_history.jsonl"),
+		"--db-profiles-file", filepath.Join(dir, "connection_profiles.json"),
+		"--log-file", "",
+		"--log-stdout=false",
+	}, flags...)
+	cfg, _, err := LoadConfig(args)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	previous := appConfig()
+	setConfig(cfg)
+	t.Cleanup(func() { setConfig(previous) })
+	discardLogs(t)
+	return cfg
+}
+
+// discardLogs 測試期間把共用 logger 的輸出丟到 io.Discard，測試結束時還原
+func discardLogs(t *testing.T) {
+	t.Helper()
+	logger := slog.New(&appHandler{outputs: []slog.Handler{slog.NewTextHandler(io.Discard, nil)}})
+	loggerMu.Lock()
+	previous := appLogger
+	appLogger = logger
+	loggerMu.Unlock()
+	previousDefault := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() {
+		loggerMu.Lock()
+		appLogger = previous
+		loggerMu.Unlock()
+		slog.SetDefault(previousDefault)
+	})
+}
+
+// newPostgresTestDatabase 連到 TEST_POSTGRES_DB 指定的資料庫（其餘連線設定取 DB_HOST 等環境變數），
+// 清空 public schema 後套用所有遷移；未設定時略過測試。該資料庫的內容會被刪除，只能使用測試專用的資料庫
+func newPostgresTestDatabase(t *testing.T, flags ...string) *Database {
+	t.Helper()
+	name := os.Getenv("TEST_POSTGRES_DB")
+	if name == "" {
+		t.Skip("TEST_POSTGRES_DB is not set")
+	}
+	loadTestConfig(t, append([]string{"--db-name", name}, flags...)...)
+	d := newDatabaseFromEnv()
+
+	db, err := d.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`DROP SCHEMA public CASCADE; CREATE SCHEMA public`); err != nil {
+		t.Fatalf("reset schema: %v", err)
+	}
+	if err := d.runMigrations(); err != nil {
+		t.Fatalf("runMigrations: %v", err)
+	}
+	return d
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ImportUsers 從 CSV / JSON / NDJSON 檔案批次匯入用戶
+// 整個匯入在單一交易中分批寫入；dryRun 為 true 時只回報預估結果，不寫入任何資料
+func (d *Database) ImportUsers(path, format, mode string, dryRun bool) (*ImportReport, error) {
+	ctx := withOperation(context.Background(), "ImportUsers")
+	start := time.Now()
+	format, err := resolveFormat(path, format)
+	if err != nil {
+		return nil, err
+	}
+	mode, err = resolveImportMode(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	// fail 模式先完整預檢一次，有任何一列會失敗就不開始寫入
+	if mode == ImportModeFail && !dryRun {
+		preview, err := d.ImportUsers(path, format, mode, true)
+		if err != nil {
+			return preview, err
+		}
+		if preview.Failed > 0 {
+			return preview, fmt.Errorf("import aborted: %d row(s) would fail, no changes were applied", preview.Failed)
+		}
+	}
+
+	db, err := d.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	report := &ImportReport{Format: format, Mode: mode, DryRun: dryRun, Errors: []ImportRowError{}}
+	seen := make(map[string]bool)
+	batch := make([]importRecord, 0, importBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := importUserBatch(ctx, tx, batch, mode, dryRun, seen, report, d.Actor())
+		batch = batch[:0]
+		return err
+	}
+
+	err = readImportFile(path, format, func(rec importRecord) error {
+		report.Total++
+		batch = append(batch, rec)
+		if len(batch) >= importBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return report, err
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	if mode == ImportModeFail && report.Failed > 0 {
+		return report, fmt.Errorf("import aborted: %d row(s) failed, no changes were applied", report.Failed)
+	}
+	if err := tx.Commit(); err != nil {
+		return report, fmt.Errorf("failed to commit import: %w", translateDBError(err))
+	}
+
+	logOperation("import_export", "import", start, nil, "Imported users", "path", path,
+		"inserted", report.Inserted, "updated", report.Updated, "skipped", report.Skipped, "failed", report.Failed)
+	return report, nil
+}
+
+// importUserBatch 驗證一批資料、判斷 email 衝突並寫入（dryRun 時只計數），每筆異動都會寫入稽核紀錄
+func importUserBatch(ctx context.Context, tx *sql.Tx, batch []importRecord, mode string, dryRun bool, seen map[string]bool, report *ImportReport, actor string) error {
+	valid := make([]importRecord, 0, len(batch))
+	for _, rec := range batch {
+		if rec.Err != nil {
+			report.addError(rec, rec.Err)
+			continue
+		}
+		if err := validateUser(rec.Name, rec.Email, rec.Age); err != nil {
+			report.addError(rec, err)
+			continue
+		}
+		valid = append(valid, rec)
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+
+	existing, err := existingEmails(ctx, tx, valid)
+	if err != nil {
+		return err
+	}
+
+	var toInsert, toUpdate []importRecord
+	for _, rec := range valid {
+		if !existing[rec.Email] && !seen[rec.Email] {
+			seen[rec.Email] = true
+			toInsert = append(toInsert, rec)
+			continue
+		}
+		switch mode {
+		case ImportModeUpsert:
+			toUpdate = append(toUpdate, rec)
+		case ImportModeSkip:
+			report.Skipped++
+		default:
+			report.addError(rec, ErrDuplicateEmail)
+		}
+	}
+
+	if !dryRun {
+		if err := insertUserRows(ctx, tx, toInsert); err != nil {
+			return err
+		}
+		inserted, err := fetchUserRowsByEmail(ctx, tx, importEmails(toInsert))
+		if err != nil {
+			return err
+		}
+		for _, rec := range toInsert {
+			after, ok := inserted[rec.Email]
+			if !ok {
+				return fmt.Errorf("failed to read back imported user on line %d: %w", rec.Line, ErrNotFound)
+			}
+			id, _ := toInt64(after["id"])
+			if err := recordUserChange(ctx, tx, id, AuditActionInsert, nil, after, actor); err != nil {
+				return err
+			}
+		}
+		if err := updateUserRows(ctx, tx, toUpdate, actor); err != nil {
+			return err
+		}
+	}
+	report.Inserted += len(toInsert)
+	report.Updated += len(toUpdate)
+	return nil
+}
+
+// updateUserRows 逐筆更新一批用戶，每次更新各寫入一筆稽核紀錄。更新前後的快照各以一次查詢讀取；
+// 同一個 email 在批次中出現多次時，除了最後一次之外的更新會在更新後立即讀取快照，作為該次的更新後與下一次的更新前快照
+func updateUserRows(ctx context.Context, tx *sql.Tx, records []importRecord, actor string) error {
+	if len(records) == 0 {
+		return nil
+	}
+	emails := importEmails(records)
+	current, err := fetchUserRowsByEmail(ctx, tx, emails)
+	if err != nil {
+		return err
+	}
+	last := make(map[string]int, len(emails))
+	for i, rec := range records {
+		last[rec.Email] = i
+	}
+
+	updateSQL := fmt.Sprintf(`UPDATE users SET name = %s, age = %s, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE email = %s AND deleted_at IS NULL`,
+		placeholder(1), placeholder(2), placeholder(3))
+	before := make([]map[string]interface{}, len(records))
+	after := make([]map[string]interface{}, len(records))
+	for i, rec := range records {
+		if _, err := tx.ExecContext(ctx, updateSQL, rec.Name, rec.Age, rec.Email); err != nil {
+			return fmt.Errorf("failed to update user on line %d: %w", rec.Line, translateDBError(err))
+		}
+		before[i] = current[rec.Email]
+		if last[rec.Email] == i {
+			continue
+		}
+		rows, err := fetchUserRowsByEmail(ctx, tx, []string{rec.Email})
+		if err != nil {
+			return err
+		}
+		after[i] = rows[rec.Email]
+		current[rec.Email] = rows[rec.Email]
+	}
+
+	final, err := fetchUserRowsByEmail(ctx, tx, emails)
+	if err != nil {
+		return err
+	}
+	for i, rec := range records {
+		row := after[i]
+		if last[rec.Email] == i {
+			row = final[rec.Email]
+		}
+		if row == nil {
+			return fmt.Errorf("failed to read back updated user %s: %w", rec.Email, ErrNotFound)
+		}
+		id, _ := toInt64(row["id"])
+		if err := recordUserChange(ctx, tx, id, AuditActionUpdate, before[i], row, actor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importEmails 回傳一批資料中不重複的 email，保留第一次出現的順序
+func importEmails(records []importRecord) []string {
+	emails := make([]string, 0, len(records))
+	seen := make(map[string]bool, len(records))
+	for _, rec := range records {
+		if !seen[rec.Email] {
+			seen[rec.Email] = true
+			emails = append(emails, rec.Email)
+		}
+	}
+	return emails
+}
+
+// existingEmails 查詢這批資料中哪些 email 已被未刪除的用戶使用；只屬於已軟刪除用戶的 email 可以再次使用
+func existingEmails(ctx context.Context, tx *sql.Tx, records []importRecord) (map[string]bool, error) {
+	args := make([]interface{}, 0, len(records))
+	holders := make([]string, 0, len(records))
+	for _, rec := range records {
+		args = append(args, rec.Email)
+		holders = append(holders, placeholder(len(args)))
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT email FROM users WHERE email IN (`+strings.Join(holders, ", ")+`) AND deleted_at IS NULL`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing emails: %w", err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, fmt.Errorf("failed to scan email: %w", err)
+		}
+		existing[email] = true
+	}
+	return existing, rows.Err()
+}
+
+// insertUserRows 以單一多列 INSERT 寫入一批用戶
+func insertUserRows(ctx context.Context, tx *sql.Tx, records []importRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(records)*3)
+	values := make([]string, 0, len(records))
+	for _, rec := range records {
+		args = append(args, rec.Name, rec.Email, rec.Age)
+		n := len(args)
+		values = append(values, fmt.Sprintf("(%s, %s, %s, CURRENT_TIMESTAMP)", placeholder(n-2), placeholder(n-1), placeholder(n)))
+	}
+
+	insertSQL := `INSERT INTO users (name, email, age, updated_at) VALUES ` + strings.Join(values, ", ")
+	if _, err := tx.ExecContext(ctx, insertSQL, args...); err != nil {
+		return fmt.Errorf("failed to insert users (lines %d-%d): %w",
+			records[0].Line, records[len(records)-1].Line, translateDBError(err))
+	}
+	return nil
+}
+
+// ExportUsers 將符合條件的用戶逐筆寫出到檔案，不會一次載入整張表
+func (d *Database) ExportUsers(filter UserFilter, format, path string) (*ExportReport, error) {
+	ctx := withOperation(context.Background(), "ExportUsers")
+	start := time.Now()
+	format, err := resolveFormat(path, format)
+	if err != nil {
+		return nil, err
+	}
+	builder := &sqlFilterBuilder{}
+	whereSQL, err := builder.where(filter)
+	if err != nil {
+		return nil, newValidationError("filter", err.Error())
+	}
+
+	db, err := d.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `SELECT id, name, email, age, created_at FROM users`+whereSQL+` ORDER BY id`, builder.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	out, err := createExportFile(path, format)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ExportReport{Path: path, Format: format}
+	for rows.Next() {
+		var (
+			id        int64
+			name      string
+			email     string
+			age       sql.NullInt64
+			createdAt sql.NullTime
+		)
+		if err := rows.Scan(&id, &name, &email, &age, &createdAt); err != nil {
+			out.Abort()
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		rec := exportRecord{ID: id, Name: name, Email: email, Age: int(age.Int64)}
+		if createdAt.Valid {
+			rec.CreatedAt = formatExportTime(createdAt.Time)
+		}
+		if err := out.Write(rec); err != nil {
+			out.Abort()
+			return nil, fmt.Errorf("failed to write export file: %w", err)
+		}
+		report.Count++
+	}
+	if err := rows.Err(); err != nil {
+		out.Abort()
+		return nil, fmt.Errorf("failed to read users: %w", err)
+	}
+	if err := out.Commit(); err != nil {
+		return nil, err
+	}
+
+	logOperation("import_export", "export", start, nil, "Exported users", "path", path, "format", format, "count", report.Count)
+	return report, nil
+}
@@ -1,29 +1,381 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// 輸出格式
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
 )
 
-// WriteAppLog writes a log message to app.log and optionally prints to stdout
-func WriteAppLog(str string, print bool) {
-	logPath := "app.log"
-	logfile, err := os.OpenFile(logPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+// 各模組共用的欄位名稱
+const (
+	LogKeyComponent = "component"   // 產生日誌的模組，例如 migration、backup
+	LogKeyOperation = "operation"   // 操作名稱，例如 migrate.up、backup
+	LogKeyDuration  = "duration_ms" // 操作耗時（毫秒）
+)
+
+// LogEntryEvent 每筆新日誌送給前端的 Wails 事件名稱
+const LogEntryEvent = "app:log"
+
+// recentLogCapacity 記憶體中保留、可由 GetRecentLogs 取回的最近日誌筆數
+const recentLogCapacity = 1000
+
+// LogOptions 日誌設定
+type LogOptions struct {
+	Level      string              // debug、info、warn 或 error
+	Format     string              // text 或 json
+	File       string              // 日誌檔路徑，空字串表示不寫檔
+	MaxSizeMB  int                 // 單一檔案超過此大小（MB）時輪替
+	MaxAgeDays int                 // 輪替後的舊檔保留天數，0 表示不依天數刪除
+	MaxBackups int                 // 輪替後的舊檔保留個數，0 表示不依個數刪除
+	Compress   bool                // 以 gzip 壓縮輪替後的舊檔
+	Stdout     bool                // 同時以文字格式輸出到 stdout
+	Redact     func(string) string // 寫出前遮罩訊息與字串欄位中的機密，可為 nil
+}
+
+// LogEntry 一筆日誌，供前端顯示
+type LogEntry struct {
+	Time      time.Time         `json:"time"`
+	Level     string            `json:"level"`
+	Message   string            `json:"message"`
+	Component string            `json:"component,omitempty"`
+	Attrs     map[string]string `json:"attrs,omitempty"`
+}
+
+var (
+	loggerMu   sync.RWMutex
+	appLogger  *slog.Logger
+	logCloser  io.Closer
+	logLevel   = new(slog.LevelVar)
+	logRedact  func(string) string
+	recentLogs = &logRing{entries: make([]LogEntry, recentLogCapacity)}
+
+	logListenerMu sync.RWMutex
+	logListener   func(LogEntry)
+)
+
+// defaultLogOptions 尚未呼叫 InitLogger 時使用的設定；只輸出到 stdout，不在目前目錄建立日誌檔
+func defaultLogOptions() LogOptions {
+	return LogOptions{Level: "info", Format: LogFormatText, Stdout: true}
+}
+
+// parseLogLevel 解析日誌層級名稱
+func parseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q (use debug, info, warn or error)", name)
+	}
+	return level, nil
+}
+
+// InitLogger 依設定建立共用的 logger 並設為 slog 的預設 logger（標準函式庫 log 套件的輸出也會經過它）；
+// 可重複呼叫，之前開啟的日誌檔會被關閉
+func InitLogger(opts LogOptions) error {
+	level, err := parseLogLevel(opts.Level)
+	if err != nil {
+		return err
+	}
+	if opts.Format != LogFormatText && opts.Format != LogFormatJSON {
+		return fmt.Errorf("unknown log format %q (use text or json)", opts.Format)
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: logLevel}
+	var outputs []slog.Handler
+	var closer io.Closer
+	if opts.File != "" {
+		file := &lumberjack.Logger{
+			Filename:   opts.File,
+			MaxSize:    opts.MaxSizeMB,
+			MaxAge:     opts.MaxAgeDays,
+			MaxBackups: opts.MaxBackups,
+			Compress:   opts.Compress,
+			LocalTime:  true,
+		}
+		if opts.Format == LogFormatJSON {
+			outputs = append(outputs, slog.NewJSONHandler(file, handlerOpts))
+		} else {
+			outputs = append(outputs, slog.NewTextHandler(file, handlerOpts))
+		}
+		closer = file
+	}
+	if opts.Stdout {
+		outputs = append(outputs, slog.NewTextHandler(os.Stdout, handlerOpts))
+	}
+
+	logger := slog.New(&appHandler{outputs: outputs})
+
+	loggerMu.Lock()
+	previous := logCloser
+	appLogger, logCloser, logRedact = logger, closer, opts.Redact
+	logLevel.Set(level)
+	loggerMu.Unlock()
+	slog.SetDefault(logger)
+
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// CloseLogger 關閉日誌檔，程式結束前呼叫
+func CloseLogger() {
+	loggerMu.Lock()
+	closer := logCloser
+	logCloser = nil
+	loggerMu.Unlock()
+	if closer != nil {
+		closer.Close()
+	}
+}
+
+// Logger 回傳共用的 logger；尚未初始化時以預設設定建立
+func Logger() *slog.Logger {
+	loggerMu.RLock()
+	logger := appLogger
+	loggerMu.RUnlock()
+	if logger != nil {
+		return logger
+	}
+	if err := InitLogger(defaultLogOptions()); err != nil {
+		return slog.Default()
+	}
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return appLogger
+}
+
+// logFor 回傳帶有 component 欄位的 logger
+func logFor(component string) *slog.Logger {
+	return Logger().With(LogKeyComponent, component)
+}
+
+// logOperation 記錄一次操作的結果與耗時：成功時為 info，失敗時為 error 並附上錯誤
+func logOperation(component, operation string, start time.Time, err error, msg string, attrs ...any) {
+	attrs = append(attrs, LogKeyOperation, operation, LogKeyDuration, time.Since(start).Milliseconds())
+	logger := logFor(component)
 	if err != nil {
-		if print {
-			fmt.Printf("Failed to open log file: %v\n", err)
+		logger.Error(msg, append(attrs, "error", err)...)
+		return
+	}
+	logger.Info(msg, attrs...)
+}
+
+// SetLogListener 設定新日誌的接收者（nil 表示不通知），由 App.startup 轉送給前端
+func SetLogListener(fn func(LogEntry)) {
+	logListenerMu.Lock()
+	logListener = fn
+	logListenerMu.Unlock()
+}
+
+// RecentLogs 回傳最近的日誌（由舊到新），只包含層級不低於 minLevel 的項目；limit <= 0 表示全部
+func RecentLogs(limit int, minLevel string) ([]LogEntry, error) {
+	level := slog.LevelDebug
+	if minLevel != "" {
+		parsed, err := parseLogLevel(minLevel)
+		if err != nil {
+			return nil, err
+		}
+		level = parsed
+	}
+	return recentLogs.list(limit, level), nil
+}
+
+// region <-- slog handler -->
+
+// appHandler 將紀錄遮罩機密後送往各輸出，並保留在記憶體中供前端讀取
+type appHandler struct {
+	outputs []slog.Handler
+	attrs   []slog.Attr // With 累積的欄位（已加上 group 前綴），供 LogEntry 使用
+	groups  []string
+}
+
+// Enabled 實作 slog.Handler
+func (h *appHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= logLevel.Level()
+}
+
+// Handle 實作 slog.Handler
+func (h *appHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, redactLog(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(a))
+		return true
+	})
+
+	var errs []error
+	for _, out := range h.outputs {
+		if out.Enabled(ctx, r.Level) {
+			errs = append(errs, out.Handle(ctx, redacted.Clone()))
+		}
+	}
+	h.record(redacted)
+	return errors.Join(errs...)
+}
+
+// WithAttrs 實作 slog.Handler
+func (h *appHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	next := &appHandler{groups: h.groups, attrs: append([]slog.Attr{}, h.attrs...)}
+	for _, out := range h.outputs {
+		next.outputs = append(next.outputs, out.WithAttrs(redacted))
+	}
+	for _, a := range redacted {
+		next.attrs = append(next.attrs, prefixAttr(h.groups, a))
+	}
+	return next
+}
+
+// WithGroup 實作 slog.Handler
+func (h *appHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	next := &appHandler{attrs: h.attrs, groups: append(append([]string{}, h.groups...), name)}
+	for _, out := range h.outputs {
+		next.outputs = append(next.outputs, out.WithGroup(name))
+	}
+	return next
+}
+
+// record 轉為 LogEntry，存入最近日誌並通知接收者
+func (h *appHandler) record(r slog.Record) {
+	entry := LogEntry{Time: r.Time, Level: r.Level.String(), Message: r.Message}
+	add := func(a slog.Attr) {
+		if a.Key == LogKeyComponent {
+			entry.Component = a.Value.String()
+			return
+		}
+		if entry.Attrs == nil {
+			entry.Attrs = map[string]string{}
+		}
+		flattenAttr("", a, entry.Attrs)
+	}
+	for _, a := range h.attrs {
+		add(a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		add(prefixAttr(h.groups, a))
+		return true
+	})
+	recentLogs.add(entry)
+
+	logListenerMu.RLock()
+	fn := logListener
+	logListenerMu.RUnlock()
+	if fn != nil {
+		fn(entry)
+	}
+}
+
+// prefixAttr 依 WithGroup 的群組為欄位名稱加上前綴
+func prefixAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 {
+		return a
+	}
+	return slog.Attr{Key: strings.Join(groups, ".") + "." + a.Key, Value: a.Value}
+}
+
+// flattenAttr 將欄位（含巢狀群組）展開為字串
+func flattenAttr(prefix string, a slog.Attr, out map[string]string) {
+	key := a.Key
+	if prefix != "" {
+		key = prefix + "." + key
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, child := range a.Value.Group() {
+			flattenAttr(key, child, out)
 		}
 		return
 	}
-	defer logfile.Close()
+	out[key] = a.Value.String()
+}
 
-	// Create a new logger to write to the file
-	fileLogger := log.New(logfile, "", log.LstdFlags)
-	fileLogger.Println(str)
+// redactLog 以設定的函式遮罩字串
+func redactLog(s string) string {
+	loggerMu.RLock()
+	redact := logRedact
+	loggerMu.RUnlock()
+	if redact == nil {
+		return s
+	}
+	return redact(s)
+}
 
-	if print {
-		fmt.Println(str)
+// redactAttr 遮罩字串與錯誤欄位中的機密
+func redactAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(redactLog(a.Value.String()))
+	case slog.KindGroup:
+		group := a.Value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, child := range group {
+			redacted[i] = redactAttr(child)
+		}
+		a.Value = slog.GroupValue(redacted...)
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(redactLog(err.Error()))
+		}
 	}
+	return a
 }
 
+// endregion
+
+// logRing 固定容量的最近日誌
+type logRing struct {
+	mu      sync.Mutex
+	entries []LogEntry
+	next    int
+	full    bool
+}
+
+// add 加入一筆日誌，已滿時覆寫最舊的一筆
+func (l *logRing) add(entry LogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// list 回傳層級不低於 level 的最近 limit 筆日誌（由舊到新）
+func (l *logRing) list(limit int, level slog.Level) []LogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ordered := l.entries[:l.next]
+	if l.full {
+		ordered = append(append([]LogEntry{}, l.entries[l.next:]...), l.entries[:l.next]...)
+	}
+
+	result := []LogEntry{}
+	for _, entry := range ordered {
+		if entryLevel, err := parseLogLevel(entry.Level); err == nil && entryLevel >= level {
+			result = append(result, entry)
+		}
+	}
+	if limit > 0 && len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+	return result
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestRestoreKeepsUserChangeTrigger(t *testing.T) {
+	d := newPostgresTestDatabase(t)
+	path := filepath.Join(t.TempDir(), "backup.sql")
+	if _, err := d.Backup(path); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	if _, err := d.Restore(path); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	listener := pq.NewListener(d.connString(), time.Second, time.Second, nil)
+	defer listener.Close()
+	if err := listener.Listen(userChangeChannel); err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	user, err := d.InsertUserReturning("Alice", "alice@example.com", 30)
+	if err != nil {
+		t.Fatalf("InsertUserReturning: %v", err)
+	}
+
+	select {
+	case n := <-listener.Notify:
+		event, err := decodeUserChange(n.Extra)
+		if err != nil {
+			t.Fatalf("decodeUserChange: %v", err)
+		}
+		id, _ := toInt64(user["id"])
+		if event.Type != UserCreatedEvent || event.ID != id {
+			t.Fatalf("event = %s for user %d, want %s for user %d", event.Type, event.ID, UserCreatedEvent, id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change notification after restoring the backup")
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsPath Prometheus 文字格式的端點路徑
+const metricsPath = "/metrics"
+
+// QueryMetric 一個操作（Database 方法）中一種命令的累計統計，供前端顯示
+type QueryMetric struct {
+	Operation string  `json:"operation"` // Database 方法名稱，例如 InsertUser
+	Command   string  `json:"command"`   // SQL 敘述種類或 MongoDB 命令，例如 select、insert、find
+	Count     int64   `json:"count"`
+	Errors    int64   `json:"errors"`
+	Slow      int64   `json:"slow"` // 超過 DB_SLOW_QUERY_THRESHOLD 的次數
+	Rows      int64   `json:"rows"` // 影響或回傳的筆數
+	TotalMs   float64 `json:"totalMs"`
+	AvgMs     float64 `json:"avgMs"`
+	MaxMs     float64 `json:"maxMs"`
+}
+
+// queryObservation 一次資料庫呼叫的結果
+type queryObservation struct {
+	Operation string
+	Command   string
+	Statement string // 已遮罩參數的敘述或命令，只在慢查詢時寫入日誌
+	Params    int    // 參數個數
+	Duration  time.Duration
+	Rows      int64
+	Err       error
+}
+
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Duration of database calls by Database operation and command.",
+		Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"operation", "command"})
+	queryRows = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_query_rows_total",
+		Help: "Rows affected or returned by database calls.",
+	}, []string{"operation", "command"})
+	queryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_query_errors_total",
+		Help: "Database calls that returned an error.",
+	}, []string{"operation", "command"})
+	slowQueries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_slow_queries_total",
+		Help: "Database calls slower than DB_SLOW_QUERY_THRESHOLD.",
+	}, []string{"operation", "command"})
+
+	queryStatsMu sync.Mutex
+	queryStats   = map[[2]string]*QueryMetric{}
+
+	metricsServerMu sync.Mutex
+	metricsServer   *http.Server
+)
+
+func init() {
+	metricsRegistry.MustRegister(queryDuration, queryRows, queryErrors, slowQueries,
+		collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+// observeQuery 記錄一次資料庫呼叫的耗時、筆數與錯誤，超過門檻時寫入慢查詢日誌
+func observeQuery(obs queryObservation) {
+	if obs.Operation == "" {
+		obs.Operation = "other"
+	}
+	labels := prometheus.Labels{"operation": obs.Operation, "command": obs.Command}
+	queryDuration.With(labels).Observe(obs.Duration.Seconds())
+	queryRows.With(labels).Add(float64(obs.Rows))
+	failed := obs.Err != nil && !errors.Is(obs.Err, context.Canceled)
+	if failed {
+		queryErrors.With(labels).Inc()
+	}
+	threshold := appConfig().SlowQueryThreshold
+	slow := obs.Duration >= threshold
+	if slow {
+		slowQueries.With(labels).Inc()
+	}
+
+	ms := float64(obs.Duration.Microseconds()) / 1000
+	queryStatsMu.Lock()
+	key := [2]string{obs.Operation, obs.Command}
+	stat := queryStats[key]
+	if stat == nil {
+		stat = &QueryMetric{Operation: obs.Operation, Command: obs.Command}
+		queryStats[key] = stat
+	}
+	stat.Count++
+	stat.Rows += obs.Rows
+	stat.TotalMs += ms
+	if ms > stat.MaxMs {
+		stat.MaxMs = ms
+	}
+	if failed {
+		stat.Errors++
+	}
+	if slow {
+		stat.Slow++
+	}
+	queryStatsMu.Unlock()
+
+	if slow {
+		attrs := []any{LogKeyOperation, obs.Operation, LogKeyDuration, obs.Duration.Milliseconds(),
+			"command", obs.Command, "statement", obs.Statement, "params", obs.Params, "rows", obs.Rows,
+			"threshold_ms", threshold.Milliseconds()}
+		if obs.Err != nil {
+			attrs = append(attrs, "error", obs.Err)
+		}
+		logFor("query").Warn("Slow query", attrs...)
+	}
+}
+
+// QueryMetrics 回傳各操作的累計統計，依總耗時由大到小排序
+func QueryMetrics() []QueryMetric {
+	queryStatsMu.Lock()
+	result := make([]QueryMetric, 0, len(queryStats))
+	for _, stat := range queryStats {
+		m := *stat
+		if m.Count > 0 {
+			m.AvgMs = m.TotalMs / float64(m.Count)
+		}
+		result = append(result, m)
+	}
+	queryStatsMu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TotalMs != result[j].TotalMs {
+			return result[i].TotalMs > result[j].TotalMs
+		}
+		return result[i].Operation+result[i].Command < result[j].Operation+result[j].Command
+	})
+	return result
+}
+
+// StartMetricsServer 在 addr 上提供 Prometheus 文字格式的 /metrics；addr 為空字串時不啟動
+func StartMetricsServer(addr string) error {
+	if addr == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s for metrics: %w", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	metricsServerMu.Lock()
+	previous := metricsServer
+	metricsServer = server
+	metricsServerMu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logFor("metrics").Error("Metrics server stopped", "error", err)
+		}
+	}()
+	logFor("metrics").Info("Serving Prometheus metrics", "address", "http://"+listener.Addr().String()+metricsPath)
+	return nil
+}
+
+// StopMetricsServer 關閉 /metrics 端點
+func StopMetricsServer() {
+	metricsServerMu.Lock()
+	server := metricsServer
+	metricsServer = nil
+	metricsServerMu.Unlock()
+	if server != nil {
+		server.Close()
+	}
+}
+
+// unobservedKey 標記背景工作的 context
+type unobservedKey struct{}
+
+// unobserved 回傳背景工作（例如變更通知）使用的 context，其中的資料庫呼叫不列入查詢統計也不建立 span
+func unobserved(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unobservedKey{}, true)
+}
+
+// isUnobserved ctx 是否來自 unobserved
+func isUnobserved(ctx context.Context) bool {
+	return ctx != nil && ctx.Value(unobservedKey{}) != nil
+}
+
+// operationKey 標記資料庫呼叫所屬的 Database 方法
+type operationKey struct{}
+
+// withOperation 回傳帶有操作名稱的 context，其中的資料庫呼叫以 operation 統計並歸入 Database.<operation> span；
+// ctx 已帶有操作名稱時（Database 方法呼叫另一個 Database 方法）保留外層的名稱
+func withOperation(ctx context.Context, operation string) context.Context {
+	if operationFrom(ctx) != "" {
+		return ctx
+	}
+	return context.WithValue(ctx, operationKey{}, operation)
+}
+
+// operationFrom ctx 中的操作名稱（見 withOperation），沒有時回傳空字串
+func operationFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	operation, _ := ctx.Value(operationKey{}).(string)
+	return operation
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// minRedactLength 短於此長度的密碼不做字面比對遮罩，避免把日誌中常見的字串也遮掉
+const minRedactLength = 4
+
+var (
+	// 連線字串中的密碼：URL 的 user:password@、key=value 形式的 password=
+	urlPasswordPattern = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://[^:/@\s]*:)[^@\s]*@`)
+	keyPasswordPattern = regexp.MustCompile(`(?i)\b(password|passwd|pwd|sslpassword)=('[^']*'|[^\s&;]+)`)
+
+	knownSecretsMu sync.RWMutex
+	knownSecrets   = map[string]struct{}{}
+)
+
+// registerSecret 記錄目前使用中的密碼，之後寫入日誌或回傳給前端的訊息中出現時會被遮罩
+func registerSecret(secret string) {
+	if len(secret) < minRedactLength {
+		return
+	}
+	knownSecretsMu.Lock()
+	knownSecrets[secret] = struct{}{}
+	knownSecretsMu.Unlock()
+}
+
+// redactSecrets 遮罩訊息中的連線密碼
+func redactSecrets(s string) string {
+	// 先以字面比對遮罩已知的密碼，密碼含 @ 等字元時下方的模式才不會只遮到一半
+	knownSecretsMu.RLock()
+	for secret := range knownSecrets {
+		s = strings.ReplaceAll(s, secret, maskedSecret)
+	}
+	knownSecretsMu.RUnlock()
+
+	s = urlPasswordPattern.ReplaceAllString(s, "${1}"+maskedSecret+"@")
+	s = keyPasswordPattern.ReplaceAllString(s, "${1}="+maskedSecret)
+	return s
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestRedactSecrets(t *testing.T) {
+	registerSecret("p@ss:w0rd!")
+	registerSecret("abc")
+	t.Cleanup(func() {
+		knownSecretsMu.Lock()
+		delete(knownSecrets, "p@ss:w0rd!")
+		knownSecretsMu.Unlock()
+	})
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"url", "dial postgres://app:s3cr3t@db:5432/users failed", "dial postgres://app:***@db:5432/users failed"},
+		{"url without password", "dial postgres://db:5432/users failed", "dial postgres://db:5432/users failed"},
+		{"key value", "host=db user=app password=s3cr3t dbname=users", "host=db user=app password=*** dbname=users"},
+		{"quoted key value", "host=db password='two words' sslmode=require", "host=db password=*** sslmode=require"},
+		{"query parameter", "opening db?user=app&PWD=s3cr3t&tls=true", "opening db?user=app&PWD=***&tls=true"},
+		{"known secret", "authentication failed for p@ss:w0rd!", "authentication failed for ***"},
+		{"short secret is left alone", "row abc not found", "row abc not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactSecrets(tt.in); got != tt.want {
+				t.Fatalf("redactSecrets(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
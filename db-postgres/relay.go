@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// relayUsage relay 子命令的說明
+const relayUsage = `Usage: <app> [config flags] relay
+
+Publishes the user events written to user_outbox (DB_OUTBOX=true) to the broker
+set by RELAY_BROKER until interrupted, instead of opening the window. An event
+is marked published only after the broker confirms it, so consumers receive
+every event at least once and should drop duplicates by eventId. The window and
+the serve command also run the relay when RELAY_BROKER is not none.`
+
+// relay 的輪詢設定
+const (
+	relayBatchSize      = 100
+	relayClaimTTL       = time.Minute // 領取事件的租約，執行個體中斷後由其他執行個體在租約過期後接手
+	relayRetryBaseDelay = time.Second
+	relayPurgeInterval  = 10 * time.Minute
+)
+
+// outboxRow user_outbox 中一筆尚未發送的事件
+type outboxRow struct {
+	id        int64
+	eventID   string
+	eventType string
+	payload   string
+	attempts  int
+	due       bool // 已到可以（重新）發送的時間
+}
+
+// outboxRelay relay 的狀態
+type outboxRelay struct {
+	opts      RelayOptions
+	publisher Publisher
+	d         *Database
+	db        *sql.DB
+	lastPurge time.Time
+	failing   bool
+}
+
+// StartRelay 在背景執行 RunRelay 直到 ctx 結束；RELAY_BROKER=none 時不啟動
+func StartRelay(ctx context.Context) {
+	opts := appConfig().relayOptions()
+	if opts.Broker == RelayBrokerNone {
+		return
+	}
+	go func() {
+		if err := RunRelay(ctx, opts); err != nil {
+			logFor("relay").Error("Relay stopped", "error", err)
+		}
+	}()
+}
+
+// RunRelay 依 id 順序將 user_outbox 中尚未發送的事件送到訊息代理，直到 ctx 結束。
+// 代理確認後才標記為已發送；發送失敗的事件以指數退避重試，重試前不發送其後的事件以維持順序
+func RunRelay(ctx context.Context, opts RelayOptions) error {
+	publisher, err := newPublisher(opts)
+	if err != nil {
+		return err
+	}
+	r := &outboxRelay{opts: opts, publisher: publisher}
+	defer r.close()
+	defer publisher.Close()
+	ctx = unobserved(ctx)
+	if !appConfig().Outbox {
+		logFor("relay").Warn("DB_OUTBOX is disabled; only events already in user_outbox will be published")
+	}
+	logFor("relay").Info("Relaying user events", "broker", opts.Broker, "target", relayTarget(opts))
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+		more, err := r.relayBatch(ctx)
+		if err == nil {
+			err = r.purge(ctx)
+		}
+		switch {
+		case err != nil && ctx.Err() == nil:
+			r.close()
+			if !r.failing {
+				r.failing = true
+				logFor("relay").Warn("Failed to read user_outbox", "error", err)
+			}
+		case err == nil && r.failing:
+			r.failing = false
+			logFor("relay").Info("Reading user_outbox resumed")
+		}
+
+		if more {
+			timer.Reset(0)
+		} else {
+			timer.Reset(opts.PollInterval)
+		}
+	}
+}
+
+// relayBatch 依序發送一批到期的事件，回傳是否可能還有待發送的事件
+func (r *outboxRelay) relayBatch(ctx context.Context) (bool, error) {
+	d := currentDatabase()
+	if d == nil {
+		return false, nil
+	}
+	if d != r.d {
+		r.close()
+		r.d = d
+	}
+	if r.db == nil {
+		db, err := d.OpenDB()
+		if err != nil {
+			return false, err
+		}
+		r.db = db
+	}
+
+	batch, err := r.pending(ctx, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	for _, row := range batch {
+		if !row.due {
+			return false, nil
+		}
+		claimed, err := r.claim(ctx, row.id)
+		if err != nil || !claimed {
+			// 其他執行個體正在發送這筆事件，等它完成後再繼續
+			return false, err
+		}
+
+		publishCtx, cancel := context.WithTimeout(ctx, relayPublishTimeout)
+		err = r.publisher.Publish(publishCtx, OutboxMessage{EventID: row.eventID, Type: row.eventType, Payload: []byte(row.payload)})
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return false, nil
+			}
+			return false, r.retryLater(ctx, row, err)
+		}
+		if err := r.markPublished(ctx, row.id); err != nil {
+			// 事件已送出但未標記，之後會再送一次
+			return false, err
+		}
+	}
+	return len(batch) == relayBatchSize, nil
+}
+
+// pending 讀取最前面的一批尚未發送的事件
+func (r *outboxRelay) pending(ctx context.Context, now time.Time) ([]outboxRow, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, event_id, event_type, payload, attempts,
+		CASE WHEN next_attempt_at IS NULL OR next_attempt_at <= `+placeholder(1)+` THEN 1 ELSE 0 END
+		FROM user_outbox WHERE published_at IS NULL ORDER BY id LIMIT `+placeholder(2), timeArg(now), relayBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var batch []outboxRow
+	for rows.Next() {
+		var row outboxRow
+		var due int
+		if err := rows.Scan(&row.id, &row.eventID, &row.eventType, &row.payload, &row.attempts, &due); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		row.due = due == 1
+		batch = append(batch, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read outbox events: %w", err)
+	}
+	return batch, nil
+}
+
+// claim 領取一筆事件，租約期間其他執行個體不會發送；事件已發送或由其他執行個體持有時回傳 false
+func (r *outboxRelay) claim(ctx context.Context, id int64) (bool, error) {
+	now := time.Now().UTC()
+	result, err := r.db.ExecContext(ctx, fmt.Sprintf(`UPDATE user_outbox SET claimed_by = %s, claimed_until = %s
+		WHERE id = %s AND published_at IS NULL AND (claimed_until IS NULL OR claimed_until < %s OR claimed_by = %s)`,
+		placeholder(1), placeholder(2), placeholder(3), placeholder(4), placeholder(5)),
+		migrationLockOwner, timeArg(now.Add(relayClaimTTL)), id, timeArg(now), migrationLockOwner)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim outbox event: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim outbox event: %w", err)
+	}
+	return n == 1, nil
+}
+
+// markPublished 標記事件已發送並釋放租約
+func (r *outboxRelay) markPublished(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, fmt.Sprintf(`UPDATE user_outbox SET published_at = %s, attempts = attempts + 1,
+		last_error = NULL, claimed_by = NULL, claimed_until = NULL WHERE id = %s`, placeholder(1), placeholder(2)),
+		timeArg(time.Now().UTC()), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox event published: %w", err)
+	}
+	return nil
+}
+
+// retryLater 記錄發送失敗，依嘗試次數決定下次發送的時間並釋放租約
+func (r *outboxRelay) retryLater(ctx context.Context, row outboxRow, publishErr error) error {
+	attempts := row.attempts + 1
+	delay := relayRetryDelay(attempts, r.opts.RetryMaxDelay)
+	logFor("relay").Warn("Failed to publish user event", "event_id", row.eventID, "type", row.eventType,
+		"attempts", attempts, "retry_in", delay, "error", publishErr)
+
+	_, err := r.db.ExecContext(ctx, fmt.Sprintf(`UPDATE user_outbox SET attempts = %s, last_error = %s, next_attempt_at = %s,
+		claimed_by = NULL, claimed_until = NULL WHERE id = %s`, placeholder(1), placeholder(2), placeholder(3), placeholder(4)),
+		attempts, publishErr.Error(), timeArg(time.Now().UTC().Add(delay)), row.id)
+	if err != nil {
+		return fmt.Errorf("failed to record outbox publish failure: %w", err)
+	}
+	return nil
+}
+
+// relayRetryDelay 第 attempts 次失敗後的等待時間：1s、2s、4s…，最長 maxDelay
+func relayRetryDelay(attempts int, maxDelay time.Duration) time.Duration {
+	delay := relayRetryBaseDelay
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// purge 每 relayPurgeInterval 刪除一次超過 RELAY_RETENTION 的已發送事件
+func (r *outboxRelay) purge(ctx context.Context) error {
+	if r.db == nil || time.Since(r.lastPurge) < relayPurgeInterval {
+		return nil
+	}
+	result, err := r.db.ExecContext(ctx, `DELETE FROM user_outbox WHERE published_at IS NOT NULL AND published_at < `+placeholder(1),
+		timeArg(time.Now().UTC().Add(-r.opts.Retention)))
+	if err != nil {
+		return fmt.Errorf("failed to purge published outbox events: %w", err)
+	}
+	r.lastPurge = time.Now()
+	if n, _ := result.RowsAffected(); n > 0 {
+		logFor("relay").Info("Purged published outbox events", "count", n, "retention", r.opts.Retention)
+	}
+	return nil
+}
+
+// close 關閉 relay 使用的連線；下次輪詢時重新開啟
+func (r *outboxRelay) close() {
+	if r.db != nil {
+		r.db.Close()
+		r.db = nil
+	}
+}
+
+// runRelayCommand 處理 `relay` 子命令：發送 user_outbox 的事件直到收到 SIGINT / SIGTERM，回傳程式結束代碼
+func runRelayCommand(args []string) int {
+	for _, arg := range args {
+		if arg == "-h" || arg == "--help" || arg == "help" {
+			fmt.Println(relayUsage)
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "unexpected argument %q\n\n%s\n", arg, relayUsage)
+		return 2
+	}
+
+	opts := appConfig().relayOptions()
+	if opts.Broker == RelayBrokerNone {
+		fmt.Fprintln(os.Stderr, "RELAY_BROKER must be amqp, mqtt or file to run the relay")
+		return 2
+	}
+
+	// 先連線並套用遷移，與桌面版啟動時相同
+	_ = GetDBInstance()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := RunRelay(ctx, opts); err != nil {
+		logFor("relay").Error("Relay stopped", "error", err)
+		return 1
+	}
+	logFor("relay").Info("Relay stopped")
+	return 0
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// Schema 差異的種類；missing 表示遷移後應該存在但實際資料庫沒有，extra 則相反
+const (
+	SchemaMissingTable  = "missing_table"
+	SchemaExtraTable    = "extra_table"
+	SchemaMissingColumn = "missing_column"
+	SchemaExtraColumn   = "extra_column"
+	SchemaColumnChanged = "column_changed"
+	SchemaMissingIndex  = "missing_index"
+	SchemaExtraIndex    = "extra_index"
+	SchemaIndexChanged  = "index_changed"
+)
+
+// schemaCheckIgnoredTables 工具自己使用的資料表，不列入比對
+var schemaCheckIgnoredTables = map[string]bool{
+	"schema_migrations":     true,
+	"schema_migration_lock": true,
+}
+
+// SchemaDifference 一項 schema 差異；Field 只在 column_changed / index_changed 時指出不同的屬性
+type SchemaDifference struct {
+	Kind     string `json:"kind"`
+	Table    string `json:"table"`
+	Name     string `json:"name,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+// SchemaReport 實際 schema 與「在暫存資料庫套用遷移到相同版本」後的 schema 比對結果
+type SchemaReport struct {
+	CurrentVersion uint               `json:"currentVersion"`
+	LatestVersion  uint               `json:"latestVersion"`
+	Dirty          bool               `json:"dirty"`
+	Scratch        string             `json:"scratch"`
+	InSync         bool               `json:"inSync"`
+	Differences    []SchemaDifference `json:"differences"`
+	CheckedAt      string             `json:"checkedAt"`
+}
+
+// schemaColumn 欄位定義
+type schemaColumn struct {
+	Name     string
+	Type     string
+	Nullable bool
+	Default  string
+}
+
+// schemaIndex 索引定義
+type schemaIndex struct {
+	Name    string
+	Columns []string
+	Unique  bool
+}
+
+// schemaTable 資料表的欄位與索引
+type schemaTable struct {
+	Columns []schemaColumn
+	Indexes map[string]schemaIndex
+}
+
+// schemaSnapshot 以資料表名稱為 key 的 schema 快照
+type schemaSnapshot map[string]*schemaTable
+
+// table 取得資料表，不存在時建立
+func (s schemaSnapshot) table(name string) *schemaTable {
+	t, ok := s[name]
+	if !ok {
+		t = &schemaTable{Indexes: map[string]schemaIndex{}}
+		s[name] = t
+	}
+	return t
+}
+
+// addIndexColumn 依序加入索引欄位（查詢結果一列一個欄位）
+func (s schemaSnapshot) addIndexColumn(table, index, column string, unique bool) {
+	t := s.table(table)
+	idx := t.Indexes[index]
+	idx.Name = index
+	idx.Unique = unique
+	idx.Columns = append(idx.Columns, column)
+	t.Indexes[index] = idx
+}
+
+func (c schemaColumn) describe() string {
+	desc := c.Type
+	if !c.Nullable {
+		desc += " NOT NULL"
+	}
+	if c.Default != "" {
+		desc += " DEFAULT " + c.Default
+	}
+	return desc
+}
+
+func (i schemaIndex) describe() string {
+	desc := "(" + strings.Join(i.Columns, ", ") + ")"
+	if i.Unique {
+		desc = "UNIQUE " + desc
+	}
+	return desc
+}
+
+// randomSuffix 產生暫存資料庫名稱使用的隨機字串
+func randomSuffix() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// CheckSchema 在暫存資料庫套用遷移到目前版本，再與實際資料庫的資料表、欄位、型別與索引比對
+func (d *Database) CheckSchema() (*SchemaReport, error) {
+	ctx := withOperation(context.Background(), "CheckSchema")
+	set, err := openMigrationSet()
+	if err != nil {
+		return nil, err
+	}
+	latest := set.latest()
+	set.close()
+
+	m, err := d.newMigrate()
+	if err != nil {
+		return nil, err
+	}
+	current, dirty, err := currentMigrationVersion(m)
+	m.Close()
+	if err != nil {
+		return nil, err
+	}
+	if current > latest {
+		return nil, fmt.Errorf("database version %d is newer than the latest migration %d", current, latest)
+	}
+
+	db, err := d.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	actual, err := readSchema(ctx, db)
+	db.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database schema: %w", err)
+	}
+
+	scratch, description, cleanup, err := d.newScratchDatabase(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scratch database: %w", err)
+	}
+	defer cleanup()
+
+	if current > 0 {
+		sm, err := scratch.newMigrate()
+		if err != nil {
+			return nil, err
+		}
+		err = sm.Migrate(current)
+		sm.Close()
+		if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return nil, fmt.Errorf("failed to migrate scratch database to version %d: %w", current, err)
+		}
+	}
+
+	sdb, err := scratch.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	expected, err := readSchema(ctx, sdb)
+	sdb.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scratch schema: %w", err)
+	}
+
+	report := &SchemaReport{
+		CurrentVersion: current,
+		LatestVersion:  latest,
+		Dirty:          dirty,
+		Scratch:        description,
+		Differences:    diffSchemas(expected, actual),
+		CheckedAt:      time.Now().Format(time.RFC3339),
+	}
+	report.InSync = len(report.Differences) == 0
+
+	logFor("schema").Info("Schema check finished", "version", current, "differences", len(report.Differences))
+	for _, diff := range report.Differences {
+		logFor("schema").Info("Schema difference",
+			"kind", diff.Kind, "table", diff.Table, "name", diff.Name, "field", diff.Field, "expected", diff.Expected, "actual", diff.Actual)
+	}
+	return report, nil
+}
+
+// diffSchemas 比對預期與實際的 schema，依資料表名稱排序輸出
+func diffSchemas(expected, actual schemaSnapshot) []SchemaDifference {
+	diffs := []SchemaDifference{}
+
+	names := map[string]bool{}
+	for name := range expected {
+		names[name] = true
+	}
+	for name := range actual {
+		names[name] = true
+	}
+	tables := make([]string, 0, len(names))
+	for name := range names {
+		if !schemaCheckIgnoredTables[name] {
+			tables = append(tables, name)
+		}
+	}
+	sort.Strings(tables)
+
+	for _, name := range tables {
+		exp, act := expected[name], actual[name]
+		switch {
+		case act == nil:
+			diffs = append(diffs, SchemaDifference{Kind: SchemaMissingTable, Table: name})
+			continue
+		case exp == nil:
+			diffs = append(diffs, SchemaDifference{Kind: SchemaExtraTable, Table: name})
+			continue
+		}
+		diffs = append(diffs, diffColumns(name, exp.Columns, act.Columns)...)
+		diffs = append(diffs, diffIndexes(name, exp.Indexes, act.Indexes)...)
+	}
+	return diffs
+}
+
+// diffColumns 比對欄位；欄位順序不同不視為差異
+func diffColumns(table string, expected, actual []schemaColumn) []SchemaDifference {
+	var diffs []SchemaDifference
+	actualByName := map[string]schemaColumn{}
+	for _, c := range actual {
+		actualByName[c.Name] = c
+	}
+
+	seen := map[string]bool{}
+	for _, exp := range expected {
+		seen[exp.Name] = true
+		act, ok := actualByName[exp.Name]
+		if !ok {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaMissingColumn, Table: table, Name: exp.Name, Expected: exp.describe()})
+			continue
+		}
+		if exp.Type != act.Type {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaColumnChanged, Table: table, Name: exp.Name, Field: "type", Expected: exp.Type, Actual: act.Type})
+		}
+		if exp.Nullable != act.Nullable {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaColumnChanged, Table: table, Name: exp.Name, Field: "nullable",
+				Expected: fmt.Sprint(exp.Nullable), Actual: fmt.Sprint(act.Nullable)})
+		}
+		if exp.Default != act.Default {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaColumnChanged, Table: table, Name: exp.Name, Field: "default", Expected: exp.Default, Actual: act.Default})
+		}
+	}
+	for _, act := range actual {
+		if !seen[act.Name] {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaExtraColumn, Table: table, Name: act.Name, Actual: act.describe()})
+		}
+	}
+	return diffs
+}
+
+// diffIndexes 以索引名稱比對欄位與唯一性
+func diffIndexes(table string, expected, actual map[string]schemaIndex) []SchemaDifference {
+	var diffs []SchemaDifference
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		exp := expected[name]
+		act, ok := actual[name]
+		if !ok {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaMissingIndex, Table: table, Name: name, Expected: exp.describe()})
+			continue
+		}
+		if strings.Join(exp.Columns, ",") != strings.Join(act.Columns, ",") {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaIndexChanged, Table: table, Name: name, Field: "columns",
+				Expected: strings.Join(exp.Columns, ", "), Actual: strings.Join(act.Columns, ", ")})
+		}
+		if exp.Unique != act.Unique {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaIndexChanged, Table: table, Name: name, Field: "unique",
+				Expected: fmt.Sprint(exp.Unique), Actual: fmt.Sprint(act.Unique)})
+		}
+	}
+
+	extra := make([]string, 0)
+	for name := range actual {
+		if _, ok := expected[name]; !ok {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		diffs = append(diffs, SchemaDifference{Kind: SchemaExtraIndex, Table: table, Name: name, Actual: actual[name].describe()})
+	}
+	return diffs
+}
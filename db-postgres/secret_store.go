@@ -0,0 +1,407 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/term"
+)
+
+// secretRefPrefix 設定值以此開頭時視為密碼庫中的機密名稱，例如 DB_PASSWORD=secret://prod-mysql
+const secretRefPrefix = "secret://"
+
+// 內建的密碼後端
+const (
+	SecretBackendFile    = "file"    // 以密語加密的本機檔案（APP_SECRET_FILE）
+	SecretBackendKeyring = "keyring" // 作業系統金鑰圈（macOS Keychain、Windows Credential Manager、Secret Service）
+)
+
+// secretKeyringService 存入作業系統金鑰圈時使用的服務名稱
+const secretKeyringService = "example-db"
+
+// 加密檔案的格式版本與 Argon2id 參數
+const (
+	secretFileVersion = 1
+	secretKDFArgon2id = "argon2id"
+	secretKDFTime     = 3
+	secretKDFMemory   = 64 * 1024 // KiB
+	secretKDFThreads  = 4
+	secretKeyLength   = 32 // AES-256
+	secretSaltLength  = 16
+	secretMaxMemory   = 1024 * 1024 // 讀取檔案時接受的最大記憶體參數（KiB），避免被竄改的檔案耗盡記憶體
+)
+
+// ErrSecretNotFound 密碼庫中沒有指定名稱的機密
+var ErrSecretNotFound = errors.New("secret not found")
+
+// secretNamePattern 機密名稱只允許英數字與 . _ -
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// SecretProvider 密碼後端，依名稱讀寫機密值
+type SecretProvider interface {
+	Get(name string) (string, error)
+	Set(name, value string) error
+	Delete(name string) error
+	List() ([]string, error)
+}
+
+// SecretBackendFactory 依設定建立密碼後端
+type SecretBackendFactory func(cfg *Config) (SecretProvider, error)
+
+var (
+	secretBackendsMu sync.RWMutex
+	secretBackends   = map[string]SecretBackendFactory{
+		SecretBackendFile:    newFileSecretStore,
+		SecretBackendKeyring: newKeyringSecretStore,
+	}
+
+	secretProviderMu sync.Mutex
+	secretProvider   SecretProvider
+)
+
+// RegisterSecretBackend 註冊密碼後端，之後可以 APP_SECRET_BACKEND=name 選用（例如雲端的密碼管理服務）
+func RegisterSecretBackend(name string, factory SecretBackendFactory) {
+	secretBackendsMu.Lock()
+	secretBackends[name] = factory
+	secretBackendsMu.Unlock()
+}
+
+// secretBackendRegistered 判斷密碼後端是否已註冊
+func secretBackendRegistered(name string) bool {
+	secretBackendsMu.RLock()
+	defer secretBackendsMu.RUnlock()
+	_, ok := secretBackends[name]
+	return ok
+}
+
+// openSecretProvider 依設定開啟密碼後端；同一個執行期間只開啟一次，密語也只詢問一次
+func openSecretProvider(cfg *Config) (SecretProvider, error) {
+	secretProviderMu.Lock()
+	defer secretProviderMu.Unlock()
+	if secretProvider != nil {
+		return secretProvider, nil
+	}
+
+	secretBackendsMu.RLock()
+	factory, ok := secretBackends[cfg.SecretBackend]
+	secretBackendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown secret backend %q", cfg.SecretBackend)
+	}
+	provider, err := factory(cfg)
+	if err != nil {
+		return nil, err
+	}
+	secretProvider = provider
+	return provider, nil
+}
+
+// isSecretRef 判斷設定值是否為 secret:// 參照
+func isSecretRef(value string) bool {
+	return strings.HasPrefix(value, secretRefPrefix)
+}
+
+// resolveSecretRef 解析 secret://名稱 參照，其他值原樣回傳
+func resolveSecretRef(cfg *Config, value string) (string, error) {
+	if !isSecretRef(value) {
+		return value, nil
+	}
+	provider, err := openSecretProvider(cfg)
+	if err != nil {
+		return "", err
+	}
+	return provider.Get(strings.TrimPrefix(value, secretRefPrefix))
+}
+
+// validateSecretName 檢查機密名稱
+func validateSecretName(name string) error {
+	if !secretNamePattern.MatchString(name) {
+		return newValidationError("name", fmt.Sprintf("invalid secret name %q (use letters, digits, '.', '_' and '-')", name))
+	}
+	return nil
+}
+
+// region <-- 加密檔案後端 -->
+
+// fileSecretStore 以密語加密的本機密碼檔：金鑰以 Argon2id 由密語導出，內容以 AES-256-GCM 加密，
+// 每次寫入都使用新的 salt 與 nonce
+type fileSecretStore struct {
+	mu         sync.Mutex
+	path       string
+	passphrase []byte
+}
+
+// secretFile 加密檔案的內容；[]byte 欄位以 base64 儲存
+type secretFile struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// newFileSecretStore 建立加密檔案後端；未設定 APP_SECRET_PASSPHRASE 時在終端機上詢問密語
+func newFileSecretStore(cfg *Config) (SecretProvider, error) {
+	passphrase := cfg.SecretPassphrase
+	if passphrase == "" {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, fmt.Errorf("APP_SECRET_PASSPHRASE is required to open the secret store %s", cfg.SecretFile)
+		}
+		fmt.Fprintf(os.Stderr, "Passphrase for %s: ", cfg.SecretFile)
+		input, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		passphrase = string(input)
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("the secret store passphrase must not be empty")
+	}
+	registerSecret(passphrase)
+	return &fileSecretStore{path: cfg.SecretFile, passphrase: []byte(passphrase)}, nil
+}
+
+// load 讀取並解密所有機密；檔案不存在時視為空的密碼庫
+func (s *fileSecretStore) load() (map[string]string, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret store: %w", err)
+	}
+
+	var file secretFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse secret store %s: %w", s.path, err)
+	}
+	if file.Version != secretFileVersion || file.KDF != secretKDFArgon2id {
+		return nil, fmt.Errorf("unsupported secret store format in %s (version %d, kdf %q)", s.path, file.Version, file.KDF)
+	}
+	if file.Time == 0 || file.Threads == 0 || file.Memory == 0 || file.Memory > secretMaxMemory {
+		return nil, fmt.Errorf("invalid key derivation parameters in %s", s.path)
+	}
+
+	gcm, err := s.cipher(file.Salt, file.Time, file.Memory, file.Threads)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce in %s", s.path)
+	}
+	plain, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret store %s: wrong passphrase or corrupted file", s.path)
+	}
+
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("failed to parse decrypted secret store: %w", err)
+	}
+	return secrets, nil
+}
+
+// save 以新的 salt 與 nonce 加密後寫入，先寫入暫存檔再改名，中途失敗不會留下損壞的檔案
+func (s *fileSecretStore) save(secrets map[string]string) error {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return fmt.Errorf("failed to encode secrets: %w", err)
+	}
+
+	file := secretFile{
+		Version: secretFileVersion,
+		KDF:     secretKDFArgon2id,
+		Salt:    make([]byte, secretSaltLength),
+		Time:    secretKDFTime,
+		Memory:  secretKDFMemory,
+		Threads: secretKDFThreads,
+	}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	gcm, err := s.cipher(file.Salt, file.Time, file.Memory, file.Threads)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	file.Data = gcm.Seal(nil, file.Nonce, plain, nil)
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode secret store: %w", err)
+	}
+	if dir := filepath.Dir(s.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return fmt.Errorf("failed to create secret store directory: %w", err)
+		}
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write secret store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace secret store: %w", err)
+	}
+	return nil
+}
+
+// cipher 以密語與 salt 導出金鑰並建立 AES-GCM
+func (s *fileSecretStore) cipher(salt []byte, time, memory uint32, threads uint8) (cipher.AEAD, error) {
+	key := argon2.IDKey(s.passphrase, salt, time, memory, threads, secretKeyLength)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return gcm, nil
+}
+
+// Get 實作 SecretProvider
+func (s *fileSecretStore) Get(name string) (string, error) {
+	if err := validateSecretName(name); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secrets, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	value, ok := secrets[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %q in %s", ErrSecretNotFound, name, s.path)
+	}
+	return value, nil
+}
+
+// Set 實作 SecretProvider
+func (s *fileSecretStore) Set(name, value string) error {
+	if err := validateSecretName(name); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	secrets[name] = value
+	return s.save(secrets)
+}
+
+// Delete 實作 SecretProvider
+func (s *fileSecretStore) Delete(name string) error {
+	if err := validateSecretName(name); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[name]; !ok {
+		return fmt.Errorf("%w: %q in %s", ErrSecretNotFound, name, s.path)
+	}
+	delete(secrets, name)
+	return s.save(secrets)
+}
+
+// List 實作 SecretProvider
+func (s *fileSecretStore) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secrets, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// endregion
+
+// region <-- 作業系統金鑰圈後端 -->
+
+// keyringSecretStore 作業系統金鑰圈；金鑰圈無法列舉項目，List 回傳錯誤
+type keyringSecretStore struct{}
+
+// newKeyringSecretStore 建立金鑰圈後端
+func newKeyringSecretStore(cfg *Config) (SecretProvider, error) {
+	return keyringSecretStore{}, nil
+}
+
+// Get 實作 SecretProvider
+func (keyringSecretStore) Get(name string) (string, error) {
+	if err := validateSecretName(name); err != nil {
+		return "", err
+	}
+	value, err := keyring.Get(secretKeyringService, name)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", fmt.Errorf("%w: %q in the OS keyring", ErrSecretNotFound, name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret from the OS keyring: %w", err)
+	}
+	return value, nil
+}
+
+// Set 實作 SecretProvider
+func (keyringSecretStore) Set(name, value string) error {
+	if err := validateSecretName(name); err != nil {
+		return err
+	}
+	if err := keyring.Set(secretKeyringService, name, value); err != nil {
+		return fmt.Errorf("failed to write secret to the OS keyring: %w", err)
+	}
+	return nil
+}
+
+// Delete 實作 SecretProvider
+func (keyringSecretStore) Delete(name string) error {
+	if err := validateSecretName(name); err != nil {
+		return err
+	}
+	err := keyring.Delete(secretKeyringService, name)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return fmt.Errorf("%w: %q in the OS keyring", ErrSecretNotFound, name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete secret from the OS keyring: %w", err)
+	}
+	return nil
+}
+
+// List 實作 SecretProvider
+func (keyringSecretStore) List() ([]string, error) {
+	return nil, fmt.Errorf("the keyring backend cannot list secrets")
+}
+
+// endregion
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestFileSecretStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "secrets.enc")
+	cfg := &Config{SecretFile: path, SecretPassphrase: "correct horse battery staple"}
+	store, err := newFileSecretStore(cfg)
+	if err != nil {
+		t.Fatalf("newFileSecretStore: %v", err)
+	}
+
+	if names, err := store.List(); err != nil || len(names) != 0 {
+		t.Fatalf("List on a missing file = %v, %v; want an empty store", names, err)
+	}
+	if err := store.Set("prod-db", "s3cr3t-value"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := store.Set("staging.db", "other"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if bytes.Contains(data, []byte("s3cr3t-value")) || bytes.Contains(data, []byte("prod-db")) {
+		t.Fatalf("secret store is not encrypted: %s", data)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("secret store mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+
+	// 以新的實例重新開啟，確認可以解密
+	reopened, err := newFileSecretStore(cfg)
+	if err != nil {
+		t.Fatalf("newFileSecretStore: %v", err)
+	}
+	if value, err := reopened.Get("prod-db"); err != nil || value != "s3cr3t-value" {
+		t.Fatalf("Get = %q, %v; want the stored value", value, err)
+	}
+	if names, err := reopened.List(); err != nil || !reflect.DeepEqual(names, []string{"prod-db", "staging.db"}) {
+		t.Fatalf("List = %v, %v", names, err)
+	}
+
+	if err := reopened.Delete("prod-db"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get("prod-db"); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("Get after Delete: err = %v, want ErrSecretNotFound", err)
+	}
+	if err := store.Delete("prod-db"); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("Delete twice: err = %v, want ErrSecretNotFound", err)
+	}
+
+	wrong, err := newFileSecretStore(&Config{SecretFile: path, SecretPassphrase: "wrong passphrase"})
+	if err != nil {
+		t.Fatalf("newFileSecretStore: %v", err)
+	}
+	if _, err := wrong.Get("staging.db"); err == nil {
+		t.Fatal("Get with the wrong passphrase succeeded")
+	}
+}
+
+func TestSecretNameValidation(t *testing.T) {
+	store, err := newFileSecretStore(&Config{SecretFile: filepath.Join(t.TempDir(), "secrets.enc"), SecretPassphrase: "passphrase"})
+	if err != nil {
+		t.Fatalf("newFileSecretStore: %v", err)
+	}
+	for _, name := range []string{"", "-leading-dash", "has space", "../escape", "slash/name"} {
+		var verr *ValidationError
+		if err := store.Set(name, "value"); !errors.As(err, &verr) {
+			t.Errorf("Set(%q): err = %v, want a ValidationError", name, err)
+		}
+	}
+}
+
+func TestKeyringSecretStoreRoundTrip(t *testing.T) {
+	keyring.MockInit()
+	store, err := newKeyringSecretStore(&Config{})
+	if err != nil {
+		t.Fatalf("newKeyringSecretStore: %v", err)
+	}
+	if err := store.Set("prod-db", "s3cr3t-value"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if value, err := store.Get("prod-db"); err != nil || value != "s3cr3t-value" {
+		t.Fatalf("Get = %q, %v; want the stored value", value, err)
+	}
+	if err := store.Delete("prod-db"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get("prod-db"); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("Get after Delete: err = %v, want ErrSecretNotFound", err)
+	}
+	if _, err := store.List(); err == nil {
+		t.Fatal("List succeeded on the keyring backend")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// GetDeletedUsers 獲取所有已軟刪除的用戶（依刪除時間降序）
+func (d *Database) GetDeletedUsers() ([]map[string]interface{}, error) {
+	ctx := withOperation(context.Background(), "GetDeletedUsers")
+	db, err := d.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, "SELECT * FROM users WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deleted users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []map[string]interface{}{}
+	for rows.Next() {
+		user, err := scanRowMap(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read deleted users: %w", err)
+	}
+
+	return users, nil
+}
+
+// RestoreUser 還原已軟刪除的用戶；email 已被其他未刪除的用戶使用時回傳 ErrDuplicateEmail
+func (d *Database) RestoreUser(id int) error {
+	_, err := d.restoreUser(withOperation(context.Background(), "RestoreUser"), id)
+	return err
+}
+
+// RestoreUserReturning 還原已軟刪除的用戶並回傳還原後的用戶（與還原在同一個交易中讀取）
+func (d *Database) RestoreUserReturning(id int) (map[string]interface{}, error) {
+	return d.restoreUser(withOperation(context.Background(), "RestoreUserReturning"), id)
+}
+
+// restoreUser RestoreUser 與 RestoreUserReturning 共用的實作
+func (d *Database) restoreUser(ctx context.Context, id int) (map[string]interface{}, error) {
+	var user map[string]interface{}
+	err := d.WithTx(ctx, func(tx Repo) error {
+		if err := tx.RestoreUser(id); err != nil {
+			return err
+		}
+		var err error
+		user, err = tx.GetUserByID(id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// PurgeDeleted 永久刪除已軟刪除超過 olderThanDays 天的用戶（0 表示全部），回傳刪除筆數
+func (d *Database) PurgeDeleted(olderThanDays int) (int, error) {
+	if olderThanDays < 0 {
+		return 0, newValidationError("olderThanDays", "must not be negative")
+	}
+
+	query := `SELECT * FROM users WHERE deleted_at IS NOT NULL`
+	var args []interface{}
+	if olderThanDays > 0 {
+		query += ` AND deleted_at < ` + placeholder(1)
+		args = append(args, timeArg(time.Now().AddDate(0, 0, -olderThanDays)))
+	}
+
+	// 交易重試時 fn 會重新執行，因此每次都重新讀取要刪除的用戶
+	ctx := withOperation(context.Background(), "PurgeDeleted")
+	var snapshots []map[string]interface{}
+	err := d.WithTx(ctx, func(repo Repo) error {
+		tx := repo.Tx()
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to query deleted users: %w", err)
+		}
+		snapshots = nil
+		for rows.Next() {
+			snapshot, err := scanRowMap(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			snapshots = append(snapshots, snapshot)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read deleted users: %w", err)
+		}
+
+		actor := d.Actor()
+		for _, snapshot := range snapshots {
+			id, ok := toInt64(snapshot["id"])
+			if !ok {
+				return fmt.Errorf("unexpected user id %v", snapshot["id"])
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = `+placeholder(1), id); err != nil {
+				return fmt.Errorf("failed to purge user %d: %w", id, err)
+			}
+			if err := recordUserChange(ctx, tx, id, AuditActionPurge, snapshot, nil, actor); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	logFor("users").Info("Purged soft-deleted users", "count", len(snapshots))
+	return len(snapshots), nil
+}
+
+// toInt64 將驅動程式回傳的整數欄位（int64 或數字字串）轉換為 int64
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int32:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	case string:
+		var n int64
+		if _, err := fmt.Sscan(v, &n); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
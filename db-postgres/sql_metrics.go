@@ -0,0 +1,468 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 包裝驅動程式的連線、敘述與結果集，讓經過 OpenDB 的每個 SQL 呼叫都送到 observeQuery 並建立 span；
+// 查詢的耗時與筆數算到結果集關閉為止；統計與 span 的操作名稱由 Database 方法以 withOperation 放在 context 中
+
+// sqlCommands 統計中個別列出的敘述種類
+var sqlCommands = map[string]bool{
+	"select": true, "insert": true, "update": true, "delete": true, "replace": true, "with": true,
+	"create": true, "alter": true, "drop": true, "truncate": true, "rename": true,
+	"begin": true, "start": true, "commit": true, "rollback": true, "savepoint": true, "release": true,
+	"set": true, "show": true, "explain": true, "describe": true, "pragma": true, "copy": true,
+	"call": true, "do": true, "lock": true, "unlock": true, "analyze": true, "vacuum": true,
+}
+
+// openInstrumented 以驅動程式與連線字串開啟會記錄統計的 *sql.DB（不會實際連線）
+func openInstrumented(drv driver.Driver, dsn string) (*sql.DB, error) {
+	if dc, ok := drv.(driver.DriverContext); ok {
+		connector, err := dc.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return sql.OpenDB(instrumentConnector(connector)), nil
+	}
+	return sql.OpenDB(instrumentConnector(dsnConnector{drv: drv, dsn: dsn})), nil
+}
+
+// instrumentConnector 包裝 driver.Connector
+func instrumentConnector(c driver.Connector) driver.Connector {
+	return &metricsConnector{Connector: c}
+}
+
+// dsnConnector 讓沒有實作 driver.DriverContext 的驅動程式也能以 Connector 開啟
+type dsnConnector struct {
+	drv driver.Driver
+	dsn string
+}
+
+// Connect 實作 driver.Connector
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.drv.Open(c.dsn) }
+
+// Driver 實作 driver.Connector
+func (c dsnConnector) Driver() driver.Driver { return c.drv }
+
+// metricsConnector 產生包裝過的連線
+type metricsConnector struct {
+	driver.Connector
+}
+
+// Connect 實作 driver.Connector
+func (c *metricsConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &metricsConn{conn: conn}, nil
+}
+
+// region <-- 連線 -->
+
+// metricsConn 記錄 ExecContext / QueryContext，其餘呼叫轉給原本的連線
+type metricsConn struct {
+	conn driver.Conn
+}
+
+// Prepare 實作 driver.Conn
+func (c *metricsConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext 實作 driver.ConnPrepareContext
+func (c *metricsConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &metricsStmt{stmt: stmt, conn: c.conn, query: query}, nil
+}
+
+// Close 實作 driver.Conn
+func (c *metricsConn) Close() error { return c.conn.Close() }
+
+// Unwrap 回傳原本的驅動程式連線，供需要驅動程式專屬 API 的呼叫（例如 SQLite 的 online backup）
+func (c *metricsConn) Unwrap() driver.Conn { return c.conn }
+
+// unwrapDriverConn 取出 sql.Conn.Raw 傳入的連線中原本的驅動程式連線
+func unwrapDriverConn(conn interface{}) interface{} {
+	if c, ok := conn.(*metricsConn); ok {
+		return c.Unwrap()
+	}
+	return conn
+}
+
+// Begin 實作 driver.Conn
+func (c *metricsConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx 實作 driver.ConnBeginTx
+func (c *metricsConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) || opts.ReadOnly {
+		return nil, errors.New("driver does not support non-default transaction options")
+	}
+	return c.conn.Begin() // 驅動程式沒有 BeginTx 時的後備
+}
+
+// ExecContext 實作 driver.ExecerContext；驅動程式不支援時回傳 driver.ErrSkip，改由 Prepare 執行
+func (c *metricsConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	call := beginSQLCall(ctx, query, len(args))
+	result, err := execer.ExecContext(ctx, query, args)
+	if errors.Is(err, driver.ErrSkip) {
+		return result, err
+	}
+	call.traced(ctx).finishExec(result, err)
+	return result, err
+}
+
+// QueryContext 實作 driver.QueryerContext；驅動程式不支援時回傳 driver.ErrSkip，改由 Prepare 執行
+func (c *metricsConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	call := beginSQLCall(ctx, query, len(args))
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if errors.Is(err, driver.ErrSkip) {
+		return rows, err
+	}
+	return wrapRows(rows, call.traced(ctx), err)
+}
+
+// Ping 實作 driver.Pinger
+func (c *metricsConn) Ping(ctx context.Context) error {
+	if p, ok := c.conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// ResetSession 實作 driver.SessionResetter
+func (c *metricsConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// IsValid 實作 driver.Validator
+func (c *metricsConn) IsValid() bool {
+	if v, ok := c.conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// CheckNamedValue 實作 driver.NamedValueChecker，讓驅動程式自訂的參數型別照常轉換
+func (c *metricsConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// endregion
+
+// region <-- 敘述 -->
+
+// metricsStmt 記錄預備敘述的執行
+type metricsStmt struct {
+	stmt  driver.Stmt
+	conn  driver.Conn
+	query string
+}
+
+// Close 實作 driver.Stmt
+func (s *metricsStmt) Close() error { return s.stmt.Close() }
+
+// NumInput 實作 driver.Stmt
+func (s *metricsStmt) NumInput() int { return s.stmt.NumInput() }
+
+// Exec 實作 driver.Stmt
+func (s *metricsStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+// Query 實作 driver.Stmt
+func (s *metricsStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+// ExecContext 實作 driver.StmtExecContext
+func (s *metricsStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	call := beginSQLCall(ctx, s.query, len(args))
+	var result driver.Result
+	var err error
+	if e, ok := s.stmt.(driver.StmtExecContext); ok {
+		result, err = e.ExecContext(ctx, args)
+	} else {
+		result, err = s.stmt.Exec(plainValues(args)) // 驅動程式沒有 ExecContext 時的後備
+	}
+	call.traced(ctx).finishExec(result, err)
+	return result, err
+}
+
+// QueryContext 實作 driver.StmtQueryContext
+func (s *metricsStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	call := beginSQLCall(ctx, s.query, len(args))
+	var rows driver.Rows
+	var err error
+	if q, ok := s.stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else {
+		rows, err = s.stmt.Query(plainValues(args)) // 驅動程式沒有 QueryContext 時的後備
+	}
+	return wrapRows(rows, call.traced(ctx), err)
+}
+
+// CheckNamedValue 實作 driver.NamedValueChecker：依序交給敘述、連線與敘述的 ColumnConverter 檢查
+func (s *metricsStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := s.stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	if checker, ok := s.conn.(driver.NamedValueChecker); ok {
+		if err := checker.CheckNamedValue(nv); !errors.Is(err, driver.ErrSkip) {
+			return err
+		}
+	}
+	if cc, ok := s.stmt.(driver.ColumnConverter); ok && nv.Ordinal > 0 { // 舊驅動程式的參數轉換
+		if _, isValuer := nv.Value.(driver.Valuer); !isValuer {
+			value, err := cc.ColumnConverter(nv.Ordinal - 1).ConvertValue(nv.Value)
+			if err != nil {
+				return err
+			}
+			nv.Value = value
+			return nil
+		}
+	}
+	return driver.ErrSkip
+}
+
+// endregion
+
+// region <-- 結果集 -->
+
+// metricsRows 計算讀取的筆數，關閉時記錄
+type metricsRows struct {
+	rows   driver.Rows
+	call   sqlCall
+	count  int64
+	err    error
+	closed bool
+}
+
+// wrapRows 查詢失敗時直接記錄，成功時包裝結果集
+func wrapRows(rows driver.Rows, call sqlCall, err error) (driver.Rows, error) {
+	if err != nil {
+		call.finish(0, err)
+		return nil, err
+	}
+	return &metricsRows{rows: rows, call: call}, nil
+}
+
+// Columns 實作 driver.Rows
+func (r *metricsRows) Columns() []string { return r.rows.Columns() }
+
+// Next 實作 driver.Rows
+func (r *metricsRows) Next(dest []driver.Value) error {
+	err := r.rows.Next(dest)
+	switch {
+	case err == nil:
+		r.count++
+	case !errors.Is(err, io.EOF):
+		r.err = err
+	}
+	return err
+}
+
+// Close 實作 driver.Rows
+func (r *metricsRows) Close() error {
+	err := r.rows.Close()
+	if !r.closed {
+		r.closed = true
+		r.call.finish(r.count, r.err)
+	}
+	return err
+}
+
+// HasNextResultSet 實作 driver.RowsNextResultSet
+func (r *metricsRows) HasNextResultSet() bool {
+	if n, ok := r.rows.(driver.RowsNextResultSet); ok {
+		return n.HasNextResultSet()
+	}
+	return false
+}
+
+// NextResultSet 實作 driver.RowsNextResultSet
+func (r *metricsRows) NextResultSet() error {
+	if n, ok := r.rows.(driver.RowsNextResultSet); ok {
+		return n.NextResultSet()
+	}
+	return io.EOF
+}
+
+// ColumnTypeScanType 實作 driver.RowsColumnTypeScanType
+func (r *metricsRows) ColumnTypeScanType(index int) reflect.Type {
+	if t, ok := r.rows.(driver.RowsColumnTypeScanType); ok {
+		return t.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(any)).Elem()
+}
+
+// ColumnTypeDatabaseTypeName 實作 driver.RowsColumnTypeDatabaseTypeName
+func (r *metricsRows) ColumnTypeDatabaseTypeName(index int) string {
+	if t, ok := r.rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return t.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+// ColumnTypeLength 實作 driver.RowsColumnTypeLength
+func (r *metricsRows) ColumnTypeLength(index int) (int64, bool) {
+	if t, ok := r.rows.(driver.RowsColumnTypeLength); ok {
+		return t.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+// ColumnTypeNullable 實作 driver.RowsColumnTypeNullable
+func (r *metricsRows) ColumnTypeNullable(index int) (bool, bool) {
+	if t, ok := r.rows.(driver.RowsColumnTypeNullable); ok {
+		return t.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+// ColumnTypePrecisionScale 實作 driver.RowsColumnTypePrecisionScale
+func (r *metricsRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if t, ok := r.rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return t.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
+
+// endregion
+
+// sqlCall 一次執行中的 SQL 呼叫
+type sqlCall struct {
+	operation string
+	command   string
+	statement string
+	params    int
+	start     time.Time
+	span      querySpan
+	skip      bool // 背景工作的呼叫（見 unobserved）
+}
+
+// beginSQLCall 開始一次 SQL 呼叫，操作名稱取自 ctx（見 withOperation）
+func beginSQLCall(ctx context.Context, query string, params int) sqlCall {
+	return sqlCall{operation: operationFrom(ctx), command: statementCommand(query), statement: redactStatement(query),
+		params: params, start: time.Now()}
+}
+
+// traced 在驅動程式回應後建立 span（起點為呼叫開始的時間）；回傳 driver.ErrSkip 的呼叫會由 database/sql 改以預備敘述重新執行，不建立 span
+func (c sqlCall) traced(ctx context.Context) sqlCall {
+	if isUnobserved(ctx) {
+		c.skip = true
+		return c
+	}
+	c.span = startQuerySpan(ctx, c.start, c.operation, c.command, c.statement)
+	return c
+}
+
+// finish 結束 span 並記錄統計
+func (c sqlCall) finish(rows int64, err error) {
+	if c.skip {
+		return
+	}
+	c.span.end(rows, err)
+	observeQuery(queryObservation{Operation: c.operation, Command: c.command, Statement: c.statement,
+		Params: c.params, Duration: time.Since(c.start), Rows: rows, Err: err})
+}
+
+// finishExec 以 RowsAffected 作為筆數結束 Exec
+func (c sqlCall) finishExec(result driver.Result, err error) {
+	var rows int64
+	if err == nil && result != nil {
+		if n, rerr := result.RowsAffected(); rerr == nil {
+			rows = n
+		}
+	}
+	c.finish(rows, err)
+}
+
+// statementCommand 敘述的第一個關鍵字（小寫），作為統計的命令名稱
+func statementCommand(query string) string {
+	query = strings.TrimLeft(query, " \t\r\n(")
+	for strings.HasPrefix(query, "--") || strings.HasPrefix(query, "/*") {
+		end := "\n"
+		if strings.HasPrefix(query, "/*") {
+			end = "*/"
+		}
+		i := strings.Index(query, end)
+		if i < 0 {
+			return "other"
+		}
+		query = strings.TrimLeft(query[i+len(end):], " \t\r\n(")
+	}
+	word := query
+	if i := strings.IndexAny(query, " \t\r\n(;"); i >= 0 {
+		word = query[:i]
+	}
+	word = strings.ToLower(word)
+	if !sqlCommands[word] {
+		return "other" // 查詢主控台可輸入任意文字，不在清單中的一律歸為 other，避免統計的種類無限增加
+	}
+	return word
+}
+
+// namedValues 將舊式參數轉為 NamedValue
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
+
+// plainValues 將 NamedValue 轉為舊式參數
+func plainValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, nv := range args {
+		values[i] = nv.Value
+	}
+	return values
+}
+
+// stringLiteralPattern SQL 中的字串常數，慢查詢日誌中以 ? 取代
+var stringLiteralPattern = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.)*"`)
+
+// redactStatement 將敘述壓成一行並遮罩其中的字串常數，供慢查詢日誌使用（密碼另由 logger 遮罩）
+func redactStatement(statement string) string {
+	statement = strings.Join(strings.Fields(statement), " ")
+	return stringLiteralPattern.ReplaceAllString(statement, "?")
+}
@@ -0,0 +1,45 @@
+package main
+
+import "fmt"
+
+// sslMode 值，與 libpq 的 sslmode 一致
+const (
+	SSLModeDisable    = "disable"     // 不加密
+	SSLModeRequire    = "require"     // 加密但不驗證伺服器憑證（設定 CAFile 時等同 verify-ca）
+	SSLModeVerifyCA   = "verify-ca"   // 驗證伺服器憑證由信任的 CA 簽發
+	SSLModeVerifyFull = "verify-full" // 另外驗證憑證上的主機名稱與 Host 相符
+)
+
+// TLSOptions 連線的憑證設定，加密模式由 SSLMode 決定；
+// 留空時依 libpq 慣例讀取 ~/.postgresql/ 下的 root.crt、postgresql.crt 與 postgresql.key
+type TLSOptions struct {
+	CAFile   string `json:"caFile,omitempty"`
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+}
+
+// envTLSOptions 依設定建立憑證設定
+func envTLSOptions() TLSOptions {
+	cfg := appConfig()
+	return TLSOptions{
+		CAFile:   cfg.TLSCAFile,
+		CertFile: cfg.TLSCertFile,
+		KeyFile:  cfg.TLSKeyFile,
+	}
+}
+
+// validateTLS 檢查 sslMode 與憑證設定，錯誤加入 verr
+func validateTLS(sslMode string, o TLSOptions, verr *ValidationError) {
+	switch sslMode {
+	case "", SSLModeDisable, SSLModeRequire, SSLModeVerifyCA, SSLModeVerifyFull:
+	default:
+		verr.Add("sslMode", fmt.Sprintf("must be one of %s, %s, %s, %s",
+			SSLModeDisable, SSLModeRequire, SSLModeVerifyCA, SSLModeVerifyFull))
+	}
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		verr.Add("tls.certFile", "client certificate and key must be set together")
+	}
+	if (sslMode == "" || sslMode == SSLModeDisable) && o != (TLSOptions{}) {
+		verr.Add("sslMode", "TLS files are set but sslMode is disable")
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// 交易重試的預設值
+const (
+	txRetryBaseDelay = 20 * time.Millisecond
+	txRetryMaxDelay  = time.Second
+)
+
+// Repo 用戶資料的操作；WithTx 傳入的 Repo 所有操作都在同一個交易中，任何一步失敗整個交易都會回復
+type Repo interface {
+	// InsertUser 插入用戶並回傳新的 id
+	InsertUser(name, email string, age int) (int64, error)
+	// GetUserByID 讀取未刪除的用戶，不存在時回傳 ErrNotFound
+	GetUserByID(id int) (map[string]interface{}, error)
+	// PatchUser 以樂觀鎖部分更新用戶，回傳更新後的資料
+	PatchUser(id int, patch UserPatch) (map[string]interface{}, error)
+	// DeleteUser 刪除用戶（軟刪除模式下只標記 deleted_at）
+	DeleteUser(id int) error
+	// RestoreUser 還原已軟刪除的用戶；email 已被其他未刪除的用戶使用時回傳 ErrDuplicateEmail
+	RestoreUser(id int) error
+	// Tx 回傳底層交易，供同一個交易中執行自訂 SQL
+	Tx() *sql.Tx
+}
+
+// TxOptions 交易設定；Isolation 為 sql.LevelDefault 時使用 DB_TX_ISOLATION，
+// MaxAttempts 小於 1 時使用 DB_TX_MAX_ATTEMPTS（預設 3，設為 1 表示不重試）
+type TxOptions struct {
+	Isolation   sql.IsolationLevel
+	ReadOnly    bool
+	MaxAttempts int
+}
+
+// txRepo 以 *sql.Tx 實作 Repo；ctx 為 WithTx 的 ctx，交易中的 SQL 呼叫以此歸入呼叫 WithTx 的 Database 方法
+type txRepo struct {
+	ctx        context.Context
+	tx         *sql.Tx
+	actor      string
+	softDelete bool
+}
+
+// parseIsolationLevel 解析隔離等級名稱（read-committed、repeatable-read、serializable 等，不分大小寫，- 與 _ 與空白皆可）
+func parseIsolationLevel(name string) (sql.IsolationLevel, error) {
+	normalized := strings.NewReplacer("-", " ", "_", " ").Replace(strings.ToLower(strings.TrimSpace(name)))
+	switch normalized {
+	case "", "default":
+		return sql.LevelDefault, nil
+	case "read uncommitted":
+		return sql.LevelReadUncommitted, nil
+	case "read committed":
+		return sql.LevelReadCommitted, nil
+	case "repeatable read":
+		return sql.LevelRepeatableRead, nil
+	case "snapshot":
+		return sql.LevelSnapshot, nil
+	case "serializable":
+		return sql.LevelSerializable, nil
+	}
+	return sql.LevelDefault, fmt.Errorf("unknown isolation level %q", name)
+}
+
+// resolveTxOptions 以設定（DB_TX_ISOLATION、DB_TX_MAX_ATTEMPTS）補上未指定的選項
+func resolveTxOptions(opts TxOptions) (TxOptions, error) {
+	cfg := appConfig()
+	if opts.Isolation == sql.LevelDefault {
+		level, err := parseIsolationLevel(cfg.TxIsolation)
+		if err != nil {
+			return opts, newValidationError("DB_TX_ISOLATION", err.Error())
+		}
+		opts.Isolation = level
+	}
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = cfg.TxMaxAttempts
+	}
+	return opts, nil
+}
+
+// txRetryDelay 第 attempt 次失敗後等待的時間：指數成長並加上隨機抖動，避免互相死結的交易同時重試
+func txRetryDelay(attempt int) time.Duration {
+	delay := txRetryBaseDelay << (attempt - 1)
+	if delay > txRetryMaxDelay || delay <= 0 {
+		delay = txRetryMaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay)))
+}
+
+// WithTx 以預設設定在交易中執行 fn，詳見 WithTxOptions
+func (d *Database) WithTx(ctx context.Context, fn func(tx Repo) error) error {
+	return d.WithTxOptions(ctx, TxOptions{}, fn)
+}
+
+// WithTxOptions 在交易中執行 fn：fn 回傳 nil 時提交，回傳錯誤或 panic 時回復。
+// 遇到死結、序列化失敗等可重試的錯誤時，整個 fn 會在新的交易中重新執行，因此 fn 除了資料庫操作外不應有其他副作用
+func (d *Database) WithTxOptions(ctx context.Context, opts TxOptions, fn func(tx Repo) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	opts, err := resolveTxOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	db, err := d.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for attempt := 1; ; attempt++ {
+		err := d.runTx(ctx, db, opts, fn)
+		if err == nil || !isRetryableTxError(err) || attempt >= opts.MaxAttempts {
+			return err
+		}
+
+		delay := txRetryDelay(attempt)
+		logFor("tx").Warn("Transaction failed with a retryable error, retrying",
+			"attempt", attempt, "max_attempts", opts.MaxAttempts, "delay", delay.Round(time.Millisecond).String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("transaction retry cancelled: %w (last error: %v)", ctx.Err(), err)
+		case <-time.After(delay):
+		}
+	}
+}
+
+// runTx 執行一次交易
+func (d *Database) runTx(ctx context.Context, db *sql.DB, opts TxOptions, fn func(tx Repo) error) error {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(&txRepo{ctx: ctx, tx: tx, actor: d.Actor(), softDelete: d.SoftDelete}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", translateDBError(err))
+	}
+	return nil
+}
+
+// Tx 回傳底層交易
+func (r *txRepo) Tx() *sql.Tx {
+	return r.tx
+}
+
+// InsertUser 插入用戶並寫入稽核紀錄
+func (r *txRepo) InsertUser(name, email string, age int) (int64, error) {
+	if err := validateUser(name, email, age); err != nil {
+		return 0, err
+	}
+
+	id, err := insertUserRow(r.ctx, r.tx, name, email, age)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert user: %w", translateDBError(err))
+	}
+
+	after, err := fetchUserRow(r.ctx, r.tx, id, false)
+	if err != nil {
+		return 0, err
+	}
+	if err := recordUserChange(r.ctx, r.tx, id, AuditActionInsert, nil, after, r.actor); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// GetUserByID 讀取未刪除的用戶
+func (r *txRepo) GetUserByID(id int) (map[string]interface{}, error) {
+	return fetchUserRow(r.ctx, r.tx, int64(id), false)
+}
+
+// PatchUser 以樂觀鎖部分更新用戶並寫入稽核紀錄
+func (r *txRepo) PatchUser(id int, patch UserPatch) (map[string]interface{}, error) {
+	if err := validateUserPatch(patch); err != nil {
+		return nil, err
+	}
+
+	before, err := fetchUserRow(r.ctx, r.tx, int64(id), false)
+	if err != nil {
+		return nil, err
+	}
+	if current, _ := toInt64(before["version"]); current != patch.Version {
+		return nil, &ConflictError{Expected: patch.Version, Current: current}
+	}
+
+	var (
+		sets []string
+		args []interface{}
+	)
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = %s", column, placeholder(len(args))))
+	}
+	if patch.Name != nil {
+		set("name", *patch.Name)
+	}
+	if patch.Email != nil {
+		set("email", *patch.Email)
+	}
+	if patch.Age != nil {
+		set("age", *patch.Age)
+	}
+	sets = append(sets, "version = version + 1", "updated_at = CURRENT_TIMESTAMP")
+	args = append(args, id, patch.Version)
+
+	// WHERE 再次比對版本，避免讀取與更新之間被其他交易搶先修改
+	updateSQL := fmt.Sprintf(`UPDATE users SET %s WHERE id = %s AND version = %s AND deleted_at IS NULL`,
+		strings.Join(sets, ", "), placeholder(len(args)-1), placeholder(len(args)))
+	result, err := r.tx.ExecContext(r.ctx, updateSQL, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", translateDBError(err))
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		latest, err := fetchUserRow(r.ctx, r.tx, int64(id), false)
+		if err != nil {
+			return nil, err
+		}
+		current, _ := toInt64(latest["version"])
+		return nil, &ConflictError{Expected: patch.Version, Current: current}
+	}
+
+	after, err := fetchUserRow(r.ctx, r.tx, int64(id), false)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordUserChange(r.ctx, r.tx, int64(id), AuditActionUpdate, before, after, r.actor); err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// DeleteUser 刪除用戶並寫入稽核紀錄
+func (r *txRepo) DeleteUser(id int) error {
+	before, err := fetchUserRow(r.ctx, r.tx, int64(id), false)
+	if err != nil {
+		return err
+	}
+
+	var after map[string]interface{}
+	if r.softDelete {
+		if _, err := r.tx.ExecContext(r.ctx, `UPDATE users SET deleted_at = CURRENT_TIMESTAMP, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = `+placeholder(1), id); err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		if after, err = fetchUserRow(r.ctx, r.tx, int64(id), true); err != nil {
+			return err
+		}
+	} else {
+		if _, err := r.tx.ExecContext(r.ctx, `DELETE FROM users WHERE id = `+placeholder(1), id); err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+	}
+
+	return recordUserChange(r.ctx, r.tx, int64(id), AuditActionDelete, before, after, r.actor)
+}
+
+// RestoreUser 還原已軟刪除的用戶並寫入稽核紀錄
+func (r *txRepo) RestoreUser(id int) error {
+	before, err := fetchUserRow(r.ctx, r.tx, int64(id), true)
+	if err != nil {
+		return err
+	}
+	if before["deleted_at"] == nil {
+		return ErrNotFound
+	}
+
+	if _, err := r.tx.ExecContext(r.ctx, `UPDATE users SET deleted_at = NULL, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = `+placeholder(1), id); err != nil {
+		return fmt.Errorf("failed to restore user: %w", translateDBError(err))
+	}
+
+	after, err := fetchUserRow(r.ctx, r.tx, int64(id), true)
+	if err != nil {
+		return err
+	}
+	return recordUserChange(r.ctx, r.tx, int64(id), AuditActionRestore, before, after, r.actor)
+}
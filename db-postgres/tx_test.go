@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTxRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempt int
+		base    time.Duration // 加上抖動前的等待時間，實際值介於 base/2 與 base*3/2 之間
+	}{
+		{1, 20 * time.Millisecond},
+		{2, 40 * time.Millisecond},
+		{3, 80 * time.Millisecond},
+		{6, 640 * time.Millisecond},
+		{7, time.Second},
+		{20, time.Second},
+		{64, time.Second}, // 位移溢位時仍以上限計算
+		{200, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 50; i++ {
+			got := txRetryDelay(tt.attempt)
+			if got < tt.base/2 || got >= tt.base*3/2 {
+				t.Fatalf("txRetryDelay(%d) = %s, want within [%s, %s)", tt.attempt, got, tt.base/2, tt.base*3/2)
+			}
+		}
+	}
+}
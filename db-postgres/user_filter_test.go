@@ -0,0 +1,115 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLFilterBuilderWhere(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   UserFilter
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "no conditions",
+			filter:   UserFilter{},
+			wantSQL:  ` WHERE deleted_at IS NULL`,
+			wantArgs: []interface{}{},
+		},
+		{
+			name:     "keyword only",
+			filter:   UserFilter{Keyword: " b "},
+			wantSQL:  ` WHERE deleted_at IS NULL AND (name ILIKE $1 ESCAPE '!' OR email ILIKE $2 ESCAPE '!')`,
+			wantArgs: []interface{}{"%b%", "%b%"},
+		},
+		{
+			name:     "keyword with condition binds conditions first",
+			filter:   UserFilter{Keyword: "b", Conditions: []FilterCondition{{Field: "age", Op: "between", Values: []interface{}{10.0, 60.0}}}},
+			wantSQL:  ` WHERE deleted_at IS NULL AND ((age BETWEEN $1 AND $2) AND (name ILIKE $3 ESCAPE '!' OR email ILIKE $4 ESCAPE '!'))`,
+			wantArgs: []interface{}{10, 60, "%b%", "%b%"},
+		},
+		{
+			name: "nested group with keyword",
+			filter: UserFilter{
+				Logic:      "or",
+				Conditions: []FilterCondition{{Field: "name", Op: "eq", Value: "Alice"}},
+				Groups:     []UserFilter{{Keyword: "x", Conditions: []FilterCondition{{Field: "age", Op: "gt", Value: "3"}}}},
+			},
+			wantSQL:  ` WHERE deleted_at IS NULL AND (name = $1 OR ((age > $2) AND (name ILIKE $3 ESCAPE '!' OR email ILIKE $4 ESCAPE '!')))`,
+			wantArgs: []interface{}{"Alice", 3, "%x%", "%x%"},
+		},
+		{
+			name: "keyword on both sides of a group",
+			filter: UserFilter{
+				Keyword:    "top",
+				Conditions: []FilterCondition{{Field: "id", Op: "in", Values: []interface{}{1.0, "2"}}},
+				Groups:     []UserFilter{{Keyword: "inner", Conditions: []FilterCondition{{Field: "email", Op: "like", Value: "@example"}}}},
+			},
+			wantSQL:  ` WHERE deleted_at IS NULL AND ((id IN ($1, $2) AND ((email ILIKE $3 ESCAPE '!') AND (name ILIKE $4 ESCAPE '!' OR email ILIKE $5 ESCAPE '!'))) AND (name ILIKE $6 ESCAPE '!' OR email ILIKE $7 ESCAPE '!'))`,
+			wantArgs: []interface{}{1, 2, "%@example%", "%inner%", "%inner%", "%top%", "%top%"},
+		},
+		{
+			name:     "like wildcards are escaped",
+			filter:   UserFilter{Keyword: "50%_!"},
+			wantSQL:  ` WHERE deleted_at IS NULL AND (name ILIKE $1 ESCAPE '!' OR email ILIKE $2 ESCAPE '!')`,
+			wantArgs: []interface{}{"%50!%!_!!%", "%50!%!_!!%"},
+		},
+		{
+			name:     "time values use the dialect format",
+			filter:   UserFilter{Conditions: []FilterCondition{{Field: "created_at", Op: "gte", Value: "2024-01-02T03:04:05Z"}}},
+			wantSQL:  ` WHERE deleted_at IS NULL AND (created_at >= $1)`,
+			wantArgs: []interface{}{timeArg(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &sqlFilterBuilder{}
+			got, err := b.where(tt.filter)
+			if err != nil {
+				t.Fatalf("where: %v", err)
+			}
+			if got != tt.wantSQL {
+				t.Errorf("SQL =\n  %s\nwant\n  %s", got, tt.wantSQL)
+			}
+			if len(b.args) == 0 {
+				b.args = []interface{}{}
+			}
+			if !reflect.DeepEqual(b.args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", b.args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestSQLFilterBuilderErrors(t *testing.T) {
+	deep := UserFilter{}
+	for i := 0; i < maxFilterDepth; i++ {
+		deep = UserFilter{Groups: []UserFilter{deep}}
+	}
+	tests := []struct {
+		name    string
+		filter  UserFilter
+		wantErr string
+	}{
+		{"unknown field", UserFilter{Conditions: []FilterCondition{{Field: "password", Op: "eq", Value: "x"}}}, "unknown filter field"},
+		{"like on integer", UserFilter{Conditions: []FilterCondition{{Field: "age", Op: "like", Value: "1"}}}, "not supported"},
+		{"range on string", UserFilter{Conditions: []FilterCondition{{Field: "name", Op: "gt", Value: "a"}}}, "not supported"},
+		{"fractional integer", UserFilter{Conditions: []FilterCondition{{Field: "age", Op: "eq", Value: 1.5}}}, "expects an integer"},
+		{"between needs two values", UserFilter{Conditions: []FilterCondition{{Field: "age", Op: "between", Values: []interface{}{1.0}}}}, "exactly two values"},
+		{"empty in", UserFilter{Conditions: []FilterCondition{{Field: "id", Op: "in"}}}, "at least one value"},
+		{"unknown logic", UserFilter{Logic: "xor"}, "unknown filter logic"},
+		{"too deep", deep, "nested deeper"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := (&sqlFilterBuilder{}).where(tt.filter)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+)
+
+// 用戶欄位的驗證規則
+const (
+	maxNameLength  = 100
+	maxEmailLength = 255
+	minAge         = 0
+	maxAge         = 150
+)
+
+// validateUser 檢查用戶輸入，一次回傳所有不合法的欄位
+func validateUser(name, email string, age int) error {
+	verr := &ValidationError{}
+
+	if msg := checkName(name); msg != "" {
+		verr.Add("name", msg)
+	}
+	if msg := checkEmail(email); msg != "" {
+		verr.Add("email", msg)
+	}
+	if msg := checkAge(age); msg != "" {
+		verr.Add("age", msg)
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// validateUserPatch 檢查部分更新，只驗證有提供的欄位，並要求帶入預期版本
+func validateUserPatch(patch UserPatch) error {
+	verr := &ValidationError{}
+
+	if patch.Name == nil && patch.Email == nil && patch.Age == nil {
+		verr.Add("patch", "at least one field must be provided")
+	}
+	if patch.Name != nil {
+		if msg := checkName(*patch.Name); msg != "" {
+			verr.Add("name", msg)
+		}
+	}
+	if patch.Email != nil {
+		if msg := checkEmail(*patch.Email); msg != "" {
+			verr.Add("email", msg)
+		}
+	}
+	if patch.Age != nil {
+		if msg := checkAge(*patch.Age); msg != "" {
+			verr.Add("age", msg)
+		}
+	}
+	if patch.Version <= 0 {
+		verr.Add("version", "expected version is required")
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// checkName 回傳姓名不合法的原因；合法時回傳空字串
+func checkName(name string) string {
+	trimmedName := strings.TrimSpace(name)
+	switch {
+	case trimmedName == "":
+		return "name is required"
+	case utf8.RuneCountInString(trimmedName) > maxNameLength:
+		return fmt.Sprintf("name must be at most %d characters", maxNameLength)
+	}
+	return ""
+}
+
+// checkAge 回傳年齡超出範圍的原因；合法時回傳空字串
+func checkAge(age int) string {
+	if age < minAge || age > maxAge {
+		return fmt.Sprintf("age must be between %d and %d", minAge, maxAge)
+	}
+	return ""
+}
+
+// checkEmail 回傳電子郵件格式錯誤的原因；格式正確時回傳空字串
+func checkEmail(email string) string {
+	if email == "" {
+		return "email is required"
+	}
+	if len(email) > maxEmailLength {
+		return fmt.Sprintf("email must be at most %d characters", maxEmailLength)
+	}
+	// mail.ParseAddress 也接受 "Name <a@b.c>" 形式，因此要求解析結果與原字串相同
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "email format is invalid"
+	}
+	at := strings.LastIndex(email, "@")
+	if domain := email[at+1:]; !strings.Contains(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "email domain is invalid"
+	}
+	return ""
+}
@@ -0,0 +1,19 @@
+DROP TABLE IF EXISTS user_audit;
+
+DROP INDEX IF EXISTS idx_users_email_live;
+
+DROP INDEX IF EXISTS idx_users_deleted_at;
+
+CREATE TABLE users_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    email TEXT UNIQUE NOT NULL,
+    age INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO users_old (id, name, email, age, created_at) SELECT id, name, email, age, created_at FROM users;
+
+DROP TABLE users;
+
+ALTER TABLE users_old RENAME TO users;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN updated_at DATETIME NULL DEFAULT NULL;
+
+UPDATE users SET updated_at = created_at WHERE updated_at IS NULL;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS user_outbox (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id TEXT NOT NULL UNIQUE,
+    event_type TEXT NOT NULL,
+    user_id INTEGER NOT NULL,
+    payload TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NULL,
+    last_error TEXT NULL,
+    claimed_by TEXT NULL,
+    claimed_until DATETIME NULL,
+    published_at DATETIME NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_outbox_pending ON user_outbox (published_at, id);
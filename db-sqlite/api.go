@@ -0,0 +1,497 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serveUsage = `Usage: <app> [config flags] serve
+
+Serves the user operations as an HTTP JSON API instead of opening the window.
+The listen address is API_ADDR (--api-addr); when API_TOKEN is set every
+request except /api/health and /api/openapi.json needs
+"Authorization: Bearer <token>". The OpenAPI spec is at /api/openapi.json.`
+
+// openAPISpec API 的 OpenAPI 3 文件
+//
+//go:embed _assets/api/openapi.json
+var openAPISpec []byte
+
+// 分頁參數的預設值與上限
+const (
+	defaultAPIPageSize = 20
+	maxAPIPageSize     = 100
+)
+
+// maxAPIBodyBytes 請求內容的大小上限
+const maxAPIBodyBytes = 1 << 20
+
+// ErrCodeUnauthorized 缺少或錯誤的 API_TOKEN（只用於 HTTP API）
+const ErrCodeUnauthorized = "unauthorized"
+
+// apiHandler 處理一個 API 請求，回傳狀態碼與回應內容；回傳錯誤時依領域錯誤決定狀態碼
+type apiHandler func(w http.ResponseWriter, r *http.Request) (int, any, error)
+
+// apiServer 以 HTTP JSON 提供 App 的用戶操作
+type apiServer struct {
+	app   *App
+	token string
+}
+
+// userInput 建立與更新用戶的請求內容
+type userInput struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Age     int    `json:"age"`
+	Version int64  `json:"version"` // 只用於更新
+}
+
+// newAPIHandler 建立 API 的路由；token 為空字串時不檢查 Authorization
+func newAPIHandler(app *App, token string) http.Handler {
+	s := &apiServer{app: app, token: token}
+	mux := http.NewServeMux()
+	s.handle(mux, "GET /api/openapi.json", false, s.openAPI)
+	s.handle(mux, "GET /api/health", false, s.health)
+	s.handle(mux, "GET /api/users", true, s.listUsers)
+	s.handle(mux, "POST /api/users", true, s.createUser)
+	s.handle(mux, "POST /api/users/search", true, s.searchUsers)
+	s.handle(mux, "GET /api/users/deleted", true, s.listDeletedUsers)
+	s.handle(mux, "DELETE /api/users/deleted", true, s.purgeDeletedUsers)
+	s.handle(mux, "GET /api/users/{id}", true, s.getUser)
+	s.handle(mux, "PUT /api/users/{id}", true, s.updateUser)
+	s.handle(mux, "PATCH /api/users/{id}", true, s.patchUser)
+	s.handle(mux, "DELETE /api/users/{id}", true, s.deleteUser)
+	s.handle(mux, "POST /api/users/{id}/restore", true, s.restoreUser)
+	s.handle(mux, "GET /api/users/{id}/audit", true, s.userAudit)
+	return mux
+}
+
+// runServeCommand 處理 `serve` 子命令：啟動 HTTP API 直到收到 SIGINT / SIGTERM，回傳程式結束代碼
+func runServeCommand(args []string) int {
+	for _, arg := range args {
+		if arg == "-h" || arg == "--help" || arg == "help" {
+			fmt.Println(serveUsage)
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "unexpected argument %q\n\n%s\n", arg, serveUsage)
+		return 2
+	}
+
+	cfg := appConfig()
+	listener, err := net.Listen("tcp", cfg.APIAddr)
+	if err != nil {
+		logFor("api").Error("Failed to listen", "address", cfg.APIAddr, "error", err)
+		return 1
+	}
+	if cfg.APIToken == "" && !isLoopbackAddr(listener.Addr()) {
+		logFor("api").Warn("HTTP API is reachable from other hosts without API_TOKEN", "address", cfg.APIAddr)
+	}
+
+	// 先連線並套用遷移，與桌面版啟動時相同
+	_ = GetDBInstance()
+
+	server := &http.Server{Handler: newAPIHandler(NewApp(), cfg.APIToken), ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	StartRelay(ctx)
+
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+	logFor("api").Info("Serving HTTP API", "address", "http://"+listener.Addr().String()+"/api",
+		"auth", cfg.APIToken != "")
+
+	select {
+	case err := <-served:
+		logFor("api").Error("HTTP API stopped", "error", err)
+		return 1
+	case <-ctx.Done():
+	}
+
+	logFor("api").Info("Shutting down HTTP API")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logFor("api").Error("Failed to shut down HTTP API", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// region <-- 路由 -->
+
+// openAPI 回傳 OpenAPI 文件
+func (s *apiServer) openAPI(w http.ResponseWriter, r *http.Request) (int, any, error) {
+	return http.StatusOK, json.RawMessage(openAPISpec), nil
+}
+
+// health 回傳資料庫連線狀態，未連線時為 503
+func (s *apiServer) health(w http.ResponseWriter, r *http.Request) (int, any, error) {
+	state := s.app.GetConnectionState()
+	if state.Status != ConnectionConnected {
+		return http.StatusServiceUnavailable, state, nil
+	}
+	return http.StatusOK, state, nil
+}
+
+// listUsers 以關鍵字搜尋用戶（keyword 可省略），分頁資訊放在回應標頭
+func (s *apiServer) listUsers(w http.ResponseWriter, r *http.Request) (int, any, error) {
+	page, pageSize, err := pageParams(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	result, err := s.app.SearchUsers(r.URL.Query().Get("keyword"), page, pageSize)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, paginate(w, r, result), nil
+}
+
+// searchUsers 以請求內容的 UserFilter 查詢用戶，分頁資訊放在回應標頭
+func (s *apiServer) searchUsers(w http.ResponseWriter, r *http.Request) (int, any, error) {
+	page, pageSize, err := pageParams(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	var filter UserFilter
+	if err := decodeJSON(r, &filter); err != nil {
+		return 0, nil, err
+	}
+	result, err := s.app.FilterUsers(filter, page, pageSize)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, paginate(w, r, result), nil
+}
+
+// createUser 建立用戶，回傳 201 與新用戶，Location 為新用戶的網址
+func (s *apiServer) createUser(w http.ResponseWriter, r *http.Request) (int, any, error) {
+	var input userInput
+	if err := decodeJSON(r, &input); err != nil {
+		return 0, nil, err
+	}
+	user, err := s.app.CreateUserReturning(input.Name, input.Email, input.Age)
+	if err != nil {
+		return 0, nil, err
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/users/%v", user["id"]))
+	return http.StatusCreated, user, nil
+}
+
+// getUser 讀取單一用戶
+func (s *apiServer) getUser(w http.ResponseWriter, r *http.Request) (int, any, error) {
+	id, err := parseUserID(r.PathValue("id"))
+	if err != nil {
+		return 0, nil, err
+	}
+	user, err := s.app.GetUser(id)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, user, nil
+}
+
+// updateUser 以樂觀鎖更新用戶的所有欄位（請求內容需帶 version），回傳更新後的用戶
+func (s *apiServer) updateUser(w http.ResponseWriter, r *http.Request) (int, any, error) {
+	id, err := parseUserID(r.PathValue("id"))
+	if err != nil {
+		return 0, nil, err
+	}
+	var input userInput
+	if err := decodeJSON(r, &input); err != nil {
+		return 0, nil, err
+	}
+	// UpdateUser 即為帶入所有欄位的 PatchUser；直接呼叫 PatchUser 以取得與更新在同一個交易中讀取的結果
+	user, err := s.app.PatchUser(id, UserPatch{Name: &input.Name, Email: &input.Email, Age: &input.Age, Version: input.Version})
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, user, nil
+}
+
+// patchUser 以樂觀鎖部分更新用戶，回傳更新後的用戶
+func (s *apiServer) patchUser(w http.ResponseWriter, r *http.Request) (int, any, error) {
+	id, err := parseUserID(r.PathValue("id"))
+	if err != nil {
+		return 0, nil, err
+	}
+	var patch UserPatch
+	if err := decodeJSON(r, &patch); err != nil {
+		return 0, nil, err
+	}
+	user, err := s.app.PatchUser(id, patch)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, user, nil
+}
+
+// deleteUser 刪除用戶（軟刪除模式下可再還原），成功時回傳 204
+func (s *apiServer) deleteUser(w http.ResponseWriter, r *http.Request) (int, any, error) {
+	id, err := parseUserID(r.PathValue("id"))
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, err := s.app.DeleteUser(id); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+// listDeletedUsers 列出已軟刪除的用戶
+func (s *apiServer) listDeletedUsers(w http.ResponseWriter, r *http.Request) (int, any, error) {
+	users, err := s.app.GetDeletedUsers()
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, nonNilUsers(users), nil
+}
+
+// purgeDeletedUsers 永久刪除軟刪除超過 olderThanDays 天的用戶；olderThanDays 為必填，避免誤刪全部
+func (s *apiServer) purgeDeletedUsers(w http.ResponseWriter, r *http.Request) (int, any, error) {
+	if r.URL.Query().Get("olderThanDays") == "" {
+		return 0, nil, newValidationError("olderThanDays", "is required (0 purges every deleted user)")
+	}
+	days, err := queryInt(r, "olderThanDays", 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	purged, err := s.app.PurgeDeleted(days)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, map[string]int{"purged": purged}, nil
+}
+
+// restoreUser 還原已軟刪除的用戶，回傳還原後的用戶
+func (s *apiServer) restoreUser(w http.ResponseWriter, r *http.Request) (int, any, error) {
+	id, err := parseUserID(r.PathValue("id"))
+	if err != nil {
+		return 0, nil, err
+	}
+	user, err := s.app.RestoreUserReturning(id)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, user, nil
+}
+
+// userAudit 列出用戶的稽核紀錄
+func (s *apiServer) userAudit(w http.ResponseWriter, r *http.Request) (int, any, error) {
+	id, err := parseUserID(r.PathValue("id"))
+	if err != nil {
+		return 0, nil, err
+	}
+	entries, err := s.app.GetUserAudit(id)
+	if err != nil {
+		return 0, nil, err
+	}
+	if entries == nil {
+		entries = []AuditEntry{}
+	}
+	return http.StatusOK, entries, nil
+}
+
+// endregion
+
+// region <-- 請求與回應 -->
+
+// handle 註冊路由：檢查 token、建立 span、寫出 JSON 回應與存取日誌
+func (s *apiServer) handle(mux *http.ServeMux, pattern string, auth bool, h apiHandler) {
+	mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		var err error
+		span, end := traceGoroutine(pattern, &err, trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.String("http.request.method", r.Method), attribute.String("http.route", pattern)))
+		defer end()
+
+		status, body := http.StatusOK, any(nil)
+		if auth && !s.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			status, body = http.StatusUnauthorized, ErrorPayload{Code: ErrCodeUnauthorized, Message: "missing or invalid bearer token"}
+		} else if status, body, err = h(w, r); err != nil {
+			status, body = apiErrorResponse(err)
+		}
+		writeJSON(w, status, body)
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+
+		level := logFor("api").Info
+		if status >= http.StatusInternalServerError {
+			level = logFor("api").Error
+		}
+		attrs := []any{"method", r.Method, "path", r.URL.Path, "status", status,
+			LogKeyDuration, time.Since(start).Milliseconds(), "remote", r.RemoteAddr}
+		if err != nil {
+			attrs = append(attrs, "error", err)
+		}
+		level("Request", attrs...)
+	})
+}
+
+// authorized 檢查 Authorization: Bearer <API_TOKEN>
+func (s *apiServer) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// errorStatus 將前端的錯誤代碼對應為 HTTP 狀態碼
+func errorStatus(code string) int {
+	switch code {
+	case ErrCodeValidation:
+		return http.StatusBadRequest
+	case ErrCodeNotFound:
+		return http.StatusNotFound
+	case ErrCodeDuplicateEmail, ErrCodeConflict:
+		return http.StatusConflict
+	case ErrCodeUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// apiErrorResponse 依領域錯誤決定狀態碼與回應內容；內部錯誤的訊息可能含有驅動程式與 SQL 的細節，
+// 只回傳通用訊息，完整的錯誤記錄在伺服器的存取日誌中
+func apiErrorResponse(err error) (int, ErrorPayload) {
+	payload, _ := formatBindingError(err).(ErrorPayload)
+	status := errorStatus(payload.Code)
+	if status == http.StatusInternalServerError {
+		payload = ErrorPayload{Code: ErrCodeInternal, Message: "internal server error"}
+	}
+	return status, payload
+}
+
+// writeJSON 寫出 JSON 回應；204 不寫內容
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logFor("api").Warn("Failed to write response", "error", err)
+	}
+}
+
+// decodeJSON 解析請求內容，格式錯誤或含有未知欄位時回傳驗證錯誤
+func decodeJSON(r *http.Request, v any) error {
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxAPIBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return newValidationError("body", "request body is required")
+		}
+		return newValidationError("body", "invalid JSON: "+err.Error())
+	}
+	return nil
+}
+
+// queryInt 讀取整數查詢參數，未提供時回傳 def
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, newValidationError(name, "must be an integer")
+	}
+	return n, nil
+}
+
+// pageParams 讀取 page（從 1 開始）與 pageSize（1 到 maxAPIPageSize）
+func pageParams(r *http.Request) (int, int, error) {
+	verr := &ValidationError{}
+	page, err := queryInt(r, "page", 1)
+	if err != nil || page < 1 {
+		verr.Add("page", "must be an integer of at least 1")
+	}
+	pageSize, err := queryInt(r, "pageSize", defaultAPIPageSize)
+	if err != nil || pageSize < 1 || pageSize > maxAPIPageSize {
+		verr.Add("pageSize", fmt.Sprintf("must be an integer between 1 and %d", maxAPIPageSize))
+	}
+	if len(verr.Fields) > 0 {
+		return 0, 0, verr
+	}
+	return page, pageSize, nil
+}
+
+// paginate 將 SearchUsers / FilterUsers 的結果寫成分頁標頭（X-Total-Count、X-Page、X-Page-Size、Link），回傳用戶清單
+func paginate(w http.ResponseWriter, r *http.Request, result map[string]interface{}) []map[string]interface{} {
+	users, _ := result["users"].([]map[string]interface{})
+	total, _ := result["total"].(int)
+	page, _ := result["page"].(int)
+	pageSize, _ := result["pageSize"].(int)
+
+	header := w.Header()
+	header.Set("X-Total-Count", strconv.Itoa(total))
+	header.Set("X-Page", strconv.Itoa(page))
+	header.Set("X-Page-Size", strconv.Itoa(pageSize))
+
+	lastPage := 1
+	if pageSize > 0 && total > 0 {
+		lastPage = (total + pageSize - 1) / pageSize
+	}
+	link := func(n int, rel string) string {
+		u := *r.URL
+		query := u.Query()
+		query.Set("page", strconv.Itoa(n))
+		query.Set("pageSize", strconv.Itoa(pageSize))
+		u.RawQuery = query.Encode()
+		return fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel)
+	}
+	links := []string{link(1, "first")}
+	if page > 1 {
+		links = append(links, link(min(page-1, lastPage), "prev"))
+	}
+	if page < lastPage {
+		links = append(links, link(page+1, "next"))
+	}
+	links = append(links, link(lastPage, "last"))
+	header.Set("Link", strings.Join(links, ", "))
+
+	return nonNilUsers(users)
+}
+
+// nonNilUsers 沒有資料時回傳空陣列而不是 null
+func nonNilUsers(users []map[string]interface{}) []map[string]interface{} {
+	if users == nil {
+		return []map[string]interface{}{}
+	}
+	return users
+}
+
+// isLoopbackAddr 是否只接受本機連線
+func isLoopbackAddr(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
+
+// parseUserID 解析路徑中的用戶 ID
+func parseUserID(value string) (int, error) {
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 1 {
+		return 0, newValidationError("id", "must be a positive integer")
+	}
+	return id, nil
+}
+
+// endregion
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestAPI 以暫存資料庫建立 API 的路由，token 為空字串時不檢查 Authorization
+func newTestAPI(t *testing.T, token string) (*Database, http.Handler) {
+	t.Helper()
+	d := newTestDatabase(t)
+	return d, newAPIHandler(NewApp(), token)
+}
+
+// doAPI 送出請求並回傳回應；body 不為空時以 JSON 送出
+func doAPI(t *testing.T, h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeAPI 解析 JSON 回應內容
+func decodeAPI[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decode response %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+func TestAPIAuth(t *testing.T) {
+	_, h := newTestAPI(t, "secret")
+
+	for _, token := range []string{"", "wrong"} {
+		rec := doAPI(t, h, "GET", "/api/users", token, "")
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("token %q: status = %d, want 401", token, rec.Code)
+		}
+		if got := decodeAPI[ErrorPayload](t, rec).Code; got != ErrCodeUnauthorized {
+			t.Fatalf("token %q: code = %q, want %q", token, got, ErrCodeUnauthorized)
+		}
+		if rec.Header().Get("WWW-Authenticate") == "" {
+			t.Fatalf("token %q: missing WWW-Authenticate header", token)
+		}
+	}
+	if rec := doAPI(t, h, "GET", "/api/users", "secret", ""); rec.Code != http.StatusOK {
+		t.Fatalf("valid token: status = %d, want 200 (%s)", rec.Code, rec.Body)
+	}
+	// health 與 openapi 不需要 token
+	for _, path := range []string{"/api/health", "/api/openapi.json"} {
+		if rec := doAPI(t, h, "GET", path, "", ""); rec.Code != http.StatusOK {
+			t.Fatalf("GET %s without token: status = %d, want 200", path, rec.Code)
+		}
+	}
+}
+
+func TestAPIStatusMapping(t *testing.T) {
+	d, h := newTestAPI(t, "")
+	insertTestUser(t, d, "Alice", "alice@example.com", 30)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{"invalid id", "GET", "/api/users/abc", "", http.StatusBadRequest, ErrCodeValidation},
+		{"invalid user", "POST", "/api/users", `{"name":"","email":"bad","age":-1}`, http.StatusBadRequest, ErrCodeValidation},
+		{"unknown field", "POST", "/api/users", `{"name":"Bob","email":"bob@example.com","age":20,"role":"admin"}`, http.StatusBadRequest, ErrCodeValidation},
+		{"invalid page", "GET", "/api/users?page=0", "", http.StatusBadRequest, ErrCodeValidation},
+		{"missing user", "GET", "/api/users/999", "", http.StatusNotFound, ErrCodeNotFound},
+		{"duplicate email", "POST", "/api/users", `{"name":"Alice 2","email":"alice@example.com","age":31}`, http.StatusConflict, ErrCodeDuplicateEmail},
+		{"purge without days", "DELETE", "/api/users/deleted", "", http.StatusBadRequest, ErrCodeValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doAPI(t, h, tt.method, tt.path, "", tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.status, rec.Body)
+			}
+			if got := decodeAPI[ErrorPayload](t, rec).Code; got != tt.code {
+				t.Fatalf("code = %q, want %q", got, tt.code)
+			}
+		})
+	}
+}
+
+func TestAPIInternalErrorHidesDetails(t *testing.T) {
+	d, h := newTestAPI(t, "")
+	id := insertTestUser(t, d, "Alice", "alice@example.com", 30)
+
+	db, err := d.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("DROP TABLE user_audit"); err != nil {
+		t.Fatalf("drop user_audit: %v", err)
+	}
+
+	rec := doAPI(t, h, "GET", fmt.Sprintf("/api/users/%d/audit", id), "", "")
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500 (%s)", rec.Code, rec.Body)
+	}
+	payload := decodeAPI[ErrorPayload](t, rec)
+	if payload.Code != ErrCodeInternal || payload.Message != "internal server error" {
+		t.Fatalf("payload = %+v, want generic internal error", payload)
+	}
+	if strings.Contains(rec.Body.String(), "user_audit") {
+		t.Fatalf("response leaks the driver error: %s", rec.Body)
+	}
+}
+
+func TestAPIUserLifecycle(t *testing.T) {
+	_, h := newTestAPI(t, "")
+
+	rec := doAPI(t, h, "POST", "/api/users", "", `{"name":"Alice","email":"alice@example.com","age":30}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, want 201 (%s)", rec.Code, rec.Body)
+	}
+	created := decodeAPI[map[string]interface{}](t, rec)
+	path := fmt.Sprintf("/api/users/%v", created["id"])
+	if got := rec.Header().Get("Location"); got != path {
+		t.Fatalf("Location = %q, want %q", got, path)
+	}
+
+	// PUT 回傳更新後的用戶，版本遞增；以舊版本再更新一次得到 409
+	rec = doAPI(t, h, "PUT", path, "", `{"name":"Alice B","email":"alice@example.com","age":31,"version":1}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("put: status = %d, want 200 (%s)", rec.Code, rec.Body)
+	}
+	updated := decodeAPI[map[string]interface{}](t, rec)
+	if updated["name"] != "Alice B" || updated["version"] != float64(2) {
+		t.Fatalf("put returned %v, want name Alice B at version 2", updated)
+	}
+	rec = doAPI(t, h, "PUT", path, "", `{"name":"Alice C","email":"alice@example.com","age":32,"version":1}`)
+	if rec.Code != http.StatusConflict || decodeAPI[ErrorPayload](t, rec).Code != ErrCodeConflict {
+		t.Fatalf("stale put: status = %d (%s), want 409 conflict", rec.Code, rec.Body)
+	}
+	rec = doAPI(t, h, "PATCH", path, "", `{"age":40,"version":1}`)
+	if rec.Code != http.StatusConflict || decodeAPI[ErrorPayload](t, rec).Code != ErrCodeConflict {
+		t.Fatalf("stale patch: status = %d (%s), want 409 conflict", rec.Code, rec.Body)
+	}
+
+	if rec = doAPI(t, h, "DELETE", path, "", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: status = %d, want 204 (%s)", rec.Code, rec.Body)
+	}
+	if rec = doAPI(t, h, "GET", path, "", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("get deleted: status = %d, want 404", rec.Code)
+	}
+	rec = doAPI(t, h, "POST", path+"/restore", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("restore: status = %d, want 200 (%s)", rec.Code, rec.Body)
+	}
+	restored := decodeAPI[map[string]interface{}](t, rec)
+	if restored["name"] != "Alice B" || restored["deleted_at"] != nil {
+		t.Fatalf("restore returned %v, want the live user", restored)
+	}
+}
+
+func TestAPIPagination(t *testing.T) {
+	d, h := newTestAPI(t, "")
+	for i := 1; i <= 5; i++ {
+		insertTestUser(t, d, fmt.Sprintf("User %d", i), fmt.Sprintf("user%d@example.com", i), 20+i)
+	}
+
+	rec := doAPI(t, h, "GET", "/api/users?page=2&pageSize=2", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (%s)", rec.Code, rec.Body)
+	}
+	if users := decodeAPI[[]map[string]interface{}](t, rec); len(users) != 2 {
+		t.Fatalf("got %d users, want 2", len(users))
+	}
+	for header, want := range map[string]string{"X-Total-Count": "5", "X-Page": "2", "X-Page-Size": "2"} {
+		if got := rec.Header().Get(header); got != want {
+			t.Fatalf("%s = %q, want %q", header, got, want)
+		}
+	}
+	wantLink := `</api/users?page=1&pageSize=2>; rel="first", </api/users?page=1&pageSize=2>; rel="prev", ` +
+		`</api/users?page=3&pageSize=2>; rel="next", </api/users?page=3&pageSize=2>; rel="last"`
+	if got := rec.Header().Get("Link"); got != wantLink {
+		t.Fatalf("Link = %q, want %q", got, wantLink)
+	}
+
+	// 超過最後一頁時回傳空陣列，prev 指向最後一頁
+	rec = doAPI(t, h, "GET", "/api/users?page=9&pageSize=2", "", "")
+	if body := strings.TrimSpace(rec.Body.String()); body != "[]" {
+		t.Fatalf("page past the end: body = %s, want []", body)
+	}
+	if got := rec.Header().Get("Link"); !strings.Contains(got, `</api/users?page=3&pageSize=2>; rel="prev"`) {
+		t.Fatalf("Link = %q, want prev pointing at the last page", got)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 稽核紀錄的動作類型
+const (
+	AuditActionInsert  = "insert"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+	AuditActionPurge   = "purge"
+)
+
+// AuditEntry 一筆用戶異動的稽核紀錄，Before / After 為異動前後的完整快照
+type AuditEntry struct {
+	ID        int64                  `json:"id"`
+	UserID    int64                  `json:"userId"`
+	Action    string                 `json:"action"`
+	Actor     string                 `json:"actor"`
+	Before    map[string]interface{} `json:"before"`
+	After     map[string]interface{} `json:"after"`
+	CreatedAt string                 `json:"createdAt"`
+}
+
+// sqlExecutor 由 *sql.DB 與 *sql.Tx 共同實作，讓輔助函式可在交易內外共用；
+// 輔助函式以呼叫端的 ctx 執行，統計與 span 才會歸入呼叫的 Database 方法（見 withOperation）
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// actorMu 保護 Database.actor，綁定方法可能被前端並行呼叫
+var actorMu sync.RWMutex
+
+// resolveActor 決定預設的操作者名稱：APP_ACTOR 設定 > 作業系統使用者
+func resolveActor() string {
+	if actor := appConfig().Actor; actor != "" {
+		return actor
+	}
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		return current.Username
+	}
+	return "unknown"
+}
+
+// Actor 回傳目前寫入稽核紀錄的操作者
+func (d *Database) Actor() string {
+	actorMu.RLock()
+	defer actorMu.RUnlock()
+	return d.actor
+}
+
+// SetActor 設定之後異動所記錄的操作者
+func (d *Database) SetActor(actor string) {
+	actorMu.Lock()
+	defer actorMu.Unlock()
+	d.actor = actor
+}
+
+// scanRowMap 將目前這一列掃描為 map，[]byte 會轉為字串以便序列化為 JSON
+func scanRowMap(rows *sql.Rows) (map[string]interface{}, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns: %w", err)
+	}
+
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	if err := rows.Scan(valuePtrs...); err != nil {
+		return nil, fmt.Errorf("failed to scan row: %w", err)
+	}
+
+	row := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		if b, ok := values[i].([]byte); ok {
+			row[column] = string(b)
+		} else {
+			row[column] = values[i]
+		}
+	}
+	return row, nil
+}
+
+// fetchUserRow 讀取單一用戶的完整快照；includeDeleted 為 false 時不含已軟刪除的用戶
+func fetchUserRow(ctx context.Context, q sqlExecutor, id int64, includeDeleted bool) (map[string]interface{}, error) {
+	query := `SELECT * FROM users WHERE id = ` + placeholder(1)
+	if !includeDeleted {
+		query += ` AND deleted_at IS NULL`
+	}
+	rows, err := q.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to query user: %w", err)
+		}
+		return nil, ErrNotFound
+	}
+	return scanRowMap(rows)
+}
+
+// fetchUserRowByEmail 以 email 讀取未刪除用戶的完整快照；email 只在未刪除的用戶間唯一，已軟刪除的用戶可能與其同名
+func fetchUserRowByEmail(ctx context.Context, q sqlExecutor, email string) (map[string]interface{}, error) {
+	rows, err := q.QueryContext(ctx, `SELECT * FROM users WHERE email = `+placeholder(1)+` AND deleted_at IS NULL`, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to query user: %w", err)
+		}
+		return nil, ErrNotFound
+	}
+	return scanRowMap(rows)
+}
+
+// fetchUserRowsByEmail 以單一查詢讀取多個 email 的未刪除用戶快照，回傳以 email 為鍵的 map；找不到的 email 不在結果中
+func fetchUserRowsByEmail(ctx context.Context, q sqlExecutor, emails []string) (map[string]map[string]interface{}, error) {
+	users := make(map[string]map[string]interface{}, len(emails))
+	if len(emails) == 0 {
+		return users, nil
+	}
+	args := make([]interface{}, 0, len(emails))
+	holders := make([]string, 0, len(emails))
+	for _, email := range emails {
+		args = append(args, email)
+		holders = append(holders, placeholder(len(args)))
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT * FROM users WHERE email IN (`+strings.Join(holders, ", ")+`) AND deleted_at IS NULL`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanRowMap(rows)
+		if err != nil {
+			return nil, err
+		}
+		email, _ := user["email"].(string)
+		users[email] = user
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read users: %w", err)
+	}
+	return users, nil
+}
+
+// auditChangeType 稽核動作對應的事件名稱：還原視為更新，軟刪除與永久刪除都是刪除
+func auditChangeType(action string) string {
+	switch action {
+	case AuditActionInsert:
+		return UserCreatedEvent
+	case AuditActionDelete, AuditActionPurge:
+		return UserDeletedEvent
+	}
+	return UserUpdatedEvent
+}
+
+// writeAudit 寫入一筆稽核紀錄，應與異動本身在同一個交易中呼叫
+func writeAudit(ctx context.Context, q sqlExecutor, userID int64, action string, before, after map[string]interface{}, actor string) error {
+	beforeJSON, err := snapshotJSON(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := snapshotJSON(after)
+	if err != nil {
+		return err
+	}
+
+	auditSQL := fmt.Sprintf(`INSERT INTO user_audit (user_id, action, actor, before_data, after_data) VALUES (%s, %s, %s, %s, %s)`,
+		placeholder(1), placeholder(2), placeholder(3), placeholder(4), placeholder(5))
+	if _, err := q.ExecContext(ctx, auditSQL, userID, action, actor, beforeJSON, afterJSON); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return nil
+}
+
+// snapshotJSON 將快照序列化為 JSON；nil 快照存為 NULL
+func snapshotJSON(snapshot map[string]interface{}) (interface{}, error) {
+	if snapshot == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit snapshot: %w", err)
+	}
+	return string(data), nil
+}
+
+// GetUserAudit 依時間順序取得單一用戶的所有稽核紀錄（包含已刪除的用戶）
+func (d *Database) GetUserAudit(id int) ([]AuditEntry, error) {
+	ctx := withOperation(context.Background(), "GetUserAudit")
+	db, err := d.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `SELECT id, user_id, action, actor, before_data, after_data, created_at FROM user_audit WHERE user_id = `+
+		placeholder(1)+` ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit records: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var (
+			entry     AuditEntry
+			before    sql.NullString
+			after     sql.NullString
+			createdAt sql.NullTime
+		)
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Action, &entry.Actor, &before, &after, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit record: %w", err)
+		}
+		if before.Valid {
+			if err := json.Unmarshal([]byte(before.String), &entry.Before); err != nil {
+				return nil, fmt.Errorf("failed to decode audit snapshot: %w", err)
+			}
+		}
+		if after.Valid {
+			if err := json.Unmarshal([]byte(after.String), &entry.After); err != nil {
+				return nil, fmt.Errorf("failed to decode audit snapshot: %w", err)
+			}
+		}
+		if createdAt.Valid {
+			entry.CreatedAt = createdAt.Time.Format(time.RFC3339)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit records: %w", err)
+	}
+
+	return entries, nil
+}
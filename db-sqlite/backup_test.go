@@ -0,0 +1,48 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	d := newTestDatabase(t)
+	if err := d.InsertUser("Alice", "alice@example.com", 30); err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot.db")
+	info, err := d.Backup(path)
+	if err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	if info.SchemaVersion == 0 || len(info.Tables) == 0 {
+		t.Fatalf("Backup info = %+v, want schema version and tables", info)
+	}
+
+	if err := d.InsertUser("Bob", "bob@example.com", 40); err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	if _, err := d.Restore(path); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	users, err := d.GetAllUsers()
+	if err != nil {
+		t.Fatalf("GetAllUsers: %v", err)
+	}
+	if len(users) != 1 || users[0]["email"] != "alice@example.com" {
+		t.Fatalf("users after restore = %v, want only alice", users)
+	}
+}
+
+func TestBackupBeforeMigration(t *testing.T) {
+	d := newTestDatabase(t, "--db-backup-before-migrate=true")
+	if err := d.backupBeforeMigration(1, 2); err != nil {
+		t.Fatalf("backupBeforeMigration: %v", err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(appConfig().BackupDir, "*"+backupFileExt))
+	if len(matches) != 1 {
+		t.Fatalf("backups = %v, want one file", matches)
+	}
+}
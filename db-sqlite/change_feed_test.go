@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// collectUserChanges 設定接收者並回傳收到的事件
+func collectUserChanges(t *testing.T) *[]UserChangeEvent {
+	t.Helper()
+	events := &[]UserChangeEvent{}
+	SetUserChangeListener(func(event UserChangeEvent) { *events = append(*events, event) })
+	t.Cleanup(func() { SetUserChangeListener(nil) })
+	return events
+}
+
+func TestAuditFeedResumesAfterRewind(t *testing.T) {
+	d := newTestDatabase(t)
+	events := collectUserChanges(t)
+	feed := &auditFeed{}
+	defer feed.close()
+	ctx := context.Background()
+
+	insertTestUser(t, d, "Alice", "alice@example.com", 30)
+	if err := feed.poll(ctx); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	bobID := insertTestUser(t, d, "Bob", "bob@example.com", 40)
+	if err := feed.poll(ctx); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if len(*events) != 1 || (*events)[0].Type != UserCreatedEvent || (*events)[0].ID != int64(bobID) {
+		t.Fatalf("events = %+v, want only the creation of bob", *events)
+	}
+
+	// 模擬還原較舊的備份：user_audit 的 id 倒退到 cursor 之前
+	db, err := d.OpenDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`DELETE FROM user_audit`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`DELETE FROM sqlite_sequence WHERE name = 'user_audit'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := feed.poll(ctx); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+
+	*events = nil
+	if err := d.DeleteUser(bobID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if err := feed.poll(ctx); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if len(*events) != 1 || (*events)[0].Type != UserDeletedEvent || (*events)[0].ID != int64(bobID) {
+		t.Fatalf("events after rewind = %+v, want the deletion of bob", *events)
+	}
+}
+
+func TestAuditFeedAdvance(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name         string
+		cursor       int64
+		seen         []int64
+		gapSince     time.Time
+		wantCursor   int64
+		wantSeen     []int64
+		wantGapSince time.Time
+	}{
+		{"nothing new", 4, nil, time.Time{}, 4, nil, time.Time{}},
+		{"contiguous ids", 0, []int64{1, 2, 3}, time.Time{}, 3, nil, time.Time{}},
+		{"late commit fills the gap", 1, []int64{2, 3}, now.Add(-5 * time.Second), 3, nil, time.Time{}},
+		{"new gap starts waiting", 0, []int64{2, 3}, time.Time{}, 0, []int64{2, 3}, now},
+		{"gap within timeout", 0, []int64{2, 3}, now.Add(-5 * time.Second), 0, []int64{2, 3}, now.Add(-5 * time.Second)},
+		{"gap timed out", 0, []int64{2, 3}, now.Add(-changeFeedGapTimeout), 3, nil, time.Time{}},
+		{"timed out gap followed by a new gap", 0, []int64{2, 5}, now.Add(-changeFeedGapTimeout), 2, []int64{5}, now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &auditFeed{cursor: tt.cursor, seen: map[int64]bool{}, gapSince: tt.gapSince}
+			for _, id := range tt.seen {
+				f.seen[id] = true
+			}
+			f.advance(now)
+
+			var seen []int64
+			for id := range f.seen {
+				seen = append(seen, id)
+			}
+			sort.Slice(seen, func(i, j int) bool { return seen[i] < seen[j] })
+			if f.cursor != tt.wantCursor || !reflect.DeepEqual(seen, tt.wantSeen) || !f.gapSince.Equal(tt.wantGapSince) {
+				t.Fatalf("advance: cursor %d, seen %v, gapSince %v; want cursor %d, seen %v, gapSince %v",
+					f.cursor, seen, f.gapSince, tt.wantCursor, tt.wantSeen, tt.wantGapSince)
+			}
+		})
+	}
+}
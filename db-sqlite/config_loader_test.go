@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// writeTestFile 在暫存目錄寫入檔案並回傳路徑
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	configFile := writeTestFile(t, "config.yaml", `
+db:
+  query:
+    max_rows: 10
+    timeout: 10s
+  change_poll_interval: 10s
+  reconnect_max_delay: 10s
+`)
+	envFile := writeTestFile(t, "test.env", `
+DB_QUERY_TIMEOUT=20s
+DB_CHANGE_POLL_INTERVAL=20s
+DB_RECONNECT_MAX_DELAY=20s
+UNRELATED_TOOL_SETTING=ignored
+`)
+	t.Setenv("DB_CHANGE_POLL_INTERVAL", "30s")
+	t.Setenv("DB_RECONNECT_MAX_DELAY", "30s")
+	t.Setenv("DB_TX_MAX_ATTEMPTS", "")
+	os.Unsetenv("DB_TX_MAX_ATTEMPTS")
+
+	cfg, rest, err := LoadConfig([]string{"--config", configFile, "--env-file", envFile, "--db-reconnect-max-delay", "40s", "serve"})
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if len(rest) != 1 || rest[0] != "serve" {
+		t.Fatalf("remaining args = %q, want [serve]", rest)
+	}
+
+	tests := []struct {
+		key        string
+		got        interface{}
+		want       interface{}
+		wantSource string
+	}{
+		{"DB_TX_MAX_ATTEMPTS", cfg.TxMaxAttempts, 3, ConfigSourceDefault},
+		{"DB_QUERY_MAX_ROWS", cfg.QueryMaxRows, 10, configFile},
+		{"DB_QUERY_TIMEOUT", cfg.QueryTimeout, 20 * time.Second, envFile},
+		{"DB_CHANGE_POLL_INTERVAL", cfg.ChangePollInterval, 30 * time.Second, ConfigSourceEnv},
+		{"DB_RECONNECT_MAX_DELAY", cfg.ReconnectMaxDelay, 40 * time.Second, ConfigSourceFlag},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want || cfg.sources[tt.key] != tt.wantSource {
+			t.Errorf("%s = %v from %s, want %v from %s", tt.key, tt.got, cfg.sources[tt.key], tt.want, tt.wantSource)
+		}
+	}
+}
+
+func TestLoadConfigReportsEveryInvalidKey(t *testing.T) {
+	configFile := writeTestFile(t, "config.toml", `
+[db]
+query_max_rows = 0
+unknown_option = true
+`)
+	_, _, err := LoadConfig([]string{"--config", configFile, "--env-file", writeTestFile(t, "empty.env", ""),
+		"--log-level", "verbose", "--db-query-timeout", "-1s"})
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("LoadConfig: err = %v, want a ValidationError", err)
+	}
+
+	var fields []string
+	for _, f := range verr.Fields {
+		fields = append(fields, f.Field)
+	}
+	sort.Strings(fields)
+	want := []string{"DB_QUERY_MAX_ROWS", "DB_QUERY_TIMEOUT", "DB_UNKNOWN_OPTION", "LOG_LEVEL"}
+	if len(fields) != len(want) {
+		t.Fatalf("invalid keys = %q, want %q", fields, want)
+	}
+	for i := range want {
+		if fields[i] != want[i] {
+			t.Fatalf("invalid keys = %q, want %q", fields, want)
+		}
+	}
+}
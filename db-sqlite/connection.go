@@ -0,0 +1,447 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 連線狀態
+const (
+	ConnectionConnecting   = "connecting"
+	ConnectionConnected    = "connected"
+	ConnectionDisconnected = "disconnected"
+)
+
+// ConnectionStateEvent 連線狀態改變時送給前端的事件名稱
+const ConnectionStateEvent = "db:connection"
+
+// 重新連線的等待時間：第 n 次失敗後等待 base * 2^(n-1)，最多 DB_RECONNECT_MAX_DELAY
+const (
+	reconnectBaseDelay    = time.Second
+	connectionTestTimeout = 10 * time.Second
+	defaultProfileName    = "default"
+)
+
+// ConnectionState 目前的連線狀態；RetryAt 為斷線時下一次嘗試重新連線的時間
+type ConnectionState struct {
+	Profile  string     `json:"profile"`
+	Status   string     `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	Failures int        `json:"failures"`
+	RetryAt  *time.Time `json:"retryAt,omitempty"`
+	Since    time.Time  `json:"since"`
+}
+
+// connTracker 記錄連線狀態並控制重新連線的頻率；nil 表示不追蹤（暫存資料庫等）
+type connTracker struct {
+	mu          sync.Mutex
+	state       ConnectionState
+	nextAttempt time.Time
+	pendingInit bool // 啟動時因無法連線而未完成初始化，恢復連線後重新執行
+	silent      bool // 為 true 時不通知前端（切換連線前的候選連線）
+}
+
+var (
+	// dbInstanceMu 保護 dbInstance；dbSwitchMu 在建立或切換連線期間持有，其他呼叫端等待初始化完成
+	dbInstanceMu sync.RWMutex
+	dbSwitchMu   sync.Mutex
+	dbInstance   *Database
+
+	// connectionListener 接收連線狀態變化，由 App 轉送為 Wails 事件
+	connectionListenerMu sync.RWMutex
+	connectionListener   func(ConnectionState)
+
+	// connectionProfilesMu 保護連線設定檔的讀寫
+	connectionProfilesMu sync.Mutex
+)
+
+// GetDBInstance 取得目前使用中的 Database；第一次呼叫時依環境變數建立並初始化，
+// 之前因無法連線而未完成的初始化會在重新連線的等待時間過後再次執行
+func GetDBInstance() *Database {
+	if d := currentDatabase(); d != nil {
+		d.resumeInitialize()
+		return d
+	}
+
+	dbSwitchMu.Lock()
+	defer dbSwitchMu.Unlock()
+	if d := currentDatabase(); d != nil {
+		return d
+	}
+	d := newDatabaseFromEnv()
+	d.Initialize()
+	dbInstanceMu.Lock()
+	dbInstance = d
+	dbInstanceMu.Unlock()
+	return d
+}
+
+// currentDatabase 回傳目前使用中的 Database，尚未建立時回傳 nil
+func currentDatabase() *Database {
+	dbInstanceMu.RLock()
+	defer dbInstanceMu.RUnlock()
+	return dbInstance
+}
+
+// SetConnectionListener 設定連線狀態變化的接收者（nil 表示不通知）
+func SetConnectionListener(fn func(ConnectionState)) {
+	connectionListenerMu.Lock()
+	connectionListener = fn
+	connectionListenerMu.Unlock()
+}
+
+// notifyConnectionState 通知連線狀態變化
+func notifyConnectionState(state ConnectionState) {
+	connectionListenerMu.RLock()
+	fn := connectionListener
+	connectionListenerMu.RUnlock()
+	if fn != nil {
+		fn(state)
+	}
+}
+
+// newConnTracker 建立連線狀態追蹤，初始狀態為 connecting
+func newConnTracker(profile string) *connTracker {
+	return &connTracker{state: ConnectionState{Profile: profile, Status: ConnectionConnecting, Since: time.Now()}}
+}
+
+// reconnectDelay 第 failures 次連線失敗後的等待時間
+func reconnectDelay(failures int) time.Duration {
+	maxDelay := appConfig().ReconnectMaxDelay
+	delay := reconnectBaseDelay
+	for i := 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// snapshot 回傳目前狀態的副本
+func (c *connTracker) snapshot() ConnectionState {
+	if c == nil {
+		return ConnectionState{Status: ConnectionConnected}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// gate 斷線且尚未到下一次嘗試時間時直接回傳 ErrUnavailable，避免每個呼叫都等待連線逾時
+func (c *connTracker) gate() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state.Status == ConnectionDisconnected && time.Now().Before(c.nextAttempt) {
+		return fmt.Errorf("%w: %s (next retry at %s)", ErrUnavailable, c.state.Error, c.nextAttempt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// record 記錄一次連線嘗試的結果；失敗時以指數成長延後下一次嘗試
+func (c *connTracker) record(err error) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	previous := c.state.Status
+	now := time.Now()
+	if err == nil {
+		if previous == ConnectionConnected {
+			c.mu.Unlock()
+			return
+		}
+		c.state = ConnectionState{Profile: c.state.Profile, Status: ConnectionConnected, Since: now}
+		c.nextAttempt = time.Time{}
+	} else {
+		c.state.Failures++
+		c.nextAttempt = now.Add(reconnectDelay(c.state.Failures))
+		retryAt := c.nextAttempt
+		if previous != ConnectionDisconnected {
+			c.state.Since = now
+		}
+		c.state.Status = ConnectionDisconnected
+		c.state.Error = err.Error()
+		c.state.RetryAt = &retryAt
+	}
+	state, silent := c.state, c.silent
+	c.mu.Unlock()
+
+	if silent {
+		return
+	}
+	if err == nil {
+		logFor("connection").Info("Database connection is available", "profile", state.Profile)
+	} else {
+		logFor("connection").Warn("Database connection unavailable",
+			"profile", state.Profile, "attempt", state.Failures, "retry_at", state.RetryAt.Format(time.RFC3339), "error", err)
+	}
+	notifyConnectionState(state)
+}
+
+// retryNow 取消等待，讓下一次呼叫立即嘗試連線
+func (c *connTracker) retryNow() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.nextAttempt = time.Time{}
+	c.mu.Unlock()
+}
+
+// setPendingInit 設定是否需要在恢復連線後重新初始化
+func (c *connTracker) setPendingInit(pending bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.pendingInit = pending
+	c.mu.Unlock()
+}
+
+// takePendingInit 若需要重新初始化且已到可嘗試的時間，清除標記並回傳 true
+func (c *connTracker) takePendingInit() bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.pendingInit || time.Now().Before(c.nextAttempt) {
+		return false
+	}
+	c.pendingInit = false
+	return true
+}
+
+// setSilent 設定是否通知前端
+func (c *connTracker) setSilent(silent bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.silent = silent
+	c.mu.Unlock()
+}
+
+// OpenDB 開啟資料庫連接；斷線期間在重新連線的等待時間內直接回傳 ErrUnavailable
+func (d *Database) OpenDB() (*sql.DB, error) {
+	if err := d.conn.gate(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), connectionTestTimeout)
+	defer cancel()
+	db, err := d.dial(ctx)
+	d.conn.record(err)
+	return db, err
+}
+
+// ConnectionState 回傳目前的連線狀態
+func (d *Database) ConnectionState() ConnectionState {
+	return d.conn.snapshot()
+}
+
+// Reconnect 忽略等待時間立即嘗試連線，成功後補做尚未完成的初始化
+func (d *Database) Reconnect() ConnectionState {
+	d.conn.retryNow()
+	if db, err := d.OpenDB(); err == nil {
+		db.Close()
+	}
+	d.resumeInitialize()
+	return d.conn.snapshot()
+}
+
+// resumeInitialize 啟動時因無法連線而未完成初始化時，於可重試的時間重新執行
+func (d *Database) resumeInitialize() {
+	if d.conn.takePendingInit() {
+		logFor("connection").Info("Retrying database initialization")
+		d.Initialize()
+	}
+}
+
+// initializeFailed 初始化失敗時呼叫：若是連線問題，標記為恢復連線後重新初始化
+func (d *Database) initializeFailed() {
+	if d.conn.snapshot().Status != ConnectionConnected {
+		d.conn.setPendingInit(true)
+	}
+}
+
+// TestConnection 以指定的連線設定嘗試連線，不影響目前使用中的連線
+func TestConnection(profile ConnectionProfile) error {
+	profile, err := resolveConnectionProfile(profile)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), connectionTestTimeout)
+	defer cancel()
+	db, err := newDatabase(profile).dial(ctx)
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// SwitchConnection 改用指定的連線設定：連線成功並初始化（含自動遷移）後才取代目前的連線，
+// 失敗時維持原本的連線。軟刪除、自動遷移等設定沿用環境變數，操作者與查詢主控台寫入模式沿用目前的連線
+func SwitchConnection(profile ConnectionProfile) (ConnectionState, error) {
+	profile, err := resolveConnectionProfile(profile)
+	if err != nil {
+		return ConnectionState{}, err
+	}
+
+	next := newDatabase(profile)
+	next.conn.setSilent(true)
+	ctx, cancel := context.WithTimeout(context.Background(), connectionTestTimeout)
+	defer cancel()
+	db, err := next.dial(ctx)
+	if err != nil {
+		return ConnectionState{}, fmt.Errorf("failed to connect with profile %q: %w", profile.Name, err)
+	}
+	db.Close()
+
+	dbSwitchMu.Lock()
+	defer dbSwitchMu.Unlock()
+	if previous := currentDatabase(); previous != nil {
+		next.SetActor(previous.Actor())
+		next.QueryWriteMode = previous.QueryWriteModeEnabled()
+		previous.conn.setSilent(true)
+	}
+	next.Initialize()
+
+	dbInstanceMu.Lock()
+	dbInstance = next
+	dbInstanceMu.Unlock()
+	next.conn.setSilent(false)
+
+	state := next.conn.snapshot()
+	logFor("connection").Info("Switched database connection", "profile", profile.Name)
+	notifyConnectionState(state)
+	return state, nil
+}
+
+// connectionProfilesPath 連線設定檔路徑（DB_PROFILES_FILE）
+func connectionProfilesPath() string {
+	return appConfig().ProfilesFile
+}
+
+// LoadConnectionProfiles 讀取所有儲存的連線設定（依名稱排序），檔案不存在時回傳空清單
+func LoadConnectionProfiles() ([]ConnectionProfile, error) {
+	connectionProfilesMu.Lock()
+	defer connectionProfilesMu.Unlock()
+	return readConnectionProfiles()
+}
+
+// readConnectionProfiles 讀取連線設定檔，呼叫端須持有 connectionProfilesMu
+func readConnectionProfiles() ([]ConnectionProfile, error) {
+	data, err := os.ReadFile(connectionProfilesPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return []ConnectionProfile{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connection profiles: %w", err)
+	}
+	profiles := []ConnectionProfile{}
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse connection profiles %s: %w", connectionProfilesPath(), err)
+	}
+	return profiles, nil
+}
+
+// writeConnectionProfiles 寫入連線設定檔（權限 0600，先寫暫存檔再改名），呼叫端須持有 connectionProfilesMu
+func writeConnectionProfiles(profiles []ConnectionProfile) error {
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode connection profiles: %w", err)
+	}
+
+	path := connectionProfilesPath()
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".profiles-*")
+	if err != nil {
+		return fmt.Errorf("failed to write connection profiles: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write connection profiles: %w", err)
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write connection profiles: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write connection profiles: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write connection profiles: %w", err)
+	}
+	return nil
+}
+
+// SaveConnectionProfile 新增或取代同名的連線設定；密碼留空時沿用已儲存的密碼
+func SaveConnectionProfile(profile ConnectionProfile) error {
+	if profile.Name == "" {
+		return newValidationError("name", "profile name is required")
+	}
+
+	connectionProfilesMu.Lock()
+	defer connectionProfilesMu.Unlock()
+	profiles, err := readConnectionProfiles()
+	if err != nil {
+		return err
+	}
+	for i, saved := range profiles {
+		if saved.Name == profile.Name {
+			profiles[i] = profile.withSecretsFrom(saved)
+			return writeConnectionProfiles(profiles)
+		}
+	}
+	return writeConnectionProfiles(append(profiles, profile))
+}
+
+// DeleteConnectionProfile 刪除指定名稱的連線設定
+func DeleteConnectionProfile(name string) error {
+	connectionProfilesMu.Lock()
+	defer connectionProfilesMu.Unlock()
+	profiles, err := readConnectionProfiles()
+	if err != nil {
+		return err
+	}
+	for i, saved := range profiles {
+		if saved.Name == name {
+			return writeConnectionProfiles(append(profiles[:i], profiles[i+1:]...))
+		}
+	}
+	return newValidationError("name", fmt.Sprintf("unknown connection profile %q", name))
+}
+
+// resolveConnectionProfile 補齊連線設定：只給名稱時使用儲存的設定，其餘欄位留空時沿用儲存的值
+func resolveConnectionProfile(profile ConnectionProfile) (ConnectionProfile, error) {
+	if profile.Name == "" {
+		profile.Name = "custom"
+	}
+	saved, err := LoadConnectionProfiles()
+	if err != nil {
+		return profile, err
+	}
+	for _, s := range saved {
+		if s.Name == profile.Name {
+			profile = profile.withDefaultsFrom(s)
+			return profile, profile.validate()
+		}
+	}
+	if profile == (ConnectionProfile{Name: profile.Name}) {
+		return profile, newValidationError("name", fmt.Sprintf("unknown connection profile %q", profile.Name))
+	}
+	return profile, profile.validate()
+}
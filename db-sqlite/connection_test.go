@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// captureConnectionStates 記錄送給前端的連線狀態，測試結束時移除
+func captureConnectionStates(t *testing.T) func() []ConnectionState {
+	t.Helper()
+	var mu sync.Mutex
+	var states []ConnectionState
+	SetConnectionListener(func(state ConnectionState) {
+		mu.Lock()
+		states = append(states, state)
+		mu.Unlock()
+	})
+	t.Cleanup(func() { SetConnectionListener(nil) })
+	return func() []ConnectionState {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]ConnectionState(nil), states...)
+	}
+}
+
+func TestOpenDBBacksOffWhileDisconnected(t *testing.T) {
+	cfg := loadTestConfig(t)
+	states := captureConnectionStates(t)
+
+	// 上層是檔案，資料庫目錄無法建立，每次連線都會失敗
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d := newDatabase(ConnectionProfile{Name: "broken", Path: filepath.Join(blocker, "test.db")})
+
+	if _, err := d.OpenDB(); err == nil || errors.Is(err, ErrUnavailable) {
+		t.Fatalf("first OpenDB: err = %v, want the dial error", err)
+	}
+	state := d.ConnectionState()
+	if state.Status != ConnectionDisconnected || state.Failures != 1 || state.RetryAt == nil {
+		t.Fatalf("state after a failed dial = %+v", state)
+	}
+
+	// 等待時間內不再嘗試連線，直接回傳 ErrUnavailable
+	if _, err := d.OpenDB(); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("OpenDB during backoff: err = %v, want ErrUnavailable", err)
+	}
+	if got := d.ConnectionState().Failures; got != 1 {
+		t.Fatalf("failures = %d after a gated call, want 1", got)
+	}
+
+	// Reconnect 忽略等待時間；再次失敗時等待時間加倍
+	before := time.Now()
+	state = d.Reconnect()
+	if state.Failures != 2 || state.RetryAt.Before(before.Add(2*time.Second)) || state.RetryAt.After(time.Now().Add(2*time.Second)) {
+		t.Fatalf("state after the second failure = %+v, want a 2s backoff", state)
+	}
+
+	// 修正路徑後 Reconnect 恢復連線，失敗次數歸零
+	d.Path = cfg.DBPath
+	if state = d.Reconnect(); state.Status != ConnectionConnected || state.Failures != 0 || state.RetryAt != nil {
+		t.Fatalf("state after recovery = %+v", state)
+	}
+	db, err := d.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB after recovery: %v", err)
+	}
+	db.Close()
+
+	var statuses []string
+	for _, s := range states() {
+		statuses = append(statuses, s.Status)
+	}
+	want := []string{ConnectionDisconnected, ConnectionDisconnected, ConnectionConnected}
+	if !slices.Equal(statuses, want) {
+		t.Fatalf("notified statuses = %v, want %v", statuses, want)
+	}
+}
+
+func TestSwitchConnectionWithCallsInFlight(t *testing.T) {
+	previous := newTestDatabase(t)
+	previous.SetActor("tester")
+	insertTestUser(t, previous, "Alice", "alice@example.com", 30)
+
+	// 切換期間持續有呼叫進行，每個呼叫都必須成功，不會拿到尚未初始化的連線
+	stop := make(chan struct{})
+	errs := make(chan error, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, _, err := GetDBInstance().SearchUsers("", 1, 10); err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					return
+				}
+			}
+		}()
+	}
+
+	path := filepath.Join(t.TempDir(), "other.db")
+	state, err := SwitchConnection(ConnectionProfile{Name: "other", Path: path})
+	time.Sleep(20 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("SwitchConnection: %v", err)
+	}
+	select {
+	case err := <-errs:
+		t.Fatalf("call during the switch failed: %v", err)
+	default:
+	}
+
+	if state.Status != ConnectionConnected || state.Profile != "other" {
+		t.Fatalf("state = %+v, want connected to other", state)
+	}
+	current := GetDBInstance()
+	if current == previous || current.Path != path || current.Actor() != "tester" {
+		t.Fatalf("current database = %s (actor %q), want %s with the previous actor", current.Path, current.Actor(), path)
+	}
+	// 新的連線已套用遷移；舊連線的資料不受影響
+	if users, total, err := current.FilterUsers(UserFilter{}, 1, 10); err != nil || total != 0 || len(users) != 0 {
+		t.Fatalf("users on the new connection = %v (total %d), %v; want none", users, total, err)
+	}
+	if _, err := previous.GetUserByEmail("alice@example.com"); err != nil {
+		t.Fatalf("previous database lost its user: %v", err)
+	}
+
+	// 無法連線的設定不會取代目前的連線
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SwitchConnection(ConnectionProfile{Name: "broken", Path: filepath.Join(blocker, "x.db")}); err == nil {
+		t.Fatal("SwitchConnection to an unusable path succeeded")
+	}
+	if GetDBInstance() != current {
+		t.Fatal("failed switch replaced the current database")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMaxMigrationVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"1_init.up.sql":       {},
+		"1_init.down.sql":     {},
+		"12_later.up.sql":     {},
+		"3_middle.down.sql":   {},
+		"99_notes.md":         {},
+		"100_nested/x.up.sql": {},
+	}
+	got, err := maxMigrationVersion(fsys)
+	if err != nil {
+		t.Fatalf("maxMigrationVersion: %v", err)
+	}
+	if got != 12 {
+		t.Fatalf("maxMigrationVersion = %d, want 12", got)
+	}
+
+	sub, err := fs.Sub(embeddedMigrations, embeddedMigrationDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := maxMigrationVersion(sub); err != nil || got != 4 {
+		t.Fatalf("maxMigrationVersion(embedded) = %d, %v; want 4", got, err)
+	}
+}
+
+func TestMigrationDirOverride(t *testing.T) {
+	// 外部目錄：嵌入的遷移加上一個緊急修補的遷移 5
+	dir := t.TempDir()
+	err := fs.WalkDir(embeddedMigrations, embeddedMigrationDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(embeddedMigrations, path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, entry.Name()), data, 0o644)
+	})
+	if err != nil {
+		t.Fatalf("copy embedded migrations: %v", err)
+	}
+	hotfix := map[string]string{
+		"5_add_user_nickname.up.sql":   "ALTER TABLE users ADD COLUMN nickname TEXT;",
+		"5_add_user_nickname.down.sql": "ALTER TABLE users DROP COLUMN nickname;",
+	}
+	for name, sql := range hotfix {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(sql), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := newTestDatabase(t, "--db-migration-dir", dir)
+	if _, source, err := migrationFS(); err != nil || source != dir {
+		t.Fatalf("migration source = %q, %v; want %s", source, err, dir)
+	}
+	status, err := d.GetMigrationStatus()
+	if err != nil {
+		t.Fatalf("GetMigrationStatus: %v", err)
+	}
+	if status.CurrentVersion != 5 || status.LatestVersion != 5 || len(status.Pending) != 0 {
+		t.Fatalf("status = version %d, latest %d, %d pending; want 5, 5, 0",
+			status.CurrentVersion, status.LatestVersion, len(status.Pending))
+	}
+	if !hasUserColumn(t, d, "nickname") {
+		t.Fatal("users.nickname is missing; the external migration was not applied")
+	}
+
+	// 外部目錄不存在時拒絕遷移，不會改用嵌入的檔案
+	loadTestConfig(t, "--db-migration-dir", filepath.Join(dir, "missing"))
+	err = newDatabaseFromEnv().runMigrations()
+	if err == nil || !strings.Contains(err.Error(), "failed to open migration dir") {
+		t.Fatalf("runMigrations with a missing dir: err = %v", err)
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// 此檔集中 SQLite 方言的差異，讓查詢組裝邏輯可在各 SQL 模組間共用
+
+// placeholder 回傳第 n 個（從 1 起算）綁定參數的佔位符
+func placeholder(n int) string {
+	return "?"
+}
+
+// likeOperator 回傳不分大小寫的模糊比對運算子（SQLite 的 LIKE 對 ASCII 不分大小寫）
+func likeOperator() string {
+	return "LIKE"
+}
+
+// castText 將欄位轉為文字，讓任意型別的欄位都能做模糊比對
+func castText(expr string) string {
+	return "CAST(" + expr + " AS TEXT)"
+}
+
+// SQL 文字的字串規則，供查詢主控台判斷敘述種類：sqlBackslashEscapes 表示字串中的反斜線為跳脫字元，
+// sqlDollarQuotes 表示支援 $tag$...$tag$ 字串，sqlHashComments 表示 # 開頭為註解（MySQL 另有會被執行的 /*! */ 註解）
+const (
+	sqlBackslashEscapes = false
+	sqlDollarQuotes     = false
+	sqlHashComments     = false
+)
+
+// explainPrefix 查詢主控台取得執行計畫時加在敘述前的關鍵字
+const explainPrefix = "EXPLAIN QUERY PLAN "
+
+// guardReadOnly SQLite 驅動忽略交易的唯讀旗標，改以 query_only 讓連線拒絕所有寫入
+func guardReadOnly(ctx context.Context, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, "PRAGMA query_only = ON"); err != nil {
+		return fmt.Errorf("failed to enable query_only: %w", err)
+	}
+	return nil
+}
+
+// timeArg 將時間轉換為可直接與 created_at 比較的參數
+// CURRENT_TIMESTAMP 以 UTC 的 "YYYY-MM-DD HH:MM:SS" 文字儲存，須用相同格式才能正確比較
+func timeArg(t time.Time) interface{} {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// translateDBError 將驅動程式錯誤碼轉換為領域錯誤；SQLite 的錯誤訊息只有欄位沒有索引名稱，
+// 因此以欄位區分，只有 users.email 才是 ErrDuplicateEmail
+func translateDBError(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		columns := uniqueConstraintColumns(sqliteErr.Error())
+		if columns == "users.email" {
+			return ErrDuplicateEmail
+		}
+		return &UniqueViolationError{Constraint: columns}
+	}
+	return err
+}
+
+// uniqueConstraintColumns 取出 "UNIQUE constraint failed: users.email" 中的欄位（多個欄位以 ", " 分隔），格式不符時回傳空字串
+func uniqueConstraintColumns(message string) string {
+	_, columns, ok := strings.Cut(message, "UNIQUE constraint failed: ")
+	if !ok {
+		return ""
+	}
+	return columns
+}
+
+// isRetryableTxError 資料庫被其他連線鎖住（SQLITE_BUSY / SQLITE_LOCKED）時整個交易重試即可成功
+func isRetryableTxError(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+// insertUserRow 插入一筆用戶並回傳自動產生的 id
+func insertUserRow(ctx context.Context, q sqlExecutor, name, email string, age int) (int64, error) {
+	result, err := q.ExecContext(ctx, `INSERT INTO users (name, email, age, updated_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)`, name, email, age)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// schemaTableExists 檢查資料庫是否有指定的資料表
+func schemaTableExists(ctx context.Context, q sqlExecutor, table string) (bool, error) {
+	return schemaCount(ctx, q, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table)
+}
+
+// schemaColumnExists 檢查資料表是否有指定的欄位
+func schemaColumnExists(ctx context.Context, q sqlExecutor, table, column string) (bool, error) {
+	return schemaCount(ctx, q, `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column)
+}
+
+// schemaIndexExists 檢查是否有指定名稱的索引
+func schemaIndexExists(ctx context.Context, q sqlExecutor, index string) (bool, error) {
+	return schemaCount(ctx, q, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?`, index)
+}
+
+// leaseMigrationLock SQLite 沒有 advisory lock，改以 schema_migration_lock 資料表中的租約實作；
+// 持有者中斷而未釋放時，租約過期後其他執行個體即可接手
+type leaseMigrationLock struct {
+	db   *sql.DB
+	ttl  time.Duration
+	held bool
+}
+
+// newMigrationLock 建立以租約資料列實作的遷移鎖
+func (d *Database) newMigrationLock(ttl time.Duration) (migrationLock, error) {
+	db, err := d.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.ExecContext(context.Background(), `CREATE TABLE IF NOT EXISTS schema_migration_lock (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		owner TEXT NOT NULL,
+		acquired_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create lock table: %w", err)
+	}
+	return &leaseMigrationLock{db: db, ttl: ttl}, nil
+}
+
+// isSQLiteBusy 判斷錯誤是否為其他連線正在寫入
+func isSQLiteBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+func (l *leaseMigrationLock) tryAcquire(ctx context.Context) (bool, string, error) {
+	now := time.Now()
+	res, err := l.db.ExecContext(ctx, `INSERT INTO schema_migration_lock (id, owner, acquired_at, expires_at) VALUES (1, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET owner = excluded.owner, acquired_at = excluded.acquired_at, expires_at = excluded.expires_at
+		WHERE schema_migration_lock.expires_at < ? OR schema_migration_lock.owner = excluded.owner`,
+		migrationLockOwner, now.UnixMilli(), now.Add(l.ttl).UnixMilli(), now.UnixMilli())
+	if isSQLiteBusy(err) {
+		return false, "another connection (database busy)", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		l.held = true
+		return true, "", nil
+	}
+
+	var (
+		owner   string
+		expires int64
+	)
+	if err := l.db.QueryRowContext(ctx, `SELECT owner, expires_at FROM schema_migration_lock WHERE id = 1`).Scan(&owner, &expires); err != nil {
+		return false, "another process", nil
+	}
+	return false, fmt.Sprintf("%s until %s", owner, time.UnixMilli(expires).Format(time.RFC3339)), nil
+}
+
+func (l *leaseMigrationLock) renew(ctx context.Context) error {
+	res, err := l.db.ExecContext(ctx, `UPDATE schema_migration_lock SET expires_at = ? WHERE id = 1 AND owner = ?`,
+		time.Now().Add(l.ttl).UnixMilli(), migrationLockOwner)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("migration lock was taken over by another process")
+	}
+	return nil
+}
+
+func (l *leaseMigrationLock) release(ctx context.Context) error {
+	var err error
+	if l.held {
+		_, err = l.db.ExecContext(ctx, `DELETE FROM schema_migration_lock WHERE id = 1 AND owner = ?`, migrationLockOwner)
+		l.held = false
+	}
+	l.db.Close()
+	return err
+}
+
+// quoteIdent 以雙引號引用識別字
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// readSchema 以 PRAGMA 讀取所有資料表的欄位與索引；主鍵欄位的型別附加 PRIMARY KEY
+func readSchema(ctx context.Context, q sqlExecutor) (schemaSnapshot, error) {
+	tables, err := listTables(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := schemaSnapshot{}
+	for _, table := range tables {
+		t := snapshot.table(table)
+		if err := readSQLiteColumns(ctx, q, table, t); err != nil {
+			return nil, err
+		}
+		if err := readSQLiteIndexes(ctx, q, table, snapshot); err != nil {
+			return nil, err
+		}
+	}
+	return snapshot, nil
+}
+
+func readSQLiteColumns(ctx context.Context, q sqlExecutor, table string, t *schemaTable) error {
+	rows, err := q.QueryContext(ctx, `PRAGMA table_info(`+quoteIdent(table)+`)`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			col              schemaColumn
+			def              sql.NullString
+		)
+		if err := rows.Scan(&cid, &col.Name, &col.Type, &notNull, &def, &pk); err != nil {
+			return err
+		}
+		col.Type = strings.ToUpper(col.Type)
+		if pk > 0 {
+			col.Type += " PRIMARY KEY"
+		}
+		col.Nullable = notNull == 0
+		col.Default = def.String
+		t.Columns = append(t.Columns, col)
+	}
+	return rows.Err()
+}
+
+func readSQLiteIndexes(ctx context.Context, q sqlExecutor, table string, snapshot schemaSnapshot) error {
+	type indexEntry struct {
+		name   string
+		unique bool
+	}
+	rows, err := q.QueryContext(ctx, `PRAGMA index_list(`+quoteIdent(table)+`)`)
+	if err != nil {
+		return err
+	}
+	var indexes []indexEntry
+	for rows.Next() {
+		var (
+			seq, unique, partial int
+			name, origin         string
+		)
+		if err := rows.Scan(&seq, &name, &unique, &origin, &partial); err != nil {
+			rows.Close()
+			return err
+		}
+		indexes = append(indexes, indexEntry{name: name, unique: unique == 1})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, index := range indexes {
+		cols, err := q.QueryContext(ctx, `PRAGMA index_info(`+quoteIdent(index.name)+`)`)
+		if err != nil {
+			return err
+		}
+		for cols.Next() {
+			var (
+				seqno, cid int
+				column     sql.NullString
+			)
+			if err := cols.Scan(&seqno, &cid, &column); err != nil {
+				cols.Close()
+				return err
+			}
+			if !column.Valid {
+				column.String = "(expression)"
+			}
+			snapshot.addIndexColumn(table, index.name, column.String, index.unique)
+		}
+		cols.Close()
+		if err := cols.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newScratchDatabase 在暫存目錄建立比對 schema 用的資料庫檔案，回傳的 cleanup 會刪除它
+func (d *Database) newScratchDatabase(ctx context.Context) (*Database, string, func(), error) {
+	dir, err := os.MkdirTemp("", "schema-check-")
+	if err != nil {
+		return nil, "", nil, err
+	}
+	scratch := *d
+	scratch.conn = nil
+	scratch.Path = filepath.Join(dir, "scratch.db")
+	return &scratch, scratch.Path, func() { os.RemoveAll(dir) }, nil
+}
+
+// 備份格式：以 SQLite online backup API 複製的完整資料庫檔案，可直接以 sqlite3 開啟
+const (
+	backupFormat  = "sqlite"
+	backupFileExt = ".db"
+)
+
+// sqliteBackupPagesPerStep 每次複製的頁數；分段複製讓其他連線在備份期間仍可寫入
+const sqliteBackupPagesPerStep = 256
+
+// backupName 預設備份檔名使用資料庫檔名（不含副檔名）
+func (d *Database) backupName() string {
+	return strings.TrimSuffix(filepath.Base(d.Path), filepath.Ext(d.Path))
+}
+
+// writeBackup 以 online backup API 將目前資料庫複製到 path
+func (d *Database) writeBackup(ctx context.Context, path string) (*BackupInfo, error) {
+	src, err := d.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	dst, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer dst.Close()
+
+	if err := sqliteOnlineBackup(ctx, dst, src); err != nil {
+		return nil, err
+	}
+	// 列數從備份檔讀取，與複製的內容一致
+	return readBackupInfo(ctx, dst)
+}
+
+// restoreBackup 先檢查備份檔的完整性，再以 online backup API 將它複製回目前資料庫
+func (d *Database) restoreBackup(ctx context.Context, path string) (*BackupInfo, error) {
+	src, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer src.Close()
+
+	var check string
+	if err := src.QueryRowContext(ctx, "PRAGMA quick_check").Scan(&check); err != nil {
+		return nil, fmt.Errorf("%s is not a valid SQLite database: %w", path, err)
+	}
+	if check != "ok" {
+		return nil, fmt.Errorf("backup %s failed integrity check: %s", path, check)
+	}
+	info, err := readBackupInfo(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	logFor("backup").Info("Restoring backup", "format", "sqlite", "version", info.SchemaVersion, "tables", len(info.Tables))
+
+	dst, err := d.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+
+	if err := sqliteOnlineBackup(ctx, dst, src); err != nil {
+		return nil, err
+	}
+	return readBackupInfo(ctx, dst)
+}
+
+// sqliteOnlineBackup 以 SQLite online backup API 將 src 的 main 資料庫完整複製到 dst
+func sqliteOnlineBackup(ctx context.Context, dst, src *sql.DB) error {
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open destination: %w", err)
+	}
+	defer dstConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open source: %w", err)
+	}
+	defer srcConn.Close()
+
+	return dstConn.Raw(func(dstDriver interface{}) error {
+		return srcConn.Raw(func(srcDriver interface{}) error {
+			dstSQLite, ok := unwrapDriverConn(dstDriver).(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("unexpected destination driver %T", dstDriver)
+			}
+			srcSQLite, ok := unwrapDriverConn(srcDriver).(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("unexpected source driver %T", srcDriver)
+			}
+
+			backup, err := dstSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return fmt.Errorf("failed to start backup: %w", err)
+			}
+			for {
+				done, err := backup.Step(sqliteBackupPagesPerStep)
+				if err != nil {
+					backup.Finish()
+					return fmt.Errorf("failed to copy pages: %w", err)
+				}
+				if done {
+					break
+				}
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// listTables 列出所有使用者資料表
+func listTables(ctx context.Context, q sqlExecutor) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
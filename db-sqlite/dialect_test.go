@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTranslateDBError(t *testing.T) {
+	d := newTestDatabase(t)
+	db, err := d.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name       string
+		stmt       string
+		want       error
+		constraint string
+	}{
+		{"email", `INSERT INTO users (name, email, age) VALUES ('Alice', 'alice@example.com', 30)`, ErrDuplicateEmail, ""},
+		{"other unique column", `INSERT INTO user_outbox (event_id, event_type, user_id, payload) VALUES ('e1', 'user.created', 1, '{}')`, ErrDuplicateValue, "user_outbox.event_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := db.Exec(tt.stmt); err != nil {
+				t.Fatalf("first insert: %v", err)
+			}
+			_, err := db.Exec(tt.stmt)
+			got := translateDBError(err)
+			if !errors.Is(got, tt.want) {
+				t.Fatalf("translateDBError(%v) = %v, want %v", err, got, tt.want)
+			}
+			var uniqueErr *UniqueViolationError
+			if errors.As(got, &uniqueErr) && uniqueErr.Constraint != tt.constraint {
+				t.Fatalf("constraint = %q, want %q", uniqueErr.Constraint, tt.constraint)
+			}
+		})
+	}
+
+	plain := errors.New("disk I/O error")
+	if got := translateDBError(plain); got != plain {
+		t.Fatalf("translateDBError(plain) = %v, want it unchanged", got)
+	}
+}
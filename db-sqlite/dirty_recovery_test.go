@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestSplitSQLStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"empty", "  \n-- only a comment\n", nil},
+		{"two statements", "CREATE TABLE a (id INT);\nDROP TABLE b;", []string{"CREATE TABLE a (id INT)", "DROP TABLE b"}},
+		{"missing trailing semicolon", "SELECT 1;\nSELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"line comments", "-- create a;\nCREATE TABLE a (id INT); -- done;\n", []string{"CREATE TABLE a (id INT)"}},
+		{"semicolon in quotes", "INSERT INTO t VALUES ('a;b', \"c;d\", `e;f`);", []string{"INSERT INTO t VALUES ('a;b', \"c;d\", `e;f`)"}},
+		{"comment marker in quotes", "INSERT INTO t VALUES ('--not a comment');", []string{"INSERT INTO t VALUES ('--not a comment')"}},
+		{
+			"dollar quoted body",
+			"CREATE FUNCTION f() RETURNS trigger AS $$ BEGIN RETURN NEW; END; $$ LANGUAGE plpgsql;\nSELECT 1;",
+			[]string{"CREATE FUNCTION f() RETURNS trigger AS $$ BEGIN RETURN NEW; END; $$ LANGUAGE plpgsql", "SELECT 1"},
+		},
+		{
+			"tagged dollar quote",
+			"DO $body$ BEGIN PERFORM 1; END $body$;",
+			[]string{"DO $body$ BEGIN PERFORM 1; END $body$"},
+		},
+		{"positional parameter is not a dollar quote", "SELECT $1; SELECT 2;", []string{"SELECT $1", "SELECT 2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitSQLStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("splitSQLStatements(%q) = %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInspectStatement(t *testing.T) {
+	d := newTestDatabase(t)
+	db, err := d.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		stmt      string
+		wantState string
+		wantCheck string
+	}{
+		{"CREATE TABLE IF NOT EXISTS users (id INTEGER)", StatementApplied, "table users exists"},
+		{"CREATE TABLE nicknames (id INTEGER)", StatementMissing, "table nicknames exists"},
+		{"DROP TABLE IF EXISTS nicknames", StatementApplied, "table nicknames is absent"},
+		{"DROP TABLE `users`", StatementMissing, "table users is absent"},
+		{"ALTER TABLE users ADD COLUMN deleted_at DATETIME", StatementApplied, "column users.deleted_at exists"},
+		{"ALTER TABLE users ADD nickname TEXT", StatementMissing, "column users.nickname exists"},
+		{"ALTER TABLE users DROP COLUMN nickname", StatementApplied, "column users.nickname is absent"},
+		{"CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_live ON users (email)", StatementApplied, "index idx_users_email_live exists"},
+		{"DROP INDEX idx_users_email_live", StatementMissing, "index idx_users_email_live is absent"},
+		{"UPDATE users SET age = 0", StatementUnknown, ""},
+	}
+	for i, tt := range tests {
+		t.Run(tt.stmt, func(t *testing.T) {
+			got, err := inspectStatement(context.Background(), db, i+1, tt.stmt)
+			if err != nil {
+				t.Fatalf("inspectStatement: %v", err)
+			}
+			if got.Index != i+1 || got.SQL != tt.stmt || got.State != tt.wantState || got.Check != tt.wantCheck {
+				t.Fatalf("inspectStatement = %+v, want state %q and check %q", got, tt.wantState, tt.wantCheck)
+			}
+		})
+	}
+}
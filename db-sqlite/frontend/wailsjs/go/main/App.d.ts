@@ -1,16 +1,97 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
+import {main} from '../models';
+
+export function Backup(arg1:string):Promise<main.BackupInfo>;
+
+export function BrowseTable(arg1:string,arg2:main.TableQuery):Promise<main.TablePage>;
+
+export function CheckSchema():Promise<main.SchemaReport>;
+
+export function ClearQueryHistory():Promise<string>;
 
 export function CreateUser(arg1:string,arg2:string,arg3:number):Promise<string>;
 
+export function CreateUserReturning(arg1:string,arg2:string,arg3:number):Promise<{[key: string]: any}>;
+
+export function DeleteConnectionProfile(arg1:string):Promise<string>;
+
 export function DeleteUser(arg1:number):Promise<string>;
 
+export function DescribeTable(arg1:string):Promise<main.TableDescription>;
+
+export function ExecuteQuery(arg1:string,arg2:Array<any>):Promise<main.QueryResult>;
+
+export function ExplainQuery(arg1:string,arg2:Array<any>):Promise<main.QueryResult>;
+
+export function ExportUsers(arg1:main.UserFilter,arg2:string,arg3:string):Promise<main.ExportReport>;
+
+export function FilterUsers(arg1:main.UserFilter,arg2:number,arg3:number):Promise<{[key: string]: any}>;
+
 export function GetAllUsers():Promise<Array<{[key: string]: any}>>;
 
+export function GetConnectionState():Promise<main.ConnectionState>;
+
+export function GetDeletedUsers():Promise<Array<{[key: string]: any}>>;
+
+export function GetEffectiveConfig():Promise<Array<main.ConfigEntry>>;
+
+export function GetMigrationStatus():Promise<main.MigrationStatus>;
+
+export function GetQueryHistory(arg1:number):Promise<Array<main.QueryHistoryEntry>>;
+
+export function GetQueryMetrics():Promise<Array<main.QueryMetric>>;
+
+export function GetQueryWriteMode():Promise<boolean>;
+
+export function GetRecentLogs(arg1:number,arg2:string):Promise<Array<main.LogEntry>>;
+
 export function GetUser(arg1:number):Promise<{[key: string]: any}>;
 
+export function GetUserAudit(arg1:number):Promise<Array<main.AuditEntry>>;
+
 export function Greet(arg1:string):Promise<string>;
 
+export function ImportUsers(arg1:string,arg2:string,arg3:string):Promise<main.ImportReport>;
+
+export function InspectDirtyMigration():Promise<main.DirtyReport>;
+
+export function ListConnectionProfiles():Promise<Array<main.ConnectionProfile>>;
+
+export function ListTables():Promise<Array<main.TableSummary>>;
+
+export function MigrateSteps(arg1:number,arg2:boolean):Promise<main.MigrationPlan>;
+
+export function MigrateTo(arg1:number,arg2:boolean):Promise<main.MigrationPlan>;
+
+export function PatchUser(arg1:number,arg2:main.UserPatch):Promise<{[key: string]: any}>;
+
+export function PreviewImport(arg1:string,arg2:string,arg3:string):Promise<main.ImportReport>;
+
+export function PurgeDeleted(arg1:number):Promise<number>;
+
+export function Reconnect():Promise<main.ConnectionState>;
+
+export function RecoverDirtyMigration(arg1:string,arg2:boolean):Promise<main.RecoveryResult>;
+
+export function RedoMigration(arg1:boolean):Promise<main.MigrationPlan>;
+
+export function Restore(arg1:string):Promise<main.BackupInfo>;
+
+export function RestoreUser(arg1:number):Promise<string>;
+
+export function RestoreUserReturning(arg1:number):Promise<{[key: string]: any}>;
+
+export function SaveConnectionProfile(arg1:main.ConnectionProfile):Promise<string>;
+
 export function SearchUsers(arg1:string,arg2:number,arg3:number):Promise<{[key: string]: any}>;
 
-export function UpdateUser(arg1:number,arg2:string,arg3:string,arg4:number):Promise<string>;
+export function SetActor(arg1:string):Promise<string>;
+
+export function SetQueryWriteMode(arg1:boolean):Promise<boolean>;
+
+export function SwitchConnection(arg1:main.ConnectionProfile):Promise<main.ConnectionState>;
+
+export function TestConnection(arg1:main.ConnectionProfile):Promise<string>;
+
+export function UpdateUser(arg1:number,arg2:string,arg3:string,arg4:number,arg5:number):Promise<string>;
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportUpsertAuditsEveryUpdate(t *testing.T) {
+	d := newTestDatabase(t)
+	bobID := insertTestUser(t, d, "Bob", "bob@example.com", 40)
+
+	path := filepath.Join(t.TempDir(), "users.ndjson")
+	data := `{"name":"Carol","email":"carol@example.com","age":20}
+{"name":"Bob 2","email":"bob@example.com","age":41}
+{"name":"Carol 2","email":"carol@example.com","age":21}
+{"name":"Bob 3","email":"bob@example.com","age":42}
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := d.ImportUsers(path, "", ImportModeUpsert, false)
+	if err != nil {
+		t.Fatalf("ImportUsers: %v", err)
+	}
+	if report.Inserted != 1 || report.Updated != 3 {
+		t.Fatalf("report = %+v, want 1 inserted and 3 updated", report)
+	}
+
+	bobAudit, err := d.GetUserAudit(bobID)
+	if err != nil {
+		t.Fatalf("GetUserAudit: %v", err)
+	}
+	if len(bobAudit) != 3 {
+		t.Fatalf("bob audit = %+v, want the insert and two updates", bobAudit)
+	}
+	for i, want := range [][2]string{{"Bob", "Bob 2"}, {"Bob 2", "Bob 3"}} {
+		update := bobAudit[i+1]
+		if update.Action != AuditActionUpdate || update.Before["name"] != want[0] || update.After["name"] != want[1] {
+			t.Fatalf("bob update %d = %+v, want %s -> %s", i+1, update, want[0], want[1])
+		}
+	}
+	if bobAudit[1].After["version"] != bobAudit[2].Before["version"] {
+		t.Fatalf("bob updates do not chain: after %v, next before %v", bobAudit[1].After["version"], bobAudit[2].Before["version"])
+	}
+
+	carol, err := d.GetUserByEmail("carol@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	carolID, _ := toInt64(carol["id"])
+	carolAudit, err := d.GetUserAudit(int(carolID))
+	if err != nil {
+		t.Fatalf("GetUserAudit: %v", err)
+	}
+	if len(carolAudit) != 2 || carolAudit[0].Action != AuditActionInsert || carolAudit[0].After["name"] != "Carol" ||
+		carolAudit[1].Before["name"] != "Carol" || carolAudit[1].After["name"] != "Carol 2" {
+		t.Fatalf("carol audit = %+v, want the insert followed by Carol -> Carol 2", carolAudit)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// querySample 一組標籤的 Prometheus 數值
+type querySample struct {
+	Count  uint64 // db_query_duration_seconds 的樣本數
+	Rows   float64
+	Errors float64
+	Slow   float64
+}
+
+// gatherQuerySample 從 metricsRegistry 讀出指定操作與命令目前的累計值
+func gatherQuerySample(t *testing.T, operation, command string) querySample {
+	t.Helper()
+	families, err := metricsRegistry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	var sample querySample
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			if labelValue(m, "operation") != operation || labelValue(m, "command") != command {
+				continue
+			}
+			switch family.GetName() {
+			case "db_query_duration_seconds":
+				sample.Count = m.GetHistogram().GetSampleCount()
+			case "db_query_rows_total":
+				sample.Rows = m.GetCounter().GetValue()
+			case "db_query_errors_total":
+				sample.Errors = m.GetCounter().GetValue()
+			case "db_slow_queries_total":
+				sample.Slow = m.GetCounter().GetValue()
+			}
+		}
+	}
+	return sample
+}
+
+// labelValue 指標中某個標籤的值
+func labelValue(m *dto.Metric, name string) string {
+	for _, label := range m.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
+// queryMetric QueryMetrics 中指定操作與命令的項目
+func queryMetric(operation, command string) QueryMetric {
+	for _, m := range QueryMetrics() {
+		if m.Operation == operation && m.Command == command {
+			return m
+		}
+	}
+	return QueryMetric{}
+}
+
+func TestQueryMetrics(t *testing.T) {
+	// 門檻為 1ns 時每個呼叫都算慢查詢
+	d := newTestDatabase(t, "--db-slow-query-threshold", "1ns")
+
+	// 統計是全域累計的，以差值比對
+	before := gatherQuerySample(t, "InsertUser", "insert")
+	beforeStat := queryMetric("InsertUser", "insert")
+
+	if err := d.InsertUser("Alice", "alice@example.com", 30); err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	// 重複的 email 在 INSERT 時失敗
+	if err := d.InsertUser("Alice 2", "alice@example.com", 31); !errors.Is(err, ErrDuplicateEmail) {
+		t.Fatalf("InsertUser with a duplicate email: err = %v, want ErrDuplicateEmail", err)
+	}
+
+	// 成功的插入寫入 users 與 user_audit 兩筆，失敗的只執行了 users 的 INSERT
+	after := gatherQuerySample(t, "InsertUser", "insert")
+	if got := after.Count - before.Count; got != 3 {
+		t.Errorf("db_query_duration_seconds samples += %d, want 3", got)
+	}
+	if got := after.Rows - before.Rows; got != 2 {
+		t.Errorf("db_query_rows_total += %v, want 2", got)
+	}
+	if got := after.Errors - before.Errors; got != 1 {
+		t.Errorf("db_query_errors_total += %v, want 1", got)
+	}
+	if got := after.Slow - before.Slow; got != 3 {
+		t.Errorf("db_slow_queries_total += %v, want 3", got)
+	}
+
+	// 交易中的讀取也算在外層的 Database 方法
+	if got := gatherQuerySample(t, "InsertUser", "select"); got.Count == 0 || got.Rows == 0 {
+		t.Errorf("InsertUser select sample = %+v, want the read-back counted", got)
+	}
+
+	stat := queryMetric("InsertUser", "insert")
+	if stat.Count-beforeStat.Count != 3 || stat.Errors-beforeStat.Errors != 1 ||
+		stat.Rows-beforeStat.Rows != 2 || stat.Slow-beforeStat.Slow != 3 {
+		t.Errorf("QueryMetrics entry = %+v (before %+v), want 3 calls, 1 error, 2 rows, 3 slow", stat, beforeStat)
+	}
+	if stat.AvgMs <= 0 || stat.MaxMs < stat.AvgMs {
+		t.Errorf("QueryMetrics durations = avg %v max %v", stat.AvgMs, stat.MaxMs)
+	}
+}
+
+func TestWithOperation(t *testing.T) {
+	if got := operationFrom(context.Background()); got != "" {
+		t.Fatalf("operationFrom(Background) = %q, want empty", got)
+	}
+	// 巢狀的 Database 方法保留外層的名稱
+	ctx := withOperation(context.Background(), "UpdateUser")
+	if got := operationFrom(withOperation(ctx, "PatchUser")); got != "UpdateUser" {
+		t.Fatalf("nested operation = %q, want UpdateUser", got)
+	}
+
+	// 沒有操作名稱的呼叫（例如 golang-migrate 執行的遷移）歸為 other
+	d := newTestDatabase(t)
+	before := gatherQuerySample(t, "other", "select")
+	db, err := d.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("SELECT 1"); err != nil {
+		t.Fatalf("SELECT 1: %v", err)
+	}
+	if got := gatherQuerySample(t, "other", "select").Count - before.Count; got != 1 {
+		t.Fatalf("other select samples += %d, want 1", got)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMigrationLockLostCancelsOperation(t *testing.T) {
+	d := newTestDatabase(t, "--db-migration-lock-ttl", "30ms")
+
+	err := d.withMigrationLock("test", func(ctx context.Context) error {
+		// 模擬其他執行個體在租約過期後接手
+		db, err := d.OpenDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		if _, err := db.Exec(`UPDATE schema_migration_lock SET owner = 'someone-else' WHERE id = 1`); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(5 * time.Second):
+			t.Error("operation was not cancelled after the lock was lost")
+			return nil
+		}
+	})
+	if !errors.Is(err, ErrMigrationLockLost) {
+		t.Fatalf("err = %v, want ErrMigrationLockLost", err)
+	}
+}
+
+func TestMigrationLockKeepsRenewing(t *testing.T) {
+	d := newTestDatabase(t, "--db-migration-lock-ttl", "30ms")
+
+	err := d.withMigrationLock("test", func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			t.Errorf("operation cancelled while holding the lock: %v", context.Cause(ctx))
+		case <-time.After(100 * time.Millisecond):
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("withMigrationLock: %v", err)
+	}
+}
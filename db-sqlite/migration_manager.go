@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// 遷移方向
+const (
+	MigrationDirectionUp   = "up"
+	MigrationDirectionDown = "down"
+)
+
+// MigrationInfo 單一遷移檔案的狀態
+type MigrationInfo struct {
+	Version uint   `json:"version"`
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+	HasDown bool   `json:"hasDown"`
+}
+
+// MigrationStatus 資料庫目前的遷移狀態，CurrentVersion 為 0 表示尚未套用任何遷移
+// Ahead 為 true 表示資料庫版本比最新的遷移檔案還新（遷移檔案缺漏）
+type MigrationStatus struct {
+	CurrentVersion uint            `json:"currentVersion"`
+	Dirty          bool            `json:"dirty"`
+	LatestVersion  uint            `json:"latestVersion"`
+	Ahead          bool            `json:"ahead"`
+	Applied        []MigrationInfo `json:"applied"`
+	Pending        []MigrationInfo `json:"pending"`
+}
+
+// MigrationStep 遷移計畫中的一個步驟，SQL 為將要執行的檔案內容
+type MigrationStep struct {
+	Version   uint   `json:"version"`
+	Name      string `json:"name"`
+	Direction string `json:"direction"`
+	SQL       string `json:"sql"`
+}
+
+// MigrationPlan 遷移計畫；DryRun 為 true 時只列出步驟與 SQL，不會執行
+type MigrationPlan struct {
+	FromVersion uint            `json:"fromVersion"`
+	ToVersion   uint            `json:"toVersion"`
+	DryRun      bool            `json:"dryRun"`
+	Steps       []MigrationStep `json:"steps"`
+}
+
+// migrationSet 遷移來源中所有的遷移檔案（依版本遞增排序）
+type migrationSet struct {
+	src        source.Driver
+	migrations []MigrationInfo
+}
+
+// openMigrationSet 讀取遷移來源中的所有版本，呼叫端負責 close
+func openMigrationSet() (*migrationSet, error) {
+	src, err := openMigrationSource()
+	if err != nil {
+		return nil, err
+	}
+
+	set := &migrationSet{src: src}
+	version, err := src.First()
+	for err == nil {
+		info := MigrationInfo{Version: version}
+		if r, name, readErr := src.ReadUp(version); readErr == nil {
+			r.Close()
+			info.Name = name
+		}
+		if r, name, readErr := src.ReadDown(version); readErr == nil {
+			r.Close()
+			info.HasDown = true
+			if info.Name == "" {
+				info.Name = name
+			}
+		}
+		set.migrations = append(set.migrations, info)
+		version, err = src.Next(version)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		src.Close()
+		return nil, fmt.Errorf("failed to read migration source: %w", err)
+	}
+	return set, nil
+}
+
+func (s *migrationSet) close() {
+	s.src.Close()
+}
+
+// index 回傳版本在清單中的位置；版本 0 回傳 -1，不存在時回傳 -2
+func (s *migrationSet) index(version uint) int {
+	if version == 0 {
+		return -1
+	}
+	for i, info := range s.migrations {
+		if info.Version == version {
+			return i
+		}
+	}
+	return -2
+}
+
+func (s *migrationSet) latest() uint {
+	if len(s.migrations) == 0 {
+		return 0
+	}
+	return s.migrations[len(s.migrations)-1].Version
+}
+
+// step 讀取單一版本指定方向的 SQL
+func (s *migrationSet) step(info MigrationInfo, direction string) (MigrationStep, error) {
+	var (
+		r   io.ReadCloser
+		err error
+	)
+	if direction == MigrationDirectionUp {
+		r, _, err = s.src.ReadUp(info.Version)
+	} else {
+		r, _, err = s.src.ReadDown(info.Version)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return MigrationStep{}, fmt.Errorf("migration %d (%s) has no %s file", info.Version, info.Name, direction)
+	}
+	if err != nil {
+		return MigrationStep{}, fmt.Errorf("failed to read migration %d: %w", info.Version, err)
+	}
+	defer r.Close()
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return MigrationStep{}, fmt.Errorf("failed to read migration %d: %w", info.Version, err)
+	}
+	return MigrationStep{Version: info.Version, Name: info.Name, Direction: direction, SQL: string(body)}, nil
+}
+
+// plan 計算從 from 遷移到 to 需要依序執行的步驟
+func (s *migrationSet) plan(from, to uint) (*MigrationPlan, error) {
+	fromIdx, toIdx := s.index(from), s.index(to)
+	if fromIdx == -2 {
+		return nil, fmt.Errorf("current version %d has no migration file", from)
+	}
+	if toIdx == -2 {
+		return nil, newValidationError("target", fmt.Sprintf("version %d does not exist", to))
+	}
+
+	plan := &MigrationPlan{FromVersion: from, ToVersion: to, Steps: []MigrationStep{}}
+	for i := fromIdx + 1; i <= toIdx; i++ {
+		step, err := s.step(s.migrations[i], MigrationDirectionUp)
+		if err != nil {
+			return nil, err
+		}
+		plan.Steps = append(plan.Steps, step)
+	}
+	for i := fromIdx; i > toIdx; i-- {
+		step, err := s.step(s.migrations[i], MigrationDirectionDown)
+		if err != nil {
+			return nil, err
+		}
+		plan.Steps = append(plan.Steps, step)
+	}
+	return plan, nil
+}
+
+// currentMigrationVersion 讀取資料庫目前的版本，尚未遷移時回傳 0
+func currentMigrationVersion(m *migrate.Migrate) (uint, bool, error) {
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get current version: %w", err)
+	}
+	return version, dirty, nil
+}
+
+// GetMigrationStatus 取得目前版本與已套用 / 待套用的遷移
+func (d *Database) GetMigrationStatus() (*MigrationStatus, error) {
+	set, err := openMigrationSet()
+	if err != nil {
+		return nil, err
+	}
+	defer set.close()
+
+	m, err := d.newMigrate()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+
+	current, dirty, err := currentMigrationVersion(m)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &MigrationStatus{
+		CurrentVersion: current,
+		Dirty:          dirty,
+		LatestVersion:  set.latest(),
+		Ahead:          current > set.latest(),
+		Applied:        []MigrationInfo{},
+		Pending:        []MigrationInfo{},
+	}
+	for _, info := range set.migrations {
+		if info.Version <= current {
+			info.Applied = true
+			status.Applied = append(status.Applied, info)
+		} else {
+			status.Pending = append(status.Pending, info)
+		}
+	}
+	return status, nil
+}
+
+// MigrateTo 遷移到指定版本（0 表示全部回復），版本較舊時會依序執行 down 檔案
+func (d *Database) MigrateTo(target uint, dryRun bool) (*MigrationPlan, error) {
+	return d.migrate(dryRun, func(set *migrationSet, current uint) (uint, error) {
+		return target, nil
+	})
+}
+
+// MigrateSteps 相對目前版本前進（正數）或回復（負數）n 個遷移
+func (d *Database) MigrateSteps(n int, dryRun bool) (*MigrationPlan, error) {
+	if n == 0 {
+		return nil, newValidationError("steps", "steps must not be zero")
+	}
+	return d.migrate(dryRun, func(set *migrationSet, current uint) (uint, error) {
+		idx := set.index(current)
+		if idx == -2 {
+			return 0, fmt.Errorf("current version %d has no migration file", current)
+		}
+		next := idx + n
+		if next < -1 || next >= len(set.migrations) {
+			return 0, newValidationError("steps", fmt.Sprintf("cannot move %d step(s) from version %d", n, current))
+		}
+		if next == -1 {
+			return 0, nil
+		}
+		return set.migrations[next].Version, nil
+	})
+}
+
+// RedoMigration 回復目前版本後再重新套用一次
+func (d *Database) RedoMigration(dryRun bool) (*MigrationPlan, error) {
+	return d.withPlanLock("redo", dryRun, d.redoMigration)
+}
+
+// redoMigration RedoMigration 的實作，非 dryRun 時呼叫端需持有遷移鎖
+func (d *Database) redoMigration(ctx context.Context, dryRun bool) (*MigrationPlan, error) {
+	set, err := openMigrationSet()
+	if err != nil {
+		return nil, err
+	}
+	defer set.close()
+
+	m, err := d.newMigrate()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+
+	current, dirty, err := currentMigrationVersion(m)
+	if err != nil {
+		return nil, err
+	}
+	if dirty {
+		return nil, fmt.Errorf("database is dirty at version %d, inspect and recover it before migrating", current)
+	}
+	idx := set.index(current)
+	if idx < 0 {
+		return nil, fmt.Errorf("no applied migration to redo (current version %d)", current)
+	}
+
+	info := set.migrations[idx]
+	down, err := set.step(info, MigrationDirectionDown)
+	if err != nil {
+		return nil, err
+	}
+	up, err := set.step(info, MigrationDirectionUp)
+	if err != nil {
+		return nil, err
+	}
+	plan := &MigrationPlan{FromVersion: current, ToVersion: current, DryRun: dryRun, Steps: []MigrationStep{down, up}}
+	logMigrationPlan(plan)
+	if dryRun {
+		return plan, nil
+	}
+
+	defer stopOnLockLoss(ctx, m)()
+	if err := m.Steps(-1); err != nil {
+		return plan, fmt.Errorf("failed to roll back migration %d: %w", current, err)
+	}
+	if err := m.Steps(1); err != nil {
+		return plan, fmt.Errorf("failed to re-apply migration %d: %w", current, err)
+	}
+	logFor("migration").Info("Migration redone", "version", current)
+	return plan, nil
+}
+
+// migrate 依 resolveTarget 算出目標版本、產生計畫，非 dryRun 時取得遷移鎖後才實際執行
+func (d *Database) migrate(dryRun bool, resolveTarget func(set *migrationSet, current uint) (uint, error)) (*MigrationPlan, error) {
+	return d.withPlanLock("migrate", dryRun, func(ctx context.Context, dryRun bool) (*MigrationPlan, error) {
+		return d.migrateUnlocked(ctx, dryRun, resolveTarget)
+	})
+}
+
+// withPlanLock dry run 不修改資料庫，直接執行；實際執行時在遷移鎖內進行，
+// 讀取目前版本與套用遷移之間不會被其他執行個體插入
+func (d *Database) withPlanLock(operation string, dryRun bool, run func(ctx context.Context, dryRun bool) (*MigrationPlan, error)) (*MigrationPlan, error) {
+	if dryRun {
+		return run(context.Background(), true)
+	}
+	var plan *MigrationPlan
+	err := d.withMigrationLock(operation, func(ctx context.Context) error {
+		var err error
+		plan, err = run(ctx, false)
+		return err
+	})
+	return plan, err
+}
+
+// migrateUnlocked migrate 的實作，非 dryRun 時呼叫端需持有遷移鎖
+func (d *Database) migrateUnlocked(ctx context.Context, dryRun bool, resolveTarget func(set *migrationSet, current uint) (uint, error)) (*MigrationPlan, error) {
+	set, err := openMigrationSet()
+	if err != nil {
+		return nil, err
+	}
+	defer set.close()
+
+	m, err := d.newMigrate()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+
+	current, dirty, err := currentMigrationVersion(m)
+	if err != nil {
+		return nil, err
+	}
+	if dirty {
+		return nil, fmt.Errorf("database is dirty at version %d, inspect and recover it before migrating", current)
+	}
+
+	target, err := resolveTarget(set, current)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := set.plan(current, target)
+	if err != nil {
+		return nil, err
+	}
+	plan.DryRun = dryRun
+	logMigrationPlan(plan)
+	if dryRun || len(plan.Steps) == 0 {
+		return plan, nil
+	}
+
+	defer stopOnLockLoss(ctx, m)()
+	start := time.Now()
+	if target == 0 {
+		err = m.Down()
+	} else {
+		err = m.Migrate(target)
+	}
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return plan, fmt.Errorf("failed to migrate from %d to %d: %w", current, target, err)
+	}
+	logOperation("migration", "migrate", start, nil, "Database migrated", "from", current, "to", target)
+	return plan, nil
+}
+
+// logMigrationPlan 將計畫寫入日誌；dry run 時一併列出每個步驟將執行的 SQL
+func logMigrationPlan(plan *MigrationPlan) {
+	if !plan.DryRun {
+		logFor("migration").Info("Applying migration plan", "from", plan.FromVersion, "to", plan.ToVersion, "steps", len(plan.Steps))
+		for _, step := range plan.Steps {
+			logFor("migration").Info("Migration step", "direction", step.Direction, "version", step.Version, "name", step.Name)
+		}
+		return
+	}
+
+	logFor("migration").Info("Migration plan (dry run)", "from", plan.FromVersion, "to", plan.ToVersion, "steps", len(plan.Steps))
+	for _, step := range plan.Steps {
+		logFor("migration").Info("Migration step SQL (dry run)", "direction", step.Direction, "version", step.Version, "name", step.Name,
+			"sql", strings.TrimSpace(step.SQL))
+	}
+}
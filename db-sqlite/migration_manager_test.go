@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// hasUserColumn users 資料表是否有指定欄位；資料表不存在時回傳 false
+func hasUserColumn(t *testing.T, d *Database, column string) bool {
+	t.Helper()
+	db, err := d.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('users') WHERE name = ?", column).Scan(&n); err != nil {
+		t.Fatalf("read users columns: %v", err)
+	}
+	return n > 0
+}
+
+// planSteps 將計畫寫成 "<版本> <方向>" 的清單，方便比對
+func planSteps(plan *MigrationPlan) []string {
+	steps := make([]string, 0, len(plan.Steps))
+	for _, step := range plan.Steps {
+		steps = append(steps, fmt.Sprintf("%d %s", step.Version, step.Direction))
+	}
+	return steps
+}
+
+// assertMigrationVersion 檢查目前版本與待套用的遷移數量
+func assertMigrationVersion(t *testing.T, d *Database, version uint, pending int) {
+	t.Helper()
+	status, err := d.GetMigrationStatus()
+	if err != nil {
+		t.Fatalf("GetMigrationStatus: %v", err)
+	}
+	if status.CurrentVersion != version || status.Dirty || len(status.Pending) != pending || status.LatestVersion != 4 {
+		t.Fatalf("status = version %d (dirty %v, latest %d) with %d pending, want version %d with %d pending",
+			status.CurrentVersion, status.Dirty, status.LatestVersion, len(status.Pending), version, pending)
+	}
+}
+
+func TestMigrationManagement(t *testing.T) {
+	d := newTestDatabase(t)
+	assertMigrationVersion(t, d, 4, 0)
+
+	// dry run 只回傳計畫與 SQL，不修改資料庫
+	plan, err := d.MigrateTo(2, true)
+	if err != nil {
+		t.Fatalf("MigrateTo(2) dry run: %v", err)
+	}
+	if got := fmt.Sprint(planSteps(plan)); got != "[4 down 3 down]" || !plan.DryRun || plan.Steps[1].SQL == "" {
+		t.Fatalf("dry run plan = %s (dry run %v)", got, plan.DryRun)
+	}
+	assertMigrationVersion(t, d, 4, 0)
+
+	// goto：回復到 2，版本欄位（遷移 3）被移除
+	if _, err := d.MigrateTo(2, false); err != nil {
+		t.Fatalf("MigrateTo(2): %v", err)
+	}
+	assertMigrationVersion(t, d, 2, 2)
+	if hasUserColumn(t, d, "version") {
+		t.Fatal("users.version still exists after migrating down to 2")
+	}
+
+	// up 一步：重新加入版本欄位
+	if plan, err = d.MigrateSteps(1, false); err != nil {
+		t.Fatalf("MigrateSteps(1): %v", err)
+	}
+	if got := fmt.Sprint(planSteps(plan)); got != "[3 up]" {
+		t.Fatalf("MigrateSteps(1) plan = %s", got)
+	}
+	assertMigrationVersion(t, d, 3, 1)
+	if !hasUserColumn(t, d, "version") {
+		t.Fatal("users.version is missing after migrating up to 3")
+	}
+
+	// redo：回復後再套用目前版本，版本不變
+	if plan, err = d.RedoMigration(false); err != nil {
+		t.Fatalf("RedoMigration: %v", err)
+	}
+	if got := fmt.Sprint(planSteps(plan)); got != "[3 down 3 up]" {
+		t.Fatalf("RedoMigration plan = %s", got)
+	}
+	assertMigrationVersion(t, d, 3, 1)
+
+	// 超出範圍的目標不執行任何步驟
+	var verr *ValidationError
+	for name, run := range map[string]func() (*MigrationPlan, error){
+		"missing version": func() (*MigrationPlan, error) { return d.MigrateTo(9, false) },
+		"too many steps":  func() (*MigrationPlan, error) { return d.MigrateSteps(-4, false) },
+		"zero steps":      func() (*MigrationPlan, error) { return d.MigrateSteps(0, false) },
+	} {
+		if _, err := run(); !errors.As(err, &verr) {
+			t.Fatalf("%s: err = %v, want *ValidationError", name, err)
+		}
+	}
+	assertMigrationVersion(t, d, 3, 1)
+
+	// down 到 0：全部回復
+	if plan, err = d.MigrateTo(0, false); err != nil {
+		t.Fatalf("MigrateTo(0): %v", err)
+	}
+	if got := fmt.Sprint(planSteps(plan)); got != "[3 down 2 down 1 down]" {
+		t.Fatalf("MigrateTo(0) plan = %s", got)
+	}
+	assertMigrationVersion(t, d, 0, 4)
+	if hasUserColumn(t, d, "id") {
+		t.Fatal("users table still exists after migrating down to 0")
+	}
+
+	// 回到最新版本
+	if _, err := d.MigrateSteps(4, false); err != nil {
+		t.Fatalf("MigrateSteps(4): %v", err)
+	}
+	assertMigrationVersion(t, d, 4, 0)
+}
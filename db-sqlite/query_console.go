@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// 查詢主控台的執行模式
+const (
+	QueryModeRead    = "read"
+	QueryModeWrite   = "write"
+	QueryModeExplain = "explain"
+)
+
+// 查詢主控台的預設限制
+const (
+	queryHistoryLimit = 200
+)
+
+// queryReadVerbs 不會修改資料的敘述開頭
+var queryReadVerbs = map[string]bool{
+	"SELECT":   true,
+	"WITH":     true,
+	"SHOW":     true,
+	"DESCRIBE": true,
+	"DESC":     true,
+	"EXPLAIN":  true,
+	"VALUES":   true,
+	"TABLE":    true,
+	"PRAGMA":   true,
+}
+
+// queryWriteKeywords 出現在讀取敘述中仍代表寫入或鎖定的關鍵字，例如 WITH ... DELETE、SELECT ... INTO、
+// SELECT ... FOR UPDATE、EXPLAIN ANALYZE UPDATE
+var queryWriteKeywords = map[string]bool{
+	"INSERT":   true,
+	"UPDATE":   true,
+	"DELETE":   true,
+	"MERGE":    true,
+	"UPSERT":   true,
+	"INTO":     true,
+	"CREATE":   true,
+	"DROP":     true,
+	"ALTER":    true,
+	"TRUNCATE": true,
+	"GRANT":    true,
+	"REVOKE":   true,
+	"CALL":     true,
+	"LOCK":     true,
+	"COPY":     true,
+}
+
+// queryReadPragmas 帶參數時仍為唯讀的 PRAGMA
+var queryReadPragmas = map[string]bool{
+	"TABLE_INFO":        true,
+	"TABLE_XINFO":       true,
+	"INDEX_LIST":        true,
+	"INDEX_INFO":        true,
+	"INDEX_XINFO":       true,
+	"FOREIGN_KEY_LIST":  true,
+	"FOREIGN_KEY_CHECK": true,
+	"INTEGRITY_CHECK":   true,
+	"QUICK_CHECK":       true,
+}
+
+// queryWriteModeMu 保護 Database.QueryWriteMode，綁定方法可能被前端並行呼叫
+var queryWriteModeMu sync.RWMutex
+
+// queryHistoryMu 保護查詢紀錄檔的讀寫
+var queryHistoryMu sync.Mutex
+
+// QueryColumn 結果欄位的名稱與資料庫型別
+type QueryColumn struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable *bool  `json:"nullable,omitempty"`
+}
+
+// QueryResult 查詢主控台的執行結果；寫入敘述只有 RowsAffected，不回傳資料列
+type QueryResult struct {
+	Mode         string          `json:"mode"`
+	Statement    string          `json:"statement"`
+	Columns      []QueryColumn   `json:"columns"`
+	Rows         [][]interface{} `json:"rows"`
+	RowCount     int             `json:"rowCount"`
+	Truncated    bool            `json:"truncated"`
+	RowsAffected int64           `json:"rowsAffected"`
+	DurationMs   int64           `json:"durationMs"`
+}
+
+// QueryHistoryEntry 查詢紀錄；Error 為空表示執行成功
+type QueryHistoryEntry struct {
+	ExecutedAt string        `json:"executedAt"`
+	Mode       string        `json:"mode"`
+	Statement  string        `json:"statement"`
+	Query      string        `json:"query"`
+	Params     []interface{} `json:"params,omitempty"`
+	Rows       int64         `json:"rows"`
+	DurationMs int64         `json:"durationMs"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// sqlStatement 敘述分析結果
+type sqlStatement struct {
+	Verb  string
+	Write bool
+}
+
+// analyzeSQL 略過註解與字串後取出關鍵字，判斷敘述是否會寫入；只允許單一敘述（結尾的分號可省略）
+func analyzeSQL(text string) (*sqlStatement, error) {
+	var words []string
+	hasAssign := false
+	pragmaCall := ""
+	ended := false
+
+	runes := []rune(text)
+	n := len(runes)
+	for i := 0; i < n; {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+			continue
+		case c == '-' && i+1 < n && runes[i+1] == '-', c == '#' && sqlHashComments:
+			for i < n && runes[i] != '\n' {
+				i++
+			}
+			continue
+		case c == '/' && i+1 < n && runes[i+1] == '*':
+			// MySQL 會執行 /*! ... */ 中的內容，無法判斷，一律視為寫入
+			if sqlHashComments && i+2 < n && runes[i+2] == '!' {
+				verb := "/*!"
+				if len(words) > 0 {
+					verb = words[0]
+				}
+				return &sqlStatement{Verb: verb, Write: true}, nil
+			}
+			end := indexRunes(runes, i+2, "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i = end + 2
+			continue
+		}
+
+		if ended {
+			return nil, fmt.Errorf("only a single statement is allowed")
+		}
+
+		switch {
+		case c == ';':
+			ended = true
+			i++
+		case c == '\'' || c == '"' || c == '`':
+			backslash := sqlBackslashEscapes && c != '`'
+			// PostgreSQL 的 E'...' 字串使用反斜線跳脫
+			if c == '\'' && i > 0 && (runes[i-1] == 'E' || runes[i-1] == 'e') && (i < 2 || !isIdentRune(runes[i-2])) {
+				backslash = true
+			}
+			end, err := skipQuoted(runes, i, c, backslash)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case c == '$' && sqlDollarQuotes && !(i > 0 && isIdentRune(runes[i-1])):
+			tagEnd := i + 1
+			for tagEnd < n && (unicode.IsLetter(runes[tagEnd]) || runes[tagEnd] == '_' || (tagEnd > i+1 && unicode.IsDigit(runes[tagEnd]))) {
+				tagEnd++
+			}
+			if tagEnd >= n || runes[tagEnd] != '$' {
+				// $1 之類的參數佔位符
+				i = tagEnd
+				continue
+			}
+			tag := string(runes[i : tagEnd+1])
+			end := indexRunes(runes, tagEnd+1, tag)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated dollar-quoted string")
+			}
+			i = end + len([]rune(tag))
+		case isIdentRune(c):
+			start := i
+			for i < n && isIdentRune(runes[i]) {
+				i++
+			}
+			words = append(words, strings.ToUpper(string(runes[start:i])))
+		default:
+			if c == '=' || (c == ':' && i+1 < n && runes[i+1] == '=') {
+				hasAssign = true
+			}
+			if c == '(' && pragmaCall == "" && len(words) > 0 {
+				pragmaCall = words[len(words)-1]
+			}
+			i++
+		}
+	}
+
+	if len(words) == 0 {
+		return nil, fmt.Errorf("query is empty")
+	}
+	stmt := &sqlStatement{Verb: words[0]}
+	if !queryReadVerbs[stmt.Verb] {
+		stmt.Write = true
+		return stmt, nil
+	}
+	if stmt.Verb == "PRAGMA" {
+		// PRAGMA name 只讀取設定；PRAGMA name = value 與 PRAGMA name(value) 會修改設定，table_info(t) 等查詢例外
+		stmt.Write = hasAssign || (pragmaCall != "" && !queryReadPragmas[pragmaCall])
+		return stmt, nil
+	}
+	for _, word := range words[1:] {
+		if queryWriteKeywords[word] {
+			stmt.Write = true
+			break
+		}
+	}
+	return stmt, nil
+}
+
+// indexRunes 回傳 pattern 從 from 開始第一次出現的位置，找不到時回傳 -1
+func indexRunes(runes []rune, from int, pattern string) int {
+	target := []rune(pattern)
+	for i := from; i+len(target) <= len(runes); i++ {
+		if string(runes[i:i+len(target)]) == pattern {
+			return i
+		}
+	}
+	return -1
+}
+
+func isIdentRune(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+// skipQuoted 回傳引號字串結束後的位置；連續兩個引號代表引號本身
+func skipQuoted(runes []rune, start int, quote rune, backslash bool) (int, error) {
+	for i := start + 1; i < len(runes); i++ {
+		switch {
+		case backslash && runes[i] == '\\':
+			i++
+		case runes[i] == quote:
+			if i+1 < len(runes) && runes[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated quoted string")
+}
+
+// QueryWriteModeEnabled 回傳查詢主控台是否允許寫入敘述
+func (d *Database) QueryWriteModeEnabled() bool {
+	queryWriteModeMu.RLock()
+	defer queryWriteModeMu.RUnlock()
+	return d.QueryWriteMode
+}
+
+// SetQueryWriteMode 開啟或關閉查詢主控台的寫入模式
+func (d *Database) SetQueryWriteMode(enabled bool) {
+	queryWriteModeMu.Lock()
+	d.QueryWriteMode = enabled
+	queryWriteModeMu.Unlock()
+	logFor("query").Info("Query console write mode changed", "enabled", enabled, "actor", d.Actor())
+}
+
+// queryLimits 查詢主控台的筆數上限（DB_QUERY_MAX_ROWS）與執行時間上限（DB_QUERY_TIMEOUT）
+func queryLimits() (int, time.Duration) {
+	cfg := appConfig()
+	return cfg.QueryMaxRows, cfg.QueryTimeout
+}
+
+// ExecuteQuery 執行單一 SQL 敘述；讀取敘述在唯讀交易中執行並受筆數上限限制，
+// 寫入敘述必須先開啟寫入模式，在交易中執行後提交。params 依各資料庫的佔位符語法綁定
+func (d *Database) ExecuteQuery(text string, params []interface{}) (*QueryResult, error) {
+	stmt, err := analyzeSQL(text)
+	if err != nil {
+		return nil, newValidationError("query", err.Error())
+	}
+	mode := QueryModeRead
+	if stmt.Write {
+		if !d.QueryWriteModeEnabled() {
+			return nil, newValidationError("query", fmt.Sprintf("%s statements are not allowed unless write mode is enabled", stmt.Verb))
+		}
+		mode = QueryModeWrite
+	}
+	return d.runConsoleQuery(withOperation(context.Background(), "ExecuteQuery"), mode, stmt.Verb, text, text, params)
+}
+
+// ExplainQuery 回傳單一 SQL 敘述的執行計畫（不實際執行敘述），寫入敘述也可以查看
+func (d *Database) ExplainQuery(text string, params []interface{}) (*QueryResult, error) {
+	stmt, err := analyzeSQL(text)
+	if err != nil {
+		return nil, newValidationError("query", err.Error())
+	}
+	if stmt.Verb == "EXPLAIN" {
+		return nil, newValidationError("query", "query is already an EXPLAIN statement")
+	}
+	query := explainPrefix + strings.TrimSuffix(strings.TrimSpace(text), ";")
+	return d.runConsoleQuery(withOperation(context.Background(), "ExplainQuery"), QueryModeExplain, stmt.Verb, text, query, params)
+}
+
+// runConsoleQuery 執行查詢並寫入查詢紀錄
+func (d *Database) runConsoleQuery(ctx context.Context, mode, verb, text, query string, params []interface{}) (*QueryResult, error) {
+	args := make([]interface{}, len(params))
+	for i, p := range params {
+		args[i] = browseArg(p)
+	}
+	maxRows, timeout := queryLimits()
+
+	started := time.Now()
+	result, err := d.executeConsoleQuery(ctx, mode, query, args, maxRows, timeout)
+	duration := time.Since(started)
+
+	entry := QueryHistoryEntry{
+		ExecutedAt: started.Format(time.RFC3339),
+		Mode:       mode,
+		Statement:  verb,
+		Query:      text,
+		Params:     params,
+		DurationMs: duration.Milliseconds(),
+	}
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("query exceeded the %s time limit: %w", timeout, err)
+		}
+		entry.Error = err.Error()
+	} else {
+		result.Mode, result.Statement, result.DurationMs = mode, verb, duration.Milliseconds()
+		entry.Rows = int64(result.RowCount)
+		if mode == QueryModeWrite {
+			entry.Rows = result.RowsAffected
+		}
+	}
+	if histErr := appendQueryHistory(entry); histErr != nil {
+		logFor("query").Warn("Failed to record query history", "error", histErr)
+	}
+	if mode == QueryModeWrite {
+		logOperation("query", "query."+verb, started, err, "Query console write",
+			"actor", d.Actor(), "query", firstLine(text), "rows", entry.Rows)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	return result, nil
+}
+
+func (d *Database) executeConsoleQuery(ctx context.Context, mode, query string, args []interface{}, maxRows int, timeout time.Duration) (*QueryResult, error) {
+	db, err := d.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result := &QueryResult{Columns: []QueryColumn{}, Rows: [][]interface{}{}}
+	if mode == QueryModeWrite {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start transaction: %w", err)
+		}
+		defer tx.Rollback()
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		if result.RowsAffected, err = res.RowsAffected(); err != nil {
+			result.RowsAffected = -1
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit: %w", err)
+		}
+		return result, nil
+	}
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start read-only transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := guardReadOnly(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns: %w", err)
+	}
+	for _, ct := range types {
+		column := QueryColumn{Name: ct.Name(), Type: ct.DatabaseTypeName()}
+		if nullable, ok := ct.Nullable(); ok {
+			column.Nullable = &nullable
+		}
+		result.Columns = append(result.Columns, column)
+	}
+
+	for rows.Next() {
+		if len(result.Rows) == maxRows {
+			result.Truncated = true
+			break
+		}
+		values := make([]interface{}, len(types))
+		valuePtrs := make([]interface{}, len(types))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		for i := range values {
+			values[i] = browseValue(values[i])
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	result.RowCount = len(result.Rows)
+	return result, nil
+}
+
+// queryHistoryPath 查詢紀錄檔的位置（DB_QUERY_HISTORY_FILE，預設 query_history.jsonl），每行一筆 JSON
+func queryHistoryPath() string {
+	return appConfig().QueryHistoryFile
+}
+
+// appendQueryHistory 寫入一筆查詢紀錄
+func appendQueryHistory(entry QueryHistoryEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	queryHistoryMu.Lock()
+	defer queryHistoryMu.Unlock()
+
+	f, err := os.OpenFile(queryHistoryPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// GetQueryHistory 回傳最近的查詢紀錄（新的在前），limit 小於 1 或超過上限時使用 queryHistoryLimit
+func GetQueryHistory(limit int) ([]QueryHistoryEntry, error) {
+	if limit < 1 || limit > queryHistoryLimit {
+		limit = queryHistoryLimit
+	}
+	queryHistoryMu.Lock()
+	defer queryHistoryMu.Unlock()
+
+	entries := []QueryHistoryEntry{}
+	f, err := os.Open(queryHistoryPath())
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open query history: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var entry QueryHistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+		if len(entries) > limit {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read query history: %w", err)
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// ClearQueryHistory 刪除所有查詢紀錄
+func ClearQueryHistory() error {
+	queryHistoryMu.Lock()
+	defer queryHistoryMu.Unlock()
+	if err := os.Remove(queryHistoryPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear query history: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readRelayFile 讀取 file 代理寫入的訊息
+func readRelayFile(t *testing.T, path string) []fileMessage {
+	t.Helper()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var messages []fileMessage
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var msg fileMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.Fatalf("invalid relay line %q: %v", scanner.Text(), err)
+		}
+		messages = append(messages, msg)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return messages
+}
+
+// outboxEventIDs 依 id 順序回傳 user_outbox 中的事件 ID 與尚未發送的筆數
+func outboxEventIDs(t *testing.T, d *Database) ([]string, int) {
+	t.Helper()
+	db, err := d.OpenDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT event_id, published_at IS NULL FROM user_outbox ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var ids []string
+	unpublished := 0
+	for rows.Next() {
+		var id string
+		var pending bool
+		if err := rows.Scan(&id, &pending); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		if pending {
+			unpublished++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return ids, unpublished
+}
+
+func TestRelayPublishesToFileBroker(t *testing.T) {
+	d := newTestDatabase(t, "--db-outbox=true")
+	aliceID := insertTestUser(t, d, "Alice", "alice@example.com", 30)
+	insertTestUser(t, d, "Bob", "bob@example.com", 40)
+	if err := d.DeleteUser(aliceID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	eventIDs, _ := outboxEventIDs(t, d)
+	if len(eventIDs) != 3 {
+		t.Fatalf("outbox events = %v, want 3", eventIDs)
+	}
+
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	opts := RelayOptions{Broker: RelayBrokerFile, URL: path, PollInterval: 10 * time.Millisecond, RetryMaxDelay: time.Second, Retention: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- RunRelay(ctx, opts) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(readRelayFile(t, path)) < len(eventIDs) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("RunRelay: %v", err)
+	}
+
+	messages := readRelayFile(t, path)
+	wantTypes := []string{UserCreatedEvent, UserCreatedEvent, UserDeletedEvent}
+	if len(messages) != len(wantTypes) {
+		t.Fatalf("published %d messages, want %d", len(messages), len(wantTypes))
+	}
+	for i, msg := range messages {
+		if msg.MessageID != eventIDs[i] || msg.Type != wantTypes[i] {
+			t.Errorf("message %d = %s %s, want %s %s", i, msg.MessageID, msg.Type, eventIDs[i], wantTypes[i])
+		}
+	}
+	if _, unpublished := outboxEventIDs(t, d); unpublished != 0 {
+		t.Fatalf("%d events left unpublished", unpublished)
+	}
+}
+
+func TestRelayRetriesInOrder(t *testing.T) {
+	d := newTestDatabase(t, "--db-outbox=true")
+	insertTestUser(t, d, "Alice", "alice@example.com", 30)
+	insertTestUser(t, d, "Bob", "bob@example.com", 40)
+	ctx := context.Background()
+
+	// 目錄不存在，file 代理無法寫入
+	dir := filepath.Join(t.TempDir(), "missing")
+	path := filepath.Join(dir, "events.jsonl")
+	opts := RelayOptions{Broker: RelayBrokerFile, URL: path, RetryMaxDelay: time.Minute, Retention: time.Hour}
+	r := &outboxRelay{opts: opts, publisher: &filePublisher{path: path}}
+	defer r.close()
+	defer r.publisher.Close()
+
+	if _, err := r.relayBatch(ctx); err != nil {
+		t.Fatalf("relayBatch: %v", err)
+	}
+	var attempts int
+	var nextAttempt, lastError string
+	if err := r.db.QueryRow(`SELECT attempts, next_attempt_at, last_error FROM user_outbox ORDER BY id LIMIT 1`).
+		Scan(&attempts, &nextAttempt, &lastError); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 1 || nextAttempt == "" || lastError == "" {
+		t.Fatalf("first event: attempts %d, next_attempt_at %q, last_error %q; want a recorded failure", attempts, nextAttempt, lastError)
+	}
+
+	// 重試時間未到：不發送，後面的事件也不能先送出
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.relayBatch(ctx); err != nil {
+		t.Fatalf("relayBatch: %v", err)
+	}
+	if messages := readRelayFile(t, path); len(messages) != 0 {
+		t.Fatalf("published %d messages before the retry was due", len(messages))
+	}
+
+	if _, err := r.db.Exec(`UPDATE user_outbox SET next_attempt_at = NULL`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.relayBatch(ctx); err != nil {
+		t.Fatalf("relayBatch: %v", err)
+	}
+	eventIDs, unpublished := outboxEventIDs(t, d)
+	messages := readRelayFile(t, path)
+	if unpublished != 0 || len(messages) != 2 || messages[0].MessageID != eventIDs[0] || messages[1].MessageID != eventIDs[1] {
+		t.Fatalf("messages = %+v, want both events in outbox order", messages)
+	}
+}
+
+func TestRelayRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		maxDelay time.Duration
+		want     time.Duration
+	}{
+		{1, time.Minute, time.Second},
+		{2, time.Minute, 2 * time.Second},
+		{4, time.Minute, 8 * time.Second},
+		{7, time.Minute, time.Minute},
+		{1000, time.Minute, time.Minute},
+		{1, 500 * time.Millisecond, 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := relayRetryDelay(tt.attempts, tt.maxDelay); got != tt.want {
+			t.Errorf("relayRetryDelay(%d, %s) = %s, want %s", tt.attempts, tt.maxDelay, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestCheckSchemaDetectsDrift(t *testing.T) {
+	d := newTestDatabase(t)
+
+	report, err := d.CheckSchema()
+	if err != nil {
+		t.Fatalf("CheckSchema: %v", err)
+	}
+	if !report.InSync || len(report.Differences) != 0 || report.CurrentVersion != 4 {
+		t.Fatalf("fresh database report = %+v, want in sync at version 4", report)
+	}
+
+	// 手動修改過的資料表
+	db, err := d.OpenDB()
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	for _, stmt := range []string{
+		"ALTER TABLE users ADD COLUMN nickname TEXT",
+		"CREATE INDEX idx_users_age ON users (age)",
+		"DROP INDEX idx_users_deleted_at",
+		"DROP INDEX idx_user_audit_user_id",
+		"CREATE INDEX idx_user_audit_user_id ON user_audit (user_id)",
+		"CREATE TABLE notes (id INTEGER PRIMARY KEY)",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	db.Close()
+
+	report, err = d.CheckSchema()
+	if err != nil {
+		t.Fatalf("CheckSchema: %v", err)
+	}
+	var got []string
+	for _, diff := range report.Differences {
+		got = append(got, fmt.Sprintf("%s %s.%s", diff.Kind, diff.Table, diff.Name))
+	}
+	want := []string{
+		SchemaExtraTable + " notes.",
+		SchemaIndexChanged + " user_audit.idx_user_audit_user_id",
+		SchemaExtraColumn + " users.nickname",
+		SchemaMissingIndex + " users.idx_users_deleted_at",
+		SchemaExtraIndex + " users.idx_users_age",
+	}
+	slices.Sort(got)
+	slices.Sort(want)
+	if report.InSync || !slices.Equal(got, want) {
+		t.Fatalf("differences =\n  %v\nwant\n  %v", got, want)
+	}
+
+	// 比對的基準是目前版本，而不是最新版本：回復到舊版本的資料庫不算漂移
+	d = newTestDatabase(t)
+	if _, err := d.MigrateTo(2, false); err != nil {
+		t.Fatalf("MigrateTo(2): %v", err)
+	}
+	if report, err = d.CheckSchema(); err != nil || !report.InSync || report.CurrentVersion != 2 || report.LatestVersion != 4 {
+		t.Fatalf("report at version 2 = %+v, %v; want in sync", report, err)
+	}
+}
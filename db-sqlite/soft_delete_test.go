@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// insertTestUser 新增用戶並回傳其 id
+func insertTestUser(t *testing.T, d *Database, name, email string, age int) int {
+	t.Helper()
+	user, err := d.InsertUserReturning(name, email, age)
+	if err != nil {
+		t.Fatalf("InsertUserReturning(%s): %v", email, err)
+	}
+	id, _ := toInt64(user["id"])
+	return int(id)
+}
+
+func TestEmailReuseAfterSoftDelete(t *testing.T) {
+	d := newTestDatabase(t)
+	oldID := insertTestUser(t, d, "Alice", "alice@example.com", 30)
+	if err := d.DeleteUser(oldID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	// 軟刪除後 email 可以再使用，GetUserByEmail 只回傳未刪除的用戶
+	newID := insertTestUser(t, d, "Alice Again", "alice@example.com", 31)
+	if newID == oldID {
+		t.Fatalf("new user reused id %d", oldID)
+	}
+	if err := d.InsertUser("Alice Twice", "alice@example.com", 32); !errors.Is(err, ErrDuplicateEmail) {
+		t.Fatalf("InsertUser with live duplicate: err = %v, want ErrDuplicateEmail", err)
+	}
+
+	// 還原時 email 已被其他用戶使用
+	if err := d.RestoreUser(oldID); !errors.Is(err, ErrDuplicateEmail) {
+		t.Fatalf("RestoreUser: err = %v, want ErrDuplicateEmail", err)
+	}
+	deleted, err := d.GetDeletedUsers()
+	if err != nil {
+		t.Fatalf("GetDeletedUsers: %v", err)
+	}
+	if len(deleted) != 1 {
+		t.Fatalf("deleted users = %v, want the original alice to stay deleted", deleted)
+	}
+
+	// 釋出 email 後即可還原
+	if err := d.DeleteUser(newID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if err := d.RestoreUser(oldID); err != nil {
+		t.Fatalf("RestoreUser after the email was freed: %v", err)
+	}
+	user, err := d.GetUserByEmail("alice@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	if user["name"] != "Alice" {
+		t.Fatalf("live user = %v, want the restored alice", user)
+	}
+}
+
+func TestImportIgnoresSoftDeletedEmails(t *testing.T) {
+	d := newTestDatabase(t)
+	deletedID := insertTestUser(t, d, "Alice", "alice@example.com", 30)
+	if err := d.DeleteUser(deletedID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	insertTestUser(t, d, "Bob", "bob@example.com", 40)
+
+	path := filepath.Join(t.TempDir(), "users.ndjson")
+	data := `{"name":"Alice New","email":"alice@example.com","age":20}
+{"name":"Bob Updated","email":"bob@example.com","age":41}
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := d.ImportUsers(path, "", ImportModeUpsert, false)
+	if err != nil {
+		t.Fatalf("ImportUsers: %v", err)
+	}
+	if report.Inserted != 1 || report.Updated != 1 {
+		t.Fatalf("report = %+v, want 1 inserted and 1 updated", report)
+	}
+
+	alice, err := d.GetUserByEmail("alice@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	if id, _ := toInt64(alice["id"]); int(id) == deletedID || alice["name"] != "Alice New" {
+		t.Fatalf("alice = %v, want a new user instead of the restored one", alice)
+	}
+	bob, err := d.GetUserByEmail("bob@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	if bob["name"] != "Bob Updated" {
+		t.Fatalf("bob = %v, want the updated name", bob)
+	}
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	d := newTestDatabase(t)
+	deletedID := insertTestUser(t, d, "Alice", "alice@example.com", 30)
+	liveID := insertTestUser(t, d, "Bob", "bob@example.com", 40)
+	if err := d.DeleteUser(deletedID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	purged, err := d.PurgeDeleted(0)
+	if err != nil {
+		t.Fatalf("PurgeDeleted: %v", err)
+	}
+	if purged != 1 {
+		t.Fatalf("purged = %d, want 1", purged)
+	}
+	if deleted, err := d.GetDeletedUsers(); err != nil || len(deleted) != 0 {
+		t.Fatalf("GetDeletedUsers = %v, %v; want none", deleted, err)
+	}
+	if _, err := d.GetUserByID(liveID); err != nil {
+		t.Fatalf("GetUserByID(live user): %v", err)
+	}
+
+	audit, err := d.GetUserAudit(deletedID)
+	if err != nil {
+		t.Fatalf("GetUserAudit: %v", err)
+	}
+	if len(audit) == 0 || audit[len(audit)-1].Action != AuditActionPurge {
+		t.Fatalf("audit = %+v, want the purge recorded last", audit)
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// 追蹤匯出方式
+const (
+	TraceExporterNone = "none"
+	TraceExporterOTLP = "otlp" // 以 OTLP/HTTP 送到 collector
+	TraceExporterFile = "file" // 每個 span 一行 JSON，寫入檔案供離線分析
+)
+
+// tracerName 本程式建立 span 使用的 instrumentation 名稱
+const tracerName = "example"
+
+// TraceOptions 追蹤設定
+type TraceOptions struct {
+	Exporter    string // none、otlp 或 file
+	Endpoint    string // OTLP/HTTP collector 的網址，例如 http://localhost:4318
+	File        string // file 匯出器寫入的檔案
+	ServiceName string
+	DBSystem    string // db.system.name 屬性，例如 mysql、mongodb
+}
+
+var (
+	tracingMu      sync.Mutex
+	tracerProvider *sdktrace.TracerProvider
+	traceFile      io.Closer
+	traceDBSystem  string
+	tracingEnabled atomic.Bool
+
+	// 執行中的 App 方法，以 goroutine 編號為鍵：Database 方法沒有 context 參數，
+	// 資料庫呼叫以此找到所屬的 App 方法（Wails 與驅動程式都在呼叫端的 goroutine 中執行）
+	bindingTraces sync.Map // uint64 -> *bindingTrace
+)
+
+// InitTracing 依設定建立 TracerProvider；Exporter 為 none 時不建立 span
+func InitTracing(opts TraceOptions) error {
+	ShutdownTracing()
+	if opts.Exporter == "" || opts.Exporter == TraceExporterNone {
+		return nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	var closer io.Closer
+	var err error
+	switch opts.Exporter {
+	case TraceExporterOTLP:
+		exporter, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(opts.Endpoint))
+		if err != nil {
+			return fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+	case TraceExporterFile:
+		f, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open trace file: %w", err)
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("failed to create file exporter: %w", err)
+		}
+		closer = f
+	default:
+		return fmt.Errorf("unknown trace exporter %q (use none, otlp or file)", opts.Exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(opts.ServiceName)))
+	if err != nil {
+		res = resource.Default()
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+
+	tracingMu.Lock()
+	tracerProvider = provider
+	traceFile = closer
+	traceDBSystem = opts.DBSystem
+	tracingMu.Unlock()
+	otel.SetTracerProvider(provider)
+	tracingEnabled.Store(true)
+
+	target := opts.Endpoint
+	if opts.Exporter == TraceExporterFile {
+		target = opts.File
+	}
+	logFor("trace").Info("Tracing enabled", "exporter", opts.Exporter, "target", target)
+	return nil
+}
+
+// ShutdownTracing 送出尚未匯出的 span 並關閉匯出器
+func ShutdownTracing() {
+	tracingEnabled.Store(false)
+	tracingMu.Lock()
+	provider, closer := tracerProvider, traceFile
+	tracerProvider, traceFile = nil, nil
+	tracingMu.Unlock()
+	if provider == nil {
+		return
+	}
+
+	otel.SetTracerProvider(noop.NewTracerProvider())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := provider.Shutdown(ctx); err != nil {
+		logFor("trace").Warn("Failed to flush spans", "error", err)
+	}
+	if closer != nil {
+		closer.Close()
+	}
+}
+
+// tracer 目前的 Tracer
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// region <-- App 方法 -->
+
+// bindingTrace 一次 App 方法呼叫（或 HTTP 請求）的 span，以及其中目前的 Database 方法 span
+type bindingTrace struct {
+	mu        sync.Mutex
+	ctx       context.Context // App 方法的 span
+	operation string
+	opCtx     context.Context
+	opSpan    trace.Span
+	opEnd     time.Time // 最後一個資料庫呼叫結束的時間
+}
+
+// traceBinding 為 Wails 綁定的 App 方法建立 span，回傳的函式在方法結束時呼叫；errp 為 nil 表示方法不回傳錯誤：
+//
+//	func (a *App) CreateUser(name, email string, age int) (_ string, err error) {
+//		defer traceBinding("CreateUser", &err)()
+func traceBinding(method string, errp *error) func() {
+	_, end := traceGoroutine("App."+method, errp, trace.WithAttributes(semconv.CodeFunctionName("App."+method)))
+	return end
+}
+
+// traceGoroutine 建立 span 並登記為目前 goroutine 中資料庫呼叫的父 span，回傳的函式結束 span；
+// 已有登記的 span 時（例如 HTTP 請求中呼叫 App 方法）新的 span 為其子 span
+func traceGoroutine(name string, errp *error, opts ...trace.SpanStartOption) (trace.Span, func()) {
+	if !tracingEnabled.Load() {
+		return trace.SpanFromContext(context.Background()), func() {}
+	}
+	id := goroutineID()
+	parent := context.Background()
+	previous, _ := bindingTraces.Load(id)
+	if previous != nil {
+		parent = previous.(*bindingTrace).ctx
+	}
+	ctx, span := tracer().Start(parent, name, opts...)
+	bt := &bindingTrace{ctx: ctx}
+	bindingTraces.Store(id, bt)
+
+	return span, func() {
+		bt.endOperation()
+		if errp != nil && *errp != nil {
+			recordSpanError(span, *errp, "")
+		}
+		span.End()
+		if previous != nil {
+			bindingTraces.Store(id, previous)
+		} else {
+			bindingTraces.Delete(id)
+		}
+	}
+}
+
+// parent 回傳資料庫呼叫的父 span：operation 的 Database span，必要時結束前一個 Database span 並建立新的。
+// Database 方法沒有進入與離開的掛勾，span 從方法中第一個資料庫呼叫開始，到最後一個呼叫結束
+func (b *bindingTrace) parent(operation string, start time.Time) context.Context {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if operation == "" {
+		return b.ctx
+	}
+	if b.opSpan != nil && b.operation == operation {
+		return b.opCtx
+	}
+	b.endOperationLocked()
+	b.operation, b.opEnd = operation, start
+	b.opCtx, b.opSpan = tracer().Start(b.ctx, "Database."+operation, trace.WithTimestamp(start),
+		trace.WithAttributes(semconv.CodeFunctionName("Database."+operation)))
+	return b.opCtx
+}
+
+// finished 記錄資料庫呼叫結束的時間
+func (b *bindingTrace) finished(end time.Time) {
+	b.mu.Lock()
+	b.opEnd = end
+	b.mu.Unlock()
+}
+
+// endOperation 結束目前的 Database span
+func (b *bindingTrace) endOperation() {
+	b.mu.Lock()
+	b.endOperationLocked()
+	b.mu.Unlock()
+}
+
+// endOperationLocked 結束目前的 Database span，呼叫端須持有 b.mu
+func (b *bindingTrace) endOperationLocked() {
+	if b.opSpan == nil {
+		return
+	}
+	b.opSpan.End(trace.WithTimestamp(b.opEnd))
+	b.operation, b.opCtx, b.opSpan = "", nil, nil
+}
+
+// endregion
+
+// region <-- 資料庫呼叫 -->
+
+// querySpan 一次資料庫呼叫的 span
+type querySpan struct {
+	span    trace.Span
+	binding *bindingTrace
+}
+
+// startQuerySpan 為一次資料庫呼叫建立 span。父 span 依序為 ctx 中的 span、目前 App 方法中 operation 的 Database span；
+// 都沒有時（例如啟動時的遷移）為新的 trace
+func startQuerySpan(ctx context.Context, start time.Time, operation, command, statement string, attrs ...attribute.KeyValue) querySpan {
+	if !tracingEnabled.Load() || isUnobserved(ctx) {
+		return querySpan{}
+	}
+	var binding *bindingTrace
+	if ctx == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = context.Background()
+		if v, ok := bindingTraces.Load(goroutineID()); ok {
+			binding = v.(*bindingTrace)
+			ctx = binding.parent(operation, start)
+		}
+	}
+
+	tracingMu.Lock()
+	system := traceDBSystem
+	tracingMu.Unlock()
+	attrs = append(attrs, semconv.DBSystemNameKey.String(system), semconv.DBOperationName(command), semconv.DBQueryText(statement))
+	if operation != "" {
+		attrs = append(attrs, semconv.CodeFunctionName("Database."+operation))
+	}
+	_, span := tracer().Start(ctx, command, trace.WithSpanKind(trace.SpanKindClient), trace.WithTimestamp(start),
+		trace.WithAttributes(attrs...))
+	return querySpan{span: span, binding: binding}
+}
+
+// end 結束 span，記錄筆數與錯誤
+func (q querySpan) end(rows int64, err error) {
+	if q.span == nil {
+		return
+	}
+	q.span.SetAttributes(semconv.DBResponseReturnedRows(int(rows)))
+	if err != nil && !errors.Is(err, context.Canceled) {
+		// 驅動程式的錯誤尚未轉換為領域錯誤，以錯誤型別區分
+		errorType := fmt.Sprintf("%T", err)
+		if errorType == "*errors.errorString" {
+			errorType = "_OTHER"
+		}
+		recordSpanError(q.span, err, errorType)
+	}
+	end := time.Now()
+	q.span.End(trace.WithTimestamp(end))
+	if q.binding != nil {
+		q.binding.finished(end)
+	}
+}
+
+// endregion
+
+// recordSpanError 將錯誤記錄到 span，訊息與前端相同（已遮罩密碼）；errorType 為空字串時以前端的錯誤代碼作為 error.type
+func recordSpanError(span trace.Span, err error, errorType string) {
+	payload, _ := formatBindingError(err).(ErrorPayload)
+	if errorType == "" {
+		errorType = payload.Code
+	}
+	span.SetAttributes(semconv.ErrorTypeKey.String(errorType))
+	span.SetStatus(codes.Error, payload.Message)
+}
+
+// goroutineID 由 runtime.Stack 的第一行（goroutine 18 [running]:）取得目前 goroutine 的編號
+func goroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = bytes.TrimPrefix(buf[:runtime.Stack(buf, false)], []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i >= 0 {
+		buf = buf[:i]
+	}
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+	return id
+}
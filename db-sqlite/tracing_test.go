@@ -0,0 +1,129 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+)
+
+// recordSpans 以記憶體中的 SpanRecorder 啟用追蹤，測試結束時關閉
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracingMu.Lock()
+	tracerProvider = provider
+	traceDBSystem = "sqlite"
+	tracingMu.Unlock()
+	otel.SetTracerProvider(provider)
+	tracingEnabled.Store(true)
+	t.Cleanup(ShutdownTracing)
+	return recorder
+}
+
+// spanAttr span 中某個屬性的值
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+// spansNamed 名稱為 name 的 span
+func spansNamed(spans []sdktrace.ReadOnlySpan, name string) []sdktrace.ReadOnlySpan {
+	var found []sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		if span.Name() == name {
+			found = append(found, span)
+		}
+	}
+	return found
+}
+
+func TestBindingSpans(t *testing.T) {
+	newTestDatabase(t)
+	recorder := recordSpans(t)
+	app := NewApp()
+
+	if _, err := app.CreateUser("Alice", "alice@example.com", 30); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	spans := recorder.Ended()
+
+	// App 方法 -> Database 方法 -> 每個 SQL 敘述
+	bindings := spansNamed(spans, "App.CreateUser")
+	if len(bindings) != 1 || bindings[0].Parent().IsValid() {
+		t.Fatalf("App.CreateUser spans = %d, want one root span", len(bindings))
+	}
+	binding := bindings[0]
+	operations := spansNamed(spans, "Database.InsertUser")
+	if len(operations) != 1 || operations[0].Parent().SpanID() != binding.SpanContext().SpanID() {
+		t.Fatalf("Database.InsertUser spans = %d, want one child of App.CreateUser", len(operations))
+	}
+	operation := operations[0]
+
+	inserts := spansNamed(spans, "insert")
+	if len(inserts) == 0 {
+		t.Fatal("no insert spans were recorded")
+	}
+	var usersInsert sdktrace.ReadOnlySpan
+	for _, span := range inserts {
+		if span.Parent().SpanID() != operation.SpanContext().SpanID() {
+			t.Errorf("insert span %q is not a child of Database.InsertUser", spanAttr(span, semconv.DBQueryTextKey))
+		}
+		if strings.Contains(spanAttr(span, semconv.DBQueryTextKey), "INSERT INTO users") {
+			usersInsert = span
+		}
+	}
+	if usersInsert == nil {
+		t.Fatal("no span for the users INSERT")
+	}
+	if got := spanAttr(usersInsert, semconv.DBSystemNameKey); got != "sqlite" {
+		t.Errorf("db.system.name = %q, want sqlite", got)
+	}
+	if got := spanAttr(usersInsert, semconv.DBOperationNameKey); got != "insert" {
+		t.Errorf("db.operation.name = %q, want insert", got)
+	}
+	if got := spanAttr(usersInsert, semconv.DBResponseReturnedRowsKey); got != "1" {
+		t.Errorf("db.response.returned_rows = %q, want 1", got)
+	}
+	if operation.StartTime().After(usersInsert.StartTime()) || operation.EndTime().Before(usersInsert.EndTime()) {
+		t.Error("Database.InsertUser span does not cover its statements")
+	}
+
+	// 失敗的呼叫：App span 以前端的錯誤代碼記錄，SQL span 以驅動程式的錯誤型別記錄
+	if _, err := app.CreateUser("Alice 2", "alice@example.com", 31); err == nil {
+		t.Fatal("CreateUser with a duplicate email succeeded")
+	}
+	failed := spansNamed(recorder.Ended(), "App.CreateUser")[1]
+	if failed.Status().Code != codes.Error || spanAttr(failed, semconv.ErrorTypeKey) != ErrCodeDuplicateEmail {
+		t.Errorf("failed App.CreateUser status = %+v, error.type %q", failed.Status(), spanAttr(failed, semconv.ErrorTypeKey))
+	}
+	var failedInsert sdktrace.ReadOnlySpan
+	for _, span := range spansNamed(recorder.Ended(), "insert") {
+		if span.Status().Code == codes.Error {
+			failedInsert = span
+		}
+	}
+	if failedInsert == nil || spanAttr(failedInsert, semconv.ErrorTypeKey) != "sqlite3.Error" {
+		t.Errorf("no failed insert span with error.type sqlite3.Error")
+	}
+
+	// 追蹤關閉後不再建立 span
+	ShutdownTracing()
+	before := len(recorder.Ended())
+	if _, err := app.GetAllUsers(); err != nil {
+		t.Fatalf("GetAllUsers: %v", err)
+	}
+	if got := len(recorder.Ended()); got != before {
+		t.Errorf("%d spans recorded with tracing disabled", got-before)
+	}
+}
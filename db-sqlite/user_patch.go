@@ -0,0 +1,35 @@
+package main
+
+import "context"
+
+// UserPatch 部分更新的欄位，未提供（nil）的欄位維持原值
+// Version 為呼叫端讀取資料時的版本號，與資料庫中的版本不符時更新會以 ErrConflict 失敗
+type UserPatch struct {
+	Name    *string `json:"name,omitempty"`
+	Email   *string `json:"email,omitempty"`
+	Age     *int    `json:"age,omitempty"`
+	Version int64   `json:"version"`
+}
+
+// PatchUser 以樂觀鎖部分更新用戶，成功時回傳更新後的資料（含新的版本號）
+func (d *Database) PatchUser(id int, patch UserPatch) (map[string]interface{}, error) {
+	return d.patchUser(withOperation(context.Background(), "PatchUser"), id, patch)
+}
+
+// patchUser PatchUser 與 UpdateUser 共用的實作
+func (d *Database) patchUser(ctx context.Context, id int, patch UserPatch) (map[string]interface{}, error) {
+	if err := validateUserPatch(patch); err != nil {
+		return nil, err
+	}
+
+	var after map[string]interface{}
+	err := d.WithTx(ctx, func(tx Repo) error {
+		var err error
+		after, err = tx.PatchUser(id, patch)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return after, nil
+}
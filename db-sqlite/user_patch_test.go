@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPatchUserUpdatesOnlySuppliedFields(t *testing.T) {
+	d := newTestDatabase(t)
+	id := insertTestUser(t, d, "Alice", "alice@example.com", 30)
+
+	age := 31
+	after, err := d.PatchUser(id, UserPatch{Age: &age, Version: 1})
+	if err != nil {
+		t.Fatalf("PatchUser: %v", err)
+	}
+	if after["name"] != "Alice" || after["email"] != "alice@example.com" {
+		t.Fatalf("PatchUser changed fields that were not supplied: %v", after)
+	}
+	if got, _ := toInt64(after["age"]); got != 31 {
+		t.Fatalf("age = %v, want 31", after["age"])
+	}
+	if got, _ := toInt64(after["version"]); got != 2 {
+		t.Fatalf("version = %v, want 2", after["version"])
+	}
+
+	// 回傳值與重新讀取的結果一致
+	stored, err := d.GetUserByID(id)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if stored["age"] != after["age"] || stored["version"] != after["version"] {
+		t.Fatalf("stored user %v does not match returned %v", stored, after)
+	}
+}
+
+func TestPatchUserStaleVersion(t *testing.T) {
+	d := newTestDatabase(t)
+	id := insertTestUser(t, d, "Alice", "alice@example.com", 30)
+
+	name := "Alice B"
+	if _, err := d.PatchUser(id, UserPatch{Name: &name, Version: 1}); err != nil {
+		t.Fatalf("PatchUser: %v", err)
+	}
+
+	stale := "Alice C"
+	_, err := d.PatchUser(id, UserPatch{Name: &stale, Version: 1})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("PatchUser with stale version: err = %v, want *ConflictError", err)
+	}
+	if conflict.Expected != 1 || conflict.Current != 2 {
+		t.Fatalf("conflict = %+v, want expected 1 and current 2", conflict)
+	}
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("errors.Is(err, ErrConflict) = false for %v", err)
+	}
+
+	stored, err := d.GetUserByID(id)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if stored["name"] != "Alice B" {
+		t.Fatalf("name = %v after a rejected patch, want Alice B", stored["name"])
+	}
+	if got, _ := toInt64(stored["version"]); got != 2 {
+		t.Fatalf("version = %v after a rejected patch, want 2", stored["version"])
+	}
+}
+
+func TestPatchUserValidation(t *testing.T) {
+	d := newTestDatabase(t)
+	id := insertTestUser(t, d, "Alice", "alice@example.com", 30)
+
+	email, invalid := "alice@example.org", "not-an-email"
+	tests := []struct {
+		name  string
+		patch UserPatch
+		field string
+	}{
+		{"no fields", UserPatch{Version: 1}, "patch"},
+		{"missing version", UserPatch{Email: &email}, "version"},
+		{"invalid email", UserPatch{Email: &invalid, Version: 1}, "email"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := d.PatchUser(id, tt.patch)
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("err = %v, want *ValidationError", err)
+			}
+			if len(verr.Fields) != 1 || verr.Fields[0].Field != tt.field {
+				t.Fatalf("fields = %+v, want a single error on %q", verr.Fields, tt.field)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidateUser(t *testing.T) {
+	tests := []struct {
+		name       string
+		user       [2]string
+		age        int
+		wantFields []string
+	}{
+		{"valid", [2]string{"Alice", "alice@example.com"}, 30, nil},
+		{"age bounds", [2]string{"Alice", "alice@example.com"}, 150, nil},
+		{"100 wide characters", [2]string{strings.Repeat("名", 100), "a@example.com"}, 0, nil},
+		{"blank name", [2]string{"   ", "alice@example.com"}, 30, []string{"name"}},
+		{"name too long", [2]string{strings.Repeat("名", 101), "alice@example.com"}, 30, []string{"name"}},
+		{"missing email", [2]string{"Alice", ""}, 30, []string{"email"}},
+		{"display name form", [2]string{"Alice", "Alice <alice@example.com>"}, 30, []string{"email"}},
+		{"domain without dot", [2]string{"Alice", "alice@localhost"}, 30, []string{"email"}},
+		{"domain ending in dot", [2]string{"Alice", "alice@example."}, 30, []string{"email"}},
+		{"email too long", [2]string{"Alice", strings.Repeat("a", 250) + "@example.com"}, 30, []string{"email"}},
+		{"negative age", [2]string{"Alice", "alice@example.com"}, -1, []string{"age"}},
+		{"age too high", [2]string{"Alice", "alice@example.com"}, 151, []string{"age"}},
+		{"every field", [2]string{"", "bad"}, 200, []string{"name", "email", "age"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateUser(tt.user[0], tt.user[1], tt.age)
+			if tt.wantFields == nil {
+				if err != nil {
+					t.Fatalf("validateUser: %v", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) || !errors.Is(err, ErrValidation) {
+				t.Fatalf("err = %v, want *ValidationError", err)
+			}
+			var fields []string
+			for _, f := range verr.Fields {
+				fields = append(fields, f.Field)
+			}
+			if fmt.Sprint(fields) != fmt.Sprint(tt.wantFields) {
+				t.Fatalf("fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestDomainErrors(t *testing.T) {
+	d := newTestDatabase(t)
+	app := NewApp()
+	insertTestUser(t, d, "Alice", "alice@example.com", 30)
+	bob := insertTestUser(t, d, "Bob", "bob@example.com", 40)
+
+	// 驗證失敗時不寫入資料
+	if err := d.InsertUser("", "carol@example.com", 20); !errors.Is(err, ErrValidation) {
+		t.Fatalf("InsertUser with a blank name: err = %v, want ErrValidation", err)
+	}
+	if _, err := d.GetUserByEmail("carol@example.com"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("invalid user was stored: err = %v", err)
+	}
+
+	// 綁定包裝過的錯誤仍對應到前端的錯誤代碼
+	tests := []struct {
+		name  string
+		call  func() error
+		code  string
+		field string
+	}{
+		{"missing user", func() error { _, err := app.GetUser(999); return err }, ErrCodeNotFound, ""},
+		{"duplicate on create", func() error { _, err := app.CreateUser("Alice 2", "alice@example.com", 31); return err }, ErrCodeDuplicateEmail, "email"},
+		{"duplicate on update", func() error {
+			_, err := app.UpdateUser(bob, "Bob", "alice@example.com", 40, 1)
+			return err
+		}, ErrCodeDuplicateEmail, "email"},
+		{"stale version", func() error { _, err := app.UpdateUser(bob, "Bob", "bob@example.com", 41, 9); return err }, ErrCodeConflict, ""},
+		{"invalid age", func() error { _, err := app.CreateUser("Dave", "dave@example.com", 999); return err }, ErrCodeValidation, "age"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if err == nil {
+				t.Fatal("call succeeded, want an error")
+			}
+			payload, ok := formatBindingError(err).(ErrorPayload)
+			if !ok || payload.Code != tt.code {
+				t.Fatalf("payload = %+v for %v, want code %q", payload, err, tt.code)
+			}
+			if tt.field != "" && (len(payload.Fields) != 1 || payload.Fields[0].Field != tt.field) {
+				t.Fatalf("fields = %+v, want one on %q", payload.Fields, tt.field)
+			}
+		})
+	}
+}
@@ -4,12 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"sync"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 // App struct
@@ -114,11 +114,20 @@ func (a *App) ensureAMQPState(role string) *amqpState {
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+
+	// 新日誌轉送給前端
+	SetLogListener(func(entry LogEntry) {
+		runtime.EventsEmit(a.ctx, LogEntryEvent, entry)
+	})
 }
 
 // Connect establishes connection to AMQP or MQTT broker using host role by default.
-func (a *App) Connect(config ConnectionConfig) error {
+func (a *App) Connect(config ConnectionConfig) (err error) {
 	config.Role = normalizeRole(config.Role)
+	defer func(start time.Time) {
+		logOperation("broker", "connect", start, err, "Connect to broker",
+			"protocol", config.Protocol, "role", config.Role, "host", config.Host, "port", config.Port)
+	}(time.Now())
 	switch config.Protocol {
 	case "amqp":
 		return a.connectAMQP(config)
@@ -156,7 +165,10 @@ func (a *App) DisconnectClient(protocol string) error {
 	return a.disconnect(protocol, roleClient)
 }
 
-func (a *App) disconnect(protocol, role string) error {
+func (a *App) disconnect(protocol, role string) (err error) {
+	defer func(start time.Time) {
+		logOperation("broker", "disconnect", start, err, "Disconnect from broker", "protocol", protocol, "role", role)
+	}(time.Now())
 	switch protocol {
 	case "amqp":
 		return a.disconnectAMQP(role)
@@ -168,7 +180,10 @@ func (a *App) disconnect(protocol, role string) error {
 }
 
 // Publish sends a message
-func (a *App) Publish(config PublishConfig) error {
+func (a *App) Publish(config PublishConfig) (err error) {
+	defer func(start time.Time) {
+		logOperation("broker", "publish", start, err, "Publish message", "protocol", config.Protocol, "topic", config.Topic)
+	}(time.Now())
 	switch config.Protocol {
 	case "amqp":
 		return a.publishAMQP(config)
@@ -180,7 +195,10 @@ func (a *App) Publish(config PublishConfig) error {
 }
 
 // Subscribe subscribes to a topic
-func (a *App) Subscribe(config SubscribeConfig) error {
+func (a *App) Subscribe(config SubscribeConfig) (err error) {
+	defer func(start time.Time) {
+		logOperation("broker", "subscribe", start, err, "Subscribe to topic", "protocol", config.Protocol, "topic", config.Topic)
+	}(time.Now())
 	switch config.Protocol {
 	case "amqp":
 		return a.subscribeAMQP(config)
@@ -204,6 +222,11 @@ func (a *App) Unsubscribe(protocol, topic string) error {
 	}
 }
 
+// GetRecentLogs 取得最近的應用程式日誌（由舊到新），level 為最低層級（debug、info、warn、error，空字串表示全部），limit <= 0 表示全部
+func (a *App) GetRecentLogs(limit int, level string) ([]LogEntry, error) {
+	return RecentLogs(limit, level)
+}
+
 // GetMessages retrieves and clears all messages from the queue
 func (a *App) GetMessages() []MessageItem {
 	a.messageQueueMux.Lock()
@@ -503,11 +526,11 @@ func (a *App) connectMQTT(config ConnectionConfig) error {
 	opts.SetKeepAlive(30 * time.Second)
 
 	opts.OnConnect = func(client mqtt.Client) {
-		log.Println("MQTT connected successfully")
+		logFor("mqtt").Info("MQTT connected successfully", "role", role)
 	}
 
 	opts.OnConnectionLost = func(client mqtt.Client, err error) {
-		log.Printf("MQTT connection lost: %v", err)
+		logFor("mqtt").Warn("MQTT connection lost", "role", role, "error", err)
 	}
 
 	client := mqtt.NewClient(opts)
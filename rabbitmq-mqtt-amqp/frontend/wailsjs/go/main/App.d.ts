@@ -16,6 +16,8 @@ export function DisconnectHost(arg1:string):Promise<void>;
 
 export function GetMessages():Promise<Array<main.MessageItem>>;
 
+export function GetRecentLogs(arg1:number,arg2:string):Promise<Array<main.LogEntry>>;
+
 export function Publish(arg1:main.PublishConfig):Promise<void>;
 
 export function Subscribe(arg1:main.SubscribeConfig):Promise<void>;
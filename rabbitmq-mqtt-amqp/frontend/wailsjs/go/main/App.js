@@ -30,6 +30,10 @@ export function GetMessages() {
   return window['go']['main']['App']['GetMessages']();
 }
 
+export function GetRecentLogs(arg1, arg2) {
+  return window['go']['main']['App']['GetRecentLogs'](arg1, arg2);
+}
+
 export function Publish(arg1) {
   return window['go']['main']['App']['Publish'](arg1);
 }
@@ -6,6 +6,7 @@ require (
 	github.com/eclipse/paho.mqtt.golang v1.4.3
 	github.com/rabbitmq/amqp091-go v1.10.0
 	github.com/wailsapp/wails/v2 v2.9.2
+	gopkg.in/natefinch/lumberjack.v2 v2.2.1
 )
 
 require (